@@ -0,0 +1,105 @@
+// bankfill downloads the bank history to the store before the incremental sync of the backend takes over
+//
+//	go run ./cmd/bankfill -from 2024-01-01
+//
+// The history continues back from the oldest synced day, or from today when the bank was never synced.
+// Fio provides only the last 90 days without an authorization, older history must be unlocked in the internet
+// banking first. Fio allows a single request per 30 seconds, so the backend should not refresh the bank meanwhile.
+// The store and the Fio token are read from the environment like the backend does. Only the Fio provider can be
+// backfilled - uploaded statements extend the synced period by themselves and the fake provider is for the development.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/kotrzina/keg-scale/pkg/clock"
+	"github.com/kotrzina/keg-scale/pkg/config"
+	"github.com/kotrzina/keg-scale/pkg/scale"
+	"github.com/kotrzina/keg-scale/pkg/store"
+	"github.com/kotrzina/keg-scale/pkg/utils"
+	"github.com/sirupsen/logrus"
+)
+
+func main() {
+	fromFlag := flag.String("from", "", "the first day of the history in YYYY-MM-DD format")
+	toFlag := flag.String("to", "", "the last day of the history in YYYY-MM-DD format, the day before the oldest synced day when empty")
+	flag.Parse()
+
+	if *fromFlag == "" {
+		_, _ = fmt.Fprintln(os.Stderr, "usage: bankfill -from YYYY-MM-DD [-to YYYY-MM-DD]")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+
+	from, err := time.ParseInLocation(time.DateOnly, *fromFlag, utils.GetTz())
+	if err != nil {
+		fatal(fmt.Errorf("invalid from: %w", err))
+	}
+
+	conf := config.NewConfig()
+	if conf.BankProvider != config.BankProviderFio {
+		fatal(fmt.Errorf("only the %s bank provider can be backfilled, %s is set", config.BankProviderFio, conf.BankProvider))
+	}
+	provider, err := scale.NewBankProvider(conf, clock.New())
+	if err != nil {
+		fatal(fmt.Errorf("could not create bank provider: %w", err))
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	storage, err := store.NewPostgresStore(ctx, conf.DBString)
+	if err != nil {
+		fatal(fmt.Errorf("could not connect to the store: %w", err))
+	}
+
+	to, err := lastDay(*toFlag, storage)
+	if err != nil {
+		fatal(err)
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(os.Stderr)
+
+	added, err := scale.BackfillBank(ctx, provider, storage, from, to, scale.BankRequestInterval, logger)
+	if err != nil {
+		fatal(err)
+	}
+
+	sync, err := storage.GetBankSync()
+	if err != nil {
+		fatal(err)
+	}
+	fmt.Printf("%d new transactions, the store covers %s - %s\n", added, sync.From.Format(time.DateOnly), sync.To.Format(time.DateOnly))
+}
+
+// lastDay returns the parsed day or the day before the oldest synced day
+func lastDay(value string, storage store.Storage) (time.Time, error) {
+	if value != "" {
+		to, err := time.ParseInLocation(time.DateOnly, value, utils.GetTz())
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid to: %w", err)
+		}
+		return to, nil
+	}
+
+	sync, err := storage.GetBankSync()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("could not get bank sync: %w", err)
+	}
+	if sync.From.IsZero() {
+		return time.Now(), nil
+	}
+
+	return sync.From.AddDate(0, 0, -1), nil
+}
+
+func fatal(err error) {
+	_, _ = fmt.Fprintf(os.Stderr, "bankfill: %v\n", err)
+	os.Exit(1)
+}
@@ -0,0 +1,159 @@
+// kegsim replays a recorded measurement log through the scale with a virtual clock
+//
+//	go run ./cmd/kegsim incident.csv
+//
+// CSV needs a header with at least the at and weight columns (tap, type, message_id and rssi are optional),
+// JSONL has one record per line. The scale configuration is read from the environment like the backend does.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kotrzina/keg-scale/pkg/config"
+	"github.com/kotrzina/keg-scale/pkg/scale"
+	"github.com/kotrzina/keg-scale/pkg/sim"
+	"github.com/sirupsen/logrus"
+)
+
+func main() {
+	format := flag.String("format", "", "input format csv or jsonl, detected from the extension when empty")
+	recheck := flag.Duration("recheck", 15*time.Second, "virtual time between periodic rechecks")
+	asJSON := flag.Bool("json", false, "print the whole result as JSON")
+	verbose := flag.Bool("v", false, "print scale logs to stderr")
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		_, _ = fmt.Fprintln(os.Stderr, "usage: kegsim [flags] <measurements.csv|measurements.jsonl>")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+
+	records, err := readRecords(flag.Arg(0), *format)
+	if err != nil {
+		fatal(err)
+	}
+
+	opts := sim.Options{
+		Config:          config.NewConfig(),
+		RecheckInterval: *recheck,
+	}
+	if *verbose {
+		opts.Logger = logrus.New()
+		opts.Logger.SetOutput(os.Stderr)
+		opts.Logger.SetLevel(logrus.DebugLevel)
+	}
+
+	result, err := sim.Replay(records, opts)
+	if err != nil {
+		fatal(err)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err = enc.Encode(result); err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	for _, line := range formatResult(result) {
+		fmt.Println(line)
+	}
+}
+
+func readRecords(path, format string) ([]sim.Record, error) {
+	if format == "" {
+		return sim.ReadFile(path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open %s: %w", path, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	return sim.ReadRecords(f, format)
+}
+
+// formatResult merges transitions and events into a timeline
+func formatResult(result sim.Result) []string {
+	type entry struct {
+		at   time.Time
+		line string
+	}
+
+	entries := make([]entry, 0, len(result.Transitions)+len(result.Events))
+	for _, t := range result.Transitions {
+		tap := t.Tap
+		if tap == "" {
+			tap = "pub"
+		}
+		entries = append(entries, entry{t.At, fmt.Sprintf("%-8s %-14s %s -> %s", tap, t.Field, t.From, t.To)})
+	}
+	for _, e := range result.Events {
+		entries = append(entries, entry{e.At, fmt.Sprintf("%-8s %-14s %s", eventTap(e), "event", formatEvent(e))})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].at.Before(entries[j].at)
+	})
+
+	lines := make([]string, 0, len(entries)+1)
+	for _, e := range entries {
+		lines = append(lines, e.at.Format("2006-01-02 15:04:05")+"  "+e.line)
+	}
+
+	beers := make([]string, 0, len(result.Final.Taps))
+	for _, t := range result.Final.Taps {
+		beers = append(beers, fmt.Sprintf("%s: %dl keg, %d beers left", t.ID, t.ActiveKeg, t.BeersLeft))
+	}
+	lines = append(lines, fmt.Sprintf("%d records replayed, final state - %s", result.Records, strings.Join(beers, ", ")))
+
+	return lines
+}
+
+func eventTap(e scale.EventPayload) string {
+	if e.Tap == "" {
+		return "pub"
+	}
+	return e.Tap
+}
+
+func formatEvent(e scale.EventPayload) string {
+	parts := []string{string(e.Type)}
+	if e.Keg > 0 {
+		parts = append(parts, fmt.Sprintf("keg=%d", e.Keg))
+	}
+	if e.Weight > 0 {
+		parts = append(parts, fmt.Sprintf("weight=%.0f", e.Weight))
+	}
+	if e.BeersLeft > 0 {
+		parts = append(parts, fmt.Sprintf("beers_left=%d", e.BeersLeft))
+	}
+	if e.Confidence > 0 {
+		parts = append(parts, fmt.Sprintf("confidence=%.2f", e.Confidence))
+	}
+	if e.Issue != "" {
+		parts = append(parts, "issue="+e.Issue)
+	}
+	if e.Loss != nil {
+		parts = append(parts, fmt.Sprintf("loss=%.0fg/%s", e.Loss.Grams, e.Loss.Kind))
+	}
+	if e.Reason != "" {
+		parts = append(parts, "reason="+e.Reason)
+	}
+
+	return strings.Join(parts, " ")
+}
+
+func fatal(err error) {
+	_, _ = fmt.Fprintf(os.Stderr, "kegsim: %v\n", err)
+	os.Exit(1)
+}
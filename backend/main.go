@@ -9,10 +9,12 @@ import (
 
 	"github.com/joho/godotenv"
 	"github.com/kotrzina/keg-scale/pkg/ai"
+	"github.com/kotrzina/keg-scale/pkg/clock"
 	"github.com/kotrzina/keg-scale/pkg/config"
 	"github.com/kotrzina/keg-scale/pkg/hook"
 	"github.com/kotrzina/keg-scale/pkg/promector"
 	"github.com/kotrzina/keg-scale/pkg/prometheus"
+	"github.com/kotrzina/keg-scale/pkg/reorder"
 	"github.com/kotrzina/keg-scale/pkg/scale"
 	"github.com/kotrzina/keg-scale/pkg/store"
 	"github.com/kotrzina/keg-scale/pkg/wa"
@@ -56,9 +58,11 @@ func main() {
 		logger.Fatalf("Failed to create PostgreSQL store: %v", err)
 	}
 
-	kegScale := scale.New(ctx, monitor, storage, conf, logger)
+	clk := clock.New()
+	kegScale := scale.New(ctx, monitor, storage, conf, clk, logger)
 	intelligence := ai.NewAi(ctx, conf, kegScale, monitor, storage, logger)
-	botka := hook.NewBotka(whatsapp, kegScale, intelligence, conf, storage, logger)
+	planner := reorder.NewPlanner(kegScale, reorder.DefaultSuppliers(clk), logger)
+	botka := hook.NewBotka(whatsapp, kegScale, intelligence, conf, storage, planner, clk, logger)
 
 	router := web.NewRouter(web.NewHandlerRepository(
 		kegScale,
@@ -69,6 +73,8 @@ func main() {
 		logger,
 		whatsapp,
 		botka,
+		planner,
+		clk,
 	))
 
 	srv := web.StartServer(router, 8080, logger)
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/kotrzina/keg-scale/pkg/config"
@@ -32,8 +33,10 @@ func (tf *ToolFactory) GetTools(model string) []Tool {
 		tf.currentKegTools(),
 		tf.beersLeftTool(),
 		tf.kegTappedAtTool(),
+		tf.kegEmptyEtaTool(),
 		tf.warehouseTotalTool(),
 		tf.warehouseKegTool(),
+		tf.warehouseBrandsTool(),
 		tf.scaleWifiStrengthTool(),
 		tf.suppliersTool(),
 		tf.localNewsTool(),
@@ -127,9 +130,21 @@ func (tf *ToolFactory) pubClosedAtTool() Tool {
 func (tf *ToolFactory) currentKegTools() Tool {
 	return Tool{
 		Name:        "current_keg",
-		Description: "If there is an active keg, it provides its size in liters",
+		Description: "If there is an active keg, it provides its size in liters. There may be more taps, each with its own keg.",
 		Fn: func(_ string) (string, error) {
 			data := tf.scale.GetScale()
+			if len(data.Taps) > 1 {
+				var sb strings.Builder
+				for _, tap := range data.Taps {
+					if tap.ActiveKeg == 0 {
+						sb.WriteString(fmt.Sprintf("<tap id=\"%s\">There is no active keg.</tap>\n", tap.ID))
+						continue
+					}
+					sb.WriteString(fmt.Sprintf("<tap id=\"%s\"><size>%d</size> liter keg is tapped.</tap>\n", tap.ID, tap.ActiveKeg))
+				}
+				return sb.String(), nil
+			}
+
 			if data.ActiveKeg == 0 {
 				return "There is no active keg.", nil
 			}
@@ -144,9 +159,21 @@ func (tf *ToolFactory) currentKegTools() Tool {
 func (tf *ToolFactory) beersLeftTool() Tool {
 	return Tool{
 		Name:        "beers_left",
-		Description: "Returns the number of beers left in the active keg.",
+		Description: "Returns the number of beers left in the active keg. There may be more taps, each with its own keg.",
 		Fn: func(_ string) (string, error) {
 			data := tf.scale.GetScale()
+			if len(data.Taps) > 1 {
+				var sb strings.Builder
+				for _, tap := range data.Taps {
+					if tap.ActiveKeg == 0 {
+						sb.WriteString(fmt.Sprintf("<tap id=\"%s\">There is no active keg.</tap>\n", tap.ID))
+						continue
+					}
+					sb.WriteString(fmt.Sprintf("<tap id=\"%s\">%d beers</tap>\n", tap.ID, tap.BeersLeft))
+				}
+				return sb.String(), nil
+			}
+
 			if data.ActiveKeg == 0 {
 				return "There is no active keg.", nil
 			}
@@ -171,6 +198,38 @@ func (tf *ToolFactory) kegTappedAtTool() Tool {
 	}
 }
 
+func (tf *ToolFactory) kegEmptyEtaTool() Tool {
+	return Tool{
+		Name:        "keg_empty_eta",
+		Description: "Estimates when the active keg is going to be empty (Europe/Prague timezone) and the current consumption rate in beers per hour. There may be more taps, each with its own keg.",
+		Fn: func(_ string) (string, error) {
+			data := tf.scale.GetScale()
+
+			var sb strings.Builder
+			for _, tap := range data.Taps {
+				sb.WriteString(fmt.Sprintf("<tap id=\"%s\">", tap.ID))
+				switch {
+				case tap.ActiveKeg == 0:
+					sb.WriteString("There is no active keg.")
+				case tap.Consumption.EmptyAt == nil:
+					sb.WriteString("Unknown, there is not enough data.")
+				default:
+					sb.WriteString(fmt.Sprintf(
+						"<empty_at>%s</empty_at><empty_in>%s</empty_in><session_rate>%.1f</session_rate><estimated_from>%s</estimated_from>",
+						utils.FormatDate(*tap.Consumption.EmptyAt),
+						tap.Consumption.EmptyIn,
+						tap.Consumption.SessionRate,
+						tap.Consumption.Source,
+					))
+				}
+				sb.WriteString("</tap>\n")
+			}
+
+			return sb.String(), nil
+		},
+	}
+}
+
 func (tf *ToolFactory) warehouseTotalTool() Tool {
 	return Tool{
 		Name:        "warehouse_total",
@@ -184,6 +243,12 @@ func (tf *ToolFactory) warehouseTotalTool() Tool {
 }
 
 func (tf *ToolFactory) warehouseKegTool() Tool {
+	kegTypes := tf.scale.GetKegTypes()
+	sizes := make([]interface{}, len(kegTypes))
+	for i, kt := range kegTypes {
+		sizes[i] = strconv.Itoa(kt.Size)
+	}
+
 	return Tool{
 		Name:        "warehouse_kegs",
 		Description: "Returns amount of kegs in the warehouse for a specific keg size",
@@ -193,7 +258,7 @@ func (tf *ToolFactory) warehouseKegTool() Tool {
 			Properties: map[string]Property{
 				"keg_size": {
 					Type:        SchemaTypeString,
-					Enum:        []interface{}{"10", "15", "20", "30", "50"},
+					Enum:        sizes,
 					Description: "The size of the keg in liters",
 				},
 			},
@@ -226,6 +291,34 @@ func (tf *ToolFactory) warehouseKegTool() Tool {
 	}
 }
 
+func (tf *ToolFactory) warehouseBrandsTool() Tool {
+	return Tool{
+		Name:        "warehouse_brands",
+		Description: "Returns kegs in the warehouse with their brand, style and best before date in the order they will be tapped",
+		Fn: func(_ string) (string, error) {
+			kegs := tf.scale.GetStockKegs()
+			if len(kegs) == 0 {
+				return "The warehouse is empty", nil
+			}
+
+			var output strings.Builder
+			for _, keg := range kegs {
+				brand := strings.TrimSpace(keg.Brand + " " + keg.Style)
+				if brand == "" {
+					brand = "unknown brand"
+				}
+				output.WriteString(fmt.Sprintf("%dl %s", keg.Size, brand))
+				if keg.BestBefore != nil {
+					output.WriteString(fmt.Sprintf(", best before %s", utils.FormatDate(*keg.BestBefore)))
+				}
+				output.WriteString("\n")
+			}
+
+			return output.String(), nil
+		},
+	}
+}
+
 func (tf *ToolFactory) scaleWifiStrengthTool() Tool {
 	return Tool{
 		Name:        "scale_wifi_strength",
@@ -571,15 +664,66 @@ func (tf *ToolFactory) pubCalendarTool() Tool {
 func (tf *ToolFactory) bankTransactionsTool() Tool {
 	return Tool{
 		Name:        "bank_transactions",
-		Description: "Provides bank transactions for the last 14 days. The result is a json document with transactions. The source is the Fio bank API.",
-		Fn: func(_ string) (string, error) {
-			s := tf.scale.GetScale()
-			output, err := json.Marshal(s.BankTransactions)
+		Description: "Provides bank transactions for the given period of days, the last 14 days when the period is not set. The result is a json document with transactions from the oldest. The source is the Fio bank API, transactions are stored since the first download.",
+		HasSchema:   true,
+		Schema: Property{
+			Type: SchemaTypeObject,
+			Properties: map[string]Property{
+				"date_from": {
+					Type:        SchemaTypeString,
+					Description: "The first day of the period in YYYY-MM-DD format",
+				},
+				"date_to": {
+					Type:        SchemaTypeString,
+					Description: "The last day of the period in YYYY-MM-DD format, the day is included",
+				},
+			},
+		},
+		Fn: func(input string) (string, error) {
+			var data struct {
+				DateFrom string `json:"date_from"`
+				DateTo   string `json:"date_to"`
+			}
+
+			if input != "" {
+				if err := json.Unmarshal([]byte(input), &data); err != nil {
+					return "", fmt.Errorf("error unmarshalling input: %w", err)
+				}
+			}
+
+			now := time.Now().In(utils.GetTz())
+			to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, utils.GetTz())
+			from := to.AddDate(0, 0, -13)
+			for _, date := range []struct {
+				value  string
+				target *time.Time
+			}{{data.DateFrom, &from}, {data.DateTo, &to}} {
+				if date.value == "" {
+					continue
+				}
+				d, err := time.ParseInLocation(time.DateOnly, date.value, utils.GetTz())
+				if err != nil {
+					return "Invalid date, use YYYY-MM-DD format", fmt.Errorf("invalid date %q: %w", date.value, err)
+				}
+				*date.target = d
+			}
+
+			transactions, err := tf.scale.GetBankTransactions(from, to.AddDate(0, 0, 1))
+			if err != nil {
+				return "Could not get transactions for the period", fmt.Errorf("could not get bank transactions: %w", err)
+			}
+
+			output, err := json.Marshal(transactions)
 			if err != nil {
 				return "", fmt.Errorf("could not marshal bank transactions: %w", err)
 			}
 
-			return fmt.Sprintf("Transactions in JSON format:\n\n```json\n%s\n```", string(output)), nil
+			return fmt.Sprintf(
+				"Transactions from %s to %s in JSON format:\n\n```json\n%s\n```",
+				from.Format(time.DateOnly),
+				to.Format(time.DateOnly),
+				string(output),
+			), nil
 		},
 	}
 }
@@ -21,6 +21,26 @@ type BotkaCommands struct {
 	Volleyball string
 	NoMessage  string
 	Shout      string
+	Warehouse  string // followed by +50 or -50 and an optional reason
+}
+
+const (
+	ChartSourceLocal      = "local"      // charts are served from measurements stored in the database
+	ChartSourcePrometheus = "prometheus" // charts are served from Prometheus, local measurements are the fallback
+)
+
+const (
+	BankProviderFio       = "fio"       // transactions are downloaded from the Fio API, disabled without the token
+	BankProviderStatement = "statement" // transactions are imported from uploaded CSV or GPC statements
+	BankProviderFake      = "fake"      // generated in-memory transactions for the development
+)
+
+// MeasurementFilter configures filtering of incoming weights before they change the scale state
+type MeasurementFilter struct {
+	Window          int     // median window size, 1 disables the median
+	MaxRate         float64 // max rate of change in grams per second, 0 disables the check
+	StableReadings  int     // readings needed to accept a jump over the max rate
+	StableTolerance float64 // grams - readings closer than this are considered the same
 }
 
 type Config struct {
@@ -39,16 +59,26 @@ type Config struct {
 	PrometheusPassword string
 	PrometheusOrg      string
 
+	ChartSource string
+
+	WarehouseLowBeers int // warehouse with this many beers or less is low
+
+	OpenPolicy string // JSON policy for the opening message, the default policy is used when empty
+
+	Filter MeasurementFilter
+
 	DBString string
 
 	WhatsAppOpenJid        string
 	WhatsAppRegularsJid    string
 	WhatsAppCustomMessages []CustomMessage
+	WhatsAppAdminJid       string // admin alerts are disabled when empty
 	AnthropicAPIKey        string
 	OpenAiAPIKey           string
 
-	FioToken string
-	FioIban  string
+	BankProvider string // where the bank transactions come from
+	FioToken     string
+	FioIban      string
 
 	Commands BotkaCommands
 
@@ -73,16 +103,31 @@ func NewConfig() *Config {
 		PrometheusPassword: getStringEnvDefault("PROMETHEUS_PASSWORD", "test"),
 		PrometheusOrg:      getStringEnvDefault("PROMETHEUS_ORG", "test"),
 
+		ChartSource: getStringEnvDefault("CHART_SOURCE", ChartSourceLocal),
+
+		WarehouseLowBeers: getIntEnvDefault("WAREHOUSE_LOW_BEERS", 60),
+
+		OpenPolicy: getStringEnvDefault("OPEN_POLICY", ""),
+
+		Filter: MeasurementFilter{
+			Window:          getIntEnvDefault("FILTER_WINDOW", 5),
+			MaxRate:         getFloatEnvDefault("FILTER_MAX_RATE", 400),
+			StableReadings:  getIntEnvDefault("FILTER_STABLE_READINGS", 3),
+			StableTolerance: getFloatEnvDefault("FILTER_STABLE_TOLERANCE", 200),
+		},
+
 		DBString: getStringEnvDefault("DB_STRING", "host=localhost port=5432 user=postgres password=admin dbname=pub sslmode=disable"),
 
 		WhatsAppOpenJid:        getStringEnvDefault("WHATSAPP_OPEN_JID", ""),
 		WhatsAppRegularsJid:    getStringEnvDefault("WHATSAPP_REGULARS_JID", ""),
 		WhatsAppCustomMessages: parseCustomMessages(getStringEnvDefault("WHATSAPP_CUSTOM_MESSAGES", "")),
+		WhatsAppAdminJid:       getStringEnvDefault("WHATSAPP_ADMIN_JID", ""),
 		AnthropicAPIKey:        getStringEnvDefault("ANTHROPIC_API_KEY", ""),
 		OpenAiAPIKey:           getStringEnvDefault("OPENAI_API_KEY", ""),
 
-		FioToken: getStringEnvDefault("FIO_TOKEN", ""),
-		FioIban:  getStringEnvDefault("FIO_IBAN", ""),
+		BankProvider: getStringEnvDefault("BANK_PROVIDER", BankProviderFio),
+		FioToken:     getStringEnvDefault("FIO_TOKEN", ""),
+		FioIban:      getStringEnvDefault("FIO_IBAN", ""),
 
 		Commands: parseBotkaCommands(os.Getenv("BOTKA_COMMANDS")),
 
@@ -122,6 +167,17 @@ func getIntEnvDefault(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getFloatEnvDefault(key string, defaultValue float64) float64 {
+	if value, ok := os.LookupEnv(key); ok {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+
+	fmt.Printf("Using default value for %s\n", key)
+	return defaultValue
+}
+
 func parseCustomMessages(envString string) []CustomMessage {
 	messages := strings.Split(envString, ",")
 
@@ -160,5 +216,6 @@ func parseBotkaCommands(input string) BotkaCommands {
 		Volleyball: commands["volleyball"],
 		NoMessage:  commands["no_message"],
 		Shout:      commands["shout"],
+		Warehouse:  commands["warehouse"],
 	}
 }
@@ -23,10 +23,11 @@ func TestParseCustomMessagesEmpty(t *testing.T) {
 }
 
 func TestParseCustomMessagesInvalid(t *testing.T) {
-	commands := parseBotkaCommands("help:sos,volleyball:vqq123,no_message:taj333,shout:vsichni")
+	commands := parseBotkaCommands("help:sos,volleyball:vqq123,no_message:taj333,shout:vsichni,warehouse:sklad77")
 
 	assert.Equal(t, "sos", commands.Help)
 	assert.Equal(t, "vqq123", commands.Volleyball)
 	assert.Equal(t, "taj333", commands.NoMessage)
 	assert.Equal(t, "vsichni", commands.Shout)
+	assert.Equal(t, "sklad77", commands.Warehouse)
 }
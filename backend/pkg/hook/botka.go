@@ -3,8 +3,8 @@ package hook
 import (
 	"context"
 	"fmt"
+	"math"
 	"regexp"
-	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -12,12 +12,15 @@ import (
 
 	"github.com/dundee/qrpay"
 	"github.com/kotrzina/keg-scale/pkg/ai"
+	"github.com/kotrzina/keg-scale/pkg/clock"
 	"github.com/kotrzina/keg-scale/pkg/config"
+	"github.com/kotrzina/keg-scale/pkg/reorder"
 	"github.com/kotrzina/keg-scale/pkg/scale"
 	"github.com/kotrzina/keg-scale/pkg/store"
 	"github.com/kotrzina/keg-scale/pkg/utils"
 	"github.com/kotrzina/keg-scale/pkg/wa"
 	"github.com/kozaktomas/diacritics"
+	"github.com/shopspring/decimal"
 	"github.com/sirupsen/logrus"
 )
 
@@ -30,6 +33,8 @@ type Botka struct {
 	ai       *ai.Ai
 	config   *config.Config
 	storage  store.Storage
+	planner  *reorder.Planner
+	clock    clock.Clock
 
 	mtx    sync.RWMutex
 	logger *logrus.Logger
@@ -41,6 +46,8 @@ func NewBotka(
 	intelligence *ai.Ai,
 	conf *config.Config,
 	storage store.Storage,
+	planner *reorder.Planner,
+	clk clock.Clock,
 	logger *logrus.Logger,
 ) *Botka {
 	w := &Botka{
@@ -49,6 +56,8 @@ func NewBotka(
 		ai:       intelligence,
 		config:   conf,
 		storage:  storage,
+		planner:  planner,
+		clock:    clk,
 
 		mtx:    sync.RWMutex{},
 		logger: logger,
@@ -66,11 +75,16 @@ func NewBotka(
 		client.RegisterEventHandler(w.qrPaymentHandler())
 		client.RegisterEventHandler(w.bankHandler())
 		client.RegisterEventHandler(w.warehouseHandler())
+		client.RegisterEventHandler(w.reorderHandler())
+		client.RegisterEventHandler(w.accountingHandler())
+		client.RegisterEventHandler(w.depositsHandler())
+		client.RegisterEventHandler(w.sessionsHandler())
 		client.RegisterEventHandler(w.resetHandler())
 
 		client.RegisterEventHandler(w.secretHelpHandler())
 		client.RegisterEventHandler(w.openHandler())
 		client.RegisterEventHandler(w.cepHandler())
+		client.RegisterEventHandler(w.warehouseChangeHandler())
 		client.RegisterEventHandler(w.volleyballHandler())
 		client.RegisterEventHandler(w.noMessageHandler())
 		client.RegisterEventHandler(w.shoutHandler())
@@ -84,6 +98,13 @@ func NewBotka(
 		kegScale.RegisterEvent(scale.EventOpen, w.messageOpenCustom)
 	}
 
+	// alert admins about kegs, scales and the warehouse
+	if conf.WhatsAppAdminJid != "" {
+		for _, event := range adminAlertEvents {
+			kegScale.RegisterEvent(event, w.messageAdminAlert)
+		}
+	}
+
 	return w
 }
 
@@ -103,10 +124,15 @@ func (b *Botka) ProvideWebHandlers() []wa.EventHandler {
 		// b.qrPaymentHandler(),
 		b.bankHandler(),
 		b.warehouseHandler(),
+		b.reorderHandler(),
+		b.accountingHandler(),
+		b.depositsHandler(),
+		b.sessionsHandler(),
 		// b.resetHandler(),
 		b.secretHelpHandler(),
 		b.openHandler(),
 		b.cepHandler(),
+		b.warehouseChangeHandler(),
 		b.volleyballHandler(),
 		b.noMessageHandler(),
 		b.shoutHandler(),
@@ -115,7 +141,7 @@ func (b *Botka) ProvideWebHandlers() []wa.EventHandler {
 }
 
 // nolint: govet // temporary
-func (b *Botka) messageOpen(_ scale.EventType) error {
+func (b *Botka) messageOpen(_ scale.EventPayload) error {
 	msg, err := b.ai.GenerateGeneralOpenMessage()
 	if err != nil {
 		b.logger.Errorf("could not generate general open message: %v", err)
@@ -123,13 +149,16 @@ func (b *Botka) messageOpen(_ scale.EventType) error {
 		// backup message
 		data := b.scale.GetScale()
 		msg = "Pivo! 🍺"
-		if data.ActiveKeg > 0 {
-			msg += fmt.Sprintf(
-				"\nMáme naraženou %dl bečku a zbývá v ní %d %s.",
-				data.ActiveKeg,
-				data.BeersLeft,
-				utils.FormatBeer(data.BeersLeft),
-			)
+		for _, tap := range data.Taps {
+			if tap.ActiveKeg > 0 {
+				msg += fmt.Sprintf(
+					"\n%s %dl bečku a zbývá v ní %d %s.",
+					tapPrefix(tap.ID, len(data.Taps)),
+					tap.ActiveKeg,
+					tap.BeersLeft,
+					utils.FormatBeer(tap.BeersLeft),
+				)
+			}
 		}
 		if data.WarehouseBeerLeft > 0 {
 			msg += fmt.Sprintf(
@@ -148,7 +177,7 @@ func (b *Botka) messageOpen(_ scale.EventType) error {
 	return nil
 }
 
-func (b *Botka) messageOpenCustom(_ scale.EventType) error {
+func (b *Botka) messageOpenCustom(_ scale.EventPayload) error {
 	for _, user := range b.config.WhatsAppCustomMessages {
 		msg, err := b.ai.GenerateCustomOpenMessage(user.Name)
 		if err != nil {
@@ -164,6 +193,113 @@ func (b *Botka) messageOpenCustom(_ scale.EventType) error {
 	return nil
 }
 
+// adminAlertEvents are sent to the admin WhatsApp
+var adminAlertEvents = []scale.EventType{
+	scale.EventKegLow,
+	scale.EventKegEmpty,
+	scale.EventScaleOffline,
+	scale.EventScaleOnline,
+	scale.EventWarehouseLow,
+	scale.EventScaleUnhealthy,
+	scale.EventKegLoss,
+}
+
+func (b *Botka) messageAdminAlert(payload scale.EventPayload) error {
+	msg := adminAlertMessage(payload)
+	if msg == "" {
+		return nil
+	}
+
+	if err := b.whatsapp.SendText(b.config.WhatsAppAdminJid, msg); err != nil {
+		return fmt.Errorf("could not send Botka admin alert: %w", err)
+	}
+
+	return nil
+}
+
+// adminAlertMessage describes the event for admins, empty for unknown events
+func adminAlertMessage(payload scale.EventPayload) string {
+	switch payload.Type {
+	case scale.EventKegLow:
+		return fmt.Sprintf(
+			"⚠️ Bečka %dl na pípě %s dochází, zbývá %d %s.",
+			payload.Keg,
+			payload.Tap,
+			payload.BeersLeft,
+			utils.FormatBeer(payload.BeersLeft),
+		)
+	case scale.EventKegEmpty:
+		return fmt.Sprintf("🪣 Bečka %dl na pípě %s je prázdná.", payload.Keg, payload.Tap)
+	case scale.EventScaleOffline:
+		return fmt.Sprintf("📴 Váha na pípě %s neposílá data.", payload.Tap)
+	case scale.EventScaleOnline:
+		return fmt.Sprintf("✅ Váha na pípě %s zase posílá data.", payload.Tap)
+	case scale.EventWarehouseLow:
+		return fmt.Sprintf(
+			"📦 Ve skladu zbývá jen %d %s, je čas objednat.",
+			payload.BeersLeft,
+			utils.FormatBeer(payload.BeersLeft),
+		)
+	case scale.EventScaleUnhealthy:
+		return scaleHealthMessage(payload)
+	case scale.EventKegLoss:
+		return kegLossMessage(payload)
+	default:
+		return ""
+	}
+}
+
+// kegLossMessage is a high-priority alert, somebody should check the pub
+func kegLossMessage(payload scale.EventPayload) string {
+	if payload.Loss == nil {
+		return ""
+	}
+
+	what := "Někdo asi točí pivo"
+	if payload.Loss.Kind == scale.KegLossLeak {
+		what = "Asi teče vedení"
+	}
+
+	return fmt.Sprintf(
+		"🚨🚨 POZOR! Z bečky na pípě %s zmizelo %.1f kg (cca %.0f %s), přestože je zavřeno. %s, zkontroluj hospodu! Naposledy v pořádku v %s.",
+		payload.Tap,
+		payload.Loss.Grams/1000,
+		payload.Loss.Beers,
+		utils.FormatBeer(int(payload.Loss.Beers+0.5)),
+		what,
+		utils.FormatTime(payload.Loss.Since),
+	)
+}
+
+func scaleHealthMessage(payload scale.EventPayload) string {
+	switch payload.Issue {
+	case scale.HealthIssueFrozen:
+		return fmt.Sprintf("🧊 Váha na pípě %s posílá pořád stejnou hodnotu, asi zamrzla.", payload.Tap)
+	case scale.HealthIssueDrift:
+		drift := 0.
+		if payload.Health != nil {
+			drift = payload.Health.Drift
+		}
+		return fmt.Sprintf("📐 Váha na pípě %s se přes zavřeno posunula o %.0f g, možná potřebuje kalibraci.", payload.Tap, drift)
+	case scale.HealthIssueReboot:
+		return fmt.Sprintf("🔄 Váha na pípě %s se restartovala.", payload.Tap)
+	case scale.HealthIssuePacketLoss:
+		loss := 0.
+		if payload.Health != nil {
+			loss = payload.Health.PacketLoss * 100
+		}
+		return fmt.Sprintf("📉 Váze na pípě %s se ztrácí %.0f %% zpráv.", payload.Tap, loss)
+	case scale.HealthIssueWeakSignal:
+		rssi := 0.
+		if payload.Health != nil {
+			rssi = payload.Health.Rssi
+		}
+		return fmt.Sprintf("📶 Váha na pípě %s má slabý WiFi signál (%.0f dBm).", payload.Tap, rssi)
+	default:
+		return fmt.Sprintf("⚠️ Váha na pípě %s má problém: %s.", payload.Tap, payload.Issue)
+	}
+}
+
 func (b *Botka) helpHandler() wa.EventHandler {
 	return wa.EventHandler{
 		MatchFunc: func(msg string) bool {
@@ -186,7 +322,12 @@ func (b *Botka) helpHandler() wa.EventHandler {
 				"/cenik - ceník \n" +
 				"/qr 275 - zaplať QR kódem \n" +
 				"/banka - stav bankovního účtu \n" +
+				"/banka 30 - transakce za posledních 30 dní, /banka 2025-03-01 2025-03-31 za období\n" +
 				"/sklad - stav skladu\n" +
+				"/objednavka 14 - návrh objednávky sudů na 14 dní\n" +
+				"/marze - náklady, příjmy a marže za bečky a měsíce\n" +
+				"/zalohy - prázdné sudy a zálohy k vrácení\n" +
+				"/vecer - dnešní večer a poslední otevírací časy\n" +
 				"/reset - Pan Botka zapomene všechno"
 
 			return reply, nil
@@ -319,18 +460,28 @@ func (b *Botka) kegHandler() wa.EventHandler {
 		},
 		HandleFunc: func(from, msg string) (string, error) {
 			s := b.scale.GetScale()
-			var reply string
-			if s.ActiveKeg == 0 {
-				reply = "Aktuálně nemáme naraženou žádnou bečku."
-			} else {
-				reply = fmt.Sprintf(
-					"Máme naraženou %dl bečku a zbývá v ní %d %s. Naražena byla %s v %s.",
-					s.ActiveKeg,
-					s.BeersLeft,
-					utils.FormatBeer(s.BeersLeft),
-					utils.FormatDateShort(s.ActiveKegAt),
-					utils.FormatTime(s.ActiveKegAt),
-				)
+			lines := []string{}
+			for _, tap := range s.Taps {
+				if tap.ActiveKeg == 0 {
+					continue
+				}
+				lines = append(lines, fmt.Sprintf(
+					"%s %dl bečku a zbývá v ní %d %s. Naražena byla %s v %s.",
+					tapPrefix(tap.ID, len(s.Taps)),
+					tap.ActiveKeg,
+					tap.BeersLeft,
+					utils.FormatBeer(tap.BeersLeft),
+					utils.FormatDateShort(tap.ActiveKegAt),
+					utils.FormatTime(tap.ActiveKegAt),
+				))
+				if eta := formatEmptyEta(tap.Consumption); eta != "" {
+					lines = append(lines, eta)
+				}
+			}
+
+			reply := "Aktuálně nemáme naraženou žádnou bečku."
+			if len(lines) > 0 {
+				reply = strings.Join(lines, "\n")
 			}
 
 			b.storeConversation(from, msg, reply)
@@ -397,7 +548,8 @@ func (b *Botka) qrPaymentHandler() wa.EventHandler {
 func (b *Botka) bankHandler() wa.EventHandler {
 	return wa.EventHandler{
 		MatchFunc: func(msg string) bool {
-			return len(msg) < 8 && strings.HasPrefix(b.sanitizeCommand(msg), "bank")
+			_, _, ok := parseBankCommand(b.sanitizeCommand(msg), b.clock.Now())
+			return ok
 		},
 		HandleFunc: func(from, msg string) (string, error) {
 			err := b.scale.BankRefresh(context.Background(), true)
@@ -407,23 +559,151 @@ func (b *Botka) bankHandler() wa.EventHandler {
 				return reply, nil
 			}
 
-			s := b.scale.GetScale()
+			start, end, _ := parseBankCommand(b.sanitizeCommand(msg), b.clock.Now())
+			transactions, err := b.scale.GetBankTransactions(start, end)
+			if err != nil {
+				b.logger.Errorf("could not get bank transactions: %v", err)
+				return "Něco se pokazilo při načítání dat z banky. Zkus to prosím znovu později.", nil
+			}
 
-			sb := strings.Builder{}
-			sb.WriteString(fmt.Sprintf("Stav účtu: %s Kč\n\n", s.BankBalance.Balance.String()))
-			sb.WriteString("Poslední transakce:\n")
-			slices.Reverse(s.BankTransactions)
-			for _, t := range s.BankTransactions {
-				sb.WriteString(fmt.Sprintf("- %s: %s Kč\n", t.AccountName, t.Amount.String()))
+			reply := formatBankTransactions(b.scale.GetScale().BankBalance, transactions, start, end)
+			b.storeConversation(from, msg, reply)
+			return reply, nil
+		},
+	}
+}
+
+const (
+	bankDefaultDays = 14
+	bankMaxLines    = 50 // WhatsApp message should stay readable
+)
+
+var reBankCommand = regexp.MustCompile(`^banka?(?:\s+([1-9][0-9]{0,2})|\s+(\d{4}-\d{2}-\d{2})\s+(\d{4}-\d{2}-\d{2}))?$`)
+
+// parseBankCommand parses sanitized "banka", "banka 30" for the last days and "banka 2025-03-01 2025-03-31"
+// it returns the period of the days from (inclusive) to (exclusive)
+func parseBankCommand(msg string, now time.Time) (from, to time.Time, ok bool) {
+	m := reBankCommand.FindStringSubmatch(strings.TrimSpace(msg))
+	if m == nil {
+		return time.Time{}, time.Time{}, false
+	}
+
+	if m[2] != "" {
+		start, err := time.ParseInLocation(time.DateOnly, m[2], utils.GetTz())
+		if err != nil {
+			return time.Time{}, time.Time{}, false
+		}
+		end, err := time.ParseInLocation(time.DateOnly, m[3], utils.GetTz())
+		if err != nil || end.Before(start) {
+			return time.Time{}, time.Time{}, false
+		}
+		return start, end.AddDate(0, 0, 1), true
+	}
+
+	days := bankDefaultDays
+	if m[1] != "" {
+		var err error
+		if days, err = strconv.Atoi(m[1]); err != nil {
+			return time.Time{}, time.Time{}, false
+		}
+	}
+
+	local := now.In(utils.GetTz())
+	to = time.Date(local.Year(), local.Month(), local.Day()+1, 0, 0, 0, 0, utils.GetTz())
+	return to.AddDate(0, 0, -days), to, true
+}
+
+// formatBankTransactions describes the balance and the transactions of the period from the newest
+func formatBankTransactions(balance scale.BalanceOutput, transactions []scale.TransactionOutput, from, to time.Time) string {
+	lines := []string{
+		fmt.Sprintf("Stav účtu: %s Kč", balance.Balance.String()),
+		"",
+		fmt.Sprintf("Transakce %s – %s:", from.Format("2. 1. 2006"), to.AddDate(0, 0, -1).Format("2. 1. 2006")),
+	}
+	if len(transactions) == 0 {
+		lines = append(lines, "žádné")
+		return strings.Join(lines, "\n")
+	}
+
+	income, expense := decimal.Zero, decimal.Zero
+	for i := len(transactions) - 1; i >= 0; i-- {
+		t := transactions[i]
+		if t.Amount.IsPositive() {
+			income = income.Add(t.Amount)
+		} else {
+			expense = expense.Add(t.Amount)
+		}
+
+		shown := len(transactions) - i
+		if shown <= bankMaxLines {
+			lines = append(lines, fmt.Sprintf("- %s: %s Kč", t.AccountName, t.Amount.String()))
+		}
+	}
+	if len(transactions) > bankMaxLines {
+		lines = append(lines, fmt.Sprintf("… a dalších %d", len(transactions)-bankMaxLines))
+	}
+	lines = append(lines, "", fmt.Sprintf("Příjmy %s Kč, výdaje %s Kč", income.String(), expense.Neg().String()))
+
+	return strings.Join(lines, "\n")
+}
+
+func (b *Botka) sessionsHandler() wa.EventHandler {
+	return wa.EventHandler{
+		MatchFunc: func(msg string) bool {
+			return b.sanitizeCommand(msg) == "vecer"
+		},
+		HandleFunc: func(from, msg string) (string, error) {
+			sessions, err := b.scale.GetPubSessions(5)
+			if err != nil {
+				b.logger.Errorf("could not get pub sessions: %v", err)
+				return "Něco se pokazilo při načítání historie. Zkus to prosím znovu později.", nil
 			}
 
-			reply := strings.TrimSuffix(sb.String(), "\n")
+			reply := formatPubSessions(sessions)
 			b.storeConversation(from, msg, reply)
 			return reply, nil
 		},
 	}
 }
 
+// formatPubSessions describes tonight so far and the last closed sessions
+func formatPubSessions(sessions scale.PubSessionsOutput) string {
+	lines := []string{}
+	if c := sessions.Current; c != nil {
+		lines = append(lines, fmt.Sprintf("🍺 Dnes je otevřeno od %s (%s).", utils.FormatTime(c.OpenedAt), c.Duration))
+		lines = append(lines, formatPubSessionStats(*c))
+	} else {
+		lines = append(lines, "😥 Dnes je zavřeno.")
+	}
+
+	if len(sessions.Sessions) > 0 {
+		lines = append(lines, "", "Poslední večery:")
+	}
+	for _, session := range sessions.Sessions {
+		lines = append(lines, fmt.Sprintf(
+			"- %s %s–%s (%s): %s",
+			utils.FormatDateShort(session.OpenedAt),
+			utils.FormatTime(session.OpenedAt),
+			utils.FormatTime(*session.ClosedAt),
+			session.Duration,
+			formatPubSessionStats(session),
+		))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func formatPubSessionStats(session scale.PubSessionOutput) string {
+	return fmt.Sprintf(
+		"%d %s, %d naražených beček, nejvíc %d lidí, příjem %s Kč",
+		session.BeersPoured,
+		utils.FormatBeer(session.BeersPoured),
+		session.KegsTapped,
+		session.PeakAttendance,
+		session.Income.StringFixed(0),
+	)
+}
+
 func (b *Botka) warehouseHandler() wa.EventHandler {
 	return wa.EventHandler{
 		MatchFunc: func(msg string) bool {
@@ -437,12 +717,202 @@ func (b *Botka) warehouseHandler() wa.EventHandler {
 					reply += fmt.Sprintf("\n%d × %dl", w.Amount, w.Keg)
 				}
 			}
+
+			// branded kegs in the order they will be tapped
+			listed := false
+			for _, keg := range b.scale.GetStockKegs() {
+				if keg.Brand == "" {
+					continue
+				}
+				if !listed {
+					reply += "\n\nNa řadě:"
+					listed = true
+				}
+				reply += fmt.Sprintf("\n%dl %s", keg.Size, strings.TrimSpace(keg.Brand+" "+keg.Style))
+				if keg.BestBefore != nil {
+					reply += fmt.Sprintf(" (do %s)", utils.FormatDateShort(*keg.BestBefore))
+				}
+			}
 			b.storeConversation(from, msg, reply)
 			return reply, nil
 		},
 	}
 }
 
+var reReorderDays = regexp.MustCompile(`^objednavka(?: ([1-9][0-9]*))?$`)
+
+func (b *Botka) reorderHandler() wa.EventHandler {
+	return wa.EventHandler{
+		MatchFunc: func(msg string) bool {
+			return reReorderDays.MatchString(b.sanitizeCommand(msg))
+		},
+		HandleFunc: func(from, msg string) (string, error) {
+			days := reorder.DefaultDays
+			if m := reReorderDays.FindStringSubmatch(b.sanitizeCommand(msg)); m[1] != "" {
+				days, _ = strconv.Atoi(m[1]) // the regex allows digits only
+			}
+
+			plan, err := b.planner.Plan(days)
+			if err != nil {
+				b.logger.Errorf("could not plan the order: %v", err)
+				return "Objednávku se nepodařilo spočítat. Zkus to prosím znovu později.", nil
+			}
+
+			reply := formatReorderPlan(plan)
+			b.storeConversation(from, msg, reply)
+			return reply, nil
+		},
+	}
+}
+
+// formatReorderPlan describes the proposed order of kegs
+func formatReorderPlan(plan reorder.Plan) string {
+	lines := []string{
+		fmt.Sprintf("🛒 Objednávka na %d dní", plan.Demand.Days),
+		fmt.Sprintf("Vypije se asi %.0f l, na čepu a ve skladu máme %.0f l.", plan.Demand.DemandLiters, plan.Demand.StockLiters),
+	}
+
+	if len(plan.Lines) == 0 {
+		lines = append(lines, "Piva máme dost, není potřeba nic objednávat. 👍")
+		return strings.Join(lines, "\n")
+	}
+
+	lines = append(lines, "")
+	for _, line := range plan.Lines {
+		item := fmt.Sprintf("- %d × %dl", line.Amount, line.Size)
+		if name := line.Name(); name != "" {
+			item += " " + name
+		}
+		if line.Priced {
+			item += fmt.Sprintf(" – %s (%s), %s Kč", line.Supplier, line.Title, line.Price.StringFixed(0))
+		} else {
+			item += " – cenu jsme nenašli"
+		}
+		lines = append(lines, item)
+	}
+	lines = append(lines, "", fmt.Sprintf("Celkem %.0f l za %s Kč", plan.Liters, plan.Total.StringFixed(0)))
+
+	return strings.Join(lines, "\n")
+}
+
+const (
+	accountingMonths = 3 // months in the accounting reply
+	accountingKegs   = 5 // kegs in the accounting reply
+)
+
+func (b *Botka) accountingHandler() wa.EventHandler {
+	return wa.EventHandler{
+		MatchFunc: func(msg string) bool {
+			return b.sanitizeCommand(msg) == "marze"
+		},
+		HandleFunc: func(from, msg string) (string, error) {
+			output, err := b.scale.GetAccounting(accountingMonths)
+			if err != nil {
+				b.logger.Errorf("could not get accounting: %v", err)
+				return "Účetnictví se nepodařilo spočítat. Zkus to prosím znovu později.", nil
+			}
+
+			reply := formatAccounting(output)
+			b.storeConversation(from, msg, reply)
+			return reply, nil
+		},
+	}
+}
+
+// formatAccounting describes cost, revenue and margin of the last months and kegs
+// revenue is marked with an asterisk when the bank data do not cover the whole period
+func formatAccounting(output scale.AccountingOutput) string {
+	incomplete := false
+	revenue := func(amount decimal.Decimal, known bool) string {
+		if known {
+			return amount.StringFixed(0) + " Kč"
+		}
+		incomplete = true
+		return amount.StringFixed(0) + " Kč*"
+	}
+
+	lines := []string{"💰 Měsíce:"}
+	for _, m := range output.Months {
+		beers := int(math.Round(m.Beers))
+		lines = append(lines, fmt.Sprintf(
+			"- %s: %d %s, náklady %s Kč (%s Kč/pivo), příjmy %s, marže %s Kč",
+			m.From.Format("01/2006"),
+			beers,
+			utils.FormatBeer(beers),
+			m.Cost.StringFixed(0),
+			m.CostPerBeer.StringFixed(2),
+			revenue(m.Revenue, m.RevenueKnown),
+			m.Margin.StringFixed(0),
+		))
+	}
+
+	if len(output.Kegs) > 0 {
+		lines = append(lines, "", "🍺 Poslední bečky:")
+	}
+	for i, keg := range output.Kegs {
+		if i == accountingKegs {
+			break
+		}
+
+		name := fmt.Sprintf("%dl", keg.Size)
+		if brand := strings.TrimSpace(keg.Brand + " " + keg.Style); brand != "" {
+			name += " " + brand
+		}
+		cost := "cena neznámá"
+		if keg.CostKnown {
+			cost = fmt.Sprintf("%s Kč/pivo", keg.CostPerBeer.StringFixed(2))
+		}
+		lines = append(lines, fmt.Sprintf(
+			"- %s (%s): %d %s, %s, příjmy %s, marže %s Kč",
+			name,
+			utils.FormatDateShort(keg.TappedAt),
+			keg.Beers,
+			utils.FormatBeer(keg.Beers),
+			cost,
+			revenue(keg.Revenue, keg.RevenueKnown),
+			keg.Margin.StringFixed(0),
+		))
+	}
+
+	if incomplete {
+		lines = append(lines, "", "* neúplná data z banky")
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func (b *Botka) depositsHandler() wa.EventHandler {
+	return wa.EventHandler{
+		MatchFunc: func(msg string) bool {
+			return b.sanitizeCommand(msg) == "zalohy"
+		},
+		HandleFunc: func(from, msg string) (string, error) {
+			reply := formatDeposits(b.scale.GetDeposits())
+			b.storeConversation(from, msg, reply)
+			return reply, nil
+		},
+	}
+}
+
+// formatDeposits describes empty kegs waiting for the return and their deposit per supplier
+func formatDeposits(deposits scale.DepositOutput) string {
+	if deposits.Kegs == 0 {
+		return "Žádné prázdné sudy nečekají na vrácení. 👍"
+	}
+
+	lines := []string{fmt.Sprintf("♻️ Prázdné sudy k vrácení: %d", deposits.Kegs)}
+	for _, supplier := range deposits.Suppliers {
+		name := supplier.Supplier
+		if name == "" {
+			name = "neznámý dodavatel"
+		}
+		lines = append(lines, fmt.Sprintf("- %s: %d×, záloha %s Kč", name, supplier.Kegs, supplier.Deposit.StringFixed(0)))
+	}
+	lines = append(lines, "", fmt.Sprintf("Celkem zálohy %s Kč", deposits.Total.StringFixed(0)))
+
+	return strings.Join(lines, "\n")
+}
+
 func (b *Botka) resetHandler() wa.EventHandler {
 	return wa.EventHandler{
 		MatchFunc: func(msg string) bool {
@@ -474,6 +944,7 @@ func (b *Botka) secretHelpHandler() wa.EventHandler {
 			sb.WriteString("*Příkazy:*\n")
 			sb.WriteString(fmt.Sprintf("*!%s* - otevři hospodu\n", b.config.Commands.Open))
 			sb.WriteString(fmt.Sprintf("*!%s* - dnes točíme tohle pivo\n", "cep")) // semi-secret command
+			sb.WriteString(fmt.Sprintf("*!%s +50 důvod* - přidej nebo odeber (-50) bečku ve skladu\n", b.config.Commands.Warehouse))
 			sb.WriteString(fmt.Sprintf("*!%s* - volejbal zpráva do skupiny hospoda\n", b.config.Commands.Volleyball))
 			sb.WriteString(fmt.Sprintf("*!%s* - neposílej dnes zprávu o otevření hospody\n", b.config.Commands.NoMessage))
 			sb.WriteString(fmt.Sprintf("*!%s ...* - zpráva do kanálu Hospoda\n", b.config.Commands.Shout))
@@ -520,6 +991,67 @@ func (b *Botka) cepHandler() wa.EventHandler {
 	}
 }
 
+func (b *Botka) warehouseChangeHandler() wa.EventHandler {
+	return wa.EventHandler{
+		MatchFunc: func(msg string) bool {
+			_, _, _, ok := parseWarehouseCommand(msg, b.config.Commands.Warehouse)
+			return ok
+		},
+		HandleFunc: func(from, msg string) (string, error) {
+			size, delta, reason, _ := parseWarehouseCommand(msg, b.config.Commands.Warehouse)
+			by := scale.WarehouseActor{Source: store.WarehouseSourceBotka, Actor: from, Reason: reason}
+
+			var err error
+			if delta > 0 {
+				_, err = b.scale.AddStockKeg(store.StockKeg{Size: size, Note: reason}, by)
+			} else {
+				_, err = b.scale.RemoveStockKeg(0, size, by)
+			}
+			if err != nil {
+				b.logger.Warnf("could not change warehouse: %v", err)
+				return fmt.Sprintf("Bečku %dl se nepodařilo změnit. Je ve skladu?", size), nil
+			}
+
+			s := b.scale.GetScale()
+			reply := fmt.Sprintf("Ok, sklad upraven (%+d × %dl). Ve skladu máme celkem %d piv.", delta, size, s.WarehouseBeerLeft)
+			return reply, nil
+		},
+	}
+}
+
+var reWarehouseCommand = regexp.MustCompile(`^([+-])([1-9][0-9]*)(?:\s+(.+))?$`)
+
+// parseWarehouseCommand parses "!command +50 reason" - the keg size, +1 or -1 and the optional reason
+// the command is secret, anybody knowing it can change the warehouse
+func parseWarehouseCommand(msg, command string) (size, delta int, reason string, ok bool) {
+	if command == "" {
+		return 0, 0, "", false // ignore if the command is not set
+	}
+
+	prefix := fmt.Sprintf("!%s ", command)
+	msg = strings.TrimSpace(msg)
+	if len(msg) <= len(prefix) || !strings.EqualFold(msg[:len(prefix)], prefix) {
+		return 0, 0, "", false
+	}
+
+	m := reWarehouseCommand.FindStringSubmatch(msg[len(prefix):])
+	if m == nil {
+		return 0, 0, "", false
+	}
+
+	size, err := strconv.Atoi(m[2])
+	if err != nil {
+		return 0, 0, "", false
+	}
+
+	delta = 1
+	if m[1] == "-" {
+		delta = -1
+	}
+
+	return size, delta, strings.TrimSpace(m[3]), true
+}
+
 func (b *Botka) volleyballHandler() wa.EventHandler {
 	return wa.EventHandler{
 		MatchFunc: func(msg string) bool {
@@ -548,9 +1080,11 @@ func (b *Botka) noMessageHandler() wa.EventHandler {
 			return checkSecretCommand(msg, b.config.Commands.NoMessage)
 		},
 		HandleFunc: func(from, _ string) (string, error) {
-			b.scale.ResetOpenAt()
-			b.logger.Infof("%s requested no message open", from)
 			reply := "Rozumím, dneska na tajňačku!! 🤫🤫"
+			if err := b.scale.SetOpenOverride(scale.OpenActionSkip, b.clock.Now().Add(12*time.Hour)); err != nil {
+				return "Něco se pokazilo, zkus to prosím znovu.", fmt.Errorf("could not skip open message: %w", err)
+			}
+			b.logger.Infof("%s requested no message open", from)
 			return reply, nil
 		},
 	}
@@ -604,7 +1138,7 @@ func (b *Botka) aiHandler() wa.EventHandler {
 			var messages []ai.ChatMessage
 			count := 0
 			for _, message := range conversation {
-				if time.Since(message.At) < 12*time.Hour { // ignore message sent more than 12 hours ago
+				if b.clock.Since(message.At) < 12*time.Hour { // ignore message sent more than 12 hours ago
 					// we need to make sure that first message will be from user
 					if count == 0 && message.Author == store.ConversationMessageAuthorBot {
 						continue
@@ -648,7 +1182,7 @@ func (b *Botka) storeConversation(id, question, answer string) {
 		return
 	}
 
-	now := time.Now()
+	now := b.clock.Now()
 	err := b.storage.AddConversationMessage(id, store.ConservationMessage{
 		ID:      id,
 		Message: question,
@@ -716,3 +1250,38 @@ func checkSecretCommand(msg, command string) bool {
 
 	return strings.EqualFold(msg, fmt.Sprintf("!%s", command))
 }
+
+// tapPrefix starts a sentence about the keg on the tap
+// the tap is mentioned only when there is more than one
+func tapPrefix(tapID string, taps int) string {
+	if taps > 1 {
+		return fmt.Sprintf("Na pípě %s máme naraženou", tapID)
+	}
+
+	return "Máme naraženou"
+}
+
+// formatEmptyEta describes when the keg is going to be empty
+func formatEmptyEta(c scale.ConsumptionOutput) string {
+	if c.EmptyAt == nil {
+		return ""
+	}
+
+	switch c.Source {
+	case scale.ConsumptionSourceSession:
+		return fmt.Sprintf(
+			"Při současném tempu %.1f piva za hodinu dojde za %s (kolem %s).",
+			c.SessionRate,
+			c.EmptyIn,
+			utils.FormatTime(*c.EmptyAt),
+		)
+	case scale.ConsumptionSourceHistory:
+		return fmt.Sprintf(
+			"Podle dřívějších týdnů dojde nejspíš %s kolem %s.",
+			utils.FormatDateShort(*c.EmptyAt),
+			utils.FormatTime(*c.EmptyAt),
+		)
+	}
+
+	return ""
+}
@@ -2,7 +2,13 @@ package hook
 
 import (
 	"testing"
+	"time"
 
+	"github.com/kotrzina/keg-scale/pkg/reorder"
+	"github.com/kotrzina/keg-scale/pkg/scale"
+	"github.com/kotrzina/keg-scale/pkg/store"
+	"github.com/kotrzina/keg-scale/pkg/utils"
+	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -112,3 +118,256 @@ func TestParseAmountFromQrPaymentCommand(t *testing.T) {
 		})
 	}
 }
+
+func TestAdminAlertMessage(t *testing.T) {
+	tests := []struct {
+		payload scale.EventPayload
+		want    string
+	}{
+		{
+			payload: scale.EventPayload{Type: scale.EventKegLow, Tap: "main", Keg: 50, BeersLeft: 4},
+			want:    "⚠️ Bečka 50l na pípě main dochází, zbývá 4 piva.",
+		},
+		{
+			payload: scale.EventPayload{Type: scale.EventKegEmpty, Tap: "left", Keg: 30},
+			want:    "🪣 Bečka 30l na pípě left je prázdná.",
+		},
+		{
+			payload: scale.EventPayload{Type: scale.EventScaleOffline, Tap: "main"},
+			want:    "📴 Váha na pípě main neposílá data.",
+		},
+		{
+			payload: scale.EventPayload{Type: scale.EventWarehouseLow, BeersLeft: 40},
+			want:    "📦 Ve skladu zbývá jen 40 piv, je čas objednat.",
+		},
+		{
+			payload: scale.EventPayload{
+				Type:   scale.EventScaleUnhealthy,
+				Tap:    "main",
+				Issue:  scale.HealthIssuePacketLoss,
+				Health: &scale.HealthOutput{PacketLoss: 0.35},
+			},
+			want: "📉 Váze na pípě main se ztrácí 35 % zpráv.",
+		},
+		{
+			payload: scale.EventPayload{
+				Type: scale.EventKegLoss,
+				Tap:  "main",
+				Loss: &scale.KegLoss{
+					Kind:  scale.KegLossLeak,
+					Grams: 2500,
+					Beers: 5,
+					Since: time.Date(2024, 11, 9, 2, 30, 0, 0, utils.GetTz()),
+				},
+			},
+			want: "🚨🚨 POZOR! Z bečky na pípě main zmizelo 2.5 kg (cca 5 piv), přestože je zavřeno. Asi teče vedení, zkontroluj hospodu! Naposledy v pořádku v 02:30.",
+		},
+		{
+			payload: scale.EventPayload{Type: scale.EventPour},
+			want:    "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.payload.Type), func(t *testing.T) {
+			assert.Equal(t, tt.want, adminAlertMessage(tt.payload))
+		})
+	}
+}
+
+func TestFormatPubSessions(t *testing.T) {
+	openedAt := time.Date(2024, 11, 8, 18, 0, 0, 0, utils.GetTz())
+	closedAt := time.Date(2024, 11, 8, 23, 30, 0, 0, utils.GetTz())
+
+	sessions := scale.PubSessionsOutput{
+		Sessions: []scale.PubSessionOutput{
+			{
+				PubSession: store.PubSession{
+					OpenedAt:       openedAt,
+					ClosedAt:       &closedAt,
+					BeersPoured:    42,
+					KegsTapped:     1,
+					PeakAttendance: 12,
+					Income:         decimal.NewFromInt(1500),
+				},
+				Duration: "5 hodin 30 minut",
+			},
+		},
+	}
+
+	want := "😥 Dnes je zavřeno.\n\nPoslední večery:\n" +
+		"- 08. 11. 18:00–23:30 (5 hodin 30 minut): 42 piv, 1 naražených beček, nejvíc 12 lidí, příjem 1500 Kč"
+	assert.Equal(t, want, formatPubSessions(sessions))
+}
+
+func TestFormatReorderPlan(t *testing.T) {
+	demand := scale.DemandOutput{Days: 14, DemandLiters: 130.4, StockLiters: 30}
+
+	plan := reorder.Plan{
+		Demand: demand,
+		Lines: []reorder.Line{
+			{Size: 50, Brand: "Policka", Style: "Hostinska", Amount: 2, Supplier: "baracek", Title: "Polička Hostinská 10° 50l", Price: decimal.NewFromInt(3980), Priced: true},
+			{Size: 30, Amount: 1},
+		},
+		Liters: 130,
+		Total:  decimal.NewFromInt(3980),
+	}
+	want := "🛒 Objednávka na 14 dní\n" +
+		"Vypije se asi 130 l, na čepu a ve skladu máme 30 l.\n\n" +
+		"- 2 × 50l Policka Hostinska – baracek (Polička Hostinská 10° 50l), 3980 Kč\n" +
+		"- 1 × 30l – cenu jsme nenašli\n\n" +
+		"Celkem 130 l za 3980 Kč"
+	assert.Equal(t, want, formatReorderPlan(plan))
+
+	want = "🛒 Objednávka na 14 dní\n" +
+		"Vypije se asi 130 l, na čepu a ve skladu máme 30 l.\n" +
+		"Piva máme dost, není potřeba nic objednávat. 👍"
+	assert.Equal(t, want, formatReorderPlan(reorder.Plan{Demand: demand}))
+}
+
+func TestReorderDaysCommand(t *testing.T) {
+	assert.True(t, reReorderDays.MatchString("objednavka"))
+	assert.Equal(t, "21", reReorderDays.FindStringSubmatch("objednavka 21")[1])
+	assert.False(t, reReorderDays.MatchString("objednavka 0"))
+	assert.False(t, reReorderDays.MatchString("objednavka piva"))
+}
+
+func TestFormatAccounting(t *testing.T) {
+	tappedAt := time.Date(2025, 3, 9, 18, 0, 0, 0, utils.GetTz())
+	output := scale.AccountingOutput{
+		Months: []scale.MonthAccounting{
+			{
+				From:         time.Date(2025, 3, 1, 0, 0, 0, 0, utils.GetTz()),
+				Beers:        164.7,
+				Cost:         decimal.NewFromInt(3500),
+				CostPerBeer:  decimal.RequireFromString("21.875"),
+				Revenue:      decimal.NewFromInt(3000),
+				RevenueKnown: false,
+				Margin:       decimal.NewFromInt(-500),
+			},
+		},
+		Kegs: []scale.KegAccounting{
+			{
+				Size:         30,
+				Brand:        "Bernard",
+				TappedAt:     tappedAt,
+				Beers:        60,
+				CostKnown:    true,
+				CostPerBeer:  decimal.NewFromInt(25),
+				Revenue:      decimal.NewFromInt(1800),
+				RevenueKnown: true,
+				Margin:       decimal.NewFromInt(300),
+			},
+			{
+				Size:         50,
+				TappedAt:     tappedAt.Add(-7 * 24 * time.Hour),
+				Beers:        1,
+				Revenue:      decimal.Zero,
+				RevenueKnown: true,
+				Margin:       decimal.Zero,
+			},
+		},
+	}
+
+	want := "💰 Měsíce:\n" +
+		"- 03/2025: 165 piv, náklady 3500 Kč (21.88 Kč/pivo), příjmy 3000 Kč*, marže -500 Kč\n\n" +
+		"🍺 Poslední bečky:\n" +
+		"- 30l Bernard (09. 03.): 60 piv, 25.00 Kč/pivo, příjmy 1800 Kč, marže 300 Kč\n" +
+		"- 50l (02. 03.): 1 pivo, cena neznámá, příjmy 0 Kč, marže 0 Kč\n\n" +
+		"* neúplná data z banky"
+	assert.Equal(t, want, formatAccounting(output))
+}
+
+func TestFormatDeposits(t *testing.T) {
+	assert.Equal(t, "Žádné prázdné sudy nečekají na vrácení. 👍", formatDeposits(scale.DepositOutput{}))
+
+	deposits := scale.DepositOutput{
+		Suppliers: []scale.SupplierDeposit{
+			{Supplier: "maneo", Kegs: 2, Deposit: decimal.NewFromInt(3000)},
+			{Kegs: 1, Deposit: decimal.Zero},
+		},
+		Kegs:  3,
+		Total: decimal.NewFromInt(3000),
+	}
+
+	want := "♻️ Prázdné sudy k vrácení: 3\n" +
+		"- maneo: 2×, záloha 3000 Kč\n" +
+		"- neznámý dodavatel: 1×, záloha 0 Kč\n\n" +
+		"Celkem zálohy 3000 Kč"
+	assert.Equal(t, want, formatDeposits(deposits))
+}
+
+func TestParseWarehouseCommand(t *testing.T) {
+	size, delta, reason, ok := parseWarehouseCommand("!sklad +50", "sklad")
+	assert.True(t, ok)
+	assert.Equal(t, 50, size)
+	assert.Equal(t, 1, delta)
+	assert.Empty(t, reason)
+
+	size, delta, reason, ok = parseWarehouseCommand("!sklad -30 prasklá bečka", "sklad")
+	assert.True(t, ok)
+	assert.Equal(t, 30, size)
+	assert.Equal(t, -1, delta)
+	assert.Equal(t, "prasklá bečka", reason)
+
+	for _, msg := range []string{"!sklad", "/sklad +50", "!sklad 50", "!sklad +0", "sklad -30", "!skladx +50"} {
+		_, _, _, ok = parseWarehouseCommand(msg, "sklad")
+		assert.False(t, ok, msg)
+	}
+
+	_, _, _, ok = parseWarehouseCommand("!sklad +50", "")
+	assert.False(t, ok, "the command is not set")
+}
+
+func TestParseBankCommand(t *testing.T) {
+	now := time.Date(2025, 3, 14, 20, 0, 0, 0, utils.GetTz())
+	d := func(month time.Month, day int) time.Time {
+		return time.Date(2025, month, day, 0, 0, 0, 0, utils.GetTz())
+	}
+
+	from, to, ok := parseBankCommand("banka", now)
+	assert.True(t, ok)
+	assert.True(t, d(3, 1).Equal(from), "the last 14 days")
+	assert.True(t, d(3, 15).Equal(to))
+
+	from, to, ok = parseBankCommand("bank 30", now)
+	assert.True(t, ok)
+	assert.True(t, d(2, 13).Equal(from))
+	assert.True(t, d(3, 15).Equal(to))
+
+	from, to, ok = parseBankCommand("banka 2025-02-01 2025-02-28", now)
+	assert.True(t, ok)
+	assert.True(t, d(2, 1).Equal(from))
+	assert.True(t, d(3, 1).Equal(to), "the last day is included")
+
+	for _, msg := range []string{"bankovni ucet", "banka 0", "banka 1000", "banka 2025-03-01", "banka 2025-03-31 2025-03-01", "banka 2025-02-30 2025-03-01"} {
+		_, _, ok = parseBankCommand(msg, now)
+		assert.False(t, ok, msg)
+	}
+}
+
+func TestFormatBankTransactions(t *testing.T) {
+	balance := scale.BalanceOutput{Balance: decimal.RequireFromString("4200.5")}
+	from := time.Date(2025, 3, 1, 0, 0, 0, 0, utils.GetTz())
+	to := time.Date(2025, 3, 15, 0, 0, 0, 0, utils.GetTz())
+
+	expected := "Stav účtu: 4200.5 Kč\n\n" +
+		"Transakce 1. 3. 2025 – 14. 3. 2025:\n" +
+		"- Franta: 300 Kč\n" +
+		"- Maneo: -5000 Kč\n" +
+		"- Pepa: 250 Kč\n\n" +
+		"Příjmy 550 Kč, výdaje 5000 Kč"
+	assert.Equal(t, expected, formatBankTransactions(balance, []scale.TransactionOutput{
+		{AccountName: "Pepa", Amount: decimal.NewFromInt(250)},
+		{AccountName: "Maneo", Amount: decimal.NewFromInt(-5000)},
+		{AccountName: "Franta", Amount: decimal.NewFromInt(300)},
+	}, from, to))
+
+	assert.Equal(t, "Stav účtu: 4200.5 Kč\n\nTransakce 1. 3. 2025 – 14. 3. 2025:\nžádné", formatBankTransactions(balance, nil, from, to))
+
+	many := make([]scale.TransactionOutput, bankMaxLines+5)
+	for i := range many {
+		many[i] = scale.TransactionOutput{AccountName: "Pepa", Amount: decimal.NewFromInt(10)}
+	}
+	assert.Contains(t, formatBankTransactions(balance, many, from, to), "… a dalších 5\n\nPříjmy 550 Kč, výdaje 0 Kč")
+}
@@ -127,17 +127,8 @@ func (p *Promector) GetRangeData(query string, start, end time.Time, step time.D
 			return nil, fmt.Errorf("could not convert value to int: %w", e)
 		}
 
-		type labelFormatter func(time.Time) string
-		var labelFunc labelFormatter
-		labelFunc = utils.FormatTime
-		if step >= 1*time.Hour {
-			labelFunc = func(t time.Time) string {
-				return t.In(utils.GetTz()).Format("2.1.")
-			}
-		}
-
 		records[i] = RangeRecord{
-			Label: labelFunc(t),
+			Label: FormatLabel(t, step),
 			Value: v,
 		}
 
@@ -148,6 +139,15 @@ func (p *Promector) GetRangeData(query string, start, end time.Time, step time.D
 	return records, nil
 }
 
+// FormatLabel formats the chart label - time for short steps, date for long ones
+func FormatLabel(t time.Time, step time.Duration) string {
+	if step >= 1*time.Hour {
+		return t.In(utils.GetTz()).Format("2.1.")
+	}
+
+	return utils.FormatTime(t)
+}
+
 func getBaseAuth(username, password string) string {
 	auth := username + ":" + password
 	return "Basic " + base64.StdEncoding.EncodeToString([]byte(auth))
@@ -15,6 +15,18 @@ type Monitor struct {
 	LastPing      *prometheus.GaugeVec
 	PubIsOpen     *prometheus.GaugeVec
 
+	ConsumptionRate *prometheus.GaugeVec
+	KegEmptyEta     *prometheus.GaugeVec
+	Pours           *prometheus.CounterVec
+
+	RejectedMeasurements *prometheus.CounterVec
+
+	ScaleHealthy    *prometheus.GaugeVec
+	ScalePacketLoss *prometheus.GaugeVec
+	ScaleResets     *prometheus.CounterVec
+	ScaleDrift      *prometheus.GaugeVec
+	KegLosses       *prometheus.CounterVec
+
 	AttendanceUptime        *prometheus.GaugeVec
 	AttendanceLastPing      *prometheus.GaugeVec
 	AttendanceScanCount     *prometheus.GaugeVec
@@ -42,17 +54,17 @@ func New() *Monitor {
 		Weight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
 			Name: "scale_weight",
 			Help: "Current weight of the keg in grams",
-		}, []string{}),
+		}, []string{"tap"}),
 
 		ActiveKeg: prometheus.NewGaugeVec(prometheus.GaugeOpts{
 			Name: "scale_active_keg",
 			Help: "Size of current keg in liters",
-		}, []string{}),
+		}, []string{"tap"}),
 
 		BeersLeft: prometheus.NewGaugeVec(prometheus.GaugeOpts{
 			Name: "scale_beers_left",
 			Help: "How to beers are left in the current keg",
-		}, []string{}),
+		}, []string{"tap"}),
 
 		BeersTotal: prometheus.NewGaugeVec(prometheus.GaugeOpts{
 			Name: "scale_beers_consumed",
@@ -62,18 +74,63 @@ func New() *Monitor {
 		ScaleWifiRssi: prometheus.NewGaugeVec(prometheus.GaugeOpts{
 			Name: "scale_wifi_rssi",
 			Help: "Current WiFi RSSI",
-		}, []string{}),
+		}, []string{"tap"}),
 
 		LastPing: prometheus.NewGaugeVec(prometheus.GaugeOpts{
 			Name: "scale_last_ping",
 			Help: "Last update time",
-		}, []string{}),
+		}, []string{"tap"}),
 
 		PubIsOpen: prometheus.NewGaugeVec(prometheus.GaugeOpts{
 			Name: "scale_pub_open",
 			Help: "Is the pub open/closed",
 		}, []string{}),
 
+		ConsumptionRate: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scale_consumption_rate",
+			Help: "Smoothed number of beers per hour in the current session",
+		}, []string{"tap"}),
+
+		KegEmptyEta: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scale_keg_empty_eta",
+			Help: "Estimated unix time when the current keg is going to be empty, 0 when unknown",
+		}, []string{"tap"}),
+
+		Pours: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "scale_pours_total",
+			Help: "Number of detected pours by serving size in liters",
+		}, []string{"tap", "serving"}),
+
+		RejectedMeasurements: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "scale_rejected_measurements_total",
+			Help: "Number of weights rejected by the filter by reason",
+		}, []string{"tap", "reason"}),
+
+		ScaleHealthy: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scale_healthy",
+			Help: "1 when the scale has no health issue",
+		}, []string{"tap"}),
+
+		ScalePacketLoss: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scale_packet_loss_ratio",
+			Help: "Ratio of messages missing in the scale message counter",
+		}, []string{"tap"}),
+
+		ScaleResets: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "scale_resets_total",
+			Help: "Number of scale reboots detected by the message counter",
+		}, []string{"tap"}),
+
+		ScaleDrift: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scale_drift_grams",
+			Help: "Weight change detected while the pub was closed",
+		}, []string{"tap"}),
+
+		KegLosses: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "scale_keg_losses_total",
+			Help: "Number of beer losses detected while the pub was closed by kind",
+		}, []string{"tap", "kind"}),
+
 		AttendanceUptime: prometheus.NewGaugeVec(prometheus.GaugeOpts{
 			Name: "attendance_uptime_seconds",
 			Help: "Uptime of the attendance device in seconds",
@@ -158,6 +215,15 @@ func New() *Monitor {
 		monitor.ScaleWifiRssi,
 		monitor.LastPing,
 		monitor.PubIsOpen,
+		monitor.ConsumptionRate,
+		monitor.KegEmptyEta,
+		monitor.Pours,
+		monitor.RejectedMeasurements,
+		monitor.ScaleHealthy,
+		monitor.ScalePacketLoss,
+		monitor.ScaleResets,
+		monitor.ScaleDrift,
+		monitor.KegLosses,
 		monitor.AnthropicInputTokens,
 		monitor.AnthropicOutputTokens,
 		monitor.OpenAiInputTokens,
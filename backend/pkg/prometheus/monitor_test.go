@@ -22,6 +22,15 @@ func TestNewMonitor(t *testing.T) {
 		{"ScaleWifiRssi", monitor.ScaleWifiRssi},
 		{"LastPing", monitor.LastPing},
 		{"PubIsOpen", monitor.PubIsOpen},
+		{"ConsumptionRate", monitor.ConsumptionRate},
+		{"KegEmptyEta", monitor.KegEmptyEta},
+		{"Pours", monitor.Pours},
+		{"RejectedMeasurements", monitor.RejectedMeasurements},
+		{"ScaleHealthy", monitor.ScaleHealthy},
+		{"ScalePacketLoss", monitor.ScalePacketLoss},
+		{"ScaleResets", monitor.ScaleResets},
+		{"ScaleDrift", monitor.ScaleDrift},
+		{"KegLosses", monitor.KegLosses},
 		{"AttendanceUptime", monitor.AttendanceUptime},
 		{"AttendanceLastPing", monitor.AttendanceLastPing},
 		{"AttendanceScanCount", monitor.AttendanceScanCount},
@@ -0,0 +1,291 @@
+package reorder
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kotrzina/keg-scale/pkg/ai"
+	"github.com/kotrzina/keg-scale/pkg/clock"
+	"github.com/kotrzina/keg-scale/pkg/scale"
+	"github.com/kozaktomas/diacritics"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultDays  = 14        // how many days the order should cover
+	priceListTTL = time.Hour // price lists are scraped from the suppliers' websites, they do not change often
+)
+
+// PriceList provides kegs offered by a supplier
+type PriceList interface {
+	GetItems() ([]ai.BeerItem, error)
+}
+
+// DefaultSuppliers returns cached price lists of the suppliers we buy from
+func DefaultSuppliers(clk clock.Clock) map[string]PriceList {
+	return map[string]PriceList{
+		"maneo":   NewCachedPriceList(&ai.ManeoProvider{}, clk),
+		"baracek": NewCachedPriceList(&ai.BaracekProvider{}, clk),
+	}
+}
+
+// CachedPriceList keeps the items of the price list for priceListTTL
+// the old items are used when the price list is not available
+type CachedPriceList struct {
+	list  PriceList
+	clock clock.Clock
+
+	mu        sync.Mutex
+	items     []ai.BeerItem
+	fetchedAt time.Time
+}
+
+func NewCachedPriceList(list PriceList, clk clock.Clock) *CachedPriceList {
+	return &CachedPriceList{
+		list:  list,
+		clock: clk,
+	}
+}
+
+func (c *CachedPriceList) GetItems() ([]ai.BeerItem, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.items != nil && c.clock.Since(c.fetchedAt) < priceListTTL {
+		return c.items, nil
+	}
+
+	items, err := c.list.GetItems()
+	if err != nil {
+		if c.items != nil {
+			return c.items, nil
+		}
+		return nil, err
+	}
+
+	c.items = items
+	c.fetchedAt = c.clock.Now()
+	return items, nil
+}
+
+// Planner proposes the next order of kegs
+// it forecasts the consumption, subtracts the stock and finds the cheapest supplier for each keg
+type Planner struct {
+	scale     *scale.Scale
+	suppliers map[string]PriceList
+	logger    *logrus.Logger
+}
+
+func NewPlanner(s *scale.Scale, suppliers map[string]PriceList, logger *logrus.Logger) *Planner {
+	return &Planner{
+		scale:     s,
+		suppliers: suppliers,
+		logger:    logger,
+	}
+}
+
+// Line is a single item of the order
+type Line struct {
+	Size      int             `json:"size"`
+	Brand     string          `json:"brand"`
+	Style     string          `json:"style"`
+	Amount    int             `json:"amount"`
+	Supplier  string          `json:"supplier"`   // the cheapest supplier, empty when there is no price
+	Title     string          `json:"title"`      // title in the price list
+	UnitPrice decimal.Decimal `json:"unit_price"` // price of a single keg in CZK
+	Price     decimal.Decimal `json:"price"`
+	Priced    bool            `json:"priced"`
+}
+
+type Plan struct {
+	Demand   scale.DemandOutput `json:"demand"`
+	Lines    []Line             `json:"lines"`
+	Liters   float64            `json:"liters"` // ordered volume
+	Total    decimal.Decimal    `json:"total"`  // price of the priced lines
+	Warnings []string           `json:"warnings"`
+}
+
+// Plan proposes the order covering the consumption for the next days
+func (p *Planner) Plan(days int) (Plan, error) {
+	demand, err := p.scale.GetDemand(days)
+	if err != nil {
+		return Plan{}, fmt.Errorf("could not forecast demand: %w", err)
+	}
+
+	plan := Plan{
+		Demand:   demand,
+		Lines:    allocate(demand.Items, demand.MissingLiters),
+		Total:    decimal.Zero,
+		Warnings: []string{},
+	}
+	if len(plan.Lines) == 0 {
+		return plan, nil
+	}
+
+	offers := map[string][]ai.BeerItem{}
+	for name, list := range p.suppliers {
+		items, err := list.GetItems()
+		if err != nil {
+			p.logger.Warnf("Could not get price list of %s: %v", name, err)
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("price list of %s is not available", name))
+			continue
+		}
+		offers[name] = items
+	}
+	slices.Sort(plan.Warnings)
+
+	for i := range plan.Lines {
+		line := &plan.Lines[i]
+		plan.Liters += float64(line.Size * line.Amount)
+		if !priceLine(line, offers) {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("no price for %dl keg %s", line.Size, line.Name()))
+			continue
+		}
+		plan.Total = plan.Total.Add(line.Price)
+	}
+
+	return plan, nil
+}
+
+// allocate splits the missing volume among the beers by their share in the history
+// the beer with the largest share gets kegs until the whole volume is covered
+func allocate(items []scale.DemandItem, missing float64) []Line {
+	if missing <= 0 || len(items) == 0 {
+		return []Line{}
+	}
+
+	lines := make([]Line, len(items))
+	ordered := 0.0
+	for i, item := range items {
+		lines[i] = Line{
+			Size:   item.Size,
+			Brand:  item.Brand,
+			Style:  item.Style,
+			Amount: int(math.Round(missing * item.Share / float64(item.Size))),
+		}
+		ordered += float64(lines[i].Size * lines[i].Amount)
+	}
+
+	for ordered < missing {
+		lines[0].Amount++
+		ordered += float64(lines[0].Size)
+	}
+
+	return slices.DeleteFunc(lines, func(l Line) bool {
+		return l.Amount == 0
+	})
+}
+
+// priceLine finds the cheapest offer of the keg size and brand
+// offers matching the style are preferred, the brand is ignored when unknown
+func priceLine(line *Line, offers map[string][]ai.BeerItem) bool {
+	suppliers := make([]string, 0, len(offers))
+	for name := range offers {
+		suppliers = append(suppliers, name)
+	}
+	slices.Sort(suppliers)
+
+	bestStyle := false
+	for _, supplier := range suppliers {
+		for _, item := range offers[supplier] {
+			if titleSize(item.Title) != line.Size || !matches(item.Title, line.Brand) {
+				continue
+			}
+
+			price, err := parsePrice(item.Price)
+			if err != nil {
+				continue
+			}
+
+			style := line.Style != "" && matches(item.Title, line.Style)
+			better := !line.Priced || style && !bestStyle || style == bestStyle && price.LessThan(line.UnitPrice)
+			if !better {
+				continue
+			}
+
+			line.Supplier = supplier
+			line.Title = item.Title
+			line.UnitPrice = price
+			line.Priced = true
+			bestStyle = style
+		}
+	}
+
+	if line.Priced {
+		line.Price = line.UnitPrice.Mul(decimal.NewFromInt(int64(line.Amount)))
+	}
+
+	return line.Priced
+}
+
+// Name returns the brand and the style of the beer
+func (line Line) Name() string {
+	return strings.TrimSpace(line.Brand + " " + line.Style)
+}
+
+var reTitleSize = regexp.MustCompile(`(?i)(\d+)\s*l\b`)
+
+// titleSize returns the keg size in liters from the price list title, zero when there is none
+func titleSize(title string) int {
+	m := reTitleSize.FindStringSubmatch(title)
+	if m == nil {
+		return 0
+	}
+
+	size, err := strconv.Atoi(m[1])
+	if err != nil {
+		return 0
+	}
+
+	return size
+}
+
+// matches returns true if the title contains the name - case and diacritics insensitive
+func matches(title, name string) bool {
+	if name == "" {
+		return true
+	}
+
+	return strings.Contains(fold(title), fold(name))
+}
+
+func fold(s string) string {
+	folded, err := diacritics.Remove(strings.ToLower(s))
+	if err != nil {
+		return strings.ToLower(s)
+	}
+
+	return folded
+}
+
+// parsePrice parses the price from the price list - "1 890 Kč", "1.234,50 Kč" or "1890.00"
+func parsePrice(s string) (decimal.Decimal, error) {
+	var b strings.Builder
+	for _, r := range s {
+		if r >= '0' && r <= '9' || r == ',' || r == '.' {
+			b.WriteRune(r)
+		}
+	}
+
+	price := b.String()
+	if strings.Contains(price, ",") {
+		// czech format - comma is the decimal separator, dots separate thousands
+		price = strings.ReplaceAll(price, ".", "")
+		price = strings.ReplaceAll(price, ",", ".")
+	}
+	price = strings.TrimSuffix(price, ".")
+
+	d, err := decimal.NewFromString(price)
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("invalid price %q: %w", s, err)
+	}
+
+	return d, nil
+}
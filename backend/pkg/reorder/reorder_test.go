@@ -0,0 +1,221 @@
+package reorder
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kotrzina/keg-scale/pkg/ai"
+	"github.com/kotrzina/keg-scale/pkg/clock"
+	"github.com/kotrzina/keg-scale/pkg/config"
+	"github.com/kotrzina/keg-scale/pkg/prometheus"
+	"github.com/kotrzina/keg-scale/pkg/scale"
+	"github.com/kotrzina/keg-scale/pkg/store"
+	"github.com/kotrzina/keg-scale/pkg/utils"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakePriceList struct {
+	items []ai.BeerItem
+	err   error
+	calls int
+}
+
+func (f *fakePriceList) GetItems() ([]ai.BeerItem, error) {
+	f.calls++
+	return f.items, f.err
+}
+
+// createScale creates a scale with the keg history - 200 l of Policka in 50l kegs and 60 l of Bernard in 30l kegs
+// in the last 8 weeks and a single 30l keg in the warehouse
+func createScale(t *testing.T) *scale.Scale {
+	t.Helper()
+	logger := logrus.New()
+	logger.SetOutput(&bytes.Buffer{})
+
+	clk := clock.NewFake(time.Date(2025, 3, 14, 20, 0, 0, 0, utils.GetTz()))
+	storage := &store.FakeStore{Clock: clk}
+	now := clk.Now()
+
+	history := []struct {
+		size         int
+		brand, style string
+	}{
+		{50, "Policka", "Hostinska"},
+		{50, "Policka", "Hostinska"},
+		{30, "Bernard", ""},
+		{50, "Policka", "Hostinska"},
+		{30, "Bernard", ""},
+		{50, "Policka", "Hostinska"},
+	}
+	for i, h := range history {
+		tappedAt := now.Add(-time.Duration(56-i*8) * 24 * time.Hour)
+		emptiedAt := tappedAt.Add(5 * 24 * time.Hour)
+		id, err := storage.AddStockKeg(store.StockKeg{
+			Size:        h.size,
+			Brand:       h.brand,
+			Style:       h.style,
+			PurchasedAt: tappedAt.Add(-24 * time.Hour),
+			OutAt:       &tappedAt,
+			OutReason:   store.StockOutReasonTapped,
+		})
+		require.NoError(t, err)
+		_, err = storage.AddKeg(store.KegRecord{
+			Tap:          store.DefaultTap,
+			Size:         h.size,
+			TappedAt:     tappedAt,
+			EmptiedAt:    &emptiedAt,
+			LitersPoured: float64(h.size),
+			StockID:      id,
+		})
+		require.NoError(t, err)
+	}
+	_, err := storage.AddStockKeg(store.StockKeg{Size: 30, PurchasedAt: now})
+	require.NoError(t, err)
+
+	conf := config.NewConfig()
+	conf.FioToken = ""
+
+	return scale.New(context.Background(), prometheus.New(), storage, conf, clk, logger)
+}
+
+func TestPlanner_Plan(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(&bytes.Buffer{})
+
+	planner := NewPlanner(createScale(t), map[string]PriceList{
+		"maneo": &fakePriceList{items: []ai.BeerItem{
+			{Title: "Polička Hostinská 10° 50l", Price: "2 100 Kč"},
+			{Title: "Bernard 11° 30 l", Price: "1 450,00 Kč"},
+		}},
+		"baracek": &fakePriceList{items: []ai.BeerItem{
+			{Title: "Polička Otakar 11° 50l", Price: "1 800 Kč"},
+			{Title: "Polička Hostinská 10° 50l", Price: "1 990 Kč"},
+			{Title: "Bernard 11° 50l", Price: "2 200 Kč"},
+		}},
+		"broken": &fakePriceList{err: errors.New("timeout")},
+	}, logger)
+
+	plan, err := planner.Plan(28)
+	require.NoError(t, err)
+	assert.InEpsilon(t, 130.0, plan.Demand.DemandLiters, 0.000001)
+	assert.InEpsilon(t, 100.0, plan.Demand.MissingLiters, 0.000001)
+
+	require.Len(t, plan.Lines, 2)
+	assert.Equal(t, 50, plan.Lines[0].Size)
+	assert.Equal(t, 2, plan.Lines[0].Amount)
+	assert.Equal(t, "baracek", plan.Lines[0].Supplier, "the cheapest offer of the same style")
+	assert.True(t, decimal.NewFromInt(3980).Equal(plan.Lines[0].Price))
+
+	assert.Equal(t, 30, plan.Lines[1].Size)
+	assert.Equal(t, 1, plan.Lines[1].Amount)
+	assert.Equal(t, "maneo", plan.Lines[1].Supplier)
+	assert.True(t, decimal.NewFromInt(1450).Equal(plan.Lines[1].UnitPrice))
+
+	assert.InEpsilon(t, 130.0, plan.Liters, 0.000001)
+	assert.True(t, decimal.NewFromInt(5430).Equal(plan.Total))
+	assert.Equal(t, []string{"price list of broken is not available"}, plan.Warnings)
+
+	// enough beer in the warehouse
+	plan, err = planner.Plan(1)
+	require.NoError(t, err)
+	assert.Empty(t, plan.Lines)
+	assert.True(t, plan.Total.IsZero())
+}
+
+func TestPlanner_PlanWithoutPrice(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(&bytes.Buffer{})
+
+	planner := NewPlanner(createScale(t), map[string]PriceList{
+		"maneo": &fakePriceList{items: []ai.BeerItem{
+			{Title: "Polička Hostinská 10° 50l", Price: "2 100 Kč"},
+		}},
+	}, logger)
+
+	plan, err := planner.Plan(28)
+	require.NoError(t, err)
+	require.Len(t, plan.Lines, 2)
+	assert.True(t, plan.Lines[0].Priced)
+	assert.False(t, plan.Lines[1].Priced)
+	assert.True(t, decimal.NewFromInt(4200).Equal(plan.Total), "only priced lines are counted")
+	assert.Equal(t, []string{"no price for 30l keg Bernard"}, plan.Warnings)
+}
+
+func TestCachedPriceList(t *testing.T) {
+	clk := clock.NewFake(time.Date(2025, 3, 14, 12, 0, 0, 0, utils.GetTz()))
+	list := &fakePriceList{items: []ai.BeerItem{{Title: "Polička Hostinská 10° 50l", Price: "2 100 Kč"}}}
+	cached := NewCachedPriceList(list, clk)
+
+	for range 3 {
+		items, err := cached.GetItems()
+		require.NoError(t, err)
+		assert.Len(t, items, 1)
+	}
+	assert.Equal(t, 1, list.calls, "the price list is scraped once")
+
+	// the supplier is down, the old items are used
+	clk.Advance(priceListTTL + time.Minute)
+	list.err = errors.New("timeout")
+	items, err := cached.GetItems()
+	require.NoError(t, err)
+	assert.Len(t, items, 1)
+	assert.Equal(t, 2, list.calls)
+
+	// no items yet
+	_, err = NewCachedPriceList(list, clk).GetItems()
+	require.Error(t, err)
+}
+
+func TestAllocate(t *testing.T) {
+	items := []scale.DemandItem{
+		{Size: 50, Brand: "Policka", Share: 0.6},
+		{Size: 30, Brand: "Bernard", Share: 0.3},
+		{Size: 10, Brand: "Kofola", Share: 0.1},
+	}
+
+	assert.Empty(t, allocate(items, 0))
+	assert.Empty(t, allocate(nil, 100))
+
+	lines := allocate(items, 20)
+	require.Len(t, lines, 1, "small amounts go to the most popular beer")
+	assert.Equal(t, 50, lines[0].Size)
+	assert.Equal(t, 1, lines[0].Amount)
+
+	lines = allocate(items, 200)
+	require.Len(t, lines, 3)
+	assert.Equal(t, 3, lines[0].Amount) // 120 l
+	assert.Equal(t, 2, lines[1].Amount) // 60 l
+	assert.Equal(t, 2, lines[2].Amount) // 20 l
+}
+
+func TestTitleSize(t *testing.T) {
+	assert.Equal(t, 50, titleSize("Polička Hostinská 10° 50l"))
+	assert.Equal(t, 30, titleSize("Bernard 11° 30 L"))
+	assert.Equal(t, 15, titleSize("Kozel lager 15l KEG"))
+	assert.Equal(t, 0, titleSize("Polička Hostinská 10°"))
+}
+
+func TestParsePrice(t *testing.T) {
+	cases := map[string]string{
+		"1 890 Kč":       "1890",
+		"1\u00a0890 Kč":  "1890",
+		"1.234,50 Kč":    "1234.5",
+		"1 450,- Kč":     "1450",
+		"1890.00":        "1890",
+		"Cena: 990,00 K": "990",
+	}
+	for input, expected := range cases {
+		price, err := parsePrice(input)
+		require.NoError(t, err, input)
+		assert.True(t, decimal.RequireFromString(expected).Equal(price), input)
+	}
+
+	_, err := parsePrice("na dotaz")
+	require.Error(t, err)
+}
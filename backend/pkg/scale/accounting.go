@@ -0,0 +1,264 @@
+package scale
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/kotrzina/keg-scale/pkg/store"
+	"github.com/kotrzina/keg-scale/pkg/utils"
+	"github.com/shopspring/decimal"
+)
+
+const accountingMaxMonths = 24
+
+// KegAccounting is the cost and the revenue of a single keg from the ledger
+// the revenue is the income of the keg days split among the kegs by the volume poured
+type KegAccounting struct {
+	ID           int64           `json:"id"`
+	Tap          string          `json:"tap"`
+	Size         int             `json:"size"`
+	Brand        string          `json:"brand"`
+	Style        string          `json:"style"`
+	TappedAt     time.Time       `json:"tapped_at"`
+	EmptiedAt    *time.Time      `json:"emptied_at"`
+	Beers        int             `json:"beers"`
+	Liters       float64         `json:"liters"`
+	Cost         decimal.Decimal `json:"cost"`
+	CostKnown    bool            `json:"cost_known"` // keg price is known from the warehouse inventory
+	CostPerBeer  decimal.Decimal `json:"cost_per_beer"`
+	Revenue      decimal.Decimal `json:"revenue"`
+	RevenueKnown bool            `json:"revenue_known"` // bank data covers the keg days
+	Margin       decimal.Decimal `json:"margin"`
+}
+
+// MonthAccounting sums kegs poured in the month, the kegs spanning more months are split by time
+type MonthAccounting struct {
+	Month             string          `json:"month"` // 2025-03
+	From              time.Time       `json:"from"`
+	Beers             float64         `json:"beers"`
+	Liters            float64         `json:"liters"`
+	Cost              decimal.Decimal `json:"cost"`                // cost of kegs with the known price
+	UnknownCostLiters float64         `json:"unknown_cost_liters"` // poured from kegs without the price
+	CostPerBeer       decimal.Decimal `json:"cost_per_beer"`
+	Revenue           decimal.Decimal `json:"revenue"`
+	RevenueKnown      bool            `json:"revenue_known"` // bank data covers the whole month
+	Margin            decimal.Decimal `json:"margin"`
+}
+
+type AccountingOutput struct {
+	Kegs       []KegAccounting   `json:"kegs"`        // newest first
+	Months     []MonthAccounting `json:"months"`      // newest first
+	IncomeFrom *time.Time        `json:"income_from"` // the oldest day covered by the bank data, nil without bank
+}
+
+// accountingKeg is a keg from the ledger with its period and the volume poured
+type accountingKeg struct {
+	record     store.KegRecord
+	start, end time.Time
+	beers      int
+	liters     float64
+	cost       decimal.Decimal
+	costKnown  bool
+}
+
+// GetAccounting attributes keg prices to the beers poured and compares them with the bank income
+// kegs and months of the last months are returned, the current month included
+func (s *Scale) GetAccounting(months int) (AccountingOutput, error) {
+	if months < 1 || months > accountingMaxMonths {
+		return AccountingOutput{}, fmt.Errorf("months must be between 1 and %d", accountingMaxMonths)
+	}
+
+	records, err := s.store.GetKegs("", demandKegsLimit)
+	if err != nil {
+		return AccountingOutput{}, fmt.Errorf("could not get keg history: %w", err)
+	}
+
+	stockKegs, err := s.store.GetStockKegs(false)
+	if err != nil {
+		return AccountingOutput{}, fmt.Errorf("could not get warehouse inventory: %w", err)
+	}
+	stock := make(map[int64]store.StockKeg, len(stockKegs))
+	for _, keg := range stockKegs {
+		stock[keg.ID] = keg
+	}
+
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	now := s.clock.Now()
+	current := day(now)
+	from := time.Date(current.Year(), current.Month()-time.Month(months-1), 1, 0, 0, 0, 0, utils.GetTz())
+
+	kegs := make([]accountingKeg, 0, len(records))
+	for _, record := range records {
+		keg := accountingKeg{start: record.TappedAt, end: now}
+		keg.beers, keg.liters, keg.record = s.kegRecordLiters(record)
+		if record.EmptiedAt != nil {
+			keg.end = *record.EmptiedAt
+		}
+
+		if !keg.end.After(from) {
+			continue
+		}
+
+		if purchase, found := stock[record.StockID]; found && purchase.Price.IsPositive() {
+			keg.cost = purchase.Price
+			keg.costKnown = true
+		}
+		kegs = append(kegs, keg)
+	}
+
+	// the income is needed from the oldest keg tapped before the first month
+	incomeStart := from
+	for _, keg := range kegs {
+		if keg.start.Before(incomeStart) {
+			incomeStart = day(keg.start)
+		}
+	}
+	transactions, err := s.store.GetBankTransactions(incomeStart, current.AddDate(0, 0, 1))
+	if err != nil {
+		return AccountingOutput{}, fmt.Errorf("could not get bank transactions: %w", err)
+	}
+
+	output := AccountingOutput{
+		Kegs:   make([]KegAccounting, 0, len(kegs)),
+		Months: make([]MonthAccounting, 0, months),
+	}
+	if !s.bank.from.IsZero() {
+		incomeFrom := day(s.bank.from)
+		output.IncomeFrom = &incomeFrom
+	}
+
+	for _, keg := range kegs {
+		output.Kegs = append(output.Kegs, s.kegAccounting(keg, kegs, stock, transactions))
+	}
+
+	for m := range months {
+		start := time.Date(current.Year(), current.Month()-time.Month(m), 1, 0, 0, 0, 0, utils.GetTz())
+		end := start.AddDate(0, 1, 0)
+		output.Months = append(output.Months, s.monthAccounting(start, end, kegs, transactions))
+	}
+
+	return output, nil
+}
+
+// kegAccounting calculates the cost and the revenue of the keg
+func (s *Scale) kegAccounting(keg accountingKeg, kegs []accountingKeg, stock map[int64]store.StockKeg, transactions []store.BankTransaction) KegAccounting {
+	purchase := stock[keg.record.StockID]
+	output := KegAccounting{
+		ID:          keg.record.ID,
+		Tap:         keg.record.Tap,
+		Size:        keg.record.Size,
+		Brand:       purchase.Brand,
+		Style:       purchase.Style,
+		TappedAt:    keg.record.TappedAt,
+		EmptiedAt:   keg.record.EmptiedAt,
+		Beers:       keg.beers,
+		Liters:      keg.liters,
+		Cost:        keg.cost,
+		CostKnown:   keg.costKnown,
+		CostPerBeer: decimal.Zero,
+		Revenue:     decimal.Zero,
+	}
+	if keg.beers > 0 {
+		output.CostPerBeer = keg.cost.Div(decimal.NewFromInt(int64(keg.beers))).Round(2)
+	}
+
+	// income of the keg days is split among all kegs poured on those days
+	start := day(keg.start)
+	end := day(keg.end).AddDate(0, 0, 1)
+	income, known := s.bankIncome(transactions, start, end)
+	poured := pouredBetween(kegs, start, end)
+	output.RevenueKnown = known
+	if poured > 0 {
+		output.Revenue = income.Mul(decimal.NewFromFloat(keg.liters / poured)).Round(0)
+	}
+	output.Margin = output.Revenue.Sub(output.Cost)
+
+	return output
+}
+
+// monthAccounting sums the kegs poured between start and end
+func (s *Scale) monthAccounting(start, end time.Time, kegs []accountingKeg, transactions []store.BankTransaction) MonthAccounting {
+	output := MonthAccounting{
+		Month:       start.Format("2006-01"),
+		From:        start,
+		Cost:        decimal.Zero,
+		CostPerBeer: decimal.Zero,
+	}
+
+	costBeers := 0.0 // beers from kegs with the known price
+	for _, keg := range kegs {
+		fraction := overlap(keg.start, keg.end, start, end)
+		if fraction == 0 {
+			continue
+		}
+
+		output.Beers += float64(keg.beers) * fraction
+		output.Liters += keg.liters * fraction
+		if keg.costKnown {
+			output.Cost = output.Cost.Add(keg.cost.Mul(decimal.NewFromFloat(fraction)))
+			costBeers += float64(keg.beers) * fraction
+		} else {
+			output.UnknownCostLiters += keg.liters * fraction
+		}
+	}
+
+	output.Cost = output.Cost.Round(0)
+	if costBeers > 0 {
+		output.CostPerBeer = output.Cost.Div(decimal.NewFromFloat(costBeers)).Round(2)
+	}
+	output.Revenue, output.RevenueKnown = s.bankIncome(transactions, start, end)
+	output.Margin = output.Revenue.Sub(output.Cost)
+
+	return output
+}
+
+// bankIncome sums incoming payments from the transactions dated from start to end (exclusive)
+// known is false when the bank data does not cover the whole period
+func (s *Scale) bankIncome(transactions []store.BankTransaction, start, end time.Time) (income decimal.Decimal, known bool) {
+	income = decimal.Zero
+	for _, t := range transactions {
+		d := day(t.Date)
+		if t.Amount.IsPositive() && !d.Before(start) && d.Before(end) {
+			income = income.Add(t.Amount)
+		}
+	}
+
+	known = !s.bank.from.IsZero() && !start.Before(day(s.bank.from))
+	return income, known
+}
+
+// pouredBetween returns liters poured from all kegs between start and end, the kegs are split by time
+func pouredBetween(kegs []accountingKeg, start, end time.Time) float64 {
+	liters := 0.0
+	for _, keg := range kegs {
+		liters += keg.liters * overlap(keg.start, keg.end, start, end)
+	}
+
+	return liters
+}
+
+// overlap returns the fraction of the keg period [kegStart, kegEnd] within [start, end)
+func overlap(kegStart, kegEnd, start, end time.Time) float64 {
+	if !kegEnd.After(kegStart) {
+		if !kegStart.Before(start) && kegStart.Before(end) {
+			return 1
+		}
+		return 0
+	}
+
+	from := kegStart
+	if start.After(from) {
+		from = start
+	}
+	to := kegEnd
+	if end.Before(to) {
+		to = end
+	}
+	if !to.After(from) {
+		return 0
+	}
+
+	return to.Sub(from).Seconds() / kegEnd.Sub(kegStart).Seconds()
+}
@@ -0,0 +1,117 @@
+package scale
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kotrzina/keg-scale/pkg/clock"
+	"github.com/kotrzina/keg-scale/pkg/store"
+	"github.com/kotrzina/keg-scale/pkg/utils"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScale_GetAccounting(t *testing.T) {
+	clk := clock.NewFake(time.Date(2025, 3, 14, 20, 0, 0, 0, utils.GetTz()))
+	s := createScaleWithClock(t, clk)
+
+	at := func(month time.Month, d, hour int) time.Time {
+		return time.Date(2025, month, d, hour, 0, 0, 0, utils.GetTz())
+	}
+	addKeg := func(size int, stockID int64, tappedAt, emptiedAt time.Time, beers int) {
+		t.Helper()
+		_, err := s.store.AddKeg(store.KegRecord{
+			Tap:          store.DefaultTap,
+			Size:         size,
+			TappedAt:     tappedAt,
+			EmptiedAt:    &emptiedAt,
+			BeersPoured:  beers,
+			LitersPoured: float64(size),
+			StockID:      stockID,
+		})
+		require.NoError(t, err)
+	}
+	addStock := func(size int, brand string, price int64) int64 {
+		t.Helper()
+		id, err := s.store.AddStockKeg(store.StockKeg{Size: size, Brand: brand, Price: decimal.NewFromInt(price), PurchasedAt: at(2, 1, 10)})
+		require.NoError(t, err)
+		return id
+	}
+
+	policka := addStock(50, "Policka", 2000)
+	bernard := addStock(30, "Bernard", 1500)
+	addKeg(30, 0, at(2, 20, 18), at(3, 1, 17), 60) // no price, spans two months
+	addKeg(50, policka, at(3, 3, 18), at(3, 7, 22), 100)
+	addKeg(30, bernard, at(3, 9, 18), at(3, 12, 22), 60)
+
+	s.bank.from = at(3, 3, 10)
+	_, err := s.store.AddBankTransactions([]store.BankTransaction{
+		{ID: 1, Date: at(3, 4, 0), Amount: decimal.NewFromInt(1000)},
+		{ID: 2, Date: at(3, 7, 0), Amount: decimal.NewFromInt(600)},
+		{ID: 3, Date: at(3, 7, 0), Amount: decimal.NewFromInt(-5000)}, // outgoing payment
+		{ID: 4, Date: at(3, 10, 0), Amount: decimal.NewFromInt(900)},
+		{ID: 5, Date: at(3, 12, 0), Amount: decimal.NewFromInt(300)},
+		{ID: 6, Date: at(3, 14, 0), Amount: decimal.NewFromInt(200)},
+	})
+	require.NoError(t, err)
+
+	output, err := s.GetAccounting(2)
+	require.NoError(t, err)
+	require.NotNil(t, output.IncomeFrom)
+	assert.True(t, at(3, 3, 0).Equal(*output.IncomeFrom))
+
+	require.Len(t, output.Kegs, 3)
+	bernardKeg := output.Kegs[0]
+	assert.Equal(t, "Bernard", bernardKeg.Brand)
+	assert.True(t, bernardKeg.CostKnown)
+	assert.True(t, decimal.NewFromInt(25).Equal(bernardKeg.CostPerBeer))
+	assert.True(t, bernardKeg.RevenueKnown)
+	assert.True(t, decimal.NewFromInt(1200).Equal(bernardKeg.Revenue), bernardKeg.Revenue.String())
+	assert.True(t, decimal.NewFromInt(-300).Equal(bernardKeg.Margin))
+
+	polickaKeg := output.Kegs[1]
+	assert.True(t, decimal.NewFromInt(20).Equal(polickaKeg.CostPerBeer))
+	assert.True(t, decimal.NewFromInt(1600).Equal(polickaKeg.Revenue), polickaKeg.Revenue.String())
+	assert.True(t, decimal.NewFromInt(-400).Equal(polickaKeg.Margin))
+
+	unknown := output.Kegs[2]
+	assert.False(t, unknown.CostKnown)
+	assert.False(t, unknown.RevenueKnown, "bank data do not cover february")
+	assert.True(t, unknown.Revenue.IsZero())
+
+	require.Len(t, output.Months, 2)
+	march := output.Months[0]
+	assert.Equal(t, "2025-03", march.Month)
+	fraction := 17.0 / 215 // 17 of 215 hours of the keg without price are in march
+	assert.InEpsilon(t, 160+60*fraction, march.Beers, 0.000001)
+	assert.InEpsilon(t, 80+30*fraction, march.Liters, 0.000001)
+	assert.InEpsilon(t, 30*fraction, march.UnknownCostLiters, 0.000001)
+	assert.True(t, decimal.NewFromInt(3500).Equal(march.Cost))
+	assert.True(t, decimal.RequireFromString("21.88").Equal(march.CostPerBeer), "only beers with the known price")
+	assert.True(t, decimal.NewFromInt(3000).Equal(march.Revenue))
+	assert.False(t, march.RevenueKnown, "bank data start on the 3rd")
+	assert.True(t, decimal.NewFromInt(-500).Equal(march.Margin))
+
+	february := output.Months[1]
+	assert.Equal(t, "2025-02", february.Month)
+	assert.InEpsilon(t, 60*(1-fraction), february.Beers, 0.000001)
+	assert.True(t, february.Cost.IsZero())
+	assert.True(t, february.CostPerBeer.IsZero())
+
+	_, err = s.GetAccounting(0)
+	require.Error(t, err)
+}
+
+func TestOverlap(t *testing.T) {
+	base := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	h := func(hours int) time.Time {
+		return base.Add(time.Duration(hours) * time.Hour)
+	}
+
+	assert.InEpsilon(t, 1.0, overlap(h(2), h(4), h(0), h(10)), 0.000001)
+	assert.InEpsilon(t, 0.5, overlap(h(2), h(6), h(4), h(10)), 0.000001)
+	assert.InEpsilon(t, 0.25, overlap(h(0), h(8), h(2), h(4)), 0.000001)
+	assert.Zero(t, overlap(h(0), h(2), h(2), h(4)))
+	assert.InEpsilon(t, 1.0, overlap(h(3), h(3), h(2), h(4)), 0.000001, "keg without duration")
+}
@@ -83,12 +83,13 @@ func (s *Scale) SetDevices(devices map[string]Device) {
 	}
 
 	s.deleteInactiveBtDevices()
-	s.attendance.lastOk = time.Now()
+	s.attendance.lastOk = s.clock.Now()
+	s.trackSessionAttendance()
 }
 
 func (s *Scale) deleteInactiveBtDevices() {
 	for address, device := range s.attendance.active {
-		if device.LastSeen.Before(time.Now().Add(-btDeviceTimeout)) {
+		if device.LastSeen.Before(s.clock.Now().Add(-btDeviceTimeout)) {
 			delete(s.attendance.active, address)
 		}
 	}
@@ -0,0 +1,38 @@
+package scale
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kotrzina/keg-scale/pkg/clock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScale_deleteInactiveBtDevices(t *testing.T) {
+	clk := clock.NewFake(time.Date(2025, 3, 14, 18, 0, 0, 0, time.UTC))
+	s := createScaleWithClock(t, clk)
+
+	s.SetDevices(map[string]Device{
+		"AA:AA": {IdentityAddress: "AA:AA", RSSI: -60, Bounded: true, LastSeen: clk.Now()},
+		"BB:BB": {IdentityAddress: "BB:BB", RSSI: -70, LastSeen: clk.Now()},
+	})
+	assert.Len(t, s.GetScale().BtDevices, 2)
+
+	// only the first device is still around
+	clk.Advance(10 * time.Minute)
+	s.SetDevices(map[string]Device{
+		"AA:AA": {IdentityAddress: "AA:AA", RSSI: -65, Bounded: true, LastSeen: clk.Now()},
+	})
+	assert.Len(t, s.GetScale().BtDevices, 2, "the device is kept for a while after the last scan")
+
+	// the attendance device stopped sending scans, expired devices are removed by the recheck
+	clk.Advance(btDeviceTimeout - 10*time.Minute + time.Second)
+	s.Recheck()
+	devices := s.GetScale().BtDevices
+	assert.Len(t, devices, 1)
+	assert.Equal(t, "AA:AA", devices[0].IdentityAddress)
+
+	clk.Advance(10 * time.Minute)
+	s.Recheck()
+	assert.Empty(t, s.GetScale().BtDevices)
+}
@@ -0,0 +1,269 @@
+package scale
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/kotrzina/keg-scale/pkg/store"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	bankRecentDays      = 14 // days of transactions kept in memory for the dashboard
+	bankHistoryDays     = 90 // the bank provides only 90 days of history without an authorization in the internet banking
+	bankSyncOverlapDays = 3  // days downloaded again, transactions may be booked with an older date
+	bankBackfillDays    = 90 // days downloaded by a single backfill request
+
+	// BankRequestInterval is the minimal time between two requests to the bank API with the same token
+	BankRequestInterval = 30 * time.Second
+)
+
+// loadBank loads the synced period and the recent transactions from the store
+func (s *Scale) loadBank() {
+	sync, err := s.store.GetBankSync()
+	if err != nil {
+		s.logger.Errorf("Could not load bank sync: %v", err)
+		return
+	}
+
+	today := day(s.clock.Now())
+	transactions, err := s.store.GetBankTransactions(today.AddDate(0, 0, -bankRecentDays), today.AddDate(0, 0, 1))
+	if err != nil {
+		s.logger.Errorf("Could not load bank transactions: %v", err)
+		return
+	}
+
+	s.bank.from = sync.From
+	s.bank.transactions = transactionsOutput(transactions)
+}
+
+// loadBankBalance loads the last known balance, the statement provider knows it only after an import
+func (s *Scale) loadBankBalance() {
+	stored, err := s.store.GetBankBalance()
+	if err != nil {
+		s.logger.Errorf("Could not load bank balance: %v", err)
+		return
+	}
+	if stored == "" {
+		return
+	}
+
+	var balance BalanceOutput
+	if err := json.Unmarshal([]byte(stored), &balance); err != nil {
+		s.logger.Errorf("Invalid stored bank balance: %v", err)
+		return
+	}
+	s.bank.balance = balance
+}
+
+// setBankBalance keeps the balance returned by the provider, an empty balance keeps the last known one
+func (s *Scale) setBankBalance(balance BalanceOutput) error {
+	if balance.isEmpty() {
+		return nil
+	}
+
+	data, err := json.Marshal(balance)
+	if err != nil {
+		return fmt.Errorf("could not marshal bank balance: %w", err)
+	}
+	if err := s.store.SetBankBalance(string(data)); err != nil {
+		return fmt.Errorf("could not store bank balance: %w", err)
+	}
+
+	s.bank.balance = balance
+	return nil
+}
+
+// GetBankTransactions returns stored bank transactions dated from (inclusive) to (exclusive) from the oldest
+func (s *Scale) GetBankTransactions(from, to time.Time) ([]TransactionOutput, error) {
+	if !to.After(from) {
+		return nil, fmt.Errorf("the end of the period must be after its start")
+	}
+
+	transactions, err := s.store.GetBankTransactions(from, to)
+	if err != nil {
+		return nil, fmt.Errorf("could not get bank transactions: %w", err)
+	}
+
+	return transactionsOutput(transactions), nil
+}
+
+// GetBankSync returns the period of the bank transactions downloaded to the store
+func (s *Scale) GetBankSync() (store.BankSync, error) {
+	return s.store.GetBankSync()
+}
+
+// ImportBankStatement stores the transactions of the uploaded statement and refreshes the bank data
+// only providers accepting statements support the import
+func (s *Scale) ImportBankStatement(ctx context.Context, r io.Reader) (int, error) {
+	s.bank.refreshMtx.Lock()
+	defer s.bank.refreshMtx.Unlock()
+
+	importer, ok := s.bank.provider.(BankStatementImporter)
+	if !ok {
+		return 0, fmt.Errorf("bank provider does not accept statements")
+	}
+
+	statement, err := importer.Import(r)
+	if err != nil {
+		return 0, fmt.Errorf("could not import bank statement: %w", err)
+	}
+
+	added, err := storeBankStatement(s.store, statement)
+	if err != nil {
+		return 0, err
+	}
+	s.logger.Infof("Bank statement from %s to %s imported, %d new transactions",
+		statement.From.Format(time.DateOnly), statement.To.Format(time.DateOnly), added)
+
+	return added, s.refreshBank(ctx)
+}
+
+// BackfillBank downloads the bank history between from and to to the store
+// the chunks are downloaded from the newest, so the synced period grows continuously
+// the bank allows a single request per interval, older Fio history must be unlocked in the internet banking first
+func BackfillBank(
+	ctx context.Context,
+	provider BankProvider,
+	storage store.Storage,
+	from, to time.Time,
+	interval time.Duration,
+	logger *logrus.Logger,
+) (int, error) {
+	from, to = day(from), day(to)
+	if to.Before(from) {
+		return 0, fmt.Errorf("the end of the period must not be before its start")
+	}
+
+	total := 0
+	for end := to; !end.Before(from); {
+		start := end.AddDate(0, 0, -(bankBackfillDays - 1))
+		if start.Before(from) {
+			start = from
+		}
+
+		if end != to {
+			select {
+			case <-ctx.Done():
+				return total, ctx.Err()
+			case <-time.After(interval):
+			}
+		}
+
+		_, added, err := syncBank(ctx, provider, storage, start, end)
+		if err != nil {
+			return total, err
+		}
+		total += added
+		logger.Infof("Bank transactions from %s to %s downloaded, %d new", start.Format(time.DateOnly), end.Format(time.DateOnly), added)
+
+		end = start.AddDate(0, 0, -1)
+	}
+
+	return total, nil
+}
+
+// syncBank downloads bank transactions dated between from and to to the store and extends the synced period
+// it returns the current balance and the number of new transactions
+func syncBank(ctx context.Context, provider BankProvider, storage store.Storage, from, to time.Time) (BalanceOutput, int, error) {
+	statement, err := provider.Statement(ctx, from, to)
+	if err != nil {
+		return BalanceOutput{}, 0, err
+	}
+
+	added, err := storeBankStatement(storage, statement)
+	if err != nil {
+		return BalanceOutput{}, 0, err
+	}
+
+	return statement.Balance, added, nil
+}
+
+// storeBankStatement stores the transactions of the statement and extends the synced period by the covered days
+func storeBankStatement(storage store.Storage, statement BankStatement) (int, error) {
+	added, err := storage.AddBankTransactions(statement.Transactions)
+	if err != nil {
+		return 0, fmt.Errorf("could not store bank transactions: %w", err)
+	}
+
+	sync, err := storage.GetBankSync()
+	if err != nil {
+		return 0, fmt.Errorf("could not get bank sync: %w", err)
+	}
+	if !statement.From.IsZero() {
+		sync = mergeBankSync(sync, day(statement.From), day(statement.To))
+	}
+	if err = storage.SetBankSync(sync); err != nil {
+		return 0, fmt.Errorf("could not set bank sync: %w", err)
+	}
+
+	return added, nil
+}
+
+// bankSyncFrom returns the first day of the incremental download
+// the last synced days are downloaded again, the history is limited by the bank
+func bankSyncFrom(sync store.BankSync, now time.Time) time.Time {
+	oldest := day(now).AddDate(0, 0, -bankHistoryDays)
+	if sync.To.IsZero() {
+		return oldest
+	}
+
+	from := day(sync.To).AddDate(0, 0, -bankSyncOverlapDays)
+	if from.Before(oldest) {
+		return oldest // days in between are lost, they can be downloaded by the backfill only
+	}
+
+	return from
+}
+
+// mergeBankSync extends the synced period by the downloaded days from and to
+// the synced period must stay continuous, so it starts over when the download leaves a gap after it
+func mergeBankSync(sync store.BankSync, from, to time.Time) store.BankSync {
+	switch {
+	case sync.From.IsZero() || from.After(sync.To.AddDate(0, 0, 1)):
+		sync.From, sync.To = from, to
+	case to.Before(sync.From.AddDate(0, 0, -1)):
+		// older days with a gap do not extend the synced period
+	default:
+		if from.Before(sync.From) {
+			sync.From = from
+		}
+		if to.After(sync.To) {
+			sync.To = to
+		}
+	}
+
+	return sync
+}
+
+func transactionsOutput(transactions []store.BankTransaction) []TransactionOutput {
+	output := make([]TransactionOutput, len(transactions))
+	for i, t := range transactions {
+		output[i] = TransactionOutput{
+			ID:                 t.ID,
+			Date:               t.Date,
+			Amount:             t.Amount,
+			Currency:           t.Currency,
+			Account:            t.Account,
+			AccountName:        t.AccountName,
+			BankName:           t.BankName,
+			BankCode:           t.BankCode,
+			ConstantSymbol:     t.ConstantSymbol,
+			VariableSymbol:     t.VariableSymbol,
+			SpecificSymbol:     t.SpecificSymbol,
+			UserIdentification: t.UserIdentification,
+			RecipientMessage:   t.RecipientMessage,
+			Type:               t.Type,
+			Specification:      t.Specification,
+			Comment:            t.Comment,
+			BIC:                t.BIC,
+			OrderID:            t.OrderID,
+			PayerReference:     t.PayerReference,
+		}
+	}
+
+	return output
+}
@@ -0,0 +1,85 @@
+package scale
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/kotrzina/keg-scale/pkg/store"
+	"github.com/shopspring/decimal"
+)
+
+// FakeBankProvider is an in-memory bank for tests and the development
+type FakeBankProvider struct {
+	Balance      BalanceOutput
+	Transactions []store.BankTransaction
+	Err          error // returned by the requests when set
+
+	mux      sync.Mutex
+	requests [][2]time.Time
+}
+
+// NewDemoBankProvider creates a fake bank with generated transactions of the last 90 days
+func NewDemoBankProvider(now time.Time) *FakeBankProvider {
+	names := []string{"Pepa Novák", "Franta Dvořák", "Jana Svobodová", "Karel Černý"}
+	today := day(now)
+
+	p := &FakeBankProvider{
+		Balance: BalanceOutput{AccountID: 2501201133, BankID: "2010", Currency: "CZK", Balance: decimal.NewFromInt(15000)},
+	}
+	for d := bankHistoryDays; d >= 0; d-- {
+		date := today.AddDate(0, 0, -d)
+		id := date.Unix()
+		for i, name := range names[:d%len(names)+1] {
+			p.Transactions = append(p.Transactions, store.BankTransaction{
+				ID:          id + int64(i),
+				Date:        date,
+				Amount:      decimal.NewFromInt(int64(50 * (d%5 + i + 1))),
+				Currency:    "CZK",
+				AccountName: name,
+				Type:        "Bezhotovostní příjem",
+			})
+		}
+		if date.Weekday() == time.Monday {
+			p.Transactions = append(p.Transactions, store.BankTransaction{
+				ID:          id + int64(len(names)),
+				Date:        date,
+				Amount:      decimal.NewFromInt(-2500),
+				Currency:    "CZK",
+				AccountName: "Maneo",
+				Type:        "Platba převodem uvnitř banky",
+			})
+		}
+	}
+
+	return p
+}
+
+func (p *FakeBankProvider) Statement(_ context.Context, from, to time.Time) (BankStatement, error) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	p.requests = append(p.requests, [2]time.Time{day(from), day(to)})
+	if p.Err != nil {
+		return BankStatement{}, fmt.Errorf("unable to retrieve transactions: %w", p.Err)
+	}
+
+	statement := BankStatement{From: day(from), To: day(to), Balance: p.Balance}
+	for _, t := range p.Transactions {
+		d := day(t.Date)
+		if !d.Before(statement.From) && !d.After(statement.To) {
+			statement.Transactions = append(statement.Transactions, t)
+		}
+	}
+
+	return statement, nil
+}
+
+// Requests returns the requested periods of days from the oldest request
+func (p *FakeBankProvider) Requests() [][2]time.Time {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	return append([][2]time.Time{}, p.requests...)
+}
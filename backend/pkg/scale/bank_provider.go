@@ -0,0 +1,111 @@
+package scale
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/jbub/fio"
+	"github.com/kotrzina/keg-scale/pkg/clock"
+	"github.com/kotrzina/keg-scale/pkg/config"
+	"github.com/kotrzina/keg-scale/pkg/store"
+)
+
+// ErrBankNotConfigured is returned when the bank is disabled by the configuration
+var ErrBankNotConfigured = errors.New("bank is not configured")
+
+// BankStatement is the balance and the transactions of the covered days
+type BankStatement struct {
+	From         time.Time // the first day covered by the transactions, zero when the statement covers no period
+	To           time.Time // the last day covered by the transactions
+	Balance      BalanceOutput
+	Transactions []store.BankTransaction
+}
+
+// BankProvider is a source of the bank transactions and the balance
+type BankProvider interface {
+	// Statement returns the current balance and the transactions dated between the days from and to (both inclusive)
+	Statement(ctx context.Context, from, to time.Time) (BankStatement, error)
+}
+
+// BankStatementImporter is a bank provider which accepts manually uploaded statements
+type BankStatementImporter interface {
+	// Import parses the uploaded statement and remembers its balance
+	Import(r io.Reader) (BankStatement, error)
+}
+
+// NewBankProvider creates the bank provider selected by the configuration
+func NewBankProvider(conf *config.Config, clk clock.Clock) (BankProvider, error) {
+	switch conf.BankProvider {
+	case config.BankProviderFio:
+		if conf.FioToken == "" {
+			return nil, ErrBankNotConfigured
+		}
+		return NewFioBankProvider(fio.NewClient(conf.FioToken, nil)), nil
+	case config.BankProviderStatement:
+		return NewStatementBankProvider(), nil
+	case config.BankProviderFake:
+		return NewDemoBankProvider(clk.Now()), nil
+	default:
+		return nil, fmt.Errorf("unknown bank provider: %q", conf.BankProvider)
+	}
+}
+
+// FioBankProvider downloads the transactions from the Fio API
+// Fio allows a single request per BankRequestInterval with the same token
+type FioBankProvider struct {
+	client *fio.Client
+}
+
+func NewFioBankProvider(client *fio.Client) *FioBankProvider {
+	return &FioBankProvider{client: client}
+}
+
+func (p *FioBankProvider) Statement(ctx context.Context, from, to time.Time) (BankStatement, error) {
+	resp, err := p.client.Transactions.ByPeriod(ctx, fio.ByPeriodOptions{DateFrom: from, DateTo: to})
+	if err != nil {
+		return BankStatement{}, fmt.Errorf("unable to retrieve transactions: %w", err)
+	}
+
+	statement := BankStatement{
+		From: day(from),
+		To:   day(to),
+		Balance: BalanceOutput{
+			AccountID: resp.Info.AccountID,
+			BankID:    resp.Info.BankID,
+			Currency:  resp.Info.Currency,
+			IBAN:      resp.Info.IBAN,
+			BIC:       resp.Info.BIC,
+			Balance:   resp.Info.ClosingBalance,
+		},
+		Transactions: make([]store.BankTransaction, len(resp.Transactions)),
+	}
+
+	for i, t := range resp.Transactions {
+		statement.Transactions[i] = store.BankTransaction{
+			ID:                 t.ID,
+			Date:               t.Date,
+			Amount:             t.Amount,
+			Currency:           t.Currency,
+			Account:            t.Account,
+			AccountName:        t.AccountName,
+			BankName:           t.BankName,
+			BankCode:           t.BankCode,
+			ConstantSymbol:     t.ConstantSymbol,
+			VariableSymbol:     t.VariableSymbol,
+			SpecificSymbol:     t.SpecificSymbol,
+			UserIdentification: t.UserIdentification,
+			RecipientMessage:   t.RecipientMessage,
+			Type:               t.Type,
+			Specification:      t.Specification,
+			Comment:            t.Comment,
+			BIC:                t.BIC,
+			OrderID:            t.OrderID,
+			PayerReference:     t.PayerReference,
+		}
+	}
+
+	return statement, nil
+}
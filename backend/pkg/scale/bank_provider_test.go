@@ -0,0 +1,128 @@
+package scale
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jbub/fio"
+	"github.com/kotrzina/keg-scale/pkg/clock"
+	"github.com/kotrzina/keg-scale/pkg/config"
+	"github.com/kotrzina/keg-scale/pkg/utils"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const fioDate = "2006-01-02-07:00"
+
+type fioTransaction struct {
+	id     int64
+	date   time.Time
+	amount int64
+	name   string
+}
+
+// fioServer serves the transactions of the period like the Fio API and records requested periods
+type fioServer struct {
+	transactions []fioTransaction
+	mux          sync.Mutex
+	periods      [][2]string
+}
+
+func (f *fioServer) client(t *testing.T) *fio.Client {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(f.handle))
+	t.Cleanup(srv.Close)
+
+	client := fio.NewClient("token", srv.Client())
+	baseURL, err := url.Parse(srv.URL + "/")
+	require.NoError(t, err)
+	client.BaseURL = baseURL
+
+	return client
+}
+
+func (f *fioServer) handle(w http.ResponseWriter, r *http.Request) {
+	// /v1/rest/periods/token/2025-03-01/2025-03-14/transactions.xml
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	from, _ := time.ParseInLocation(time.DateOnly, parts[4], utils.GetTz())
+	to, _ := time.ParseInLocation(time.DateOnly, parts[5], utils.GetTz())
+
+	f.mux.Lock()
+	f.periods = append(f.periods, [2]string{parts[4], parts[5]})
+	f.mux.Unlock()
+
+	sb := strings.Builder{}
+	sb.WriteString(`<?xml version="1.0" encoding="UTF-8"?><AccountStatement><Info>`)
+	sb.WriteString(`<accountId>2501201133</accountId><bankId>2010</bankId><currency>CZK</currency><closingBalance>4200.50</closingBalance>`)
+	sb.WriteString(fmt.Sprintf(`<dateStart>%s</dateStart><dateEnd>%s</dateEnd>`, from.Format(fioDate), to.Format(fioDate)))
+	sb.WriteString(`</Info><TransactionList>`)
+	for _, t := range f.transactions {
+		if t.date.Before(from) || t.date.After(to) {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf(
+			`<Transaction><column_22 id="22">%d</column_22><column_0 id="0">%s</column_0><column_1 id="1">%d</column_1><column_10 id="10">%s</column_10></Transaction>`,
+			t.id, t.date.Format(fioDate), t.amount, t.name,
+		))
+	}
+	sb.WriteString(`</TransactionList></AccountStatement>`)
+	_, _ = w.Write([]byte(sb.String()))
+}
+
+func TestFioBankProvider_Statement(t *testing.T) {
+	date := func(month time.Month, d int) time.Time {
+		return time.Date(2025, month, d, 0, 0, 0, 0, utils.GetTz())
+	}
+	server := &fioServer{transactions: []fioTransaction{
+		{id: 1, date: date(2, 28), amount: 100, name: "before"},
+		{id: 2, date: date(3, 1), amount: 250, name: "Pepa"},
+		{id: 3, date: date(3, 13), amount: -5000, name: "Maneo"},
+	}}
+	provider := NewFioBankProvider(server.client(t))
+
+	statement, err := provider.Statement(context.Background(), date(3, 1), date(3, 14))
+	require.NoError(t, err)
+	require.Len(t, server.periods, 1)
+	assert.Equal(t, [2]string{"2025-03-01", "2025-03-14"}, server.periods[0])
+	assert.True(t, date(3, 1).Equal(statement.From))
+	assert.True(t, date(3, 14).Equal(statement.To))
+	assert.Equal(t, int64(2501201133), statement.Balance.AccountID)
+	assert.True(t, decimal.RequireFromString("4200.50").Equal(statement.Balance.Balance))
+
+	require.Len(t, statement.Transactions, 2)
+	assert.Equal(t, int64(2), statement.Transactions[0].ID)
+	assert.Equal(t, "Pepa", statement.Transactions[0].AccountName)
+	assert.True(t, decimal.NewFromInt(-5000).Equal(statement.Transactions[1].Amount))
+}
+
+func TestNewBankProvider(t *testing.T) {
+	clk := clock.NewFake(time.Date(2025, 3, 14, 20, 0, 0, 0, utils.GetTz()))
+
+	_, err := NewBankProvider(&config.Config{BankProvider: config.BankProviderFio}, clk)
+	require.ErrorIs(t, err, ErrBankNotConfigured)
+
+	provider, err := NewBankProvider(&config.Config{BankProvider: config.BankProviderFio, FioToken: "token"}, clk)
+	require.NoError(t, err)
+	assert.IsType(t, &FioBankProvider{}, provider)
+
+	provider, err = NewBankProvider(&config.Config{BankProvider: config.BankProviderStatement}, clk)
+	require.NoError(t, err)
+	assert.Implements(t, (*BankStatementImporter)(nil), provider)
+
+	provider, err = NewBankProvider(&config.Config{BankProvider: config.BankProviderFake}, clk)
+	require.NoError(t, err)
+	statement, err := provider.Statement(context.Background(), clk.Now().AddDate(0, 0, -6), clk.Now())
+	require.NoError(t, err)
+	assert.NotEmpty(t, statement.Transactions, "the demo bank has transactions every day")
+
+	_, err = NewBankProvider(&config.Config{BankProvider: "unknown"}, clk)
+	require.Error(t, err)
+}
@@ -0,0 +1,405 @@
+package scale
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/kotrzina/keg-scale/pkg/store"
+	"github.com/kotrzina/keg-scale/pkg/utils"
+	"github.com/shopspring/decimal"
+	"golang.org/x/text/encoding/charmap"
+)
+
+const bankStatementMaxSize = 10 << 20 // 10 MB
+
+// StatementBankProvider provides transactions from manually uploaded statements
+// Fio CSV exports and ABO (GPC) statements are supported, both in UTF-8 or Windows-1250
+type StatementBankProvider struct {
+	mux     sync.Mutex
+	balance BalanceOutput
+	to      time.Time // the last day of the newest statement
+}
+
+func NewStatementBankProvider() *StatementBankProvider {
+	return &StatementBankProvider{}
+}
+
+// Import parses the uploaded statement, the balance of the newest statement is the current balance
+func (p *StatementBankProvider) Import(r io.Reader) (BankStatement, error) {
+	data, err := io.ReadAll(io.LimitReader(r, bankStatementMaxSize+1))
+	if err != nil {
+		return BankStatement{}, fmt.Errorf("could not read statement: %w", err)
+	}
+	if len(data) > bankStatementMaxSize {
+		return BankStatement{}, fmt.Errorf("statement is larger than %d bytes", bankStatementMaxSize)
+	}
+
+	statement, err := parseBankStatement(data)
+	if err != nil {
+		return BankStatement{}, err
+	}
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	if !statement.To.Before(p.to) {
+		p.balance = statement.Balance
+		p.to = statement.To
+	}
+
+	return statement, nil
+}
+
+// Statement returns the balance of the newest statement
+// the uploaded transactions are stored by the import, so there is nothing new to download
+func (p *StatementBankProvider) Statement(_ context.Context, _, _ time.Time) (BankStatement, error) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	return BankStatement{Balance: p.balance}, nil
+}
+
+// parseBankStatement detects the format of the statement and parses it
+func parseBankStatement(data []byte) (BankStatement, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")) // UTF-8 BOM
+	if !utf8.Valid(data) {
+		decoded, err := charmap.Windows1250.NewDecoder().Bytes(data)
+		if err != nil {
+			return BankStatement{}, fmt.Errorf("could not decode statement: %w", err)
+		}
+		data = decoded
+	}
+
+	var statement BankStatement
+	var err error
+	if bytes.HasPrefix(data, []byte("074")) {
+		statement, err = parseGpcStatement(string(data))
+	} else {
+		statement, err = parseCsvStatement(string(data))
+	}
+	if err != nil {
+		return BankStatement{}, err
+	}
+
+	if len(statement.Transactions) == 0 && statement.From.IsZero() {
+		return BankStatement{}, fmt.Errorf("statement has no transactions")
+	}
+
+	// the period is taken from the transactions when the statement does not say
+	for _, t := range statement.Transactions {
+		d := day(t.Date)
+		if statement.From.IsZero() || d.Before(statement.From) {
+			statement.From = d
+		}
+		if statement.To.IsZero() || d.After(statement.To) {
+			statement.To = d
+		}
+	}
+
+	return statement, nil
+}
+
+// parseCsvStatement parses the Fio CSV export
+// the optional header with account info is followed by the table of transactions with Czech column names
+func parseCsvStatement(data string) (BankStatement, error) {
+	reader := csv.NewReader(strings.NewReader(data))
+	reader.Comma = ';'
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return BankStatement{}, fmt.Errorf("could not read CSV statement: %w", err)
+	}
+
+	statement := BankStatement{}
+	var columns map[string]int
+	for i, record := range records {
+		if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+
+		if columns == nil {
+			if len(record) == 2 {
+				if err = parseCsvInfo(&statement, record[0], record[1]); err != nil {
+					return BankStatement{}, err
+				}
+				continue
+			}
+
+			columns = map[string]int{}
+			for j, name := range record {
+				columns[strings.TrimSpace(name)] = j
+			}
+			for _, required := range []string{"ID pohybu", "Datum", "Objem"} {
+				if _, found := columns[required]; !found {
+					return BankStatement{}, fmt.Errorf("CSV statement has no column %q", required)
+				}
+			}
+			continue
+		}
+
+		t, err := parseCsvTransaction(record, columns)
+		if err != nil {
+			return BankStatement{}, fmt.Errorf("could not parse CSV statement line %d: %w", i+1, err)
+		}
+		statement.Transactions = append(statement.Transactions, t)
+	}
+
+	if columns == nil {
+		return BankStatement{}, fmt.Errorf("CSV statement has no transactions table")
+	}
+
+	return statement, nil
+}
+
+func parseCsvInfo(statement *BankStatement, key, value string) error {
+	var err error
+	value = strings.TrimSpace(value)
+	switch key {
+	case "accountId":
+		statement.Balance.AccountID, err = strconv.ParseInt(value, 10, 64)
+	case "bankId":
+		statement.Balance.BankID = value
+	case "currency":
+		statement.Balance.Currency = value
+	case "iban":
+		statement.Balance.IBAN = value
+	case "bic":
+		statement.Balance.BIC = value
+	case "closingBalance":
+		statement.Balance.Balance, err = parseStatementAmount(value)
+	case "dateStart":
+		statement.From, err = parseStatementDate(value)
+	case "dateEnd":
+		statement.To, err = parseStatementDate(value)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %s in CSV statement: %w", key, err)
+	}
+
+	return nil
+}
+
+func parseCsvTransaction(record []string, columns map[string]int) (store.BankTransaction, error) {
+	value := func(column string) string {
+		i, found := columns[column]
+		if !found || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	id, err := strconv.ParseInt(value("ID pohybu"), 10, 64)
+	if err != nil {
+		return store.BankTransaction{}, fmt.Errorf("invalid transaction id: %w", err)
+	}
+	date, err := parseStatementDate(value("Datum"))
+	if err != nil {
+		return store.BankTransaction{}, fmt.Errorf("invalid date: %w", err)
+	}
+	amount, err := parseStatementAmount(value("Objem"))
+	if err != nil {
+		return store.BankTransaction{}, fmt.Errorf("invalid amount: %w", err)
+	}
+
+	return store.BankTransaction{
+		ID:                 id,
+		Date:               date,
+		Amount:             amount,
+		Currency:           value("Měna"),
+		Account:            value("Protiúčet"),
+		AccountName:        value("Název protiúčtu"),
+		BankName:           value("Název banky"),
+		BankCode:           value("Kód banky"),
+		ConstantSymbol:     value("KS"),
+		VariableSymbol:     value("VS"),
+		SpecificSymbol:     value("SS"),
+		UserIdentification: value("Uživatelská identifikace"),
+		RecipientMessage:   value("Zpráva pro příjemce"),
+		Type:               value("Typ"),
+		Specification:      value("Upřesnění"),
+		Comment:            value("Komentář"),
+		BIC:                value("BIC"),
+		OrderID:            value("ID pokynu"),
+		PayerReference:     value("Reference plátce"),
+	}, nil
+}
+
+// parseStatementDate parses the day in the formats used by the statements
+func parseStatementDate(value string) (time.Time, error) {
+	for _, layout := range []string{"2.1.2006", "2006-01-02", "2006-01-02-07:00"} {
+		if t, err := time.ParseInLocation(layout, value, utils.GetTz()); err == nil {
+			return day(t), nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("unknown date format: %q", value)
+}
+
+// parseStatementAmount parses amounts like "1 250,50" or "-5000.00"
+func parseStatementAmount(value string) (decimal.Decimal, error) {
+	value = strings.NewReplacer(" ", "", "\u00a0", "", ",", ".").Replace(value)
+	return decimal.NewFromString(value)
+}
+
+// parseGpcStatement parses the ABO (GPC) statement with fixed width records
+// 074 is the account header with balances, 075 is a transaction, 078 and 079 carry the message of the transaction
+func parseGpcStatement(data string) (BankStatement, error) {
+	statement := BankStatement{}
+	for i, line := range strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		// fields are addressed by characters, short lines are padded
+		r := []rune(line)
+		for len(r) < 128 {
+			r = append(r, ' ')
+		}
+		field := func(from, to int) string {
+			return strings.TrimSpace(string(r[from-1 : to]))
+		}
+
+		var err error
+		switch field(1, 3) {
+		case "074":
+			err = parseGpcHeader(&statement, field)
+		case "075":
+			var t store.BankTransaction
+			t, err = parseGpcTransaction(field)
+			statement.Transactions = append(statement.Transactions, t)
+		case "078", "079":
+			if n := len(statement.Transactions); n > 0 {
+				message := strings.TrimSpace(statement.Transactions[n-1].RecipientMessage + " " + field(4, 128))
+				statement.Transactions[n-1].RecipientMessage = message
+			}
+		}
+		if err != nil {
+			return BankStatement{}, fmt.Errorf("could not parse GPC statement line %d: %w", i+1, err)
+		}
+	}
+
+	if len(statement.Transactions) > 0 {
+		statement.Balance.Currency = statement.Transactions[0].Currency
+	}
+
+	return statement, nil
+}
+
+func parseGpcHeader(statement *BankStatement, field func(from, to int) string) error {
+	account, err := strconv.ParseInt(field(4, 19), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid account: %w", err)
+	}
+	balance, err := parseGpcAmount(field(61, 74), field(75, 75) == "-")
+	if err != nil {
+		return fmt.Errorf("invalid balance: %w", err)
+	}
+
+	statement.Balance.AccountID = account
+	statement.Balance.Balance = balance
+
+	// the old balance is from the day before the statement starts
+	if oldDate, err := parseGpcDate(field(40, 45)); err == nil {
+		statement.From = oldDate.AddDate(0, 0, 1)
+	}
+	if date, err := parseGpcDate(field(109, 114)); err == nil {
+		statement.To = date
+	}
+	if statement.To.Before(statement.From) {
+		statement.From, statement.To = time.Time{}, time.Time{} // the transactions say
+	}
+
+	return nil
+}
+
+func parseGpcTransaction(field func(from, to int) string) (store.BankTransaction, error) {
+	id, err := strconv.ParseInt(field(36, 48), 10, 64)
+	if err != nil {
+		return store.BankTransaction{}, fmt.Errorf("invalid transaction id: %w", err)
+	}
+
+	// 1 is debit, 2 credit, 4 cancelled debit and 5 cancelled credit
+	code := field(61, 61)
+	amount, err := parseGpcAmount(field(49, 60), code == "1" || code == "5")
+	if err != nil {
+		return store.BankTransaction{}, fmt.Errorf("invalid amount: %w", err)
+	}
+
+	date, err := parseGpcDate(field(123, 128))
+	if err != nil {
+		date, err = parseGpcDate(field(92, 97))
+		if err != nil {
+			return store.BankTransaction{}, fmt.Errorf("invalid date: %w", err)
+		}
+	}
+
+	return store.BankTransaction{
+		ID:             id,
+		Date:           date,
+		Amount:         amount,
+		Currency:       gpcCurrency(field(119, 122)),
+		Account:        gpcAccount(field(20, 35)),
+		AccountName:    field(98, 117),
+		BankCode:       field(74, 77),
+		ConstantSymbol: strings.TrimLeft(field(78, 81), "0"),
+		VariableSymbol: strings.TrimLeft(field(62, 71), "0"),
+		SpecificSymbol: strings.TrimLeft(field(82, 91), "0"),
+	}, nil
+}
+
+// parseGpcAmount parses the amount in hundredths
+func parseGpcAmount(value string, negative bool) (decimal.Decimal, error) {
+	hundredths, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	if negative {
+		hundredths = -hundredths
+	}
+
+	return decimal.New(hundredths, -2), nil
+}
+
+// parseGpcDate parses DDMMYY dates
+func parseGpcDate(value string) (time.Time, error) {
+	return time.ParseInLocation("020106", value, utils.GetTz())
+}
+
+// gpcCurrency maps ISO 4217 numeric codes used by ABO to currencies
+func gpcCurrency(code string) string {
+	switch code {
+	case "0203":
+		return "CZK"
+	case "0978":
+		return "EUR"
+	case "0840":
+		return "USD"
+	default:
+		return code
+	}
+}
+
+// gpcAccount formats the 16 digits account as prefix-number without leading zeros
+func gpcAccount(value string) string {
+	if len(value) != 16 {
+		return strings.TrimLeft(value, "0")
+	}
+
+	prefix := strings.TrimLeft(value[:6], "0")
+	number := strings.TrimLeft(value[6:], "0")
+	if prefix == "" {
+		return number
+	}
+
+	return prefix + "-" + number
+}
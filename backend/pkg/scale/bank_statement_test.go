@@ -0,0 +1,196 @@
+package scale
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kotrzina/keg-scale/pkg/clock"
+	"github.com/kotrzina/keg-scale/pkg/utils"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/encoding/charmap"
+)
+
+const csvStatement = `"accountId";"2501201133"
+"bankId";"2010"
+"currency";"CZK"
+"iban";"CZ6520100000002501201133"
+"bic";"FIOBCZPPXXX"
+"openingBalance";"1000,00"
+"closingBalance";"4 200,50"
+"dateStart";"01.03.2025"
+"dateEnd";"14.03.2025"
+
+"ID pohybu";"Datum";"Objem";"Měna";"Protiúčet";"Název protiúčtu";"Kód banky";"VS";"Zpráva pro příjemce";"Typ"
+"26001";"03.03.2025";"250,00";"CZK";"123456789";"Pepa Novák";"0800";"42";"pivo";"Bezhotovostní příjem"
+"26002";"13.03.2025";"-5000,00";"CZK";"987654321";"Maneo";"2010";"";"";"Platba převodem uvnitř banky"
+`
+
+// gpcLine places the values to their positions (1-indexed) of the fixed width record
+func gpcLine(values map[int]string) string {
+	line := []rune(strings.Repeat(" ", 128))
+	for pos, value := range values {
+		copy(line[pos-1:], []rune(value))
+	}
+	return string(line)
+}
+
+func TestParseBankStatement_Csv(t *testing.T) {
+	date := func(d int) time.Time {
+		return time.Date(2025, 3, d, 0, 0, 0, 0, utils.GetTz())
+	}
+
+	for name, data := range map[string]string{
+		"utf-8":        "\xef\xbb\xbf" + csvStatement,
+		"windows-1250": mustEncode(t, csvStatement),
+	} {
+		t.Run(name, func(t *testing.T) {
+			statement, err := parseBankStatement([]byte(data))
+			require.NoError(t, err)
+
+			assert.True(t, date(1).Equal(statement.From))
+			assert.True(t, date(14).Equal(statement.To))
+			assert.Equal(t, int64(2501201133), statement.Balance.AccountID)
+			assert.Equal(t, "CZK", statement.Balance.Currency)
+			assert.True(t, decimal.RequireFromString("4200.50").Equal(statement.Balance.Balance))
+
+			require.Len(t, statement.Transactions, 2)
+			pepa := statement.Transactions[0]
+			assert.Equal(t, int64(26001), pepa.ID)
+			assert.True(t, date(3).Equal(pepa.Date))
+			assert.True(t, decimal.NewFromInt(250).Equal(pepa.Amount))
+			assert.Equal(t, "Pepa Novák", pepa.AccountName)
+			assert.Equal(t, "0800", pepa.BankCode)
+			assert.Equal(t, "42", pepa.VariableSymbol)
+			assert.Equal(t, "pivo", pepa.RecipientMessage)
+			assert.True(t, decimal.NewFromInt(-5000).Equal(statement.Transactions[1].Amount))
+		})
+	}
+}
+
+func TestParseBankStatement_CsvWithoutInfo(t *testing.T) {
+	data := "ID pohybu;Datum;Objem\n1;2025-03-05;100\n2;2025-03-02;50,5\n"
+
+	statement, err := parseBankStatement([]byte(data))
+	require.NoError(t, err)
+	require.Len(t, statement.Transactions, 2)
+	assert.True(t, time.Date(2025, 3, 2, 0, 0, 0, 0, utils.GetTz()).Equal(statement.From), "the period comes from the transactions")
+	assert.True(t, time.Date(2025, 3, 5, 0, 0, 0, 0, utils.GetTz()).Equal(statement.To))
+
+	_, err = parseBankStatement([]byte("Datum;Objem\n2025-03-05;100\n"))
+	require.Error(t, err, "the id is required")
+
+	_, err = parseBankStatement([]byte("ID pohybu;Datum;Objem\n1;yesterday;100\n"))
+	require.Error(t, err)
+
+	_, err = parseBankStatement([]byte("ID pohybu;Datum;Objem\n"))
+	require.Error(t, err, "no transactions and no period")
+}
+
+func TestParseBankStatement_Gpc(t *testing.T) {
+	date := func(d int) time.Time {
+		return time.Date(2025, 3, d, 0, 0, 0, 0, utils.GetTz())
+	}
+
+	data := strings.Join([]string{
+		gpcLine(map[int]string{1: "074", 4: "0000002501201133", 20: "Hospoda", 40: "280225", 46: "00000000100000", 60: "+",
+			61: "00000000420050", 75: "+", 109: "140325"}),
+		gpcLine(map[int]string{1: "075", 4: "0000002501201133", 20: "0000000123456789", 36: "0000000026001", 49: "000000025000",
+			61: "2", 62: "0000000042", 72: "00", 74: "0800", 78: "0308", 82: "0000000000", 92: "030325", 98: "Pepa Novák",
+			118: "0", 119: "0203", 123: "030325"}),
+		gpcLine(map[int]string{1: "078", 4: "pivo"}),
+		gpcLine(map[int]string{1: "079", 4: "a klobása"}),
+		gpcLine(map[int]string{1: "075", 4: "0000002501201133", 20: "0000190987654321", 36: "0000000026002", 49: "000000500000",
+			61: "1", 62: "0000000000", 74: "2010", 92: "130325", 98: "Maneo", 119: "0203"}),
+	}, "\r\n")
+
+	statement, err := parseBankStatement([]byte(mustEncode(t, data)))
+	require.NoError(t, err)
+
+	assert.True(t, date(1).Equal(statement.From), "the day after the old balance")
+	assert.True(t, date(14).Equal(statement.To))
+	assert.Equal(t, int64(2501201133), statement.Balance.AccountID)
+	assert.Equal(t, "CZK", statement.Balance.Currency)
+	assert.True(t, decimal.RequireFromString("4200.50").Equal(statement.Balance.Balance))
+
+	require.Len(t, statement.Transactions, 2)
+	pepa := statement.Transactions[0]
+	assert.Equal(t, int64(26001), pepa.ID)
+	assert.True(t, date(3).Equal(pepa.Date))
+	assert.True(t, decimal.NewFromInt(250).Equal(pepa.Amount))
+	assert.Equal(t, "123456789", pepa.Account)
+	assert.Equal(t, "Pepa Novák", pepa.AccountName)
+	assert.Equal(t, "0800", pepa.BankCode)
+	assert.Equal(t, "308", pepa.ConstantSymbol)
+	assert.Equal(t, "42", pepa.VariableSymbol)
+	assert.Equal(t, "", pepa.SpecificSymbol)
+	assert.Equal(t, "pivo a klobása", pepa.RecipientMessage)
+
+	maneo := statement.Transactions[1]
+	assert.True(t, date(13).Equal(maneo.Date), "the date falls back to the value date")
+	assert.True(t, decimal.NewFromInt(-5000).Equal(maneo.Amount), "debit is negative")
+	assert.Equal(t, "19-987654321", maneo.Account)
+
+	_, err = parseBankStatement([]byte(gpcLine(map[int]string{1: "074", 4: "account"})))
+	require.Error(t, err)
+}
+
+func TestScale_ImportBankStatement(t *testing.T) {
+	clk := clock.NewFake(time.Date(2025, 3, 14, 20, 0, 0, 0, utils.GetTz()))
+	s := createScaleWithClock(t, clk)
+
+	_, err := s.ImportBankStatement(context.Background(), strings.NewReader(csvStatement))
+	require.Error(t, err, "the bank is not configured")
+
+	s.bank.provider = NewStatementBankProvider()
+
+	added, err := s.ImportBankStatement(context.Background(), strings.NewReader(csvStatement))
+	require.NoError(t, err)
+	assert.Equal(t, 2, added)
+	assert.True(t, decimal.RequireFromString("4200.50").Equal(s.GetScale().BankBalance.Balance))
+	assert.Len(t, s.GetScale().BankTransactions, 2)
+
+	sync, err := s.GetBankSync()
+	require.NoError(t, err)
+	assert.True(t, time.Date(2025, 3, 1, 0, 0, 0, 0, utils.GetTz()).Equal(sync.From))
+	assert.True(t, time.Date(2025, 3, 14, 0, 0, 0, 0, utils.GetTz()).Equal(sync.To))
+
+	// the same statement again adds nothing
+	added, err = s.ImportBankStatement(context.Background(), strings.NewReader(csvStatement))
+	require.NoError(t, err)
+	assert.Equal(t, 0, added)
+
+	// an older statement keeps the newest balance
+	older := "ID pohybu;Datum;Objem\n25001;2025-02-10;100\n"
+	added, err = s.ImportBankStatement(context.Background(), strings.NewReader(older))
+	require.NoError(t, err)
+	assert.Equal(t, 1, added)
+	assert.True(t, decimal.RequireFromString("4200.50").Equal(s.GetScale().BankBalance.Balance))
+
+	// the periodic refresh does not extend the synced period
+	clk.Advance(48 * time.Hour)
+	require.NoError(t, s.BankRefresh(context.Background(), true))
+	sync, err = s.GetBankSync()
+	require.NoError(t, err)
+	assert.True(t, time.Date(2025, 3, 14, 0, 0, 0, 0, utils.GetTz()).Equal(sync.To))
+
+	// after a restart the provider knows no balance until the next import, the stored one is kept
+	s.bank.provider = NewStatementBankProvider()
+	s.bank.balance = BalanceOutput{}
+	s.loadBankBalance()
+	require.NoError(t, s.BankRefresh(context.Background(), true))
+	assert.True(t, decimal.RequireFromString("4200.50").Equal(s.GetScale().BankBalance.Balance))
+
+	_, err = s.ImportBankStatement(context.Background(), strings.NewReader("garbage"))
+	require.Error(t, err)
+}
+
+func mustEncode(t *testing.T, data string) string {
+	t.Helper()
+	encoded, err := charmap.Windows1250.NewEncoder().String(data)
+	require.NoError(t, err)
+	return encoded
+}
@@ -0,0 +1,154 @@
+package scale
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kotrzina/keg-scale/pkg/clock"
+	"github.com/kotrzina/keg-scale/pkg/store"
+	"github.com/kotrzina/keg-scale/pkg/utils"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScale_BankRefresh(t *testing.T) {
+	clk := clock.NewFake(time.Date(2025, 3, 14, 20, 0, 0, 0, utils.GetTz()))
+	s := createScaleWithClock(t, clk)
+	date := func(year int, month time.Month, d int) time.Time {
+		return time.Date(year, month, d, 0, 0, 0, 0, utils.GetTz())
+	}
+
+	bank := &FakeBankProvider{
+		Balance: BalanceOutput{Currency: "CZK", Balance: decimal.RequireFromString("4200.50")},
+		Transactions: []store.BankTransaction{
+			bankTransaction(1, date(2024, 11, 20), 100, "too old"),
+			bankTransaction(2, date(2025, 2, 1), 250, "Pepa"),
+			bankTransaction(3, date(2025, 3, 13), -5000, "Maneo"),
+			bankTransaction(4, date(2025, 3, 14), 300, "Franta"),
+		},
+	}
+	s.bank.provider = bank
+
+	// the first refresh downloads all the history the bank provides
+	require.NoError(t, s.BankRefresh(context.Background(), true))
+	require.Len(t, bank.Requests(), 1)
+	assert.Equal(t, [2]time.Time{date(2024, 12, 14), date(2025, 3, 14)}, bank.Requests()[0])
+	assert.True(t, decimal.RequireFromString("4200.50").Equal(s.GetScale().BankBalance.Balance))
+	assert.True(t, date(2024, 12, 14).Equal(s.bank.from))
+
+	recent := s.GetScale().BankTransactions
+	require.Len(t, recent, 2, "only the recent days are in memory")
+	assert.Equal(t, "Maneo", recent[0].AccountName)
+
+	transactions, err := s.GetBankTransactions(date(2024, 1, 1), date(2025, 3, 1))
+	require.NoError(t, err)
+	require.Len(t, transactions, 1)
+	assert.Equal(t, "Pepa", transactions[0].AccountName)
+
+	// the next refresh continues from the last synced day
+	clk.Advance(48 * time.Hour)
+	bank.Transactions = append(bank.Transactions, bankTransaction(5, date(2025, 3, 12), 50, "booked late"))
+	require.NoError(t, s.BankRefresh(context.Background(), true))
+	require.Len(t, bank.Requests(), 2)
+	assert.Equal(t, [2]time.Time{date(2025, 3, 11), date(2025, 3, 16)}, bank.Requests()[1])
+	assert.Len(t, s.GetScale().BankTransactions, 3)
+
+	sync, err := s.store.GetBankSync()
+	require.NoError(t, err)
+	assert.True(t, date(2025, 3, 16).Equal(sync.To))
+
+	// failed download keeps the stored transactions
+	bank.Err = errors.New("bank is down")
+	require.Error(t, s.BankRefresh(context.Background(), true))
+	assert.Len(t, s.GetScale().BankTransactions, 3)
+
+	// transactions survive the restart
+	restarted := New(context.Background(), s.monitor, s.store, s.config, clk, s.logger)
+	assert.Len(t, restarted.GetScale().BankTransactions, 3)
+	assert.True(t, s.bank.from.Equal(restarted.bank.from))
+
+	_, err = s.GetBankTransactions(date(2025, 3, 1), date(2025, 3, 1))
+	require.Error(t, err)
+}
+
+func TestBackfillBank(t *testing.T) {
+	date := func(year int, month time.Month, d int) time.Time {
+		return time.Date(year, month, d, 0, 0, 0, 0, utils.GetTz())
+	}
+	bank := &FakeBankProvider{Transactions: []store.BankTransaction{
+		bankTransaction(1, date(2024, 6, 1), 100, "old"),
+		bankTransaction(2, date(2024, 12, 24), 200, "christmas"),
+		bankTransaction(3, date(2025, 3, 1), 300, "recent"),
+	}}
+	storage := &store.FakeStore{}
+	require.NoError(t, storage.SetBankSync(store.BankSync{From: date(2025, 3, 1), To: date(2025, 3, 14)}))
+	logger := logrus.New()
+	logger.SetOutput(&bytes.Buffer{})
+
+	added, err := BackfillBank(context.Background(), bank, storage, date(2024, 6, 1), date(2025, 2, 28), 0, logger)
+	require.NoError(t, err)
+	assert.Equal(t, 2, added)
+	requests := bank.Requests()
+	require.Len(t, requests, 4, "nine months in 90 days chunks from the newest")
+	assert.Equal(t, [2]time.Time{date(2024, 12, 1), date(2025, 2, 28)}, requests[0])
+	assert.Equal(t, [2]time.Time{date(2024, 6, 1), date(2024, 6, 3)}, requests[3])
+
+	sync, err := storage.GetBankSync()
+	require.NoError(t, err)
+	assert.True(t, date(2024, 6, 1).Equal(sync.From))
+	assert.True(t, date(2025, 3, 14).Equal(sync.To))
+
+	// the backfill stops with the context
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = BackfillBank(ctx, bank, storage, date(2024, 1, 1), date(2024, 12, 31), time.Hour, logger)
+	require.ErrorIs(t, err, context.Canceled)
+
+	_, err = BackfillBank(context.Background(), bank, storage, date(2025, 1, 2), date(2025, 1, 1), 0, logger)
+	require.Error(t, err)
+}
+
+func bankTransaction(id int64, date time.Time, amount int64, name string) store.BankTransaction {
+	return store.BankTransaction{ID: id, Date: date, Amount: decimal.NewFromInt(amount), Currency: "CZK", AccountName: name}
+}
+
+func TestMergeBankSync(t *testing.T) {
+	d := func(day int) time.Time {
+		return time.Date(2025, 3, day, 0, 0, 0, 0, utils.GetTz())
+	}
+
+	sync := mergeBankSync(store.BankSync{}, d(1), d(14))
+	assert.True(t, d(1).Equal(sync.From))
+	assert.True(t, d(14).Equal(sync.To))
+
+	sync = mergeBankSync(sync, d(12), d(16))
+	assert.True(t, d(1).Equal(sync.From), "overlapping period is extended")
+	assert.True(t, d(16).Equal(sync.To))
+
+	sync = mergeBankSync(sync, d(17), d(18))
+	assert.True(t, d(1).Equal(sync.From), "the next day continues the period")
+	assert.True(t, d(18).Equal(sync.To))
+
+	older := mergeBankSync(store.BankSync{From: d(10), To: d(18)}, d(1), d(5))
+	assert.True(t, d(10).Equal(older.From), "a gap before does not extend the period")
+
+	newer := mergeBankSync(store.BankSync{From: d(1), To: d(5)}, d(10), d(18))
+	assert.True(t, d(10).Equal(newer.From), "a gap after starts the period over")
+	assert.True(t, d(18).Equal(newer.To))
+}
+
+func TestBankSyncFrom(t *testing.T) {
+	now := time.Date(2025, 3, 14, 20, 0, 0, 0, utils.GetTz())
+	d := func(month time.Month, day int) time.Time {
+		return time.Date(2025, month, day, 0, 0, 0, 0, utils.GetTz())
+	}
+
+	assert.True(t, d(3, 14).AddDate(0, 0, -90).Equal(bankSyncFrom(store.BankSync{}, now)))
+	assert.True(t, d(3, 9).Equal(bankSyncFrom(store.BankSync{From: d(1, 1), To: d(3, 12)}, now)))
+	assert.True(t, d(3, 14).AddDate(0, 0, -90).Equal(bankSyncFrom(store.BankSync{To: d(1, 1).AddDate(-1, 0, 0)}, now)))
+}
@@ -0,0 +1,288 @@
+package scale
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/kotrzina/keg-scale/pkg/store"
+)
+
+const (
+	calibrationMinGain     = 0.5 // gains out of this range mean wrong points, not a scale drift
+	calibrationMaxGain     = 2.0
+	calibrationMinDistance = 1000.0 // grams - minimal difference of tare and reference weight
+	calibrationHistory     = 20     // how many calibrations we return in the output
+)
+
+// calibration holds the active calibration of the tap scale and the running calibration workflow
+type calibration struct {
+	active  store.Calibration // zero ID when the scale has never been calibrated
+	session *calibrationSession
+
+	lastRaw   float64 // last raw reading from the scale
+	lastRawAt time.Time
+}
+
+// calibrationSession captures points of the calibration workflow
+// measurements do not change the keg state while the session is running
+type calibrationSession struct {
+	startedAt time.Time
+
+	tareSet    bool
+	tareRaw    float64
+	tareWeight float64
+
+	referenceSet    bool
+	referenceRaw    float64
+	referenceWeight float64
+}
+
+type CalibrationOutput struct {
+	Tap         string              `json:"tap"`
+	Calibrating bool                `json:"calibrating"`
+	LastRaw     float64             `json:"last_raw"`
+	LastRawAt   time.Time           `json:"last_raw_at"`
+	Active      *store.Calibration  `json:"active"` // nil when the scale has never been calibrated
+	Tare        *CalibrationPoint   `json:"tare"`   // captured tare point of the running calibration
+	Reference   *CalibrationPoint   `json:"reference"`
+	History     []store.Calibration `json:"history"`
+}
+
+type CalibrationPoint struct {
+	Raw    float64 `json:"raw"`
+	Weight float64 `json:"weight"` // known weight in grams
+}
+
+// apply converts the raw reading to grams
+func (c *calibration) apply(raw float64) float64 {
+	if c.active.ID == 0 {
+		return raw
+	}
+
+	return raw*c.active.Gain + c.active.Offset
+}
+
+// loadCalibration loads the last calibration of the tap from the store
+func (s *Scale) loadCalibration(t *tap) {
+	calibrations, err := s.store.GetCalibrations(t.id, 1)
+	if err != nil {
+		s.logger.Errorf("Could not load calibration of tap %s: %v", t.id, err)
+		return
+	}
+
+	if len(calibrations) > 0 {
+		t.calibration.active = calibrations[0]
+	}
+}
+
+// StartCalibration starts the calibration workflow of the tap scale
+// the keg state is frozen until the calibration is finished or canceled
+func (s *Scale) StartCalibration(tapID string) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	t, err := s.existingTap(tapID)
+	if err != nil {
+		return err
+	}
+
+	t.calibration.session = &calibrationSession{startedAt: s.clock.Now()}
+	s.logger.Infof("Calibration of tap %s started", t.id)
+
+	return nil
+}
+
+// CaptureCalibrationTare captures the last raw reading as the tare point
+// the known weight is the given weight, the empty weight of the keg from the catalog, or zero for an empty scale
+func (s *Scale) CaptureCalibrationTare(tapID string, keg int, weight float64) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	t, err := s.calibratingTap(tapID)
+	if err != nil {
+		return err
+	}
+
+	raw, ok := t.calibration.lastReading()
+	if !ok {
+		return fmt.Errorf("no measurement from tap %s since the calibration started", t.id)
+	}
+
+	if weight < 0 {
+		return fmt.Errorf("invalid tare weight: %.0f", weight)
+	}
+
+	if weight == 0 && keg > 0 {
+		empty, found := s.catalog.EmptyWeights()[keg]
+		if !found {
+			return fmt.Errorf("unknown keg type: %d", keg)
+		}
+		weight = empty
+	}
+
+	session := t.calibration.session
+	session.tareSet = true
+	session.tareRaw = raw
+	session.tareWeight = weight
+	s.logger.Infof("Calibration of tap %s: tare %.0f captured as %.0f g", t.id, session.tareRaw, weight)
+
+	return nil
+}
+
+// CaptureCalibrationReference captures the last raw reading as the reference point with the known weight
+func (s *Scale) CaptureCalibrationReference(tapID string, weight float64) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	t, err := s.calibratingTap(tapID)
+	if err != nil {
+		return err
+	}
+
+	raw, ok := t.calibration.lastReading()
+	if !ok {
+		return fmt.Errorf("no measurement from tap %s since the calibration started", t.id)
+	}
+
+	if weight <= 0 {
+		return fmt.Errorf("invalid reference weight: %.0f", weight)
+	}
+
+	session := t.calibration.session
+	session.referenceSet = true
+	session.referenceRaw = raw
+	session.referenceWeight = weight
+	s.logger.Infof("Calibration of tap %s: reference %.0f captured as %.0f g", t.id, session.referenceRaw, weight)
+
+	return nil
+}
+
+// FinishCalibration computes offset and gain from the captured points, stores and applies them
+func (s *Scale) FinishCalibration(tapID string) (store.Calibration, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	t, err := s.calibratingTap(tapID)
+	if err != nil {
+		return store.Calibration{}, err
+	}
+
+	session := t.calibration.session
+	if !session.tareSet || !session.referenceSet {
+		return store.Calibration{}, fmt.Errorf("both tare and reference weight must be captured")
+	}
+
+	if math.Abs(session.referenceWeight-session.tareWeight) < calibrationMinDistance ||
+		math.Abs(session.referenceRaw-session.tareRaw) < calibrationMinDistance {
+		return store.Calibration{}, fmt.Errorf("tare and reference weight are too close")
+	}
+
+	gain := (session.referenceWeight - session.tareWeight) / (session.referenceRaw - session.tareRaw)
+	if gain < calibrationMinGain || gain > calibrationMaxGain {
+		return store.Calibration{}, fmt.Errorf("calibration gain %.3f is out of range", gain)
+	}
+
+	c := store.Calibration{
+		Tap:             t.id,
+		Offset:          session.tareWeight - gain*session.tareRaw,
+		Gain:            gain,
+		TareRaw:         session.tareRaw,
+		TareWeight:      session.tareWeight,
+		ReferenceRaw:    session.referenceRaw,
+		ReferenceWeight: session.referenceWeight,
+		CreatedAt:       s.clock.Now(),
+	}
+
+	id, err := s.store.AddCalibration(c)
+	if err != nil {
+		return store.Calibration{}, fmt.Errorf("could not store calibration: %w", err)
+	}
+	c.ID = id
+
+	t.calibration.active = c
+	t.calibration.session = nil
+	t.filter = weightFilter{} // old readings are not comparable with the new calibration
+	s.logger.Infof("Calibration of tap %s finished with offset %.0f and gain %.4f", t.id, c.Offset, c.Gain)
+
+	return c, nil
+}
+
+// CancelCalibration stops the calibration workflow and keeps the active calibration
+func (s *Scale) CancelCalibration(tapID string) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	t, err := s.calibratingTap(tapID)
+	if err != nil {
+		return err
+	}
+
+	t.calibration.session = nil
+	s.logger.Infof("Calibration of tap %s canceled", t.id)
+
+	return nil
+}
+
+// calibratingTap returns the tap with a running calibration
+func (s *Scale) calibratingTap(tapID string) (*tap, error) {
+	t, err := s.existingTap(tapID)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.calibration.session == nil {
+		return nil, fmt.Errorf("calibration of tap %s is not running", t.id)
+	}
+
+	return t, nil
+}
+
+// lastReading returns the last raw reading captured during the running calibration
+func (c *calibration) lastReading() (float64, bool) {
+	if c.session == nil || c.lastRawAt.Before(c.session.startedAt) {
+		return 0, false
+	}
+
+	return c.lastRaw, true
+}
+
+// GetCalibration returns the calibration state of the tap with its history
+func (s *Scale) GetCalibration(tapID string) (CalibrationOutput, error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	t, err := s.existingTap(tapID)
+	if err != nil {
+		return CalibrationOutput{}, err
+	}
+
+	history, err := s.store.GetCalibrations(t.id, calibrationHistory)
+	if err != nil {
+		return CalibrationOutput{}, fmt.Errorf("could not get calibrations: %w", err)
+	}
+
+	output := CalibrationOutput{
+		Tap:         t.id,
+		Calibrating: t.calibration.session != nil,
+		LastRaw:     t.calibration.lastRaw,
+		LastRawAt:   t.calibration.lastRawAt,
+		History:     history,
+	}
+
+	if t.calibration.active.ID > 0 {
+		active := t.calibration.active
+		output.Active = &active
+	}
+
+	if session := t.calibration.session; session != nil {
+		if session.tareSet {
+			output.Tare = &CalibrationPoint{Raw: session.tareRaw, Weight: session.tareWeight}
+		}
+		if session.referenceSet {
+			output.Reference = &CalibrationPoint{Raw: session.referenceRaw, Weight: session.referenceWeight}
+		}
+	}
+
+	return output, nil
+}
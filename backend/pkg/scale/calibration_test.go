@@ -0,0 +1,88 @@
+package scale
+
+import (
+	"testing"
+
+	"github.com/kotrzina/keg-scale/pkg/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScale_Calibration(t *testing.T) {
+	s := createScaleWithMeasurements(t, 40, 40)
+	tp := s.taps[store.DefaultTap]
+	require.Equal(t, 30, tp.activeKeg)
+
+	// nothing to capture before the calibration starts
+	require.Error(t, s.CaptureCalibrationTare(store.DefaultTap, 0, 0))
+	require.NoError(t, s.StartCalibration(store.DefaultTap))
+	require.Error(t, s.CaptureCalibrationTare(store.DefaultTap, 0, 0), "no measurement since start")
+
+	// empty 50l keg reads 14500 instead of 13500
+	require.NoError(t, s.AddMeasurement(store.DefaultTap, 14500))
+	require.NoError(t, s.CaptureCalibrationTare(store.DefaultTap, 50, 0))
+	_, err := s.FinishCalibration(store.DefaultTap)
+	require.Error(t, err, "reference is missing")
+
+	// 13500 + 20000 reference reads 35000
+	require.NoError(t, s.AddMeasurement(store.DefaultTap, 35000))
+	require.NoError(t, s.CaptureCalibrationReference(store.DefaultTap, 33500))
+
+	// the keg state is frozen during the calibration
+	assert.Equal(t, 30, tp.activeKeg)
+	assert.InEpsilon(t, 40000.0, tp.weight, 0.000001)
+	assert.True(t, s.GetScale().Taps[0].Calibrating)
+
+	c, err := s.FinishCalibration(store.DefaultTap)
+	require.NoError(t, err)
+	assert.InEpsilon(t, 20000.0/20500.0, c.Gain, 0.000001)
+	assert.InEpsilon(t, 13500.0-14500.0*c.Gain, c.Offset, 0.000001)
+
+	// measurements are corrected now
+	require.NoError(t, s.AddMeasurement(store.DefaultTap, 35000))
+	assert.InEpsilon(t, 33500.0, tp.weight, 0.000001)
+	assert.Equal(t, 30, tp.activeKeg)
+
+	output, err := s.GetCalibration(store.DefaultTap)
+	require.NoError(t, err)
+	assert.False(t, output.Calibrating)
+	require.NotNil(t, output.Active)
+	assert.Equal(t, c.ID, output.Active.ID)
+	require.Len(t, output.History, 1)
+
+	// the calibration survives the restart
+	loaded := newTap(store.DefaultTap)
+	s.loadCalibration(loaded)
+	assert.Equal(t, c, loaded.calibration.active)
+}
+
+func TestScale_CalibrationInvalid(t *testing.T) {
+	s := createScaleWithMeasurements(t, 40)
+
+	_, err := s.GetCalibration("unknown")
+	require.Error(t, err)
+	require.Error(t, s.StartCalibration("unknown"))
+
+	require.NoError(t, s.StartCalibration(store.DefaultTap))
+	require.NoError(t, s.AddMeasurement(store.DefaultTap, 14000))
+	require.Error(t, s.CaptureCalibrationTare(store.DefaultTap, 42, 0), "unknown keg type")
+	require.NoError(t, s.CaptureCalibrationTare(store.DefaultTap, 0, 0))
+	require.Error(t, s.CaptureCalibrationReference(store.DefaultTap, 0))
+
+	// reference reading too close to the tare
+	require.NoError(t, s.AddMeasurement(store.DefaultTap, 14500))
+	require.NoError(t, s.CaptureCalibrationReference(store.DefaultTap, 20000))
+	_, err = s.FinishCalibration(store.DefaultTap)
+	require.Error(t, err)
+
+	// gain far from one means wrong points
+	require.NoError(t, s.AddMeasurement(store.DefaultTap, 24000))
+	require.NoError(t, s.CaptureCalibrationReference(store.DefaultTap, 40000))
+	_, err = s.FinishCalibration(store.DefaultTap)
+	require.Error(t, err)
+
+	// canceled calibration keeps the scale uncalibrated
+	require.NoError(t, s.CancelCalibration(store.DefaultTap))
+	require.NoError(t, s.AddMeasurement(store.DefaultTap, 39000))
+	assert.InEpsilon(t, 39000.0, s.taps[store.DefaultTap].weight, 0.000001)
+}
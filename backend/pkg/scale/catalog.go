@@ -0,0 +1,124 @@
+package scale
+
+import (
+	"fmt"
+
+	"github.com/kotrzina/keg-scale/pkg/store"
+)
+
+// loadKegCatalog loads the keg catalog from the store
+// an empty catalog is seeded with default keg types
+func (s *Scale) loadKegCatalog() {
+	types, err := s.store.GetKegTypes()
+	if err != nil {
+		s.logger.Errorf("Could not load keg catalog, using default keg types: %v", err)
+		return
+	}
+
+	if len(types) == 0 {
+		types = DefaultKegTypes()
+		for _, kt := range types {
+			if err := s.store.SetKegType(kt); err != nil {
+				s.logger.Errorf("Could not seed keg catalog with %dl keg: %v", kt.Size, err)
+			}
+		}
+	}
+
+	s.catalog = NewKegCatalog(types)
+}
+
+// GetKegTypes returns all keg types from the catalog ordered by size
+func (s *Scale) GetKegTypes() []store.KegType {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	return s.catalog.Types()
+}
+
+// HasKegType returns true if the keg size is in the catalog
+func (s *Scale) HasKegType(keg int) bool {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	return s.catalog.Has(keg)
+}
+
+// SetKegType adds a new keg type to the catalog or updates the existing one
+func (s *Scale) SetKegType(kt store.KegType) error {
+	if kt.Size <= 0 {
+		return fmt.Errorf("invalid keg size: %d", kt.Size)
+	}
+
+	if kt.EmptyWeight <= 0 {
+		return fmt.Errorf("invalid empty weight: %.0f", kt.EmptyWeight)
+	}
+
+	if kt.ServingSize < 0 || kt.ServingSize > float64(kt.Size) {
+		return fmt.Errorf("invalid serving size: %.2f", kt.ServingSize)
+	}
+
+	for _, serving := range kt.Servings {
+		if serving <= 0 || serving > float64(kt.Size) {
+			return fmt.Errorf("invalid serving: %.2f", serving)
+		}
+	}
+
+	if kt.Yield < 0 || kt.Yield > 1 {
+		return fmt.Errorf("invalid yield: %.2f", kt.Yield)
+	}
+
+	if kt.Density < 0 || kt.Density > 2 {
+		return fmt.Errorf("invalid density: %.3f", kt.Density)
+	}
+
+	if kt.Deposit.IsNegative() {
+		return fmt.Errorf("invalid deposit: %s", kt.Deposit)
+	}
+
+	if kt.Label == "" {
+		kt.Label = fmt.Sprintf("%dl", kt.Size)
+	}
+	kt = WithKegDefaults(kt)
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if err := s.store.SetKegType(kt); err != nil {
+		return fmt.Errorf("could not store keg type: %w", err)
+	}
+
+	s.catalog[kt.Size] = kt
+	s.logger.Infof("Keg type %dl stored in the catalog with empty weight %.0f", kt.Size, kt.EmptyWeight)
+
+	return nil
+}
+
+// DeleteKegType removes a keg type from the catalog
+// keg types in use (active keg or warehouse) cannot be removed
+func (s *Scale) DeleteKegType(keg int) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if !s.catalog.Has(keg) {
+		return fmt.Errorf("unknown keg type: %d", keg)
+	}
+
+	for _, t := range s.taps {
+		if t.activeKeg == keg {
+			return fmt.Errorf("keg type %d is currently tapped on %s", keg, t.id)
+		}
+	}
+
+	if s.warehouse[keg] > 0 {
+		return fmt.Errorf("keg type %d is in the warehouse", keg)
+	}
+
+	if err := s.store.DeleteKegType(keg); err != nil {
+		return fmt.Errorf("could not delete keg type: %w", err)
+	}
+
+	delete(s.catalog, keg)
+	s.logger.Infof("Keg type %dl deleted from the catalog", keg)
+
+	return nil
+}
@@ -0,0 +1,40 @@
+package scale
+
+import (
+	"testing"
+
+	"github.com/kotrzina/keg-scale/pkg/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScale_KegCatalog(t *testing.T) {
+	s := createScaleWithMeasurements(t)
+	assert.Len(t, s.GetKegTypes(), 5, "empty catalog should be seeded with default kegs")
+
+	require.Error(t, s.IncreaseWarehouse(25, WarehouseActor{}))
+	require.Error(t, s.SetKegType(store.KegType{Size: 25}))
+
+	require.Error(t, s.SetKegType(store.KegType{Size: 25, EmptyWeight: 8500, Yield: 1.2}))
+	require.Error(t, s.SetKegType(store.KegType{Size: 25, EmptyWeight: 8500, ServingSize: 30}))
+	require.Error(t, s.SetKegType(store.KegType{Size: 25, EmptyWeight: 8500, Servings: []float64{0.5, -0.3}}))
+	require.Error(t, s.SetKegType(store.KegType{Size: 25, EmptyWeight: 8500, Density: 3}))
+
+	require.NoError(t, s.SetKegType(store.KegType{Size: 25, EmptyWeight: 8500, Supplier: "maneo"}))
+	assert.True(t, s.HasKegType(25))
+	assert.Equal(t, "25l", s.GetKegTypes()[3].Label)
+	assert.InEpsilon(t, DefaultServingSize, s.GetKegTypes()[3].ServingSize, 0.000001, "unset values get defaults")
+
+	require.NoError(t, s.IncreaseWarehouse(25, WarehouseActor{}))
+	assert.Equal(t, 1, s.GetScale().Warehouse[3].Amount)
+	require.Error(t, s.DeleteKegType(25), "keg type in the warehouse cannot be deleted")
+
+	require.NoError(t, s.DecreaseWarehouse(25, WarehouseActor{}))
+	require.NoError(t, s.DeleteKegType(25))
+	assert.False(t, s.HasKegType(25))
+
+	// a full 25l keg is not recognized anymore
+	require.NoError(t, s.AddMeasurement(store.DefaultTap, 33500))
+	require.NoError(t, s.AddMeasurement(store.DefaultTap, 33500))
+	assert.Equal(t, 0, s.GetScale().ActiveKeg)
+}
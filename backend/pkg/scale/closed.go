@@ -0,0 +1,105 @@
+package scale
+
+import (
+	"time"
+)
+
+// closedWatch compares the weight when the pub closed with the weight when it opens again
+// nobody should pour while the pub is closed, so a lost weight is a theft or a leaking line
+// the scale is silent while the pub is closed, its ping opens the pub and the weight follows right after the boot
+// only this first reading shows the closed time, the later ones may be pours already
+
+const (
+	KegLossDrop = "drop" // beer disappeared quickly - someone is pouring without the pub being open
+	KegLossLeak = "leak" // beer disappears slowly - the line is leaking
+
+	closedLossMin       = 400.0            // grams - smaller losses are a drift of the sensor or a noise
+	closedLeakMaxRate   = 100.0            // grams per hour - a dripping line loses less than a beer in five hours
+	closedOpeningWindow = 30 * time.Second // the scale sends its weight within seconds after the opening ping
+)
+
+type closedWatch struct {
+	weight   float64   // weight when the pub closed, zero when the watch is not running
+	keg      int       // active keg when the pub closed
+	at       time.Time // when the pub closed
+	openedAt time.Time // when the scale pinged again, zero while it is silent
+}
+
+type KegLoss struct {
+	Kind  string    `json:"kind"`
+	Grams float64   `json:"grams"`
+	Beers float64   `json:"beers"`
+	Since time.Time `json:"since"` // the keg was untouched until this time
+	Rate  float64   `json:"rate"`  // grams per hour, the average over the closed time
+}
+
+// startClosedWatch remembers the weights of all taps with a keg when the pub closes
+func (s *Scale) startClosedWatch() {
+	for _, t := range s.taps {
+		t.closed = closedWatch{}
+		if t.activeKeg > 0 && t.weight > 0 {
+			t.closed = closedWatch{
+				weight: t.weight,
+				keg:    t.activeKeg,
+				at:     s.pub.closedAt,
+			}
+		}
+	}
+}
+
+// observeClosedPing notes the first ping of the tap scale since the pub closed
+func (s *Scale) observeClosedPing(t *tap) {
+	if t.closed.weight > 0 && t.closed.openedAt.IsZero() {
+		t.closed.openedAt = s.clock.Now()
+	}
+}
+
+// watchClosed compares the first raw reading after the opening ping with the weight when the pub closed
+// the watch ends with this reading
+func (s *Scale) watchClosed(t *tap, weight float64) {
+	w := t.closed
+	if w.weight == 0 || w.openedAt.IsZero() {
+		return
+	}
+	t.closed = closedWatch{}
+
+	low, high := s.catalog.WeightRange()
+	switch {
+	case t.activeKeg != w.keg || weight < low || weight > high:
+		return // the keg was replaced or removed, the weights are not comparable
+	case s.clock.Since(w.openedAt) > closedOpeningWindow:
+		return // the scale did not reboot, the reading is a change after the opening
+	}
+
+	loss := w.weight - weight
+	if loss >= closedLossMin {
+		s.reportKegLoss(t, w, loss)
+		return
+	}
+
+	// losses are reported above, smaller changes of an untouched keg are the drift of the sensor
+	s.checkDrift(t, -loss)
+}
+
+func (s *Scale) reportKegLoss(t *tap, w closedWatch, loss float64) {
+	elapsed := max(s.clock.Since(w.at), time.Minute)
+	rate := loss / elapsed.Hours()
+
+	kind := KegLossLeak
+	if rate >= closedLeakMaxRate {
+		kind = KegLossDrop
+	}
+
+	s.logger.Warnf("Tap %s lost %.0f g while the pub was closed (%s, %.0f g/h)", t.id, loss, kind, rate)
+	s.monitor.KegLosses.WithLabelValues(t.id, kind).Inc()
+
+	payload := s.newTapEvent(EventKegLoss, t, EventReasonScale)
+	payload.Loss = &KegLoss{
+		Kind:  kind,
+		Grams: loss,
+		Beers: loss / s.catalog.GramsPerBeer(w.keg),
+		Since: w.at,
+		Rate:  rate,
+	}
+	s.dispatchEvent(payload)
+}
@@ -0,0 +1,106 @@
+package scale
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kotrzina/keg-scale/pkg/clock"
+	"github.com/kotrzina/keg-scale/pkg/store"
+	"github.com/kotrzina/keg-scale/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func lastKegLoss(t *testing.T, s *Scale) *KegLoss {
+	t.Helper()
+
+	s.WaitEvents()
+	events, err := s.GetEvents(store.EventFilter{Types: []string{string(EventKegLoss)}})
+	require.NoError(t, err)
+	if len(events.Events) == 0 {
+		return nil
+	}
+
+	return events.Events[0].Loss
+}
+
+// pushMeasurements sends the weights like the scale does - every message pings first
+func pushMeasurements(t *testing.T, s *Scale, weights ...float64) {
+	t.Helper()
+	for _, w := range weights {
+		require.NoError(t, s.Ping(store.DefaultTap))
+		require.NoError(t, s.AddMeasurement(store.DefaultTap, w))
+	}
+}
+
+// createClosedScale creates a scale with a 30l keg, the scale goes silent and the pub closes
+func createClosedScale(t *testing.T) (*Scale, *clock.Fake) {
+	t.Helper()
+	clk := clock.NewFake(time.Date(2025, 3, 14, 22, 0, 0, 0, utils.GetTz()))
+	s := createScaleWithClock(t, clk)
+	pushMeasurements(t, s, 40000, 40000)
+	require.Equal(t, 30, s.taps[store.DefaultTap].activeKeg)
+
+	clk.Advance(s.okLimit() + time.Minute)
+	s.Recheck()
+	require.False(t, s.pub.isOpen)
+
+	return s, clk
+}
+
+func TestScale_KegLossDrop(t *testing.T) {
+	s, clk := createClosedScale(t)
+	closedAt := s.pub.closedAt
+
+	// eight beers were poured overnight, the scale boots in the morning
+	clk.Advance(10 * time.Hour)
+	pushMeasurements(t, s, 36000)
+
+	loss := lastKegLoss(t, s)
+	require.NotNil(t, loss)
+	assert.Equal(t, KegLossDrop, loss.Kind)
+	assert.InDelta(t, 4000, loss.Grams, 0.1)
+	assert.InDelta(t, 8, loss.Beers, 0.01)
+	assert.True(t, closedAt.Equal(loss.Since))
+
+	// reported only once, the pub is open now
+	pushMeasurements(t, s, 35500, 35000)
+	assert.Equal(t, 1, countEvents(t, s, EventKegLoss)[EventKegLoss])
+}
+
+func TestScale_KegLossLeak(t *testing.T) {
+	s, clk := createClosedScale(t)
+
+	// the keg lost three beers during the weekend
+	clk.Advance(60 * time.Hour)
+	pushMeasurements(t, s, 38500)
+
+	loss := lastKegLoss(t, s)
+	require.NotNil(t, loss)
+	assert.Equal(t, KegLossLeak, loss.Kind)
+	assert.InDelta(t, 1500.0/61, loss.Rate, 1)
+	assert.Empty(t, s.GetScale().Health.Issues, "the loss is not a drift")
+}
+
+func TestScale_KegLossIgnored(t *testing.T) {
+	// pouring right after the opening
+	s, clk := createClosedScale(t)
+	clk.Advance(10 * time.Hour)
+	pushMeasurements(t, s, 40000, 39500, 39000, 38500, 38000)
+	assert.Nil(t, lastKegLoss(t, s))
+
+	// the scale did not reboot, it sends the weight only when somebody pours
+	s, clk = createClosedScale(t)
+	clk.Advance(10 * time.Hour)
+	require.NoError(t, s.Ping(store.DefaultTap))
+	clk.Advance(5 * time.Minute)
+	pushMeasurements(t, s, 39000)
+	assert.Nil(t, lastKegLoss(t, s))
+
+	// the keg was replaced while closed
+	s, clk = createClosedScale(t)
+	clk.Advance(10 * time.Hour)
+	require.NoError(t, s.SetActiveKeg(store.DefaultTap, 50))
+	pushMeasurements(t, s, 38000)
+	assert.Nil(t, lastKegLoss(t, s))
+}
@@ -0,0 +1,174 @@
+package scale
+
+import (
+	"math"
+	"time"
+
+	"github.com/hako/durafmt"
+	"github.com/kotrzina/keg-scale/pkg/store"
+	"github.com/kotrzina/keg-scale/pkg/utils"
+)
+
+const (
+	rateHalfLife        = 15 * time.Minute // how fast the session rate forgets older measurements
+	rateMinInterval     = time.Minute      // measurements closer to each other are skipped
+	rateMinBeersPerHour = 0.5              // slower sessions fall back to the history
+
+	historyWeeks   = 8         // how many weeks of rollups we use for the weekday/hour averages
+	historyRefresh = time.Hour // how often we recalculate the averages
+	etaHorizon     = 60 * 24 * time.Hour
+
+	ConsumptionSourceSession = "session"
+	ConsumptionSourceHistory = "history"
+)
+
+// consumption is a smoothed consumption rate of the tap in the current pub session
+type consumption struct {
+	keg        int
+	rate       float64 // beers per hour
+	ready      bool    // rate has at least one value
+	lastAt     time.Time
+	lastWeight float64
+}
+
+// consumptionHistory holds average consumption per weekday and hour in the local timezone
+type consumptionHistory struct {
+	rates     [7][24]float64 // beers per hour - weekday => hour => rate
+	updatedAt time.Time
+}
+
+type ConsumptionOutput struct {
+	SessionRate    float64    `json:"session_rate"`    // smoothed beers per hour in the current session
+	HistoricalRate float64    `json:"historical_rate"` // average beers per hour for the current weekday and hour
+	EmptyAt        *time.Time `json:"empty_at"`        // nil when we can't tell
+	EmptyIn        string     `json:"empty_in"`
+	Source         string     `json:"source"` // session or history, empty when we can't tell
+}
+
+// updateConsumption updates the session consumption rate of the tap with its last measurement
+// the rate is an exponentially weighted average of the beers poured between measurements
+func (s *Scale) updateConsumption(t *tap) {
+	c := &t.consumption
+
+	// new keg or new session - start from scratch
+	if t.activeKeg == 0 || c.keg != t.activeKeg || c.lastAt.Before(s.pub.openedAt) {
+		t.consumption = consumption{
+			keg:        t.activeKeg,
+			lastAt:     t.weightAt,
+			lastWeight: t.weight,
+		}
+		return
+	}
+
+	dt := t.weightAt.Sub(c.lastAt)
+	if dt < rateMinInterval {
+		return
+	}
+
+	beers := math.Max(0, (c.lastWeight-t.weight)/s.catalog.GramsPerBeer(t.activeKeg)) // the keg only gets lighter
+	rate := beers / dt.Hours()
+	if c.ready {
+		alpha := 1 - math.Exp(-math.Ln2*dt.Seconds()/rateHalfLife.Seconds())
+		rate = alpha*rate + (1-alpha)*c.rate
+	}
+
+	c.rate = rate
+	c.ready = true
+	c.lastAt = t.weightAt
+	c.lastWeight = t.weight
+}
+
+// refreshConsumptionHistory recalculates weekday/hour averages of the tap from hourly rollups
+// the consumption of every hour is divided by the number of weeks, so closed pub counts as zero
+func (s *Scale) refreshConsumptionHistory(t *tap, now time.Time) {
+	if now.Sub(t.history.updatedAt) < historyRefresh {
+		return
+	}
+	t.history.updatedAt = now
+
+	from := now.Add(-historyWeeks * 7 * 24 * time.Hour)
+	rollups, err := s.store.GetMeasurementRollups(t.id, store.MeasurementResolution1h, from, now)
+	if err != nil {
+		s.logger.Errorf("Could not load consumption history of tap %s: %v", t.id, err)
+		return
+	}
+
+	if len(rollups) < 2 {
+		t.history.rates = [7][24]float64{}
+		return
+	}
+
+	weeks := math.Ceil(now.Sub(rollups[0].Bucket).Hours() / (7 * 24))
+	weeks = math.Max(1, math.Min(historyWeeks, weeks))
+
+	var sums [7][24]float64
+	for i := 1; i < len(rollups); i++ {
+		prev, cur := rollups[i-1], rollups[i]
+		if cur.Bucket.Sub(prev.Bucket) != time.Hour || cur.ActiveKeg == 0 || prev.ActiveKeg != cur.ActiveKeg {
+			continue // gap or rekeg
+		}
+
+		local := cur.Bucket.In(utils.GetTz())
+		sums[local.Weekday()][local.Hour()] += float64(max(0, prev.BeersLeft-cur.BeersLeft))
+	}
+
+	for d := range sums {
+		for h := range sums[d] {
+			t.history.rates[d][h] = sums[d][h] / weeks
+		}
+	}
+}
+
+// historicalRate returns the average consumption of the tap at the given time
+func (t *tap) historicalRate(at time.Time) float64 {
+	local := at.In(utils.GetTz())
+	return t.history.rates[local.Weekday()][local.Hour()]
+}
+
+// estimateEmpty estimates when the active keg of the tap is going to be empty
+// the session rate is used while the pub is open, otherwise we walk through the history hour by hour
+func (s *Scale) estimateEmpty(t *tap, now time.Time) (time.Time, string, bool) {
+	if t.activeKeg == 0 || t.beersLeft <= 0 {
+		return time.Time{}, "", false
+	}
+
+	left := float64(t.beersLeft)
+
+	if s.pub.isOpen && t.consumption.ready && t.consumption.rate >= rateMinBeersPerHour {
+		d := time.Duration(left / t.consumption.rate * float64(time.Hour))
+		return now.Add(d), ConsumptionSourceSession, true
+	}
+
+	at := now
+	for at.Before(now.Add(etaHorizon)) {
+		next := at.Truncate(time.Hour).Add(time.Hour)
+		beers := t.historicalRate(at) * next.Sub(at).Hours()
+		if beers >= left {
+			d := time.Duration(left / beers * float64(next.Sub(at)))
+			return at.Add(d), ConsumptionSourceHistory, true
+		}
+		left -= beers
+		at = next
+	}
+
+	return time.Time{}, "", false
+}
+
+func (s *Scale) getConsumptionOutput(t *tap) ConsumptionOutput {
+	now := s.clock.Now()
+	output := ConsumptionOutput{
+		HistoricalRate: t.historicalRate(now),
+	}
+
+	if s.pub.isOpen && t.consumption.ready {
+		output.SessionRate = t.consumption.rate
+	}
+
+	if emptyAt, source, ok := s.estimateEmpty(t, now); ok {
+		output.EmptyAt = &emptyAt
+		output.EmptyIn = durafmt.Parse(emptyAt.Sub(now).Round(time.Minute)).LimitFirstN(2).Format(s.fmtUnits)
+		output.Source = source
+	}
+
+	return output
+}
@@ -0,0 +1,99 @@
+package scale
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kotrzina/keg-scale/pkg/store"
+	"github.com/kotrzina/keg-scale/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScale_updateConsumption(t *testing.T) {
+	s := createScaleWithMeasurements(t)
+	s.pub.isOpen = true
+	s.pub.openedAt = time.Now().Add(-2 * time.Hour)
+
+	tp := s.taps[store.DefaultTap]
+	tp.activeKeg = 50
+	tp.beersLeft = 60
+
+	// 6 beers per hour - one beer every 10 minutes
+	start := time.Now().Add(-time.Hour)
+	for i := 0; i <= 6; i++ {
+		tp.weightAt = start.Add(time.Duration(i) * 10 * time.Minute)
+		tp.weight = 50000 - float64(i)*s.catalog.GramsPerBeer(tp.activeKeg)
+		s.updateConsumption(tp)
+	}
+
+	require.True(t, tp.consumption.ready)
+	assert.InEpsilon(t, 6.0, tp.consumption.rate, 0.000001)
+
+	emptyAt, source, ok := s.estimateEmpty(tp, time.Now())
+	require.True(t, ok)
+	assert.Equal(t, ConsumptionSourceSession, source)
+	assert.WithinDuration(t, time.Now().Add(10*time.Hour), emptyAt, time.Minute)
+
+	// nobody drinks - the rate goes down
+	tp.weightAt = tp.weightAt.Add(45 * time.Minute)
+	s.updateConsumption(tp)
+	assert.Less(t, tp.consumption.rate, 1.0)
+
+	// new keg starts from scratch
+	tp.activeKeg = 30
+	tp.weightAt = tp.weightAt.Add(time.Minute)
+	s.updateConsumption(tp)
+	assert.False(t, tp.consumption.ready)
+}
+
+func TestScale_estimateEmptyFromHistory(t *testing.T) {
+	s := createScaleWithMeasurements(t)
+	s.pub.isOpen = false
+
+	tp := s.taps[store.DefaultTap]
+	tp.activeKeg = 30
+	tp.beersLeft = 30
+
+	// 10 beers per hour on Friday evening
+	for h := 18; h < 24; h++ {
+		tp.history.rates[time.Friday][h] = 10
+	}
+
+	// Wednesday noon
+	now := time.Date(2025, 3, 12, 12, 0, 0, 0, utils.GetTz())
+	emptyAt, source, ok := s.estimateEmpty(tp, now)
+	require.True(t, ok)
+	assert.Equal(t, ConsumptionSourceHistory, source)
+	assert.Equal(t, time.Date(2025, 3, 14, 21, 0, 0, 0, utils.GetTz()), emptyAt.In(utils.GetTz()))
+
+	// no history at all
+	tp.history = consumptionHistory{}
+	_, _, ok = s.estimateEmpty(tp, now)
+	assert.False(t, ok)
+}
+
+func TestScale_refreshConsumptionHistory(t *testing.T) {
+	fs := &store.FakeStore{}
+	s := createScaleWithMeasurements(t)
+	s.store = fs
+
+	now := time.Date(2025, 3, 15, 12, 0, 0, 0, utils.GetTz())
+	friday := time.Date(2025, 3, 14, 19, 30, 0, 0, utils.GetTz())
+	for i, beersLeft := range []int{60, 52, 45} {
+		require.NoError(t, fs.AddMeasurement(store.Measurement{
+			Tap:       store.DefaultTap,
+			At:        friday.Add(time.Duration(i) * time.Hour),
+			ActiveKeg: 30,
+			BeersLeft: beersLeft,
+		}))
+	}
+
+	tp := s.taps[store.DefaultTap]
+	tp.history.updatedAt = time.Time{}
+	s.refreshConsumptionHistory(tp, now)
+
+	assert.InEpsilon(t, 8.0, tp.history.rates[time.Friday][20], 0.000001)
+	assert.InEpsilon(t, 7.0, tp.history.rates[time.Friday][21], 0.000001)
+	assert.Zero(t, tp.history.rates[time.Friday][19])
+}
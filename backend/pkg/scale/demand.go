@@ -0,0 +1,154 @@
+package scale
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/kotrzina/keg-scale/pkg/store"
+)
+
+const (
+	demandHistory    = historyWeeks * 7 * 24 * time.Hour // how far back we look for the consumption
+	demandMinHistory = 7 * 24 * time.Hour                // shorter history is stretched, so a single evening is not a daily rate
+	demandKegsLimit  = 500
+	demandMaxDays    = 365
+)
+
+// DemandItem is a beer drunk in the history - keg size, brand and its share of the poured volume
+type DemandItem struct {
+	Size     int     `json:"size"`
+	Brand    string  `json:"brand"`
+	Style    string  `json:"style"`
+	Supplier string  `json:"supplier"` // supplier of the last purchase
+	Liters   float64 `json:"liters"`   // poured in the history
+	Share    float64 `json:"share"`    // share of the poured volume
+}
+
+type DemandOutput struct {
+	Days          int          `json:"days"`
+	HistoryFrom   time.Time    `json:"history_from"`
+	HistoryDays   float64      `json:"history_days"`
+	DailyLiters   float64      `json:"daily_liters"`
+	DemandLiters  float64      `json:"demand_liters"`  // expected consumption in the next days
+	StockLiters   float64      `json:"stock_liters"`   // left in the tapped kegs and in the warehouse
+	MissingLiters float64      `json:"missing_liters"` // demand not covered by the stock
+	Items         []DemandItem `json:"items"`          // the largest share first
+}
+
+type demandKey struct {
+	size         int
+	brand, style string
+}
+
+// GetDemand forecasts the consumption for the next days from the keg ledger and compares it with the stock
+// the daily rate is the volume poured in the last weeks divided by their length - closed days included
+func (s *Scale) GetDemand(days int) (DemandOutput, error) {
+	if days < 1 || days > demandMaxDays {
+		return DemandOutput{}, fmt.Errorf("days must be between 1 and %d", demandMaxDays)
+	}
+
+	kegs, err := s.store.GetKegs("", demandKegsLimit)
+	if err != nil {
+		return DemandOutput{}, fmt.Errorf("could not get keg history: %w", err)
+	}
+
+	stockKegs, err := s.store.GetStockKegs(false)
+	if err != nil {
+		return DemandOutput{}, fmt.Errorf("could not get warehouse inventory: %w", err)
+	}
+	stock := make(map[int64]store.StockKeg, len(stockKegs))
+	for _, keg := range stockKegs {
+		stock[keg.ID] = keg
+	}
+
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	now := s.clock.Now()
+	from := now.Add(-demandHistory)
+	start := now
+
+	total := 0.0
+	items := map[demandKey]*DemandItem{}
+	supplierAt := map[demandKey]time.Time{}
+	for _, record := range kegs {
+		_, liters, keg := s.kegRecordLiters(record)
+		end := now
+		if keg.EmptiedAt != nil {
+			end = *keg.EmptiedAt
+		}
+
+		if !end.After(from) {
+			continue
+		}
+
+		// only the part of the keg poured in the history counts
+		tappedAt := keg.TappedAt
+		if tappedAt.Before(from) {
+			liters *= end.Sub(from).Seconds() / end.Sub(tappedAt).Seconds()
+			tappedAt = from
+		}
+		if tappedAt.Before(start) {
+			start = tappedAt
+		}
+
+		key := demandKey{size: keg.Size}
+		purchase, found := stock[keg.StockID]
+		if found {
+			key.brand = purchase.Brand
+			key.style = purchase.Style
+		}
+
+		item, ok := items[key]
+		if !ok {
+			item = &DemandItem{Size: key.size, Brand: key.brand, Style: key.style}
+			items[key] = item
+		}
+		item.Liters += liters
+		total += liters
+
+		if found && purchase.Supplier != "" && purchase.PurchasedAt.After(supplierAt[key]) {
+			item.Supplier = purchase.Supplier
+			supplierAt[key] = purchase.PurchasedAt
+		}
+	}
+
+	history := max(now.Sub(start), demandMinHistory)
+	output := DemandOutput{
+		Days:        days,
+		HistoryFrom: now.Add(-history),
+		HistoryDays: history.Hours() / 24,
+		Items:       make([]DemandItem, 0, len(items)),
+	}
+	output.DailyLiters = total / output.HistoryDays
+	output.DemandLiters = output.DailyLiters * float64(days)
+
+	for _, t := range s.taps {
+		if t.activeKeg > 0 {
+			output.StockLiters += s.catalog.CalcLitersLeft(t.activeKeg, t.weight)
+		}
+	}
+	output.StockLiters += s.catalog.WarehouseLiters(s.warehouse)
+	output.MissingLiters = math.Max(0, output.DemandLiters-output.StockLiters)
+
+	for _, item := range items {
+		if total > 0 {
+			item.Share = item.Liters / total
+		}
+		output.Items = append(output.Items, *item)
+	}
+	sort.Slice(output.Items, func(i, j int) bool {
+		a, b := output.Items[i], output.Items[j]
+		if a.Liters != b.Liters {
+			return a.Liters > b.Liters
+		}
+		if a.Size != b.Size {
+			return a.Size > b.Size
+		}
+		return a.Brand+a.Style < b.Brand+b.Style
+	})
+
+	return output, nil
+}
@@ -0,0 +1,99 @@
+package scale
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kotrzina/keg-scale/pkg/clock"
+	"github.com/kotrzina/keg-scale/pkg/store"
+	"github.com/kotrzina/keg-scale/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScale_GetDemand(t *testing.T) {
+	clk := clock.NewFake(time.Date(2025, 3, 14, 20, 0, 0, 0, utils.GetTz()))
+	s := createScaleWithClock(t, clk)
+	s.stock = nil
+	s.warehouse = map[int]int{}
+
+	now := clk.Now()
+	daysAgo := func(days int) time.Time {
+		return now.Add(-time.Duration(days) * 24 * time.Hour)
+	}
+	addKeg := func(size int, stockID int64, tapped, emptied int, liters float64) {
+		t.Helper()
+		emptiedAt := daysAgo(emptied)
+		_, err := s.store.AddKeg(store.KegRecord{
+			Tap:          store.DefaultTap,
+			Size:         size,
+			TappedAt:     daysAgo(tapped),
+			EmptiedAt:    &emptiedAt,
+			LitersPoured: liters,
+			StockID:      stockID,
+		})
+		require.NoError(t, err)
+	}
+	addStock := func(size int, brand, supplier string, purchased int) int64 {
+		t.Helper()
+		id, err := s.store.AddStockKeg(store.StockKeg{Size: size, Brand: brand, Supplier: supplier, PurchasedAt: daysAgo(purchased)})
+		require.NoError(t, err)
+		return id
+	}
+
+	policka := addStock(50, "Policka", "baracek", 80)
+	policka2 := addStock(50, "Policka", "maneo", 35)
+	bernard := addStock(30, "Bernard", "maneo", 12)
+
+	addKeg(30, 0, 100, 90, 30)       // too old
+	addKeg(50, policka, 70, 50, 50)  // 6 of 20 days in the history - 15 l
+	addKeg(50, policka2, 30, 20, 45) // 45 l
+	addKeg(30, bernard, 10, 5, 30)   // 30 l
+	_, err := s.AddStockKeg(store.StockKeg{Size: 30}, WarehouseActor{})
+	require.NoError(t, err)
+
+	demand, err := s.GetDemand(28)
+	require.NoError(t, err)
+	assert.InEpsilon(t, 56.0, demand.HistoryDays, 0.000001)
+	assert.InEpsilon(t, 90.0/56, demand.DailyLiters, 0.000001)
+	assert.InEpsilon(t, 45.0, demand.DemandLiters, 0.000001)
+	assert.InEpsilon(t, 30.0, demand.StockLiters, 0.000001)
+	assert.InEpsilon(t, 15.0, demand.MissingLiters, 0.000001)
+
+	require.Len(t, demand.Items, 2)
+	assert.Equal(t, 50, demand.Items[0].Size)
+	assert.Equal(t, "Policka", demand.Items[0].Brand)
+	assert.Equal(t, "maneo", demand.Items[0].Supplier, "supplier of the last purchase")
+	assert.InEpsilon(t, 60.0, demand.Items[0].Liters, 0.000001)
+	assert.InEpsilon(t, 2.0/3, demand.Items[0].Share, 0.000001)
+	assert.Equal(t, "Bernard", demand.Items[1].Brand)
+
+	// enough beer in the warehouse
+	demand, err = s.GetDemand(7)
+	require.NoError(t, err)
+	assert.Zero(t, demand.MissingLiters)
+
+	_, err = s.GetDemand(0)
+	require.Error(t, err)
+}
+
+func TestScale_GetDemandShortHistory(t *testing.T) {
+	clk := clock.NewFake(time.Date(2025, 3, 14, 20, 0, 0, 0, utils.GetTz()))
+	s := createScaleWithClock(t, clk)
+
+	// nothing was drunk yet
+	demand, err := s.GetDemand(14)
+	require.NoError(t, err)
+	assert.Zero(t, demand.DemandLiters)
+	assert.Empty(t, demand.Items)
+
+	// a single evening is spread over a week
+	emptiedAt := clk.Now().Add(-time.Hour)
+	_, err = s.store.AddKeg(store.KegRecord{Size: 15, TappedAt: clk.Now().Add(-5 * time.Hour), EmptiedAt: &emptiedAt, LitersPoured: 14})
+	require.NoError(t, err)
+
+	demand, err = s.GetDemand(14)
+	require.NoError(t, err)
+	assert.InEpsilon(t, 7.0, demand.HistoryDays, 0.000001)
+	assert.InEpsilon(t, 28.0, demand.DemandLiters, 0.000001)
+}
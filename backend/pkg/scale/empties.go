@@ -0,0 +1,219 @@
+package scale
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/kotrzina/keg-scale/pkg/store"
+	"github.com/shopspring/decimal"
+)
+
+// SupplierDeposit sums the empty kegs which should go back to the supplier
+type SupplierDeposit struct {
+	Supplier string          `json:"supplier"` // empty when unknown
+	Kegs     int             `json:"kegs"`
+	Deposit  decimal.Decimal `json:"deposit"`
+}
+
+type DepositOutput struct {
+	Suppliers []SupplierDeposit `json:"suppliers"` // the largest deposit first
+	Kegs      int               `json:"kegs"`
+	Total     decimal.Decimal   `json:"total"`
+}
+
+// loadEmpties loads the empty kegs waiting for the return
+func (s *Scale) loadEmpties() {
+	kegs, err := s.store.GetEmptyKegs(true)
+	if err != nil {
+		s.logger.Errorf("Could not load empty kegs: %v", err)
+		return
+	}
+
+	s.empties = kegs
+}
+
+// addEmptyKeg moves the keg closed in the ledger to the empties waiting for the return
+// the supplier and the deposit come from the purchase, the keg type defaults are used when unknown
+// the keg is already off the tap, so the failure is only logged
+func (s *Scale) addEmptyKeg(record store.KegRecord) {
+	kt := s.catalog[record.Size]
+	keg := store.EmptyKeg{
+		Size:      record.Size,
+		StockID:   record.StockID,
+		KegID:     record.ID,
+		Tap:       record.Tap,
+		Supplier:  kt.Supplier,
+		Deposit:   kt.Deposit,
+		EmptiedAt: s.clock.Now(),
+		Refund:    decimal.Zero,
+	}
+
+	if purchase, found := s.findPurchase(record.StockID); found {
+		if purchase.Supplier != "" {
+			keg.Supplier = purchase.Supplier
+		}
+		if purchase.Deposit.IsPositive() {
+			keg.Deposit = purchase.Deposit
+		}
+	}
+
+	id, err := s.store.AddEmptyKeg(keg)
+	if err != nil {
+		s.logger.Errorf("Could not add empty keg %d (%d l): %v", record.ID, record.Size, err)
+		return
+	}
+	keg.ID = id
+
+	s.empties = append(s.empties, keg)
+	s.logger.Infof("Keg %d (%d l) waits for the return to %q with deposit %s", record.ID, record.Size, keg.Supplier, keg.Deposit)
+}
+
+// findPurchase returns the keg from the warehouse inventory including the kegs already tapped
+func (s *Scale) findPurchase(stockID int64) (store.StockKeg, bool) {
+	if stockID == 0 {
+		return store.StockKeg{}, false
+	}
+
+	kegs, err := s.store.GetStockKegs(false)
+	if err != nil {
+		s.logger.Errorf("Could not get warehouse inventory: %v", err)
+		return store.StockKeg{}, false
+	}
+
+	for _, keg := range kegs {
+		if keg.ID == stockID {
+			return keg, true
+		}
+	}
+
+	return store.StockKeg{}, false
+}
+
+// ReturnEmptyKeg records the return of the empty keg to the supplier
+// the oldest keg of the size is returned when id is zero, the supplier narrows the search when set
+// the refund is the deposit of the keg when nil
+func (s *Scale) ReturnEmptyKeg(id int64, size int, supplier string, refund *decimal.Decimal, note string) (store.EmptyKeg, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	kegs, err := s.returnEmptyKegs(func(keg store.EmptyKeg) bool {
+		if id > 0 {
+			return keg.ID == id
+		}
+		return keg.Size == size && (supplier == "" || keg.Supplier == supplier)
+	}, 1, refund, note)
+	if err != nil {
+		return store.EmptyKeg{}, err
+	}
+
+	return kegs[0], nil
+}
+
+// ReturnEmptyKegs records the return of the amount of the oldest empty kegs of the size at once
+// nothing is returned when there are not enough such kegs
+func (s *Scale) ReturnEmptyKegs(size int, supplier string, amount int, refund *decimal.Decimal, note string) ([]store.EmptyKeg, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.returnEmptyKegs(func(keg store.EmptyKeg) bool {
+		return keg.Size == size && (supplier == "" || keg.Supplier == supplier)
+	}, amount, refund, note)
+}
+
+func (s *Scale) returnEmptyKegs(match func(store.EmptyKeg) bool, amount int, refund *decimal.Decimal, note string) ([]store.EmptyKeg, error) {
+	if amount < 1 {
+		return nil, fmt.Errorf("amount must be positive")
+	}
+	if refund != nil && refund.IsNegative() {
+		return nil, fmt.Errorf("refund cannot be negative")
+	}
+
+	now := s.clock.Now()
+	kegs := make([]store.EmptyKeg, 0, amount)
+	for _, keg := range s.empties {
+		if len(kegs) == amount {
+			break
+		}
+		if !match(keg) {
+			continue
+		}
+
+		keg.ReturnedAt = &now
+		keg.Refund = keg.Deposit
+		if refund != nil {
+			keg.Refund = *refund
+		}
+		keg.Note = note
+		kegs = append(kegs, keg)
+	}
+	if len(kegs) == 0 {
+		return nil, fmt.Errorf("keg is not among the empty kegs")
+	}
+	if len(kegs) < amount {
+		return nil, fmt.Errorf("only %d such kegs are among the empty kegs", len(kegs))
+	}
+
+	if err := s.store.UpdateEmptyKegs(kegs); err != nil {
+		return nil, fmt.Errorf("could not update empty kegs: %w", err)
+	}
+
+	s.empties = slices.DeleteFunc(s.empties, func(keg store.EmptyKeg) bool {
+		return slices.ContainsFunc(kegs, func(returned store.EmptyKeg) bool { return returned.ID == keg.ID })
+	})
+	for _, keg := range kegs {
+		s.logger.Infof("Empty keg %d (%d l) returned to %q with refund %s", keg.ID, keg.Size, keg.Supplier, keg.Refund)
+	}
+
+	return kegs, nil
+}
+
+// GetEmptyKegs returns the empty kegs waiting for the return from the oldest
+func (s *Scale) GetEmptyKegs() []store.EmptyKeg {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	return slices.Clone(s.empties)
+}
+
+// GetDeposits returns the outstanding deposit of the empty kegs per supplier
+func (s *Scale) GetDeposits() DepositOutput {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	return s.getDeposits()
+}
+
+func (s *Scale) getDeposits() DepositOutput {
+	output := DepositOutput{
+		Suppliers: []SupplierDeposit{},
+		Total:     decimal.Zero,
+	}
+
+	suppliers := map[string]*SupplierDeposit{}
+	for _, keg := range s.empties {
+		deposit, found := suppliers[keg.Supplier]
+		if !found {
+			deposit = &SupplierDeposit{Supplier: keg.Supplier, Deposit: decimal.Zero}
+			suppliers[keg.Supplier] = deposit
+		}
+		deposit.Kegs++
+		deposit.Deposit = deposit.Deposit.Add(keg.Deposit)
+
+		output.Kegs++
+		output.Total = output.Total.Add(keg.Deposit)
+	}
+
+	for _, deposit := range suppliers {
+		output.Suppliers = append(output.Suppliers, *deposit)
+	}
+	sort.Slice(output.Suppliers, func(i, j int) bool {
+		a, b := output.Suppliers[i], output.Suppliers[j]
+		if !a.Deposit.Equal(b.Deposit) {
+			return a.Deposit.GreaterThan(b.Deposit)
+		}
+		return a.Supplier < b.Supplier
+	})
+
+	return output
+}
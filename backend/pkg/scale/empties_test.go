@@ -0,0 +1,153 @@
+package scale
+
+import (
+	"testing"
+
+	"github.com/kotrzina/keg-scale/pkg/store"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScale_EmptyKegs(t *testing.T) {
+	s := createScaleWithMeasurements(t, 63.5, 63.5)
+	s.stock = nil
+	require.Equal(t, 50, s.taps[store.DefaultTap].activeKeg)
+
+	kt := s.catalog[50]
+	kt.Supplier = "maneo"
+	kt.Deposit = decimal.NewFromInt(1500)
+	s.catalog[50] = kt
+
+	purchase, err := s.AddStockKeg(store.StockKeg{Size: 10, Supplier: "baracek", Deposit: decimal.NewFromInt(500)}, WarehouseActor{})
+	require.NoError(t, err)
+
+	// the 50l keg is drunk out, it waits for the return with the keg type deposit
+	addMeasurements(t, s, 30000, 13400)
+	require.Equal(t, 0, s.taps[store.DefaultTap].activeKeg)
+	empties := s.GetEmptyKegs()
+	require.Len(t, empties, 1)
+	assert.Equal(t, 50, empties[0].Size)
+	assert.Equal(t, "maneo", empties[0].Supplier)
+	assert.True(t, decimal.NewFromInt(1500).Equal(empties[0].Deposit))
+	assert.Positive(t, empties[0].KegID)
+
+	// more measurements of the empty scale do not add another keg
+	addMeasurements(t, s, -20, -20)
+	assert.Len(t, s.GetEmptyKegs(), 1)
+
+	// the 10l keg from the warehouse is tapped and emptied manually, the purchase deposit wins
+	addMeasurements(t, s, 16000, 16000)
+	require.Equal(t, 10, s.taps[store.DefaultTap].activeKeg)
+	require.NoError(t, s.SetActiveKeg(store.DefaultTap, 0))
+	empties = s.GetEmptyKegs()
+	require.Len(t, empties, 2)
+	assert.Equal(t, purchase.ID, empties[1].StockID)
+	assert.Equal(t, "baracek", empties[1].Supplier)
+	assert.True(t, decimal.NewFromInt(500).Equal(empties[1].Deposit))
+
+	deposits := s.GetDeposits()
+	assert.Equal(t, 2, deposits.Kegs)
+	assert.True(t, decimal.NewFromInt(2000).Equal(deposits.Total))
+	require.Len(t, deposits.Suppliers, 2)
+	assert.Equal(t, "maneo", deposits.Suppliers[0].Supplier, "the largest deposit first")
+	assert.Equal(t, 1, deposits.Suppliers[0].Kegs)
+	assert.True(t, decimal.NewFromInt(500).Equal(deposits.Suppliers[1].Deposit))
+	assert.True(t, decimal.NewFromInt(2000).Equal(s.GetScale().Deposits.Total))
+}
+
+func TestScale_EmptyKegsManualCorrection(t *testing.T) {
+	s := createScaleWithMeasurements(t, 63.5, 63.5)
+	require.Equal(t, 50, s.taps[store.DefaultTap].activeKeg)
+
+	// the keg was recognised wrong, the 50l keg is still full in the cellar
+	require.NoError(t, s.SetActiveKeg(store.DefaultTap, 30))
+	assert.Empty(t, s.GetEmptyKegs())
+
+	kegs, err := s.store.GetKegs(store.DefaultTap, 2)
+	require.NoError(t, err)
+	require.Len(t, kegs, 2)
+	assert.Equal(t, store.KegEndReasonManual, kegs[1].EndReason, "the ledger record is closed anyway")
+
+	// emptying the tap manually makes an empty
+	require.NoError(t, s.SetActiveKeg(store.DefaultTap, 0))
+	require.Len(t, s.GetEmptyKegs(), 1)
+	assert.Equal(t, 30, s.GetEmptyKegs()[0].Size)
+}
+
+func TestScale_ReturnEmptyKeg(t *testing.T) {
+	s := createScaleWithMeasurements(t)
+	for _, keg := range []store.EmptyKeg{
+		{Size: 50, Supplier: "maneo", Deposit: decimal.NewFromInt(1500)},
+		{Size: 30, Supplier: "maneo", Deposit: decimal.NewFromInt(1200)},
+		{Size: 30, Supplier: "baracek", Deposit: decimal.NewFromInt(1000)},
+	} {
+		keg.EmptiedAt = s.clock.Now()
+		id, err := s.store.AddEmptyKeg(keg)
+		require.NoError(t, err)
+		keg.ID = id
+		s.empties = append(s.empties, keg)
+	}
+
+	// the oldest keg of the size and the supplier is returned with the full deposit
+	returned, err := s.ReturnEmptyKeg(0, 30, "baracek", nil, "")
+	require.NoError(t, err)
+	assert.Equal(t, "baracek", returned.Supplier)
+	assert.True(t, decimal.NewFromInt(1000).Equal(returned.Refund))
+	require.NotNil(t, returned.ReturnedAt)
+
+	// the supplier can refund less for a damaged keg
+	refund := decimal.NewFromInt(1000)
+	returned, err = s.ReturnEmptyKeg(0, 30, "", &refund, "damaged valve")
+	require.NoError(t, err)
+	assert.Equal(t, "maneo", returned.Supplier)
+	assert.True(t, refund.Equal(returned.Refund))
+	assert.Equal(t, "damaged valve", returned.Note)
+
+	_, err = s.ReturnEmptyKeg(0, 30, "", nil, "")
+	require.Error(t, err, "no 30l keg is waiting anymore")
+	negative := decimal.NewFromInt(-1)
+	_, err = s.ReturnEmptyKeg(0, 50, "", &negative, "")
+	require.Error(t, err)
+
+	deposits := s.GetDeposits()
+	assert.Equal(t, 1, deposits.Kegs)
+	assert.True(t, decimal.NewFromInt(1500).Equal(deposits.Total))
+
+	// returned kegs stay in the store
+	all, err := s.store.GetEmptyKegs(false)
+	require.NoError(t, err)
+	assert.Len(t, all, 3)
+	awaiting, err := s.store.GetEmptyKegs(true)
+	require.NoError(t, err)
+	assert.Len(t, awaiting, 1)
+}
+
+func TestScale_ReturnEmptyKegs(t *testing.T) {
+	s := createScaleWithMeasurements(t)
+	for _, supplier := range []string{"maneo", "baracek", "maneo"} {
+		keg := store.EmptyKeg{Size: 30, Supplier: supplier, Deposit: decimal.NewFromInt(1200), EmptiedAt: s.clock.Now()}
+		id, err := s.store.AddEmptyKeg(keg)
+		require.NoError(t, err)
+		keg.ID = id
+		s.empties = append(s.empties, keg)
+	}
+
+	// more kegs than are waiting, nothing is returned
+	_, err := s.ReturnEmptyKegs(30, "maneo", 3, nil, "")
+	require.Error(t, err)
+	_, err = s.ReturnEmptyKegs(30, "", 0, nil, "")
+	require.Error(t, err)
+	assert.Len(t, s.GetEmptyKegs(), 3)
+	awaiting, err := s.store.GetEmptyKegs(true)
+	require.NoError(t, err)
+	assert.Len(t, awaiting, 3)
+
+	returned, err := s.ReturnEmptyKegs(30, "maneo", 2, nil, "")
+	require.NoError(t, err)
+	require.Len(t, returned, 2)
+	assert.Equal(t, "maneo", returned[1].Supplier)
+	require.Len(t, s.GetEmptyKegs(), 1)
+	assert.Equal(t, "baracek", s.GetEmptyKegs()[0].Supplier)
+	assert.True(t, decimal.NewFromInt(1200).Equal(s.GetDeposits().Total))
+}
@@ -0,0 +1,80 @@
+package scale
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/kotrzina/keg-scale/pkg/config"
+)
+
+const (
+	RejectReasonRange    = "range"    // weight outside of the catalog weight range
+	RejectReasonRate     = "rate"     // weight changed faster than allowed
+	RejectReasonUnstable = "unstable" // weight jumped and did not settle yet
+)
+
+// weightFilter removes spikes from the weights of a single tap scale
+// someone leaning on the keg or a crate dropped next to it must not change the keg state
+type weightFilter struct {
+	window   []float64 // last accepted raw readings for the median
+	accepted float64   // last accepted weight, zero when there is none
+	at       time.Time // time of the last accepted weight
+	pending  []float64 // readings after a jump waiting to settle
+}
+
+// add filters a new raw reading
+// it returns the filtered weight or the reason why the reading was rejected
+func (f *weightFilter) add(weight float64, at time.Time, conf config.MeasurementFilter) (float64, string) {
+	if f.accepted == 0 {
+		return f.accept([]float64{weight}, at, conf), ""
+	}
+
+	dt := math.Max(at.Sub(f.at).Seconds(), 1)
+	if conf.MaxRate > 0 && math.Abs(weight-f.accepted)/dt > conf.MaxRate {
+		// a jump is real only when it stays - new keg, removed crate
+		if len(f.pending) > 0 && math.Abs(weight-f.pending[0]) > conf.StableTolerance {
+			f.pending = nil
+		}
+		f.pending = append(f.pending, weight)
+
+		if len(f.pending) < conf.StableReadings {
+			if len(f.pending) == 1 {
+				return 0, RejectReasonRate
+			}
+			return 0, RejectReasonUnstable
+		}
+
+		return f.accept(f.pending, at, conf), ""
+	}
+
+	f.pending = nil
+	return f.accept(append(f.window, weight), at, conf), ""
+}
+
+// accept sets the window and returns its median as the accepted weight
+func (f *weightFilter) accept(window []float64, at time.Time, conf config.MeasurementFilter) float64 {
+	size := max(conf.Window, 1)
+	if len(window) > size {
+		window = window[len(window)-size:]
+	}
+
+	f.window = append([]float64{}, window...)
+	f.pending = nil
+	f.accepted = median(f.window)
+	f.at = at
+
+	return f.accepted
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
@@ -0,0 +1,100 @@
+package scale
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kotrzina/keg-scale/pkg/config"
+	"github.com/kotrzina/keg-scale/pkg/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testFilter = config.MeasurementFilter{
+	Window:          3,
+	MaxRate:         400,
+	StableReadings:  3,
+	StableTolerance: 200,
+}
+
+func TestWeightFilter(t *testing.T) {
+	type reading struct {
+		weight   float64
+		expected float64
+		reason   string
+	}
+
+	cases := []struct {
+		name     string
+		readings []reading
+	}{
+		{"median removes noise", []reading{
+			{40000, 40000, ""},
+			{40100, 40050, ""},
+			{39900, 40000, ""},
+			{40050, 40050, ""},
+		}},
+		{"single spike is rejected", []reading{
+			{40000, 40000, ""},
+			{55000, 0, RejectReasonRate},
+			{40000, 40000, ""},
+		}},
+		{"leaning on the keg for a while is rejected", []reading{
+			{40000, 40000, ""},
+			{52000, 0, RejectReasonRate},
+			{48000, 0, RejectReasonRate},
+			{51000, 0, RejectReasonRate},
+			{40000, 40000, ""},
+		}},
+		{"new keg is accepted when it settles", []reading{
+			{14000, 14000, ""},
+			{63500, 0, RejectReasonRate},
+			{63550, 0, RejectReasonUnstable},
+			{63450, 63500, ""},
+			{63400, 63450, ""},
+		}},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			f := weightFilter{}
+			at := time.Now()
+			for i, r := range tt.readings {
+				at = at.Add(5 * time.Second)
+				weight, reason := f.add(r.weight, at, testFilter)
+				assert.Equal(t, r.reason, reason, "reading %d", i)
+				if r.reason == "" {
+					assert.InDelta(t, r.expected, weight, 0.000001, "reading %d", i)
+				}
+			}
+		})
+	}
+}
+
+func TestWeightFilter_Disabled(t *testing.T) {
+	f := weightFilter{}
+	conf := config.MeasurementFilter{Window: 1}
+
+	for _, w := range []float64{10000, 60000, 20000} {
+		weight, reason := f.add(w, time.Now(), conf)
+		require.Empty(t, reason)
+		assert.InDelta(t, w, weight, 0.000001)
+	}
+}
+
+func TestScale_AddMeasurementFiltered(t *testing.T) {
+	s := createScaleWithMeasurements(t)
+	s.config.Filter = testFilter
+
+	// 30l keg is tapped
+	tp := s.taps[store.DefaultTap]
+	require.NoError(t, s.SetActiveKeg(store.DefaultTap, 30))
+	require.NoError(t, s.AddMeasurement(store.DefaultTap, 30000))
+	beersLeft := tp.beersLeft
+
+	// somebody sits on the keg - candidate keg must not be registered
+	require.NoError(t, s.AddMeasurement(store.DefaultTap, 63500))
+	assert.Equal(t, 0, tp.candidateKeg)
+	assert.Equal(t, beersLeft, tp.beersLeft)
+	assert.InDelta(t, 30000, tp.weight, 0.000001)
+}
@@ -0,0 +1,248 @@
+package scale
+
+import (
+	"math"
+	"slices"
+	"time"
+)
+
+// health analyzes the message stream of the tap scale to find sensor and connection problems
+// problems are reported once when they appear
+
+const (
+	HealthIssueFrozen     = "frozen"      // the scale keeps sending exactly the same value
+	HealthIssueDrift      = "drift"       // the weight changed while the pub was closed
+	HealthIssueReboot     = "reboot"      // the message counter started again
+	HealthIssuePacketLoss = "packet_loss" // messages are missing in the counter sequence
+	HealthIssueWeakSignal = "weak_signal" // WiFi signal of the scale is weak
+)
+
+const (
+	healthFrozenReadings = 30               // identical raw readings in a row
+	healthFrozenDuration = 30 * time.Minute // how long the identical readings must last
+	healthDriftMin       = 150.0            // grams - smaller changes are a noise
+	healthDriftMax       = 2000.0           // grams - bigger changes are a keg handling, not a drift
+	healthRebootWindow   = time.Hour        // reboot is reported as an issue for this long
+	healthLossWindow     = 200              // expected messages kept for the packet loss ratio
+	healthLossMinSamples = 20               // expected messages needed before the loss is evaluated
+	healthLossMax        = 0.2              // more than 20 % of lost messages is an issue
+	healthRssiAlpha      = 0.2              // smoothing of RSSI readings
+	healthRssiWeak       = -80.0            // dBm - smoothed RSSI below this is weak
+	healthRssiMinSamples = 5
+)
+
+type health struct {
+	// message counter sequence
+	hasMessageID  bool
+	lastMessageID uint64
+	expected      int // expected messages in the loss window
+	lost          int // missing messages in the loss window
+	resets        int // counter resets since the start of the backend
+	lastResetAt   time.Time
+
+	// smoothed RSSI
+	rssi        float64
+	rssiSamples int
+
+	// identical raw readings
+	frozenRaw      float64
+	frozenSince    time.Time
+	frozenReadings int
+
+	// weight change while the pub was closed, see closedWatch
+	drift   float64 // grams, last detected drift
+	driftAt time.Time
+
+	issues []string // currently reported issues
+}
+
+type HealthOutput struct {
+	Healthy       bool       `json:"healthy"`
+	Issues        []string   `json:"issues"`
+	LastMessageID uint64     `json:"last_message_id"`
+	Resets        int        `json:"resets"`
+	LastResetAt   *time.Time `json:"last_reset_at"`
+	PacketLoss    float64    `json:"packet_loss"` // ratio of lost messages 0 - 1
+	Rssi          float64    `json:"rssi"`        // smoothed RSSI in dBm
+	FrozenSince   *time.Time `json:"frozen_since"`
+	Drift         float64    `json:"drift"` // grams, positive when the weight grew while closed
+	DriftAt       *time.Time `json:"drift_at"`
+}
+
+// ObserveMessage records the message counter and the WiFi signal of the tap scale
+func (s *Scale) ObserveMessage(tapID string, messageID uint64, rssi float64) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	t, found := s.taps[tapID]
+	if !found {
+		return
+	}
+
+	s.monitor.ScaleWifiRssi.WithLabelValues(t.id).Set(rssi)
+	t.rssi = rssi
+
+	h := &t.health
+	if h.rssiSamples == 0 {
+		h.rssi = rssi
+	} else {
+		h.rssi = healthRssiAlpha*rssi + (1-healthRssiAlpha)*h.rssi
+	}
+	h.rssiSamples++
+
+	switch {
+	case !h.hasMessageID:
+		h.hasMessageID = true
+	case messageID < h.lastMessageID:
+		// the counter starts from the beginning after the device reboot
+		h.resets++
+		h.lastResetAt = s.clock.Now()
+		s.monitor.ScaleResets.WithLabelValues(t.id).Inc()
+		s.logger.Warnf("Scale of tap %s rebooted, message counter %d -> %d", t.id, h.lastMessageID, messageID)
+	case messageID == h.lastMessageID:
+		return // repeated message
+	default:
+		h.addExpected(int(messageID-h.lastMessageID), int(messageID-h.lastMessageID-1))
+	}
+	h.lastMessageID = messageID
+
+	s.checkHealth(t)
+}
+
+// addExpected adds messages to the loss window, old values decay by halving the window
+func (h *health) addExpected(expected, lost int) {
+	h.expected += expected
+	h.lost += lost
+	for h.expected > healthLossWindow {
+		h.expected /= 2
+		h.lost /= 2
+	}
+}
+
+func (h *health) packetLoss() float64 {
+	if h.expected == 0 {
+		return 0
+	}
+
+	return float64(h.lost) / float64(h.expected)
+}
+
+// observeRaw checks the raw reading for the frozen sensor
+func (h *health) observeRaw(raw float64, at time.Time) {
+	if h.frozenReadings > 0 && raw == h.frozenRaw {
+		h.frozenReadings++
+		return
+	}
+
+	h.frozenRaw = raw
+	h.frozenSince = at
+	h.frozenReadings = 1
+}
+
+func (h *health) isFrozen(now time.Time) bool {
+	return h.frozenReadings >= healthFrozenReadings && now.Sub(h.frozenSince) >= healthFrozenDuration
+}
+
+// checkDrift checks the weight change of the closed pub which is not a loss of beer
+// nobody should touch the keg while the pub is closed, so a small change is a drift of the sensor
+func (s *Scale) checkDrift(t *tap, diff float64) {
+	h := &t.health
+	h.drift = 0
+	if math.Abs(diff) >= healthDriftMin && math.Abs(diff) <= healthDriftMax {
+		h.drift = diff
+		h.driftAt = s.clock.Now()
+		s.logger.Warnf("Scale of tap %s drifted %.0f g while the pub was closed", t.id, diff)
+	}
+	s.monitor.ScaleDrift.WithLabelValues(t.id).Set(h.drift)
+	s.checkHealth(t)
+}
+
+// currentIssues evaluates all health checks of the tap
+func (s *Scale) currentIssues(t *tap) []string {
+	h := &t.health
+	now := s.clock.Now()
+	issues := []string{}
+
+	if h.isFrozen(now) {
+		issues = append(issues, HealthIssueFrozen)
+	}
+	if h.drift != 0 {
+		issues = append(issues, HealthIssueDrift)
+	}
+	if h.resets > 0 && now.Sub(h.lastResetAt) < healthRebootWindow {
+		issues = append(issues, HealthIssueReboot)
+	}
+	if h.expected >= healthLossMinSamples && h.packetLoss() > healthLossMax {
+		issues = append(issues, HealthIssuePacketLoss)
+	}
+	if h.rssiSamples >= healthRssiMinSamples && h.rssi < healthRssiWeak {
+		issues = append(issues, HealthIssueWeakSignal)
+	}
+
+	return issues
+}
+
+// checkHealth dispatches an event for every new issue of the tap
+func (s *Scale) checkHealth(t *tap) {
+	previous := t.health.issues
+	t.health.issues = s.currentIssues(t)
+	s.updateHealthMetrics(t)
+
+	for _, issue := range previous {
+		if !slices.Contains(t.health.issues, issue) {
+			s.logger.Infof("Scale of tap %s recovered from %s", t.id, issue)
+		}
+	}
+
+	for _, issue := range t.health.issues {
+		if slices.Contains(previous, issue) {
+			continue
+		}
+
+		s.logger.Warnf("Scale of tap %s is unhealthy: %s", t.id, issue)
+		payload := s.newTapEvent(EventScaleUnhealthy, t, EventReasonScale)
+		payload.Issue = issue
+		output := s.getHealthOutput(t)
+		payload.Health = &output
+		s.dispatchEvent(payload)
+	}
+}
+
+func (s *Scale) updateHealthMetrics(t *tap) {
+	healthy := 0.
+	if len(t.health.issues) == 0 {
+		healthy = 1.
+	}
+
+	s.monitor.ScaleHealthy.WithLabelValues(t.id).Set(healthy)
+	s.monitor.ScalePacketLoss.WithLabelValues(t.id).Set(t.health.packetLoss())
+}
+
+func (s *Scale) getHealthOutput(t *tap) HealthOutput {
+	h := &t.health
+	output := HealthOutput{
+		Healthy:       len(h.issues) == 0,
+		Issues:        make([]string, len(h.issues)),
+		LastMessageID: h.lastMessageID,
+		Resets:        h.resets,
+		PacketLoss:    h.packetLoss(),
+		Rssi:          h.rssi,
+		Drift:         h.drift,
+	}
+	copy(output.Issues, h.issues)
+
+	if h.resets > 0 {
+		at := h.lastResetAt
+		output.LastResetAt = &at
+	}
+	if h.isFrozen(s.clock.Now()) {
+		since := h.frozenSince
+		output.FrozenSince = &since
+	}
+	if h.drift != 0 {
+		at := h.driftAt
+		output.DriftAt = &at
+	}
+
+	return output
+}
@@ -0,0 +1,103 @@
+package scale
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kotrzina/keg-scale/pkg/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScale_HealthMessageCounter(t *testing.T) {
+	s := createScaleWithMeasurements(t)
+
+	// every other message is lost
+	id := uint64(100)
+	for range 30 {
+		s.ObserveMessage(store.DefaultTap, id, -60)
+		id += 2
+	}
+	health := s.GetScale().Health
+	assert.InDelta(t, 0.5, health.PacketLoss, 0.01)
+	assert.Equal(t, []string{HealthIssuePacketLoss}, health.Issues)
+	assert.False(t, health.Healthy)
+
+	// repeated message does not change anything
+	s.ObserveMessage(store.DefaultTap, id-2, -60)
+	assert.Equal(t, id-2, s.GetScale().Health.LastMessageID)
+
+	// device reboot
+	s.ObserveMessage(store.DefaultTap, 1, -60)
+	health = s.GetScale().Health
+	assert.Equal(t, 1, health.Resets)
+	assert.NotNil(t, health.LastResetAt)
+	assert.Contains(t, health.Issues, HealthIssueReboot)
+
+	// the reboot is not an issue after a while
+	s.taps[store.DefaultTap].health.lastResetAt = time.Now().Add(-2 * healthRebootWindow)
+	s.Recheck()
+	assert.NotContains(t, s.GetScale().Health.Issues, HealthIssueReboot)
+
+	counts := countEvents(t, s, EventScaleUnhealthy)
+	assert.Equal(t, 2, counts[EventScaleUnhealthy])
+}
+
+func TestScale_HealthWeakSignal(t *testing.T) {
+	s := createScaleWithMeasurements(t)
+
+	for i := range 10 {
+		s.ObserveMessage(store.DefaultTap, uint64(i), -70)
+	}
+	assert.True(t, s.GetScale().Health.Healthy)
+
+	for i := range 10 {
+		s.ObserveMessage(store.DefaultTap, uint64(10+i), -90)
+	}
+	health := s.GetScale().Health
+	assert.Equal(t, []string{HealthIssueWeakSignal}, health.Issues)
+	assert.Less(t, health.Rssi, healthRssiWeak)
+}
+
+func TestScale_HealthFrozen(t *testing.T) {
+	s := createScaleWithMeasurements(t)
+
+	for range healthFrozenReadings {
+		addMeasurements(t, s, 30000)
+	}
+	assert.True(t, s.GetScale().Health.Healthy, "identical readings must last for a while")
+
+	s.taps[store.DefaultTap].health.frozenSince = time.Now().Add(-healthFrozenDuration)
+	addMeasurements(t, s, 30000)
+	health := s.GetScale().Health
+	assert.Equal(t, []string{HealthIssueFrozen}, health.Issues)
+	assert.NotNil(t, health.FrozenSince)
+
+	addMeasurements(t, s, 30010)
+	assert.True(t, s.GetScale().Health.Healthy)
+}
+
+func TestScale_HealthDrift(t *testing.T) {
+	s := createScaleWithMeasurements(t, 40, 40)
+	require.Equal(t, 30, s.taps[store.DefaultTap].activeKeg)
+
+	// the keg got lighter by 300 g while nobody was there
+	s.updatePub(false, false)
+	require.NoError(t, s.Ping(store.DefaultTap))
+	addMeasurements(t, s, 39700)
+	health := s.GetScale().Health
+	assert.Equal(t, []string{HealthIssueDrift}, health.Issues)
+	assert.InDelta(t, -300, health.Drift, 0.1)
+
+	// no drift during the next closed period
+	s.updatePub(false, false)
+	require.NoError(t, s.Ping(store.DefaultTap))
+	addMeasurements(t, s, 39720)
+	assert.True(t, s.GetScale().Health.Healthy)
+
+	// something heavy was put on the keg, it is not a drift
+	s.updatePub(false, false)
+	require.NoError(t, s.Ping(store.DefaultTap))
+	addMeasurements(t, s, 43000)
+	assert.True(t, s.GetScale().Health.Healthy)
+}
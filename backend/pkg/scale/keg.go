@@ -1,93 +1,235 @@
 package scale
 
 import (
-	"fmt"
 	"math"
+	"sort"
+
+	"github.com/kotrzina/keg-scale/pkg/store"
+)
+
+const (
+	DefaultServingSize = 0.5 // liters - the good old half a liter
+	DefaultYield       = 1.0 // the whole keg ends up in glasses
+	DefaultBeerDensity = 1.0 // kg per liter - kegs were always weighed as water, lager is about 1.01
 )
 
 type KegWeights map[int]float64
 
-// GetEmptyWeights returns a map of keg sizes and their empty weights in grams
-func GetEmptyWeights() KegWeights {
-	return KegWeights{
-		10: 6000,
-		15: 7000,
-		20: 9250,
-		30: 10000,
-		50: 13500,
+// KegCatalog holds all known keg types indexed by their size in liters
+type KegCatalog map[int]store.KegType
+
+// DefaultKegTypes returns keg types used before the catalog existed
+// they are used to seed an empty catalog
+func DefaultKegTypes() []store.KegType {
+	return []store.KegType{
+		{Size: 10, EmptyWeight: 6000, Label: "10l"},
+		{Size: 15, EmptyWeight: 7000, Label: "15l"},
+		{Size: 20, EmptyWeight: 9250, Label: "20l"},
+		{Size: 30, EmptyWeight: 10000, Label: "30l"},
+		{Size: 50, EmptyWeight: 13500, Label: "50l"},
+	}
+}
+
+// NewKegCatalog creates a catalog from the list of keg types
+// unset serving sizes, yield and density get default values
+func NewKegCatalog(types []store.KegType) KegCatalog {
+	c := make(KegCatalog, len(types))
+	for _, kt := range types {
+		c[kt.Size] = WithKegDefaults(kt)
+	}
+
+	return c
+}
+
+// WithKegDefaults fills unset serving sizes, yield and density of the keg type
+func WithKegDefaults(kt store.KegType) store.KegType {
+	if kt.ServingSize <= 0 {
+		kt.ServingSize = DefaultServingSize
+	}
+	if len(kt.Servings) == 0 {
+		kt.Servings = []float64{ServingSmall, ServingLarge}
+	}
+	if kt.Yield <= 0 {
+		kt.Yield = DefaultYield
+	}
+	if kt.Density <= 0 {
+		kt.Density = DefaultBeerDensity
+	}
+
+	return kt
+}
+
+// kegType returns the keg type from the catalog, unknown kegs have no tare weight and default values
+func (c KegCatalog) kegType(keg int) store.KegType {
+	if kt, found := c[keg]; found {
+		return kt
+	}
+
+	return WithKegDefaults(store.KegType{Size: keg})
+}
+
+// DefaultKegCatalog returns a catalog with default keg types
+func DefaultKegCatalog() KegCatalog {
+	return NewKegCatalog(DefaultKegTypes())
+}
+
+// Sizes returns all keg sizes in the catalog in ascending order
+func (c KegCatalog) Sizes() []int {
+	sizes := make([]int, 0, len(c))
+	for size := range c {
+		sizes = append(sizes, size)
 	}
+	sort.Ints(sizes)
+
+	return sizes
+}
+
+// Types returns all keg types in the catalog ordered by size
+func (c KegCatalog) Types() []store.KegType {
+	types := make([]store.KegType, 0, len(c))
+	for _, size := range c.Sizes() {
+		types = append(types, c[size])
+	}
+
+	return types
+}
+
+// Has returns true if the keg size is in the catalog
+func (c KegCatalog) Has(keg int) bool {
+	_, found := c[keg]
+	return found
 }
 
-// GetFullWeights returns a map of keg sizes and their full weights in grams
-func GetFullWeights() KegWeights {
-	w := make(map[int]float64)
-	empty := GetEmptyWeights()
-	for keg, weight := range empty {
-		w[keg] = float64(keg)*1000 + weight
+// EmptyWeights returns a map of keg sizes and their empty weights in grams
+func (c KegCatalog) EmptyWeights() KegWeights {
+	w := make(KegWeights, len(c))
+	for keg, kt := range c {
+		w[keg] = kt.EmptyWeight
 	}
 
 	return w
 }
 
-// CalcBeersLeft calculates the number of beers left in a keg based on its size and current weight
-func CalcBeersLeft(keg int, weight float64) int {
-	if keg == 0 {
-		return 0
+// FullWeights returns a map of keg sizes and their full weights in grams
+func (c KegCatalog) FullWeights() KegWeights {
+	w := make(KegWeights, len(c))
+	for keg, kt := range c {
+		w[keg] = float64(keg)*1000*kt.Density + kt.EmptyWeight
 	}
-	kegWeight, found := GetEmptyWeights()[keg]
-	if !found {
-		kegWeight = 0
+
+	return w
+}
+
+// WeightRange returns the lowest and the highest weight which makes sense for the catalog
+// anything outside is not a keg on the scale
+func (c KegCatalog) WeightRange() (float64, float64) {
+	if len(c) == 0 {
+		return 0, 0
 	}
 
-	if kegWeight/1000 > weight/1000 {
-		return 0
+	low := math.Inf(1)
+	high := 0.0
+	for keg, kt := range c {
+		low = math.Min(low, kt.EmptyWeight)
+		high = math.Max(high, float64(keg)*1000*kt.Density+kt.EmptyWeight)
 	}
 
-	return int(math.Floor((weight/1000 - kegWeight/1000) * 2))
+	return low, high + 1500
 }
 
-// CalcBeersConsumed calculates the number of beers consumed from a keg based on its size and current weight
-func CalcBeersConsumed(keg int, weight float64) int {
-	kegWeight, found := GetEmptyWeights()[keg]
-	if !found {
+// CalcLitersLeft calculates the volume of beer left in a keg based on its size and current weight
+// unknown kegs have no tare weight
+func (c KegCatalog) CalcLitersLeft(keg int, weight float64) float64 {
+	if keg == 0 {
 		return 0
 	}
-	fullKeg := float64(keg) * 2 // how many beers do we have in full keg
 
-	w := weight - kegWeight
+	kt := c.kegType(keg)
+	return math.Max(0, (weight-kt.EmptyWeight)/1000/kt.Density)
+}
 
-	if w <= 0 {
-		return keg * 2
+// CalcLitersConsumed calculates the volume of beer consumed from a keg based on its size and current weight
+func (c KegCatalog) CalcLitersConsumed(keg int, weight float64) float64 {
+	if !c.Has(keg) {
+		return 0
 	}
 
-	if w >= float64(keg)*1000 {
-		return int(fullKeg)
+	left := c.CalcLitersLeft(keg, weight)
+	if left > float64(keg) {
+		return float64(keg) // heavier than the full keg - it is not our keg anymore
 	}
 
-	return int(math.Floor(fullKeg - (w / 500)))
+	return math.Max(0, float64(keg)-left)
+}
+
+// CalcBeersLeft calculates the number of beers left in a keg based on its size and current weight
+func (c KegCatalog) CalcBeersLeft(keg int, weight float64) int {
+	return c.Beers(keg, c.CalcLitersLeft(keg, weight))
+}
+
+// CalcBeersConsumed calculates the number of beers consumed from a keg based on its size and current weight
+func (c KegCatalog) CalcBeersConsumed(keg int, weight float64) int {
+	return c.Beers(keg, c.CalcLitersConsumed(keg, weight))
+}
+
+// Beers converts the volume of the keg to servings which end up in glasses
+func (c KegCatalog) Beers(keg int, liters float64) int {
+	kt := c.kegType(keg)
+	return int(math.Floor(liters*kt.Yield/kt.ServingSize + 1e-9)) // float error must not cost a beer
 }
 
-func IsKegLow(keg int, weight float64) bool {
+// KegBeers returns the number of beers in the full keg
+func (c KegCatalog) KegBeers(keg int) int {
+	return c.Beers(keg, float64(keg))
+}
+
+// GramsPerBeer returns the weight of the beer in grams including its share of the lost volume
+func (c KegCatalog) GramsPerBeer(keg int) float64 {
+	kt := c.kegType(keg)
+	return kt.ServingSize * kt.Density * 1000 / kt.Yield
+}
+
+func (c KegCatalog) IsKegLow(keg int, weight float64) bool {
 	if keg == 0 {
 		return true // no keg is set - is low for a new one
 	}
 
-	kegWeight, found := GetEmptyWeights()[keg]
+	kt, found := c[keg]
 	if !found {
 		return true // unknown keg - islow for a new one
 	}
 
-	return math.Abs(weight-kegWeight) < 2500 // we are 2500 grams close to the empty keg
+	return math.Abs(weight-kt.EmptyWeight) < 2500 // we are 2500 grams close to the empty keg
 }
 
-func GuessNewKegSize(weight float64) (int, error) {
-	kegs := GetFullWeights()
-	delta := 2500.0
-	for keg, fullWeight := range kegs {
-		if math.Abs(weight-fullWeight) < delta {
-			return keg, nil
+// KegMatch is a full keg from the catalog matching the weight
+type KegMatch struct {
+	Size  int
+	Score float64 // 1 for exact weight, 0 at the edge of the tolerance
+}
+
+// kegMatchTolerance is the max distance from the full keg weight in grams
+const kegMatchTolerance = 2500.0
+
+// MatchKegs finds full kegs close to the weight ordered from the best match
+func (c KegCatalog) MatchKegs(weight float64) []KegMatch {
+	matches := []KegMatch{}
+	for keg, fullWeight := range c.FullWeights() {
+		d := math.Abs(weight - fullWeight)
+		if d < kegMatchTolerance {
+			matches = append(matches, KegMatch{
+				Size:  keg,
+				Score: 1 - d/kegMatchTolerance,
+			})
 		}
 	}
 
-	return 0, fmt.Errorf("could not guess keg size based on weight: %f", weight)
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score == matches[j].Score {
+			return matches[i].Size < matches[j].Size
+		}
+		return matches[i].Score > matches[j].Score
+	})
+
+	return matches
 }
@@ -3,6 +3,7 @@ package scale
 import (
 	"testing"
 
+	"github.com/kotrzina/keg-scale/pkg/store"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -30,7 +31,7 @@ func TestCalcBeersLeft(t *testing.T) {
 	}
 
 	for _, tc := range testcases {
-		beers := CalcBeersLeft(tc.keg, tc.weight)
+		beers := DefaultKegCatalog().CalcBeersLeft(tc.keg, tc.weight)
 		assert.Equal(t, tc.beers, beers, "Keg %d with weight %f - Expected beers to be %d, got %d", tc.keg, tc.weight, tc.beers, beers)
 	}
 }
@@ -54,11 +55,47 @@ func TestCalcBeersConsumed(t *testing.T) {
 	}
 
 	for _, tc := range testcases {
-		beers := CalcBeersConsumed(tc.keg, tc.weight)
+		beers := DefaultKegCatalog().CalcBeersConsumed(tc.keg, tc.weight)
 		assert.Equal(t, tc.beers, beers, "Keg %d with weight %f - Expected beers to be %d, got %d", tc.keg, tc.weight, tc.beers, beers)
 	}
 }
 
+func TestKegCatalog_ServingSizeAndYield(t *testing.T) {
+	c := NewKegCatalog([]store.KegType{
+		{Size: 15, EmptyWeight: 7000, ServingSize: 0.3},
+		{Size: 30, EmptyWeight: 10000, Yield: 0.9},
+		{Size: 50, EmptyWeight: 13500, Density: 1.01},
+	})
+
+	// defaults
+	assert.InEpsilon(t, DefaultServingSize, c[30].ServingSize, 0.000001)
+	assert.Equal(t, []float64{ServingSmall, ServingLarge}, c[30].Servings)
+	assert.InEpsilon(t, DefaultYield, c[15].Yield, 0.000001)
+	assert.InEpsilon(t, DefaultBeerDensity, c[15].Density, 0.000001)
+
+	// 0.3 l glasses
+	assert.Equal(t, 50, c.KegBeers(15))
+	assert.Equal(t, 10, c.CalcBeersLeft(15, 10000))
+	assert.InEpsilon(t, 3.0, c.CalcLitersLeft(15, 10000), 0.000001)
+	assert.Equal(t, 40, c.CalcBeersConsumed(15, 10000))
+	assert.InEpsilon(t, 12.0, c.CalcLitersConsumed(15, 10000), 0.000001)
+
+	// 10 % of the keg is lost in foam
+	assert.Equal(t, 54, c.KegBeers(30))
+	assert.Equal(t, 18, c.CalcBeersLeft(30, 20000))
+	assert.InEpsilon(t, 555.555556, c.GramsPerBeer(30), 0.000001)
+
+	// heavier beer
+	assert.InEpsilon(t, 64000.0, c.FullWeights()[50], 0.000001)
+	assert.InEpsilon(t, 50.0, c.CalcLitersLeft(50, 64000), 0.000001)
+	assert.Equal(t, 100, c.CalcBeersLeft(50, 64000))
+	assert.Equal(t, 0, c.CalcBeersConsumed(50, 64000))
+	assert.InEpsilon(t, 505.0, c.GramsPerBeer(50), 0.000001)
+	matches := c.MatchKegs(64000)
+	require.Len(t, matches, 1)
+	assert.InEpsilon(t, 1.0, matches[0].Score, 0.000001)
+}
+
 func TestIsKegLow(t *testing.T) {
 	type testcase struct {
 		keg    int
@@ -77,12 +114,12 @@ func TestIsKegLow(t *testing.T) {
 	}
 
 	for _, tc := range testcases {
-		ready := IsKegLow(tc.keg, tc.weight)
+		ready := DefaultKegCatalog().IsKegLow(tc.keg, tc.weight)
 		assert.Equal(t, tc.isLow, ready, "Expected is_low to be %t, got %t", tc.isLow, ready)
 	}
 }
 
-func TestGuessNewKegSize(t *testing.T) {
+func TestKegCatalog_MatchKegs(t *testing.T) {
 	type testcase struct {
 		weight float64
 		keg    int
@@ -94,8 +131,48 @@ func TestGuessNewKegSize(t *testing.T) {
 	}
 
 	for _, tc := range testcases {
-		keg, err := GuessNewKegSize(tc.weight)
-		require.NoError(t, err)
-		require.Equal(t, tc.keg, keg, "Expected keg to be %d, got %d", tc.keg, keg)
+		matches := DefaultKegCatalog().MatchKegs(tc.weight)
+		require.NotEmpty(t, matches)
+		require.Equal(t, tc.keg, matches[0].Size, "Expected keg to be %d, got %d", tc.keg, matches[0].Size)
 	}
+
+	// unknown weight
+	assert.Empty(t, DefaultKegCatalog().MatchKegs(45000))
+
+	// exact weight
+	matches := DefaultKegCatalog().MatchKegs(40000)
+	require.Len(t, matches, 1)
+	assert.InEpsilon(t, 1.0, matches[0].Score, 0.000001)
+
+	// custom catalog with 5l and 25l kegs
+	catalog := NewKegCatalog(append(DefaultKegTypes(),
+		store.KegType{Size: 5, EmptyWeight: 4500},
+		store.KegType{Size: 25, EmptyWeight: 8500},
+	))
+	matches = catalog.MatchKegs(9400)
+	require.NotEmpty(t, matches)
+	assert.Equal(t, 5, matches[0].Size)
+	matches = catalog.MatchKegs(33400)
+	require.NotEmpty(t, matches)
+	assert.Equal(t, 25, matches[0].Size)
+
+	// both kegs are close - the better one goes first
+	catalog = NewKegCatalog([]store.KegType{
+		{Size: 10, EmptyWeight: 6000},
+		{Size: 12, EmptyWeight: 5000},
+	})
+	matches = catalog.MatchKegs(16600)
+	require.Len(t, matches, 2)
+	assert.Equal(t, 12, matches[0].Size)
+	assert.Equal(t, 10, matches[1].Size)
+}
+
+func TestKegCatalog_WeightRange(t *testing.T) {
+	low, high := DefaultKegCatalog().WeightRange()
+	assert.InEpsilon(t, 6000.0, low, 0.000001)
+	assert.InEpsilon(t, 65000.0, high, 0.000001)
+
+	catalog := NewKegCatalog(append(DefaultKegTypes(), store.KegType{Size: 5, EmptyWeight: 4500}))
+	low, _ = catalog.WeightRange()
+	assert.InEpsilon(t, 4500.0, low, 0.000001)
 }
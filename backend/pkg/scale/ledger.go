@@ -0,0 +1,104 @@
+package scale
+
+import (
+	"fmt"
+
+	"github.com/kotrzina/keg-scale/pkg/store"
+)
+
+// openKegRecord starts a new record in the keg ledger for the active keg of the tap
+// stockID links the record to the keg from the warehouse, zero when unknown
+func (s *Scale) openKegRecord(t *tap, stockID int64) error {
+	record := store.KegRecord{
+		Tap:         t.id,
+		Size:        t.activeKeg,
+		TappedAt:    t.activeKegAt,
+		StartWeight: t.weight,
+		EndWeight:   t.weight,
+		StockID:     stockID,
+	}
+
+	id, err := s.store.AddKeg(record)
+	if err != nil {
+		return fmt.Errorf("could not add keg to the ledger: %w", err)
+	}
+
+	record.ID = id
+	t.kegRecord = record
+
+	return nil
+}
+
+// closeKegRecord finishes the ledger record of the active keg of the tap
+// an emptied keg leaves the tap and waits for the return to the supplier
+// a corrected keg was never on the tap, so it is not an empty
+// it does nothing when there is no open record
+func (s *Scale) closeKegRecord(t *tap, reason store.KegEndReason, emptied bool) error {
+	if t.kegRecord.ID == 0 {
+		return nil
+	}
+
+	now := s.clock.Now()
+	t.kegRecord.EmptiedAt = &now
+	t.kegRecord.EndReason = reason
+	t.kegRecord.BeersPoured = s.catalog.CalcBeersConsumed(t.kegRecord.Size, t.kegRecord.EndWeight)
+	t.kegRecord.LitersPoured = s.catalog.CalcLitersConsumed(t.kegRecord.Size, t.kegRecord.EndWeight)
+	if err := s.store.UpdateKeg(t.kegRecord); err != nil {
+		return fmt.Errorf("could not update keg in the ledger: %w", err)
+	}
+
+	s.logger.Infof("Keg %d (%d l) closed in the ledger (%s) with %d beers poured", t.kegRecord.ID, t.kegRecord.Size, reason, t.kegRecord.BeersPoured)
+	if emptied {
+		s.addEmptyKeg(t.kegRecord)
+	}
+	t.kegRecord = store.KegRecord{}
+
+	return nil
+}
+
+// kegRecordLiters returns what was poured from the keg of the ledger record
+// the keg still on the tap is counted from the live record of the tap, which is returned too
+func (s *Scale) kegRecordLiters(record store.KegRecord) (beers int, liters float64, live store.KegRecord) {
+	if record.EmptiedAt == nil {
+		if t, found := s.taps[record.Tap]; found && record.ID == t.kegRecord.ID {
+			record = t.kegRecord
+		}
+		return s.catalog.CalcBeersConsumed(record.Size, record.EndWeight), s.catalog.CalcLitersConsumed(record.Size, record.EndWeight), record
+	}
+
+	liters = record.LitersPoured
+	if liters == 0 {
+		liters = float64(record.BeersPoured) * DefaultServingSize // closed before liters were tracked
+	}
+	return record.BeersPoured, liters, record
+}
+
+// trackKegRecord keeps the lowest weight seen for the active keg of the tap
+// the weight only goes down while the keg is being drunk, so the new keg does not affect it
+func (s *Scale) trackKegRecord(t *tap) {
+	if t.kegRecord.ID > 0 && t.weight < t.kegRecord.EndWeight {
+		t.kegRecord.EndWeight = t.weight
+	}
+}
+
+// loadKegRecord loads the open ledger record of the active keg of the tap
+// kegs tapped before the ledger existed get a new record
+func (s *Scale) loadKegRecord(t *tap) {
+	kegs, err := s.store.GetKegs(t.id, 1)
+	if err != nil {
+		s.logger.Errorf("Could not load keg ledger: %v", err)
+		return
+	}
+
+	if len(kegs) > 0 && kegs[0].EmptiedAt == nil && kegs[0].Size == t.activeKeg {
+		t.kegRecord = kegs[0]
+		s.trackKegRecord(t)
+		return
+	}
+
+	if t.activeKeg > 0 {
+		if err := s.openKegRecord(t, 0); err != nil {
+			s.logger.Errorf("Could not create ledger record for the active keg: %v", err)
+		}
+	}
+}
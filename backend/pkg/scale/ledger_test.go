@@ -0,0 +1,44 @@
+package scale
+
+import (
+	"testing"
+
+	"github.com/kotrzina/keg-scale/pkg/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScale_KegLedger(t *testing.T) {
+	// 30l keg is tapped, drunk and emptied
+	s := createScaleWithMeasurements(t, 40, 40, 30, 20, 9)
+
+	kegs, err := s.GetKegHistory("", 10)
+	require.NoError(t, err)
+	require.Len(t, kegs, 1)
+	assert.Equal(t, 30, kegs[0].Size)
+	assert.False(t, kegs[0].IsActive)
+	assert.Equal(t, store.KegEndReasonAuto, kegs[0].EndReason)
+	assert.InEpsilon(t, 40000.0, kegs[0].StartWeight, 0.000001)
+	assert.InEpsilon(t, 9000.0, kegs[0].EndWeight, 0.000001)
+	assert.Equal(t, 60, kegs[0].BeersPoured)
+
+	// 50l keg is tapped and manually removed
+	for _, w := range []float64{63500, 63500, 50000} {
+		require.NoError(t, s.AddMeasurement(store.DefaultTap, w))
+	}
+
+	kegs, err = s.GetKegHistory("", 10)
+	require.NoError(t, err)
+	require.Len(t, kegs, 2)
+	assert.Equal(t, 50, kegs[0].Size)
+	assert.True(t, kegs[0].IsActive)
+	assert.Equal(t, 27, kegs[0].BeersPoured)
+
+	require.NoError(t, s.SetActiveKeg(store.DefaultTap, 0))
+	kegs, err = s.GetKegHistory("", 10)
+	require.NoError(t, err)
+	require.Len(t, kegs, 2)
+	assert.False(t, kegs[0].IsActive)
+	assert.Equal(t, store.KegEndReasonManual, kegs[0].EndReason)
+	assert.Equal(t, 27, kegs[0].BeersPoured)
+}
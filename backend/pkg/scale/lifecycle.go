@@ -0,0 +1,51 @@
+package scale
+
+// lifecycle events are dispatched once per transition
+// the flags are computed on startup without any event, so a restart does not repeat alerts
+
+// markScaleOnline reports the tap scale which started to send data again
+func (s *Scale) markScaleOnline(t *tap) {
+	if !t.offline {
+		return
+	}
+
+	t.offline = false
+	s.logger.Infof("Scale of tap %s is online", t.id)
+	s.dispatchEvent(s.newTapEvent(EventScaleOnline, t, EventReasonScale))
+}
+
+// markScaleOffline reports the tap scale which stopped sending data while the pub is open
+// all scales are silent while the pub is closed, that is not an outage
+func (s *Scale) markScaleOffline(t *tap) {
+	if t.offline || s.isTapOk(t) || !s.pub.isOpen {
+		return
+	}
+
+	t.offline = true
+	s.logger.Warnf("Scale of tap %s is offline since %s", t.id, t.lastOk.Format("2006-01-02 15:04:05"))
+	s.dispatchEvent(s.newTapEvent(EventScaleOffline, t, EventReasonTimeout))
+}
+
+// isWarehouseLow returns true if there are not enough beers in the warehouse
+func (s *Scale) isWarehouseLow() bool {
+	return s.catalog.WarehouseBeers(s.warehouse) <= s.config.WarehouseLowBeers
+}
+
+// checkWarehouse reports the warehouse which has just become low
+func (s *Scale) checkWarehouse(reason string) {
+	low := s.isWarehouseLow()
+	if low == s.warehouseLow {
+		return
+	}
+
+	s.warehouseLow = low
+	if !low {
+		return
+	}
+
+	beers := s.catalog.WarehouseBeers(s.warehouse)
+	s.logger.Warnf("Warehouse is low with %d beers left", beers)
+	payload := s.newEvent(EventWarehouseLow, reason)
+	payload.BeersLeft = beers
+	s.dispatchEvent(payload)
+}
@@ -0,0 +1,114 @@
+package scale
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kotrzina/keg-scale/pkg/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countEvents waits for the dispatched events and returns their count per type
+func countEvents(t *testing.T, s *Scale, types ...EventType) map[EventType]int {
+	t.Helper()
+
+	filter := store.EventFilter{}
+	for _, et := range types {
+		filter.Types = append(filter.Types, string(et))
+	}
+
+	s.WaitEvents()
+	events, err := s.GetEvents(filter)
+	require.NoError(t, err)
+
+	counts := map[EventType]int{}
+	for _, e := range events.Events {
+		counts[e.Type]++
+	}
+
+	return counts
+}
+
+func TestScale_KegLowAndEmptyEvents(t *testing.T) {
+	s := createScaleWithMeasurements(t, 40, 40)
+	require.Equal(t, 30, s.taps[store.DefaultTap].activeKeg)
+
+	// 30l keg gets low and then empty, every transition is reported once
+	addMeasurements(t, s, 12500, 12400, 12300, 10100, 10050, 10000)
+
+	counts := countEvents(t, s, EventKegLow, EventKegEmpty)
+	assert.Equal(t, 1, counts[EventKegLow])
+	assert.Equal(t, 1, counts[EventKegEmpty])
+	assert.Equal(t, 0, s.taps[store.DefaultTap].activeKeg)
+}
+
+func TestScale_ScaleOfflineOnlineEvents(t *testing.T) {
+	s := createScaleWithMeasurements(t)
+	tp := s.taps[store.DefaultTap]
+	assert.False(t, tp.offline, "the scale was ok before the restart")
+
+	require.NoError(t, s.Ping(store.DefaultTap))
+
+	// new scale goes online with the first ping
+	require.NoError(t, s.Ping("left"))
+
+	// no data for a long time, the other scale keeps the pub open
+	tp.lastOk = time.Now().Add(-2 * okLimit)
+	s.Recheck()
+	s.Recheck()
+	require.True(t, s.pub.isOpen)
+	assert.True(t, tp.offline)
+
+	require.NoError(t, s.Ping(store.DefaultTap))
+	require.NoError(t, s.Ping(store.DefaultTap))
+	assert.False(t, tp.offline)
+
+	counts := countEvents(t, s, EventScaleOffline, EventScaleOnline)
+	assert.Equal(t, 1, counts[EventScaleOffline])
+	assert.Equal(t, 2, counts[EventScaleOnline])
+}
+
+func TestScale_ScaleSilentWhileClosed(t *testing.T) {
+	s := createScaleWithMeasurements(t)
+	tp := s.taps[store.DefaultTap]
+	require.NoError(t, s.Ping(store.DefaultTap))
+
+	// the scale goes silent, the pub closes and opens again with the next ping
+	tp.lastOk = time.Now().Add(-2 * okLimit)
+	s.Recheck()
+	require.False(t, s.pub.isOpen)
+	assert.False(t, tp.offline)
+
+	require.NoError(t, s.Ping(store.DefaultTap))
+	require.True(t, s.pub.isOpen)
+
+	// a restart while the pub is closed does not report the silent scale either
+	tp.lastOk = time.Now().Add(-2 * okLimit)
+	s.Recheck()
+	require.NoError(t, s.store.SetLastOk(tp.id, tp.lastOk))
+	s.loadDataFromStore()
+	assert.False(t, s.taps[store.DefaultTap].offline)
+
+	counts := countEvents(t, s, EventScaleOffline, EventScaleOnline)
+	assert.Zero(t, counts[EventScaleOffline])
+	assert.Zero(t, counts[EventScaleOnline])
+}
+
+func TestScale_WarehouseLowEvent(t *testing.T) {
+	s := createScaleWithMeasurements(t)
+	s.config.WarehouseLowBeers = 60
+	s.stock = nil
+	s.warehouse = map[int]int{}
+	s.warehouseLow = true
+	require.NoError(t, s.IncreaseWarehouse(30, WarehouseActor{}))
+	require.NoError(t, s.IncreaseWarehouse(30, WarehouseActor{})) // 120 beers - not low
+
+	require.NoError(t, s.DecreaseWarehouse(30, WarehouseActor{})) // 60 beers left - low
+	require.NoError(t, s.DecreaseWarehouse(30, WarehouseActor{}))
+	require.NoError(t, s.IncreaseWarehouse(50, WarehouseActor{})) // 100 beers - not low anymore
+	require.NoError(t, s.DecreaseWarehouse(50, WarehouseActor{})) // low again
+
+	counts := countEvents(t, s, EventWarehouseLow)
+	assert.Equal(t, 2, counts[EventWarehouseLow])
+}
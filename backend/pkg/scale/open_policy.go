@@ -0,0 +1,429 @@
+package scale
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kotrzina/keg-scale/pkg/utils"
+)
+
+const (
+	OpenActionSend = "send"
+	OpenActionSkip = "skip"
+)
+
+const (
+	OpenPolicySourceDefault = "default" // built-in policy
+	OpenPolicySourceConfig  = "config"  // OPEN_POLICY environment variable
+	OpenPolicySourceStore   = "store"   // policy saved through the API
+)
+
+// OpenPolicy decides whether the opening message is sent when the pub opens
+// rules are evaluated in order and the first matching rule wins
+type OpenPolicy struct {
+	CloseAfter PolicyDuration `json:"close_after"` // the pub is closed when no scale sends data for this long
+	Default    string         `json:"default"`     // action when no rule matches
+	Rules      []OpenRule     `json:"rules"`
+}
+
+// OpenRule matches when all its conditions match, a rule without conditions matches always
+type OpenRule struct {
+	Name   string `json:"name"`
+	Action string `json:"action"`
+
+	Manual       *bool          `json:"manual,omitempty"`        // opened by a command instead of the scale
+	Weekdays     []string       `json:"weekdays,omitempty"`      // mon, tue, wed, thu, fri, sat, sun
+	Months       []int          `json:"months,omitempty"`        // 1 - 12
+	From         string         `json:"from,omitempty"`          // time of day HH:MM, wraps over midnight when from > to
+	To           string         `json:"to,omitempty"`            // time of day HH:MM, exclusive
+	OpenedWithin PolicyDuration `json:"opened_within,omitempty"` // the pub was opened less than this ago
+	ClosedWithin PolicyDuration `json:"closed_within,omitempty"` // the pub was closed less than this ago
+}
+
+// OpenOverride is a manual decision which wins over all rules until it expires
+// it applies to the openings by the scale only, the pub opened by a command follows the rules
+type OpenOverride struct {
+	Action string    `json:"action"`
+	Until  time.Time `json:"until"`
+}
+
+// OpenDecision explains whether the opening message would be sent
+type OpenDecision struct {
+	Send     bool      `json:"send"`
+	Rule     string    `json:"rule,omitempty"` // name of the matching rule
+	Reason   string    `json:"reason"`
+	At       time.Time `json:"at"`
+	Manual   bool      `json:"manual"`
+	OpenedAt time.Time `json:"opened_at"` // last opening of the pub
+	ClosedAt time.Time `json:"closed_at"` // last closing of the pub
+}
+
+type OpenPolicyOutput struct {
+	Policy   OpenPolicy    `json:"policy"`
+	Source   string        `json:"source"`
+	Override *OpenOverride `json:"override"` // nil without an active override
+}
+
+// PolicyDuration is a duration encoded as a string like 12h or 30m in JSON
+type PolicyDuration time.Duration
+
+var policyWeekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// DefaultOpenPolicy sends the message once per 12 hours after the pub was closed for at least 3 hours
+// we don't want to spam the group with messages
+// it could happen for example when the scale is restarted or lost Wi-Fi connection for a while
+func DefaultOpenPolicy() OpenPolicy {
+	manual := true
+	return OpenPolicy{
+		CloseAfter: PolicyDuration(okLimit),
+		Default:    OpenActionSend,
+		Rules: []OpenRule{
+			{Name: "manual opening", Action: OpenActionSend, Manual: &manual},
+			{Name: "once per 12 hours", Action: OpenActionSkip, OpenedWithin: PolicyDuration(12 * time.Hour)},
+			{Name: "at least 3 hours closed", Action: OpenActionSkip, ClosedWithin: PolicyDuration(3 * time.Hour)},
+		},
+	}
+}
+
+// ParseOpenPolicy decodes and validates the policy from JSON
+func ParseOpenPolicy(data string) (OpenPolicy, error) {
+	var p OpenPolicy
+	if err := json.Unmarshal([]byte(data), &p); err != nil {
+		return OpenPolicy{}, fmt.Errorf("could not decode open policy: %w", err)
+	}
+
+	if err := p.Validate(); err != nil {
+		return OpenPolicy{}, err
+	}
+
+	return p, nil
+}
+
+// Validate checks the policy and fills default values
+func (p *OpenPolicy) Validate() error {
+	if p.CloseAfter == 0 {
+		p.CloseAfter = PolicyDuration(okLimit)
+	}
+	if p.CloseAfter < 0 {
+		return fmt.Errorf("invalid close_after: %s", time.Duration(p.CloseAfter))
+	}
+
+	if p.Default == "" {
+		p.Default = OpenActionSend
+	}
+	if !validOpenAction(p.Default) {
+		return fmt.Errorf("invalid default action: %q", p.Default)
+	}
+
+	for i, rule := range p.Rules {
+		if err := rule.validate(); err != nil {
+			return fmt.Errorf("invalid rule %d %q: %w", i+1, rule.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (r OpenRule) validate() error {
+	if !validOpenAction(r.Action) {
+		return fmt.Errorf("invalid action: %q", r.Action)
+	}
+
+	for _, wd := range r.Weekdays {
+		if _, found := policyWeekdays[strings.ToLower(wd)]; !found {
+			return fmt.Errorf("invalid weekday: %q", wd)
+		}
+	}
+
+	for _, m := range r.Months {
+		if m < 1 || m > 12 {
+			return fmt.Errorf("invalid month: %d", m)
+		}
+	}
+
+	if (r.From == "") != (r.To == "") {
+		return fmt.Errorf("both from and to must be set")
+	}
+	if r.From != "" {
+		if _, err := parseTimeOfDay(r.From); err != nil {
+			return err
+		}
+		if _, err := parseTimeOfDay(r.To); err != nil {
+			return err
+		}
+	}
+
+	if r.OpenedWithin < 0 || r.ClosedWithin < 0 {
+		return fmt.Errorf("durations must not be negative")
+	}
+
+	return nil
+}
+
+// Decide evaluates the policy for the pub opening at the given time
+func (p OpenPolicy) Decide(at, openedAt, closedAt time.Time, manual bool, override *OpenOverride) OpenDecision {
+	decision := OpenDecision{
+		At:       at,
+		Manual:   manual,
+		OpenedAt: openedAt,
+		ClosedAt: closedAt,
+	}
+
+	if override != nil && !manual && at.Before(override.Until) {
+		decision.Send = override.Action == OpenActionSend
+		decision.Reason = fmt.Sprintf("manual override %s until %s", override.Action, utils.FormatDate(override.Until))
+		return decision
+	}
+
+	for _, rule := range p.Rules {
+		if rule.matches(at, openedAt, closedAt, manual) {
+			decision.Send = rule.Action == OpenActionSend
+			decision.Rule = rule.Name
+			decision.Reason = fmt.Sprintf("rule %q: %s", rule.Name, rule.Action)
+			return decision
+		}
+	}
+
+	decision.Send = p.Default == OpenActionSend
+	decision.Reason = fmt.Sprintf("no rule matched: %s", p.Default)
+	return decision
+}
+
+func (r OpenRule) matches(at, openedAt, closedAt time.Time, manual bool) bool {
+	local := at.In(utils.GetTz())
+
+	if r.Manual != nil && *r.Manual != manual {
+		return false
+	}
+
+	if len(r.Weekdays) > 0 && !slices.ContainsFunc(r.Weekdays, func(wd string) bool {
+		return policyWeekdays[strings.ToLower(wd)] == local.Weekday()
+	}) {
+		return false
+	}
+
+	if len(r.Months) > 0 && !slices.Contains(r.Months, int(local.Month())) {
+		return false
+	}
+
+	if r.From != "" {
+		from, _ := parseTimeOfDay(r.From) // validated
+		to, _ := parseTimeOfDay(r.To)
+		now := time.Duration(local.Hour())*time.Hour + time.Duration(local.Minute())*time.Minute
+		if from <= to && (now < from || now >= to) {
+			return false
+		}
+		if from > to && now < from && now >= to {
+			return false
+		}
+	}
+
+	if r.OpenedWithin > 0 && at.Sub(openedAt) >= time.Duration(r.OpenedWithin) {
+		return false
+	}
+
+	if r.ClosedWithin > 0 && at.Sub(closedAt) >= time.Duration(r.ClosedWithin) {
+		return false
+	}
+
+	return true
+}
+
+func validOpenAction(action string) bool {
+	return action == OpenActionSend || action == OpenActionSkip
+}
+
+// parseTimeOfDay returns the duration since midnight
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day: %q", s)
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func (d PolicyDuration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *PolicyDuration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string like 12h: %w", err)
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %w", s, err)
+	}
+
+	*d = PolicyDuration(parsed)
+	return nil
+}
+
+// loadOpenPolicy loads the policy saved through the API, then the configured one, then the default one
+func (s *Scale) loadOpenPolicy() {
+	s.pub.policy = DefaultOpenPolicy()
+	s.pub.policySource = OpenPolicySourceDefault
+
+	if s.config.OpenPolicy != "" {
+		p, err := ParseOpenPolicy(s.config.OpenPolicy)
+		if err != nil {
+			s.logger.Errorf("Invalid open policy in config, using the default one: %v", err)
+		} else {
+			s.pub.policy = p
+			s.pub.policySource = OpenPolicySourceConfig
+		}
+	}
+
+	stored, err := s.store.GetOpenPolicy()
+	if err != nil {
+		s.logger.Errorf("Could not load open policy: %v", err)
+		return
+	}
+	if stored == "" {
+		return
+	}
+
+	p, err := ParseOpenPolicy(stored)
+	if err != nil {
+		s.logger.Errorf("Invalid stored open policy, using the %s one: %v", s.pub.policySource, err)
+		return
+	}
+	s.pub.policy = p
+	s.pub.policySource = OpenPolicySourceStore
+}
+
+// loadOpenOverride loads the manual override saved through the API
+func (s *Scale) loadOpenOverride() {
+	stored, err := s.store.GetOpenOverride()
+	if err != nil {
+		s.logger.Errorf("Could not load open override: %v", err)
+		return
+	}
+	if stored == "" {
+		return
+	}
+
+	var override OpenOverride
+	if err := json.Unmarshal([]byte(stored), &override); err != nil {
+		s.logger.Errorf("Invalid stored open override: %v", err)
+		return
+	}
+	s.pub.override = &override
+}
+
+// okLimit returns how long a scale can be without data before it is considered not ok
+func (s *Scale) okLimit() time.Duration {
+	return time.Duration(s.pub.policy.CloseAfter)
+}
+
+// activeOpenOverride returns the override if it has not expired yet
+func (s *Scale) activeOpenOverride() *OpenOverride {
+	if s.pub.override == nil || !s.clock.Now().Before(s.pub.override.Until) {
+		return nil
+	}
+
+	override := *s.pub.override
+	return &override
+}
+
+// decideOpen applies the policy for the pub which is just opening
+func (s *Scale) decideOpen(manual bool) OpenDecision {
+	return s.pub.policy.Decide(s.clock.Now(), s.pub.openedAt, s.pub.closedAt, manual, s.activeOpenOverride())
+}
+
+// GetOpenPolicy returns the active policy with its source and the active override
+func (s *Scale) GetOpenPolicy() OpenPolicyOutput {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	return OpenPolicyOutput{
+		Policy:   s.pub.policy,
+		Source:   s.pub.policySource,
+		Override: s.activeOpenOverride(),
+	}
+}
+
+// SetOpenPolicy validates, stores and applies the policy
+func (s *Scale) SetOpenPolicy(p OpenPolicy) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("could not encode open policy: %w", err)
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if err := s.store.SetOpenPolicy(string(data)); err != nil {
+		return fmt.Errorf("could not store open policy: %w", err)
+	}
+
+	s.pub.policy = p
+	s.pub.policySource = OpenPolicySourceStore
+	s.logger.Infof("Open policy updated with %d rules", len(p.Rules))
+
+	return nil
+}
+
+// SetOpenOverride sends or skips the opening message until the given time regardless of the rules
+// an empty action removes the override, the override is kept in the store over restarts
+func (s *Scale) SetOpenOverride(action string, until time.Time) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if action == "" {
+		if err := s.store.SetOpenOverride(""); err != nil {
+			return fmt.Errorf("could not store open override: %w", err)
+		}
+		s.pub.override = nil
+		s.logger.Infof("Open override removed")
+		return nil
+	}
+
+	if !validOpenAction(action) {
+		return fmt.Errorf("invalid action: %q", action)
+	}
+
+	if !until.After(s.clock.Now()) {
+		return fmt.Errorf("override must end in the future")
+	}
+
+	override := OpenOverride{Action: action, Until: until}
+	data, err := json.Marshal(override)
+	if err != nil {
+		return fmt.Errorf("could not encode open override: %w", err)
+	}
+	if err := s.store.SetOpenOverride(string(data)); err != nil {
+		return fmt.Errorf("could not store open override: %w", err)
+	}
+
+	s.pub.override = &override
+	s.logger.Infof("Open override %s until %s", action, utils.FormatDate(until))
+
+	return nil
+}
+
+// PreviewOpen returns whether the opening message would be sent if the pub opened at the given time
+func (s *Scale) PreviewOpen(at time.Time, manual bool) OpenDecision {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	return s.pub.policy.Decide(at, s.pub.openedAt, s.pub.closedAt, manual, s.activeOpenOverride())
+}
@@ -0,0 +1,141 @@
+package scale
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kotrzina/keg-scale/pkg/store"
+	"github.com/kotrzina/keg-scale/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenPolicy_Decide(t *testing.T) {
+	policy, err := ParseOpenPolicy(`{
+		"close_after": "15m",
+		"rules": [
+			{"name": "quiet hours", "action": "skip", "from": "22:00", "to": "06:00"},
+			{"name": "no monday", "action": "skip", "weekdays": ["mon"]},
+			{"name": "manual", "action": "send", "manual": true},
+			{"name": "winter debounce", "action": "skip", "months": [12, 1, 2], "opened_within": "24h"},
+			{"name": "debounce", "action": "skip", "opened_within": "12h"}
+		]
+	}`)
+	require.NoError(t, err)
+	assert.Equal(t, 15*time.Minute, time.Duration(policy.CloseAfter))
+	assert.Equal(t, OpenActionSend, policy.Default)
+
+	at := func(month time.Month, day, hour int) time.Time {
+		return time.Date(2024, month, day, hour, 0, 0, 0, utils.GetTz())
+	}
+	longAgo := at(1, 1, 0).Add(-1000 * time.Hour)
+
+	cases := []struct {
+		name     string
+		at       time.Time
+		openedAt time.Time
+		manual   bool
+		send     bool
+		rule     string
+	}{
+		{"no rule", at(6, 14, 18), longAgo, false, true, ""}, // friday
+		{"quiet hours", at(6, 14, 23), longAgo, false, false, "quiet hours"},
+		{"quiet hours after midnight", at(6, 15, 5), longAgo, true, false, "quiet hours"},
+		{"monday", at(6, 17, 18), longAgo, false, false, "no monday"},
+		{"manual wins over debounce", at(6, 14, 18), at(6, 14, 10), true, true, "manual"},
+		{"debounce", at(6, 14, 18), at(6, 14, 10), false, false, "debounce"},
+		{"winter debounce", at(12, 13, 18), at(12, 12, 20), false, false, "winter debounce"},
+		{"summer without winter debounce", at(6, 14, 18), at(6, 13, 20), false, true, ""},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			d := policy.Decide(tt.at, tt.openedAt, longAgo, tt.manual, nil)
+			assert.Equal(t, tt.send, d.Send, d.Reason)
+			assert.Equal(t, tt.rule, d.Rule)
+		})
+	}
+
+	override := &OpenOverride{Action: OpenActionSend, Until: at(6, 15, 0)}
+	d := policy.Decide(at(6, 14, 23), longAgo, longAgo, false, override)
+	assert.True(t, d.Send, "override wins over quiet hours")
+	assert.Contains(t, d.Reason, "override")
+
+	d = policy.Decide(at(6, 15, 1), longAgo, longAgo, false, override)
+	assert.False(t, d.Send, "expired override")
+
+	override = &OpenOverride{Action: OpenActionSkip, Until: at(6, 15, 0)}
+	d = policy.Decide(at(6, 14, 18), longAgo, longAgo, true, override)
+	assert.True(t, d.Send, "the pub opened by a command ignores the override")
+	assert.Equal(t, "manual", d.Rule)
+}
+
+func TestScale_ForceOpenAfterSkip(t *testing.T) {
+	s := createScaleWithMeasurements(t)
+	require.False(t, s.pub.isOpen)
+
+	// !no_message and then !open
+	require.NoError(t, s.SetOpenOverride(OpenActionSkip, time.Now().Add(12*time.Hour)))
+	require.NoError(t, s.ForceOpen())
+	assert.Equal(t, 1, countEvents(t, s, EventOpen)[EventOpen])
+}
+
+func TestParseOpenPolicy_Invalid(t *testing.T) {
+	invalid := []string{
+		`{"rules": [{"action": "maybe"}]}`,
+		`{"rules": [{"action": "skip", "weekdays": ["monday"]}]}`,
+		`{"rules": [{"action": "skip", "months": [13]}]}`,
+		`{"rules": [{"action": "skip", "from": "22:00"}]}`,
+		`{"rules": [{"action": "skip", "from": "25:00", "to": "06:00"}]}`,
+		`{"rules": [{"action": "skip", "opened_within": 12}]}`,
+		`{"default": "never"}`,
+	}
+
+	for _, data := range invalid {
+		_, err := ParseOpenPolicy(data)
+		assert.Error(t, err, data)
+	}
+}
+
+func TestScale_OpenPolicy(t *testing.T) {
+	s := createScaleWithMeasurements(t)
+	assert.Equal(t, OpenPolicySourceDefault, s.GetOpenPolicy().Source)
+
+	policy := OpenPolicy{
+		Rules: []OpenRule{{Name: "never", Action: OpenActionSkip}},
+	}
+	require.NoError(t, s.SetOpenPolicy(policy))
+	assert.Equal(t, OpenPolicySourceStore, s.GetOpenPolicy().Source)
+	assert.Equal(t, okLimit, s.okLimit(), "default close_after")
+
+	d := s.PreviewOpen(time.Now(), false)
+	assert.False(t, d.Send)
+	assert.Equal(t, "never", d.Rule)
+
+	require.NoError(t, s.SetOpenOverride(OpenActionSend, time.Now().Add(time.Hour)))
+	assert.NotNil(t, s.GetOpenPolicy().Override)
+	assert.True(t, s.PreviewOpen(time.Now(), false).Send)
+
+	// the override survives a restart
+	s.pub.override = nil
+	s.loadOpenOverride()
+	require.NotNil(t, s.GetOpenPolicy().Override)
+	assert.Equal(t, OpenActionSend, s.GetOpenPolicy().Override.Action)
+
+	require.NoError(t, s.SetOpenOverride("", time.Time{}))
+	assert.Nil(t, s.GetOpenPolicy().Override)
+	s.loadOpenOverride()
+	assert.Nil(t, s.GetOpenPolicy().Override)
+	assert.Error(t, s.SetOpenOverride(OpenActionSkip, time.Now().Add(-time.Hour)))
+
+	// the stored policy wins over the config after a restart
+	s.config.OpenPolicy = `{"rules": []}`
+	s.loadOpenPolicy()
+	assert.Equal(t, OpenPolicySourceStore, s.pub.policySource)
+	assert.Len(t, s.pub.policy.Rules, 1)
+
+	s.store = &store.FakeStore{}
+	s.loadOpenPolicy()
+	assert.Equal(t, OpenPolicySourceConfig, s.pub.policySource)
+	assert.Empty(t, s.pub.policy.Rules)
+}
@@ -0,0 +1,136 @@
+package scale
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	pourStabilityTolerance = 30.0  // grams - two readings of a settled scale are closer than this
+	pourMinWeight          = 250.0 // grams - smaller drops are noise or foam
+	pourMaxWeight          = 700.0 // grams - bigger drops are more pours at once or a keg manipulation
+
+	ServingSmall = 0.3 // liters - default servings of the keg type
+	ServingLarge = 0.5 // liters
+)
+
+// pourDetector recognises individual pours from the drops of a settled scale
+type pourDetector struct {
+	lastWeight   float64 // last reading
+	stableWeight float64 // weight before the current pour, zero when unknown
+
+	sessionAt time.Time // start of the pub session the counters belong to
+	pours     int
+	volume    float64 // liters poured in the session
+	waste     float64 // liters poured over the serving size in the session
+}
+
+// Pour is a single detected pour
+type Pour struct {
+	Tap     string    `json:"tap"`
+	At      time.Time `json:"at"`
+	Volume  float64   `json:"volume"`  // liters
+	Serving float64   `json:"serving"` // the closest serving size in liters
+	Waste   float64   `json:"waste"`   // liters over the serving size - usually foam
+}
+
+type PourOutput struct {
+	SessionPours  int     `json:"session_pours"`
+	SessionVolume float64 `json:"session_volume"` // liters
+	SessionWaste  float64 `json:"session_waste"`  // liters
+}
+
+// detectPour checks the last measurement of the tap for a finished pour
+// the scale is moving while the beer is being poured, so we compare settled readings only
+func (s *Scale) detectPour(t *tap) (Pour, bool) {
+	p := &t.pour
+
+	// new session - reset counters
+	if p.sessionAt.Before(s.pub.openedAt) {
+		p.sessionAt = s.pub.openedAt
+		p.pours = 0
+		p.volume = 0
+		p.waste = 0
+	}
+
+	previous := p.lastWeight
+	p.lastWeight = t.weight
+
+	if t.activeKeg == 0 {
+		p.stableWeight = 0
+		return Pour{}, false
+	}
+
+	if math.Abs(t.weight-previous) > pourStabilityTolerance {
+		return Pour{}, false // still moving
+	}
+
+	if p.stableWeight == 0 || t.weight > p.stableWeight {
+		p.stableWeight = t.weight // first reading or the scale went up
+		return Pour{}, false
+	}
+
+	drop := p.stableWeight - t.weight
+	if drop < pourMinWeight {
+		return Pour{}, false // keep the baseline, small drops add up
+	}
+
+	p.stableWeight = t.weight
+	if drop > pourMaxWeight {
+		s.logger.Debugf("Weight drop %.0f g is too big for a single pour (tap %s)", drop, t.id)
+		return Pour{}, false
+	}
+
+	kt := s.catalog.kegType(t.activeKeg)
+	volume := drop / 1000 / kt.Density
+	serving := closestServing(kt.Servings, volume)
+
+	pour := Pour{
+		Tap:     t.id,
+		At:      t.weightAt,
+		Volume:  volume,
+		Serving: serving,
+		Waste:   math.Max(0, volume-serving),
+	}
+
+	p.pours++
+	p.volume += pour.Volume
+	p.waste += pour.Waste
+
+	return pour, true
+}
+
+// closestServing returns the serving size closest to the poured volume
+func closestServing(servings []float64, volume float64) float64 {
+	serving := servings[0]
+	for _, s := range servings[1:] {
+		if math.Abs(volume-s) < math.Abs(volume-serving) {
+			serving = s
+		}
+	}
+
+	return serving
+}
+
+// handlePour reports the detected pour
+func (s *Scale) handlePour(t *tap, pour Pour) {
+	s.monitor.Pours.WithLabelValues(pour.Tap, fmt.Sprintf("%.1f", pour.Serving)).Inc()
+	s.logger.Infof("Pour of %.2f l (%.1f l serving) detected on tap %s", pour.Volume, pour.Serving, pour.Tap)
+	payload := s.newTapEvent(EventPour, t, EventReasonScale)
+	payload.At = pour.At
+	payload.Pour = &pour
+	s.dispatchEvent(payload)
+}
+
+func (s *Scale) getPourOutput(t *tap) PourOutput {
+	if t.pour.sessionAt.Before(s.pub.openedAt) {
+		return PourOutput{} // counters belong to the previous session
+	}
+
+	return PourOutput{
+		SessionPours:  t.pour.pours,
+		SessionVolume: t.pour.volume,
+		SessionWaste:  t.pour.waste,
+	}
+}
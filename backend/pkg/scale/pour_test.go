@@ -0,0 +1,94 @@
+package scale
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kotrzina/keg-scale/pkg/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScale_detectPour(t *testing.T) {
+	s := createScaleWithMeasurements(t)
+	s.pub.openedAt = time.Now().Add(-time.Hour)
+
+	tp := s.taps[store.DefaultTap]
+	tp.activeKeg = 50
+
+	var pours []Pour
+	readings := []float64{
+		40000, 40000, // settled
+		39800, 39600, 39510, 39500, // 0.5 l pour
+		39500,
+		39400, 39210, 39200, // 0.3 l pour
+		39190,
+		39100, 39000, 39000, 38990, 38900, 38800, 38440, 38450, // more pours at once
+		38450,
+		38500, 38510, // the scale went up - new baseline
+		38400, 38390, // small drop is kept
+		38260, 38260, // adds up to 0.25 kg
+	}
+	for _, w := range readings {
+		tp.weight = w
+		tp.weightAt = time.Now()
+		if pour, ok := s.detectPour(tp); ok {
+			pours = append(pours, pour)
+		}
+	}
+
+	require.Len(t, pours, 3)
+	assert.InEpsilon(t, 0.5, pours[0].Volume, 0.000001)
+	assert.InEpsilon(t, ServingLarge, pours[0].Serving, 0.000001)
+	assert.InEpsilon(t, 0.3, pours[1].Volume, 0.000001)
+	assert.InEpsilon(t, ServingSmall, pours[1].Serving, 0.000001)
+	assert.InEpsilon(t, 0.25, pours[2].Volume, 0.000001)
+
+	output := s.getPourOutput(tp)
+	assert.Equal(t, 3, output.SessionPours)
+	assert.InEpsilon(t, 1.05, output.SessionVolume, 0.000001)
+
+	// new session starts from zero
+	s.pub.openedAt = time.Now()
+	assert.Equal(t, 0, s.getPourOutput(tp).SessionPours)
+}
+
+func TestScale_detectPourWaste(t *testing.T) {
+	s := createScaleWithMeasurements(t)
+
+	tp := s.taps[store.DefaultTap]
+	tp.activeKeg = 30
+
+	for _, w := range []float64{30000, 30000, 29380, 29380} {
+		tp.weight = w
+		if pour, ok := s.detectPour(tp); ok {
+			assert.InEpsilon(t, ServingLarge, pour.Serving, 0.000001)
+			assert.InEpsilon(t, 0.12, pour.Waste, 0.000001)
+			return
+		}
+	}
+
+	t.Fatal("pour was not detected")
+}
+
+func TestScale_detectPourServings(t *testing.T) {
+	s := createScaleWithMeasurements(t)
+	require.NoError(t, s.SetKegType(store.KegType{Size: 30, EmptyWeight: 10000, Servings: []float64{0.3, 0.4, 0.5}}))
+
+	tp := s.taps[store.DefaultTap]
+	tp.activeKeg = 30
+
+	var pours []Pour
+	for _, w := range []float64{30000, 30000, 29590, 29590, 29290, 29290, 28780, 28780} {
+		tp.weight = w
+		if pour, ok := s.detectPour(tp); ok {
+			pours = append(pours, pour)
+		}
+	}
+
+	require.Len(t, pours, 3)
+	assert.InEpsilon(t, 0.4, pours[0].Serving, 0.000001)
+	assert.InEpsilon(t, 0.3, pours[1].Serving, 0.000001)
+	assert.InEpsilon(t, 0.5, pours[2].Serving, 0.000001)
+	assert.InEpsilon(t, 0.01, pours[2].Waste, 0.000001)
+}
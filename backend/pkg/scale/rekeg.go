@@ -0,0 +1,184 @@
+package scale
+
+import (
+	"math"
+	"time"
+)
+
+type RekegState string
+
+const (
+	RekegStateIdle      RekegState = "idle"      // the active keg is on the scale
+	RekegStateRemoved   RekegState = "removed"   // the scale was emptied, a new keg is expected
+	RekegStateCandidate RekegState = "candidate" // a new keg is on the scale and waits for confirmation
+	RekegStateAmbiguous RekegState = "ambiguous" // a new keg may be on the scale, manual confirmation is needed
+)
+
+const (
+	rekegJump            = 3000.0           // grams - weight can go up this much only when a keg is swapped
+	rekegSettleTolerance = 500.0            // grams - the weight returned to the active keg when it is this close
+	rekegEvidenceWindow  = 30 * time.Minute // a keg swap takes minutes, older removals and jumps are forgotten
+
+	rekegConfirmConfidence  = 0.7  // candidates with higher confidence are tapped
+	rekegEscalateConfidence = 0.35 // candidates with higher confidence are reported as ambiguous
+
+	// parts of the confidence
+	rekegWeightWeight    = 0.4  // how close the weight is to the full keg
+	rekegHistoryWeight   = 0.4  // the scale was emptied or the weight jumped
+	rekegActivePenalty   = 0.3  // the weight is explained by the active keg being drunk
+	rekegWarehouseWeight = 0.2  // the keg is in the warehouse
+	rekegAmbiguousMatch  = 0.15 // two catalog kegs with closer scores are ambiguous
+	rekegAmbiguousCap    = 0.5  // max confidence of ambiguous catalog matches
+)
+
+// rekeg tracks the keg swap of a single tap
+type rekeg struct {
+	state      RekegState
+	removedAt  time.Time // when the scale was emptied since the last rekeg
+	jumpedAt   time.Time // when the weight jumped up since the last rekeg
+	before     float64   // weight of the active keg before the scale was emptied or the weight jumped
+	baseline   bool      // the keg was set manually, the next weight belongs to it
+	confidence float64   // confidence of the current candidate
+	escalated  bool      // the ambiguous candidate was already reported
+}
+
+type RekegOutput struct {
+	State      RekegState `json:"state"`
+	Candidate  int        `json:"candidate"`
+	Confidence float64    `json:"confidence"`
+}
+
+// observeRemoval notes that there is nothing on the scale - a keg swap has started
+func (s *Scale) observeRemoval(t *tap) {
+	if t.rekeg.state != RekegStateRemoved {
+		s.logger.Infof("Scale of tap %s is empty, waiting for a new keg", t.id)
+	}
+
+	if !t.hasRekegEvidence() {
+		t.rekeg.before = t.weight
+	}
+	t.filter = weightFilter{} // readings of the removed keg must not smooth the next one
+	t.rekeg.state = RekegStateRemoved
+	t.rekeg.removedAt = s.clock.Now()
+	t.rekeg.escalated = false
+}
+
+// observeWeight notes a jump of the weight - kegs only get lighter while being drunk
+// the evidence of a keg swap is forgotten when the weight returns to the active keg or after a while
+func (s *Scale) observeWeight(t *tap, previous float64) {
+	if t.rekeg.baseline {
+		t.rekeg.baseline = false
+		return
+	}
+
+	if previous > 0 && t.weight-previous > rekegJump {
+		if !t.hasRekegEvidence() {
+			t.rekeg.before = previous
+		}
+		t.rekeg.jumpedAt = s.clock.Now()
+		t.rekeg.escalated = false
+		return
+	}
+
+	if !t.hasRekegEvidence() {
+		return
+	}
+
+	// e.g. a single glitch reading, the same keg is still there
+	settled := t.activeKeg > 0 && t.rekeg.before > 0 &&
+		t.weight >= t.rekeg.before-rekegJump && t.weight <= t.rekeg.before+rekegSettleTolerance
+	expired := s.clock.Since(t.lastRekegEvidence()) > rekegEvidenceWindow
+	if settled || expired {
+		s.logger.Infof("Keg swap evidence of tap %s forgotten with current value %.0f", t.id, t.weight)
+		t.rekeg.removedAt = time.Time{}
+		t.rekeg.jumpedAt = time.Time{}
+		t.rekeg.before = 0
+		if t.rekeg.state == RekegStateRemoved {
+			t.rekeg.state = RekegStateIdle
+		}
+	}
+}
+
+// hasRekegEvidence returns true when the weight history shows a keg swap
+func (t *tap) hasRekegEvidence() bool {
+	return !t.rekeg.removedAt.IsZero() || !t.rekeg.jumpedAt.IsZero()
+}
+
+// lastRekegEvidence returns when the scale was emptied or the weight jumped the last time
+func (t *tap) lastRekegEvidence() time.Time {
+	if t.rekeg.jumpedAt.After(t.rekeg.removedAt) {
+		return t.rekeg.jumpedAt
+	}
+
+	return t.rekeg.removedAt
+}
+
+// rekegConfidence computes how sure we are that the best match is a newly tapped keg
+// it combines the weight match, the weight history, the active keg and the warehouse
+func (s *Scale) rekegConfidence(t *tap, matches []KegMatch) float64 {
+	best := matches[0]
+	confidence := rekegWeightWeight * best.Score
+
+	switch {
+	case t.hasRekegEvidence() || t.activeKeg == 0:
+		confidence += rekegHistoryWeight
+	case s.fitsActiveKeg(t):
+		// e.g. empty 50l keg weighs the same as full 10l keg
+		confidence -= rekegActivePenalty
+	}
+
+	if s.warehouse[best.Size] > 0 {
+		confidence += rekegWarehouseWeight
+	}
+
+	if len(matches) > 1 && best.Score-matches[1].Score < rekegAmbiguousMatch {
+		confidence = math.Min(confidence, rekegAmbiguousCap)
+	}
+
+	return math.Max(0, math.Min(1, confidence))
+}
+
+// fitsActiveKeg returns true if the weight can be the active keg somewhere between full and empty
+func (s *Scale) fitsActiveKeg(t *tap) bool {
+	if t.activeKeg == 0 {
+		return false
+	}
+
+	empty, foundEmpty := s.catalog.EmptyWeights()[t.activeKeg]
+	full, foundFull := s.catalog.FullWeights()[t.activeKeg]
+
+	return foundEmpty && foundFull && t.weight > empty-kegMatchTolerance && t.weight < full+kegMatchTolerance
+}
+
+// resetRekeg returns the rekeg state machine to the idle state
+func (t *tap) resetRekeg() {
+	t.rekeg = rekeg{state: RekegStateIdle}
+}
+
+// escalateRekeg reports an ambiguous candidate once so it can be confirmed manually
+func (s *Scale) escalateRekeg(t *tap, keg int) {
+	t.rekeg.state = RekegStateAmbiguous
+	if t.rekeg.escalated {
+		return
+	}
+
+	t.rekeg.escalated = true
+	s.logger.Warnf("New keg (%d l) is AMBIGUOUS with current value %.0f and confidence %.2f (tap %s)", keg, t.weight, t.rekeg.confidence, t.id)
+	payload := s.newTapEvent(EventRekegAmbiguous, t, EventReasonScale)
+	payload.Keg = keg
+	payload.Confidence = t.rekeg.confidence
+	s.dispatchEvent(payload)
+}
+
+func (s *Scale) getRekegOutput(t *tap) RekegOutput {
+	state := t.rekeg.state
+	if state == "" {
+		state = RekegStateIdle
+	}
+
+	return RekegOutput{
+		State:      state,
+		Candidate:  t.candidateKeg,
+		Confidence: t.rekeg.confidence,
+	}
+}
@@ -0,0 +1,147 @@
+package scale
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kotrzina/keg-scale/pkg/clock"
+	"github.com/kotrzina/keg-scale/pkg/config"
+	"github.com/kotrzina/keg-scale/pkg/store"
+	"github.com/kotrzina/keg-scale/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func addMeasurements(t *testing.T, s *Scale, weights ...float64) {
+	t.Helper()
+	for _, w := range weights {
+		require.NoError(t, s.AddMeasurement(store.DefaultTap, w))
+	}
+}
+
+func TestScale_RekegEmpty50lIsNot10l(t *testing.T) {
+	s := createScaleWithMeasurements(t, 63.5, 63.5)
+	tp := s.taps[store.DefaultTap]
+	require.Equal(t, 50, tp.activeKeg)
+
+	// the 50l keg is being drunk until it weighs like a full 10l keg
+	addMeasurements(t, s, 40000, 20000, 15800, 15800, 15800)
+
+	assert.Equal(t, 50, tp.activeKeg)
+	assert.Equal(t, 0, tp.candidateKeg)
+	assert.NotEqual(t, RekegStateAmbiguous, s.GetScale().Rekeg.State)
+}
+
+func TestScale_RekegSwap50lFor10l(t *testing.T) {
+	s := createScaleWithMeasurements(t, 63.5, 63.5)
+	tp := s.taps[store.DefaultTap]
+
+	// the 50l keg is almost empty, it is removed and a 10l keg is tapped
+	addMeasurements(t, s, 14500, 14500, 150, -20, 16000)
+	assert.Equal(t, RekegStateCandidate, tp.rekeg.state)
+	assert.Equal(t, 10, tp.candidateKeg)
+	assert.GreaterOrEqual(t, tp.rekeg.confidence, rekegConfirmConfidence)
+
+	addMeasurements(t, s, 16000)
+	assert.Equal(t, 10, tp.activeKeg)
+	assert.Equal(t, RekegStateIdle, tp.rekeg.state)
+
+	kegs, err := s.GetKegHistory(store.DefaultTap, 10)
+	require.NoError(t, err)
+	require.Len(t, kegs, 2)
+	assert.Equal(t, 10, kegs[0].Size)
+	assert.Equal(t, 50, kegs[1].Size)
+}
+
+func TestScale_RekegGlitchIsForgotten(t *testing.T) {
+	cases := []struct {
+		name   string
+		weight float64
+	}{
+		{name: "half full 50l keg is not a full 30l keg", weight: 40500},
+		{name: "drained 50l keg is not a full 10l keg", weight: 15900},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := createScaleWithMeasurements(t, 63.5, 63.5)
+			tp := s.taps[store.DefaultTap]
+			addMeasurements(t, s, c.weight, c.weight)
+
+			// a single glitch reading, the same keg is still on the scale
+			addMeasurements(t, s, 0, c.weight)
+			assert.False(t, tp.hasRekegEvidence())
+			assert.Equal(t, RekegStateIdle, tp.rekeg.state)
+
+			addMeasurements(t, s, c.weight, c.weight, c.weight)
+			assert.Equal(t, 50, tp.activeKeg)
+			assert.Equal(t, 0, tp.candidateKeg)
+		})
+	}
+}
+
+func TestScale_RekegEvidenceExpires(t *testing.T) {
+	clk := clock.NewFake(time.Date(2025, 3, 14, 18, 0, 0, 0, utils.GetTz()))
+	s := createScaleWithClock(t, clk)
+	s.config.Filter = config.MeasurementFilter{Window: 1}
+	tp := s.taps[store.DefaultTap]
+
+	require.NoError(t, s.SetActiveKeg(store.DefaultTap, 50))
+	addMeasurements(t, s, 20000, 20000, 0)
+	require.True(t, tp.hasRekegEvidence())
+
+	// the weight fits the active keg long after the scale was emptied
+	clk.Advance(rekegEvidenceWindow + time.Minute)
+	addMeasurements(t, s, 16000, 16000)
+	assert.False(t, tp.hasRekegEvidence())
+	assert.Equal(t, 50, tp.activeKeg)
+	assert.Equal(t, 0, tp.candidateKeg)
+}
+
+func TestScale_RekegAfterManualKeg(t *testing.T) {
+	s := createScaleWithMeasurements(t, 16, 16)
+	require.Equal(t, 10, s.taps[store.DefaultTap].activeKeg)
+
+	// the 30l keg is set manually before the scale reports it, the weight jump is not a swap
+	require.NoError(t, s.SetActiveKeg(store.DefaultTap, 30))
+	addMeasurements(t, s, 30000, 30000)
+	assert.Equal(t, 30, s.taps[store.DefaultTap].activeKeg)
+	assert.Equal(t, 0, s.taps[store.DefaultTap].candidateKeg)
+}
+
+func TestScale_RekegAmbiguous(t *testing.T) {
+	s := createScaleWithMeasurements(t, 40, 40)
+	tp := s.taps[store.DefaultTap]
+	require.Equal(t, 30, tp.activeKeg)
+
+	// 10l keg is not in the warehouse and its weight is off
+	require.NoError(t, s.DecreaseWarehouse(10, WarehouseActor{}))
+	require.Zero(t, s.warehouse[10])
+	addMeasurements(t, s, 150, 17500, 17500, 17500)
+
+	assert.Equal(t, 30, tp.activeKeg)
+	output := s.GetScale().Rekeg
+	assert.Equal(t, RekegStateAmbiguous, output.State)
+	assert.Greater(t, output.Confidence, rekegEscalateConfidence)
+	assert.Less(t, output.Confidence, rekegConfirmConfidence)
+	assert.True(t, tp.rekeg.escalated)
+
+	// the keg is confirmed manually
+	require.NoError(t, s.SetActiveKeg(store.DefaultTap, 10))
+	assert.Equal(t, RekegStateIdle, s.GetScale().Rekeg.State)
+}
+
+func TestScale_rekegConfidenceAmbiguousCatalog(t *testing.T) {
+	s := createScaleWithMeasurements(t)
+	s.catalog = NewKegCatalog([]store.KegType{
+		{Size: 10, EmptyWeight: 6000},
+		{Size: 12, EmptyWeight: 5000},
+	})
+
+	tp := s.taps[store.DefaultTap]
+	tp.weight = 16500
+	matches := s.catalog.MatchKegs(tp.weight)
+	require.Len(t, matches, 2)
+
+	assert.LessOrEqual(t, s.rekegConfidence(tp, matches), rekegAmbiguousCap)
+}
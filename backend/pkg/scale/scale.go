@@ -2,12 +2,13 @@ package scale
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
 
 	"github.com/hako/durafmt"
-	"github.com/jbub/fio"
+	"github.com/kotrzina/keg-scale/pkg/clock"
 	"github.com/kotrzina/keg-scale/pkg/config"
 	"github.com/kotrzina/keg-scale/pkg/prometheus"
 	"github.com/kotrzina/keg-scale/pkg/store"
@@ -19,27 +20,25 @@ type Scale struct {
 	mux     sync.RWMutex
 	monitor *prometheus.Monitor
 
-	weight       float64 // current scale value
-	weightAt     time.Time
-	candidateKeg int       // candidate keg size
-	activeKeg    int       // int value of the active keg in liters
-	activeKegAt  time.Time // time when the active keg was set
-	beersLeft    int       // how many beers are left in the keg
-	beersTotal   int       // how many beers were consumed ever
-	isLow        bool      // is the keg low and needs to be replaced soon
-	warehouse    [5]int    // warehouse of kegs [10l, 15l, 20l, 30l, 50l]
+	taps         map[string]*tap  // scales with kegs - tap id => tap
+	beersTotal   int              // how many beers were consumed ever
+	litersTotal  float64          // how many liters were consumed ever
+	warehouse    map[int]int      // warehouse of kegs - keg size => amount, counted from the stock
+	stock        []store.StockKeg // kegs in the warehouse in the order they should be tapped
+	empties      []store.EmptyKeg // emptied kegs waiting for the return to the supplier
+	warehouseLow bool             // low warehouse was already reported
+	catalog      KegCatalog       // known keg types
 
 	pub        pub
 	bank       *bank
 	attendance attendance
 
-	lastOk time.Time
-	rssi   float64
-
-	events map[EventType][]Event
+	events      map[EventType][]Event
+	dispatching sync.WaitGroup // events being stored and handled by callbacks
 
 	store    store.Storage
 	config   *config.Config
+	clock    clock.Clock
 	logger   *logrus.Logger
 	ctx      context.Context
 	fmtUnits durafmt.Units
@@ -49,19 +48,27 @@ type pub struct {
 	isOpen   bool
 	openedAt time.Time
 	closedAt time.Time
+	session  pubSession
+
+	policy       OpenPolicy    // rules for sending the opening message
+	policySource string        // where the policy was loaded from
+	override     *OpenOverride // manual decision which wins over the policy
 }
 
 type bank struct {
-	client *fio.Client
+	provider BankProvider // nil when the bank is not configured
 
 	lastUpdate   time.Time
-	transactions []TransactionOutput
+	from         time.Time           // the oldest day of the transactions in the store
+	transactions []TransactionOutput // transactions of the recent days
 	balance      BalanceOutput
 
 	refreshMtx sync.Mutex // only one refresh at a time
 }
 
-const okLimit = 10 * time.Minute
+const okLimit = 10 * time.Minute // default time without data before the pub is closed
+
+const storePruneInterval = time.Hour // how often old rows are deleted from the store
 
 const localizationUnits = "r:r,t:t,d:d,h:h,m:m,s:s,ms:ms,microsecond"
 
@@ -70,6 +77,7 @@ func New(
 	monitor *prometheus.Monitor,
 	storage store.Storage,
 	conf *config.Config,
+	clk clock.Clock,
 	logger *logrus.Logger,
 ) *Scale {
 	fmtUnits, err := durafmt.DefaultUnitsCoder.Decode(localizationUnits)
@@ -81,25 +89,19 @@ func New(
 		mux:     sync.RWMutex{},
 		monitor: monitor,
 
-		weight:       0,
-		weightAt:     time.Unix(0, 0), // time of last weight measurement
-		candidateKeg: 0,
-		activeKeg:    0,
-		activeKegAt:  time.Unix(0, 0),
-		beersLeft:    0,
-		beersTotal:   0,
-		isLow:        false,
-		warehouse:    [5]int{0, 0, 0, 0, 0},
+		taps:       map[string]*tap{},
+		beersTotal: 0,
+		warehouse:  map[int]int{},
+		catalog:    DefaultKegCatalog(),
 
 		pub: pub{
 			isOpen:   false,
-			openedAt: time.Now().Add(-9999 * time.Hour),
-			closedAt: time.Now().Add(-9999 * time.Hour),
+			openedAt: clk.Now().Add(-9999 * time.Hour),
+			closedAt: clk.Now().Add(-9999 * time.Hour),
 		},
 
 		bank: &bank{
-			client:     fio.NewClient(conf.FioToken, nil),
-			lastUpdate: time.Now().Add(-9999 * time.Hour),
+			lastUpdate: clk.Now().Add(-9999 * time.Hour),
 			refreshMtx: sync.Mutex{},
 		},
 
@@ -107,37 +109,64 @@ func New(
 			irks:   []Irk{},
 			active: map[string]Device{},
 			known:  map[string]string{},
-			lastOk: time.Now().Add(-9999 * time.Hour),
+			lastOk: clk.Now().Add(-9999 * time.Hour),
 		},
 
-		lastOk: time.Now().Add(-9999 * time.Hour),
-
 		events: map[EventType][]Event{},
 
 		store:    storage,
 		config:   conf,
+		clock:    clk,
 		logger:   logger,
 		ctx:      ctx,
 		fmtUnits: fmtUnits,
 	}
 
+	s.bank.provider, err = NewBankProvider(conf, clk)
+	if errors.Is(err, ErrBankNotConfigured) {
+		s.logger.Info("Bank is not configured")
+	} else if err != nil {
+		s.logger.Errorf("Could not create bank provider: %v", err)
+	}
+
 	s.loadDataFromStore()
 
 	// periodically call recheck
 	go func(s *Scale) {
-		tick := time.NewTicker(15 * time.Second)
+		tick := s.clock.NewTicker(15 * time.Second)
 		defer tick.Stop()
 		for {
 			select {
 			case <-s.ctx.Done():
 				s.logger.Debug("Scale recheck stopped")
 				return
-			case <-tick.C:
+			case <-tick.C():
 				s.Recheck()
 			}
 		}
 	}(s)
 
+	// periodically delete old rows from the store
+	go func(s *Scale, storage store.Storage) {
+		prune := func() {
+			if err := storage.Prune(); err != nil {
+				s.logger.Errorf("Could not prune the store: %v", err)
+			}
+		}
+
+		prune()
+		tick := s.clock.NewTicker(storePruneInterval)
+		defer tick.Stop()
+		for {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-tick.C():
+				prune()
+			}
+		}
+	}(s, s.store)
+
 	// initial bank data refresh
 	if err = s.BankRefresh(ctx, true); err != nil {
 		s.logger.Errorf("Could not initianly refresh bank data: %v", err)
@@ -145,10 +174,10 @@ func New(
 
 	// periodically refresh bank data
 	go func(ctx context.Context, s *Scale) {
-		ticker := time.NewTicker(15 * time.Second)
+		ticker := s.clock.NewTicker(15 * time.Second)
 		for {
 			select {
-			case <-ticker.C:
+			case <-ticker.C():
 				if err = s.BankRefresh(ctx, false); err != nil {
 					s.logger.Errorf("Could not refresh bank data: %v", err)
 				}
@@ -164,32 +193,25 @@ func New(
 }
 
 func (s *Scale) loadDataFromStore() {
-	weight, err := s.store.GetWeight()
-	if err == nil {
-		s.weight = weight
-		s.monitor.Weight.WithLabelValues().Set(weight)
-	}
+	s.loadOpenPolicy()
+	s.loadOpenOverride()
+	s.loadKegCatalog()
 
-	weightAt, err := s.store.GetWeightAt()
-	if err == nil {
-		s.weightAt = weightAt
+	taps, err := s.store.GetTaps()
+	if err != nil || len(taps) == 0 {
+		taps = []string{store.DefaultTap}
 	}
-
-	activeKeg, err := s.store.GetActiveKeg()
-	if err == nil {
-		s.activeKeg = activeKeg
-		s.monitor.ActiveKeg.WithLabelValues().Set(float64(activeKeg))
+	for _, id := range taps {
+		s.taps[id] = s.loadTap(id)
 	}
-
-	activeKegAt, err := s.store.GetActiveKegAt()
-	if err == nil {
-		s.activeKegAt = activeKegAt
+	if _, found := s.taps[store.DefaultTap]; !found {
+		s.taps[store.DefaultTap] = s.loadTap(store.DefaultTap)
 	}
 
-	beersLeft, err := s.store.GetBeersLeft()
-	if err == nil {
-		s.beersLeft = beersLeft
-		s.monitor.BeersLeft.WithLabelValues().Set(float64(beersLeft))
+	// a silent scale is offline only when the other scales keep the pub open
+	anyOk := s.isOk()
+	for _, t := range s.taps {
+		t.offline = anyOk && !s.isTapOk(t)
 	}
 
 	beersTotal, err := s.store.GetBeersTotal()
@@ -197,20 +219,18 @@ func (s *Scale) loadDataFromStore() {
 		s.beersTotal = beersTotal
 	}
 
-	isLow, err := s.store.GetIsLow()
+	litersTotal, err := s.store.GetLitersTotal()
 	if err == nil {
-		s.isLow = isLow
-	}
-
-	warehouse, err := s.store.GetWarehouse()
-	if err == nil {
-		s.warehouse = warehouse
+		s.litersTotal = litersTotal
+	} else {
+		s.litersTotal = float64(s.beersTotal) * DefaultServingSize // the total used to be counted in half liters only
 	}
 
-	lastOk, err := s.store.GetLastOk()
-	if err == nil {
-		s.lastOk = lastOk
-	}
+	s.loadStock()
+	s.loadEmpties()
+	s.loadBank()
+	s.loadBankBalance()
+	s.warehouseLow = s.isWarehouseLow()
 
 	isOpen, err := s.store.GetIsOpen()
 	if err == nil {
@@ -246,253 +266,298 @@ func (s *Scale) loadDataFromStore() {
 		s.attendance.irks = irks
 	}
 
-	s.monitor.BeersTotal.WithLabelValues().Set(float64(s.getBeersTotal()))
+	for _, t := range s.taps {
+		s.loadKegRecord(t)
+		s.loadCalibration(t)
+		s.refreshConsumptionHistory(t, s.clock.Now())
+		s.updateMetrics(t)
+	}
+
+	s.loadPubSession()
 }
 
-// AddMeasurement handles a new measurement from the scale
+// AddMeasurement handles a new measurement from the tap scale
 // the most important function in the scale
-func (s *Scale) AddMeasurement(weight float64) error {
-	if weight < 6000 || weight > 65000 {
-		s.logger.Infof("Invalid weight: %.0f", weight)
+func (s *Scale) AddMeasurement(tapID string, weight float64) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	t, err := s.getTap(tapID)
+	if err != nil {
+		return err
+	}
+
+	// raw readings are kept for the calibration, the keg state waits until it is finished
+	now := s.clock.Now()
+	t.health.observeRaw(weight, now)
+	s.checkHealth(t)
+	t.calibration.lastRaw = weight
+	t.calibration.lastRawAt = now
+	if t.calibration.session != nil {
+		s.logger.Debugf("Measurement %.0f used for calibration only (tap %s)", weight, t.id)
 		return nil
 	}
+	weight = t.calibration.apply(weight)
+	s.watchClosed(t, weight)
 
-	s.mux.Lock()
-	defer s.mux.Unlock()
+	low, high := s.catalog.WeightRange()
+	if weight < low || weight > high {
+		if weight < low {
+			s.observeRemoval(t) // nothing on the scale
+		}
+		s.rejectMeasurement(t, weight, RejectReasonRange)
+		return nil
+	}
+
+	// filter spikes before they change the state
+	filtered, reason := t.filter.add(weight, now, s.config.Filter)
+	if reason != "" {
+		s.rejectMeasurement(t, weight, reason)
+		return nil
+	}
 
 	// set new values to the structure
-	s.weight = weight
-	s.weightAt = time.Now()
-	if serr := s.store.SetWeight(weight); serr != nil {
+	previous := t.weight
+	t.weight = filtered
+	t.weightAt = now
+	s.observeWeight(t, previous)
+	if serr := s.store.SetWeight(t.id, t.weight); serr != nil {
 		return fmt.Errorf("could not store weight: %w", serr)
 	}
-	if serr := s.store.SetWeightAt(s.weightAt); serr != nil {
+	if serr := s.store.SetWeightAt(t.id, t.weightAt); serr != nil {
 		return fmt.Errorf("could not store weight_at: %w", serr)
 	}
+	s.trackKegRecord(t)
 
 	// recalculate beers left
-	s.beersLeft = CalcBeersLeft(s.activeKeg, weight)
-	if serr := s.store.SetBeersLeft(s.beersLeft); serr != nil {
+	t.beersLeft = s.catalog.CalcBeersLeft(t.activeKeg, t.weight)
+	if serr := s.store.SetBeersLeft(t.id, t.beersLeft); serr != nil {
 		return fmt.Errorf("could not store beers_left: %w", serr)
 	}
+	s.trackSessionBeers(t)
+
+	if pour, ok := s.detectPour(t); ok {
+		s.handlePour(t, pour)
+	}
 
 	// check empty keg
-	if s.beersLeft == 0 {
-		if serr := s.addCurrentKegToTotal(); serr != nil {
+	if t.beersLeft == 0 {
+		if t.activeKeg > 0 {
+			s.logger.Infof("Keg (%d l) is EMPTY with current value %.0f (tap %s)", t.activeKeg, t.weight, t.id)
+			s.dispatchEvent(s.newTapEvent(EventKegEmpty, t, EventReasonScale))
+		}
+		if serr := s.addCurrentKegToTotal(t); serr != nil {
 			return fmt.Errorf("could not add current keg to total: %w", serr)
 		}
-		s.activeKeg = 0
-		if serr := s.store.SetActiveKeg(s.activeKeg); serr != nil {
+		if serr := s.closeKegRecord(t, store.KegEndReasonAuto, true); serr != nil {
+			return serr
+		}
+		t.activeKeg = 0
+		if serr := s.store.SetActiveKeg(t.id, t.activeKeg); serr != nil {
 			return fmt.Errorf("could not store active_keg: %w", serr)
 		}
 	}
 
 	// check if keg is low
-	if !s.isLow {
-		s.isLow = IsKegLow(s.activeKeg, weight)
-		if s.isLow {
-			if serr := s.store.SetIsLow(s.isLow); serr != nil {
+	if !t.isLow {
+		t.isLow = s.catalog.IsKegLow(t.activeKeg, t.weight)
+		if t.isLow {
+			if serr := s.store.SetIsLow(t.id, t.isLow); serr != nil {
 				return fmt.Errorf("could not store is_low: %w", serr)
 			}
+			if t.activeKeg > 0 {
+				s.dispatchEvent(s.newTapEvent(EventKegLow, t, EventReasonScale))
+			}
 		}
 	}
 
 	// check if we expect a new keg
-	if s.activeKeg == 0 || s.isLow {
-		if serr := s.tryNewKeg(); serr != nil {
+	if t.activeKeg == 0 || t.isLow || t.hasRekegEvidence() {
+		if serr := s.tryNewKeg(t); serr != nil {
 			return fmt.Errorf("could not try new keg: %w", serr)
 		}
 	}
 
-	s.updateMetrics()
+	s.updateConsumption(t)
+
+	// keep the time-series for charts
+	measurement := store.Measurement{
+		Tap:       t.id,
+		At:        t.weightAt,
+		Weight:    t.weight,
+		ActiveKeg: t.activeKeg,
+		BeersLeft: t.beersLeft,
+	}
+	if serr := s.store.AddMeasurement(measurement); serr != nil {
+		return fmt.Errorf("could not store measurement: %w", serr)
+	}
+
+	s.updateMetrics(t)
 
 	return nil
 }
 
-func (s *Scale) Ping() {
-	s.monitor.LastPing.WithLabelValues().SetToCurrentTime()
-	now := time.Now()
-	err := s.store.SetLastOk(s.lastOk)
-	if err != nil {
-		s.logger.Errorf("Could not set last_ok time: %v", err)
-	}
+// rejectMeasurement reports a weight which did not pass the checks
+func (s *Scale) rejectMeasurement(t *tap, weight float64, reason string) {
+	s.monitor.RejectedMeasurements.WithLabelValues(t.id, reason).Inc()
+	s.logger.Warnf("Measurement %.0f rejected (tap %s): %s", weight, t.id, reason)
+}
 
+// Ping handles a ping from the tap scale
+// any working scale means the pub is open
+func (s *Scale) Ping(tapID string) error {
 	s.mux.Lock()
 	defer s.mux.Unlock()
 
+	t, err := s.getTap(tapID)
+	if err != nil {
+		return err
+	}
+
+	s.monitor.LastPing.WithLabelValues(t.id).SetToCurrentTime()
+	t.lastOk = s.clock.Now()
+	if err := s.store.SetLastOk(t.id, t.lastOk); err != nil {
+		s.logger.Errorf("Could not set last_ok time: %v", err)
+	}
+	s.markScaleOnline(t)
+	s.observeClosedPing(t)
+
 	if !s.pub.isOpen {
 		s.updatePub(true, false)
 	}
 
-	s.lastOk = now
+	return nil
 }
 
 // Recheck checks various conditions and states
-// - sets the scale to not open after [okLimit] minutes
+// - sets the scale to not open after the close_after duration of the open policy
 // it should be called everytime we want to get some calculations
 // to recalculate the state of the scale
 func (s *Scale) Recheck() {
 	s.mux.Lock()
 	defer s.mux.Unlock()
 
-	// we haven't received any data for [okLimit] minutes and pub is open
+	// we haven't received any data for a while and pub is open
 	if !s.isOk() && s.pub.isOpen {
 		s.updatePub(false, false) // close the pub
 	}
 
 	// we want to remove expired devices even if the BT device does not work
 	s.deleteInactiveBtDevices()
+
+	for _, t := range s.taps {
+		s.markScaleOffline(t)
+		s.checkHealth(t)
+		s.refreshConsumptionHistory(t, s.clock.Now())
+		s.updateMetrics(t)
+	}
 }
 
-// BankRefresh refreshes the bank transactions and balance
+// BankRefresh downloads new bank transactions to the store and refreshes the balance
+// the download continues from the last synced day, the recent transactions are kept in memory
 func (s *Scale) BankRefresh(ctx context.Context, force bool) error {
 	s.bank.refreshMtx.Lock()
 	defer s.bank.refreshMtx.Unlock()
 
+	if s.bank.provider == nil {
+		return nil // bank is not configured
+	}
+
 	if !s.shouldRefreshBank(s.bank.lastUpdate, force) {
 		return nil // no need to refresh
 	}
 
-	s.bank.lastUpdate = time.Now()
+	s.bank.lastUpdate = s.clock.Now()
+
+	return s.refreshBank(ctx)
+}
 
-	opts := fio.ByPeriodOptions{
-		DateFrom: time.Now().Add(-14 * 24 * time.Hour),
-		DateTo:   time.Now(),
+// refreshBank downloads new bank transactions, refreshMtx must be held
+func (s *Scale) refreshBank(ctx context.Context) error {
+	sync, err := s.store.GetBankSync()
+	if err != nil {
+		return fmt.Errorf("could not get bank sync: %w", err)
 	}
 
-	resp, err := s.bank.client.Transactions.ByPeriod(ctx, opts)
+	now := s.clock.Now()
+	balance, added, err := syncBank(ctx, s.bank.provider, s.store, bankSyncFrom(sync, now), now)
 	if err != nil {
-		return fmt.Errorf("unable to retrieve transactions: %w", err)
-	}
-
-	balance := BalanceOutput{
-		AccountID: resp.Info.AccountID,
-		BankID:    resp.Info.BankID,
-		Currency:  resp.Info.Currency,
-		IBAN:      resp.Info.IBAN,
-		BIC:       resp.Info.BIC,
-		Balance:   resp.Info.ClosingBalance,
-	}
-
-	transactions := make([]TransactionOutput, len(resp.Transactions))
-	for i, t := range resp.Transactions {
-		transactions[i] = TransactionOutput{
-			ID:                 t.ID,
-			Date:               t.Date,
-			Amount:             t.Amount,
-			Currency:           t.Currency,
-			Account:            t.Account,
-			AccountName:        t.AccountName,
-			BankName:           t.BankName,
-			BankCode:           t.BankCode,
-			ConstantSymbol:     t.ConstantSymbol,
-			VariableSymbol:     t.VariableSymbol,
-			SpecificSymbol:     t.SpecificSymbol,
-			UserIdentification: t.UserIdentification,
-			RecipientMessage:   t.RecipientMessage,
-			Type:               t.Type,
-			Specification:      t.Specification,
-			Comment:            t.Comment,
-			BIC:                t.BIC,
-			OrderID:            t.OrderID,
-			PayerReference:     t.PayerReference,
-		}
-	}
-
-	s.logger.Info("Bank transactions refreshed")
+		return err
+	}
+
+	s.logger.Infof("Bank transactions refreshed, %d new", added)
 
 	s.mux.Lock()
 	defer s.mux.Unlock()
 
-	s.bank.balance = balance
-	s.bank.transactions = transactions
+	if err := s.setBankBalance(balance); err != nil {
+		return err
+	}
+	s.loadBank()
 
 	return nil
 }
 
-// SetRssi sets the RSSI value of the WiFi signal
-func (s *Scale) SetRssi(rssi float64) {
-	s.monitor.ScaleWifiRssi.WithLabelValues().Set(rssi)
-
+// SetActiveKeg sets the current active keg of the tap
+func (s *Scale) SetActiveKeg(tapID string, keg int) error {
 	s.mux.Lock()
 	defer s.mux.Unlock()
 
-	s.rssi = rssi
-}
-
-// SetActiveKeg sets the current active keg
-func (s *Scale) SetActiveKeg(keg int) error {
-	s.mux.Lock()
-	defer s.mux.Unlock()
+	t, found := s.taps[tapID]
+	if !found {
+		return fmt.Errorf("unknown tap: %s", tapID)
+	}
 
-	s.isLow = false
+	t.isLow = false
+	t.resetRekeg()
+	t.rekeg.baseline = keg > 0 // the weight may jump from the previous keg
 
 	// manually empty the keg
 	if keg == 0 {
-		s.isLow = true // enable rekeg
-		s.beersLeft = 0
-		if serr := s.store.SetBeersLeft(s.beersLeft); serr != nil {
+		t.isLow = true // enable rekeg
+		t.beersLeft = 0
+		if serr := s.store.SetBeersLeft(t.id, t.beersLeft); serr != nil {
 			return fmt.Errorf("could not store beers_left: %w", serr)
 		}
-		if serr := s.addCurrentKegToTotal(); serr != nil {
+		if serr := s.addCurrentKegToTotal(t); serr != nil {
 			return fmt.Errorf("could not add current keg to total: %w", serr)
 		}
 	}
 
-	s.activeKeg = keg
-	if err := s.store.SetActiveKeg(s.activeKeg); err != nil {
-		return err
+	// keep the ledger in sync - setting the same keg again is just a correction
+	// only the emptied keg goes to the empties, another keg means the active one was wrong
+	if keg != t.activeKeg {
+		if err := s.closeKegRecord(t, store.KegEndReasonManual, keg == 0); err != nil {
+			return err
+		}
 	}
 
-	if err := s.store.SetIsLow(s.isLow); err != nil {
+	isNew := keg > 0 && keg != t.activeKeg
+	t.activeKeg = keg
+	if err := s.store.SetActiveKeg(t.id, t.activeKeg); err != nil {
 		return err
 	}
 
-	s.updateMetrics()
-
-	return nil
-}
-
-func (s *Scale) IncreaseWarehouse(keg int) error {
-	s.mux.Lock()
-	defer s.mux.Unlock()
-
-	index, err := GetWarehouseIndex(keg)
-	if err != nil {
-		return err
+	if isNew {
+		t.activeKegAt = s.clock.Now()
+		if err := s.store.SetActiveKegAt(t.id, t.activeKegAt); err != nil {
+			return err
+		}
+		if err := s.openKegRecord(t, 0); err != nil {
+			return err
+		}
+		s.trackSessionKeg()
 	}
 
-	s.warehouse[index]++
-	return s.store.SetWarehouse(s.warehouse)
-}
-
-func (s *Scale) DecreaseWarehouse(keg int) error {
-	s.mux.Lock()
-	defer s.mux.Unlock()
-
-	index, err := GetWarehouseIndex(keg)
-	if err != nil {
+	if err := s.store.SetIsLow(t.id, t.isLow); err != nil {
 		return err
 	}
 
-	if s.warehouse[index] > 0 {
-		s.warehouse[index]--
-		return s.store.SetWarehouse(s.warehouse)
-	}
+	s.updateMetrics(t)
 
 	return nil
 }
 
-// ResetOpenAt resets the open_at time for the pub
-// it might be useful for force message skipping
-// it basically says that the pub was opened right now
-func (s *Scale) ResetOpenAt() {
-	s.mux.Lock()
-	defer s.mux.Unlock()
-
-	s.pub.openedAt = time.Now()
-}
-
 // ForceOpen forces the pub to be open
 func (s *Scale) ForceOpen() error {
 	s.mux.Lock()
@@ -506,9 +571,15 @@ func (s *Scale) ForceOpen() error {
 	return nil
 }
 
-// isOk returns true if the scale is ok based on the last update time
+// isOk returns true if at least one tap scale is ok based on the last update time
 func (s *Scale) isOk() bool {
-	return time.Since(s.lastOk) < okLimit
+	for _, t := range s.taps {
+		if s.isTapOk(t) {
+			return true
+		}
+	}
+
+	return false
 }
 
 // updatePub updates the pub state
@@ -520,22 +591,29 @@ func (s *Scale) updatePub(isOpen, forceEvent bool) {
 	}
 
 	if isOpen {
-		if forceEvent || s.shouldSendOpen() {
-			s.dispatchEvent(EventOpen)
+		if decision := s.decideOpen(forceEvent); decision.Send {
+			reason := EventReasonScale
+			if forceEvent {
+				reason = EventReasonManual
+			}
+			s.dispatchEvent(s.newEvent(EventOpen, reason))
 		} else {
-			s.logger.Warningf("Pub is open, but the opening message has been skipped. Diff: %s", time.Since(s.pub.openedAt).String())
+			s.logger.Warningf("Pub is open, but the opening message has been skipped: %s", decision.Reason)
 		}
 
-		s.pub.openedAt = time.Now()
+		s.pub.openedAt = s.clock.Now()
 		if err := s.store.SetOpenAt(s.pub.openedAt); err != nil {
 			s.logger.Errorf("Could not set open_at time: %v", err)
 		}
+		s.startPubSession()
 	} else {
-		s.pub.closedAt = time.Now().Add(-1 * okLimit)
+		s.pub.closedAt = s.clock.Now().Add(-1 * s.okLimit())
 		if err := s.store.SetCloseAt(s.pub.closedAt); err != nil {
 			s.logger.Errorf("Could not set close_at time: %v", err)
 		}
-		s.dispatchEvent(EventClose)
+		s.endPubSession()
+		s.startClosedWatch()
+		s.dispatchEvent(s.newEvent(EventClose, EventReasonTimeout))
 	}
 
 	fIsOpen := 0.
@@ -546,69 +624,92 @@ func (s *Scale) updatePub(isOpen, forceEvent bool) {
 	s.monitor.PubIsOpen.WithLabelValues().Set(fIsOpen)
 }
 
-// tryNewKeg tries to find a new keg based on the current weight
-// we need at least two measurements to be sure
+// tryNewKeg tries to find a new keg based on the current weight of the tap
+// every candidate gets a confidence based on the weight, its history and the warehouse
+// confident candidates need two measurements to be sure
 // first measurement sets the candidate keg
 // second measurement sets the active keg
-func (s *Scale) tryNewKeg() error {
-	keg, err := GuessNewKegSize(s.weight)
-	if err == nil {
-		// we found a good candidate
-		if s.candidateKeg > 0 && s.candidateKeg == keg {
-			// we have two measurements with the same keg - rekeg successful !!!
-
-			if s.activeKeg == 50 && keg == 10 {
-				// known bug - there is a conflict between 50l and 10l kegs
-				// when the 50l keg is empty, the weight is the same as full 10l keg
-				// we don't want to rekeg in this case because in many cases it's not true
-				s.logger.Warnf("Conflict between 50l and 10l kegs detected. Ignoring rekeg.")
-				return nil
+// ambiguous candidates are reported and wait for manual confirmation
+func (s *Scale) tryNewKeg(t *tap) error {
+	matches := s.catalog.MatchKegs(t.weight)
+	if len(matches) == 0 {
+		if t.rekeg.state == RekegStateCandidate || t.rekeg.state == RekegStateAmbiguous {
+			t.rekeg.state = RekegStateIdle
+			if t.hasRekegEvidence() {
+				t.rekeg.state = RekegStateRemoved
 			}
+		}
+		return nil
+	}
 
-			if serr := s.addCurrentKegToTotal(); serr != nil {
-				return fmt.Errorf("could not add current keg to total: %w", serr)
-			}
+	keg := matches[0].Size
+	t.rekeg.confidence = s.rekegConfidence(t, matches)
 
-			s.candidateKeg = 0
-			s.activeKeg = keg
-			if serr := s.store.SetActiveKeg(keg); serr != nil {
-				return fmt.Errorf("could not store active_keg: %w", serr)
-			}
-			s.activeKegAt = time.Now()
-			if serr := s.store.SetActiveKegAt(s.activeKegAt); serr != nil {
-				return fmt.Errorf("could not store active_keg_at: %w", serr)
-			}
-			s.beersLeft = CalcBeersLeft(s.activeKeg, s.weight)
-			if serr := s.store.SetBeersLeft(s.beersLeft); serr != nil {
-				return fmt.Errorf("could not store beers_left: %w", serr)
-			}
+	if t.rekeg.confidence < rekegEscalateConfidence {
+		s.logger.Debugf("New keg (%d l) IGNORED with current value %.0f and confidence %.2f (tap %s)", keg, t.weight, t.rekeg.confidence, t.id)
+		return nil
+	}
 
-			s.isLow = false
-			if serr := s.store.SetIsLow(false); serr != nil {
-				return fmt.Errorf("could not store is_low: %w", serr)
-			}
+	if t.rekeg.confidence < rekegConfirmConfidence {
+		s.escalateRekeg(t, keg)
+		return nil
+	}
 
-			// remove keg from warehouse
-			index, err := GetWarehouseIndex(keg)
-			if err != nil {
-				return err
-			}
-			if s.warehouse[index] > 0 {
-				s.warehouse[index]--
-				if serr := s.store.SetWarehouse(s.warehouse); serr != nil {
-					return fmt.Errorf("could not update store warehouse: %w", serr)
-				}
-			} else {
-				s.logger.Warnf("Keg %d is not available in the warehouse", keg)
-			}
+	// we found a good candidate
+	if t.candidateKeg > 0 && t.candidateKeg == keg {
+		// we have two measurements with the same keg - rekeg successful !!!
+		if serr := s.addCurrentKegToTotal(t); serr != nil {
+			return fmt.Errorf("could not add current keg to total: %w", serr)
+		}
+		if serr := s.closeKegRecord(t, store.KegEndReasonAuto, true); serr != nil {
+			return serr
+		}
 
-			s.dispatchEvent(EventNewKegTapped)
-			s.logger.Infof("New keg (%d l) CONFIRMED with current value %.0f", keg, s.weight)
-		} else {
-			// new candidate keg
-			// we already know that the new keg is there, but we need to confirm it
-			s.logger.Infof("New keg candidate (%d l) REGISTERED with current value %.0f", keg, s.weight)
-			s.candidateKeg = keg
+		t.candidateKeg = 0
+		if serr := s.store.SetCandidateKeg(t.id, t.candidateKeg); serr != nil {
+			return fmt.Errorf("could not store candidate_keg: %w", serr)
+		}
+		t.activeKeg = keg
+		if serr := s.store.SetActiveKeg(t.id, keg); serr != nil {
+			return fmt.Errorf("could not store active_keg: %w", serr)
+		}
+		t.activeKegAt = s.clock.Now()
+		if serr := s.store.SetActiveKegAt(t.id, t.activeKegAt); serr != nil {
+			return fmt.Errorf("could not store active_keg_at: %w", serr)
+		}
+		t.beersLeft = s.catalog.CalcBeersLeft(t.activeKeg, t.weight)
+		if serr := s.store.SetBeersLeft(t.id, t.beersLeft); serr != nil {
+			return fmt.Errorf("could not store beers_left: %w", serr)
+		}
+		// remove keg from warehouse
+		stockID, serr := s.tapStockKeg(t, keg)
+		if serr != nil {
+			return serr
+		}
+		if serr := s.openKegRecord(t, stockID); serr != nil {
+			return serr
+		}
+
+		t.isLow = false
+		if serr := s.store.SetIsLow(t.id, false); serr != nil {
+			return fmt.Errorf("could not store is_low: %w", serr)
+		}
+
+		payload := s.newTapEvent(EventNewKegTapped, t, EventReasonScale)
+		payload.Confidence = t.rekeg.confidence
+		t.resetRekeg()
+		s.trackSessionKeg()
+
+		s.dispatchEvent(payload)
+		s.logger.Infof("New keg (%d l) CONFIRMED with current value %.0f (tap %s)", keg, t.weight, t.id)
+	} else {
+		// new candidate keg
+		// we already know that the new keg is there, but we need to confirm it
+		s.logger.Infof("New keg candidate (%d l) REGISTERED with current value %.0f and confidence %.2f (tap %s)", keg, t.weight, t.rekeg.confidence, t.id)
+		t.rekeg.state = RekegStateCandidate
+		t.candidateKeg = keg
+		if serr := s.store.SetCandidateKeg(t.id, t.candidateKeg); serr != nil {
+			return fmt.Errorf("could not store candidate_keg: %w", serr)
 		}
 	}
 
@@ -616,53 +717,63 @@ func (s *Scale) tryNewKeg() error {
 }
 
 // getBeersTotal calculates the total amount of beers consumed
-// adds two values together - total from the store and the current active keg
+// adds values together - total from the store and the current active kegs of all taps
 func (s *Scale) getBeersTotal() int {
 	total := s.beersTotal
 
-	if s.activeKeg > 0 {
-		total += CalcBeersConsumed(s.activeKeg, s.weight)
+	for _, t := range s.taps {
+		if t.activeKeg > 0 {
+			total += s.catalog.CalcBeersConsumed(t.activeKeg, t.weight)
+		}
+	}
+
+	return total
+}
+
+// getLitersTotal calculates the total volume of beer consumed the same way as getBeersTotal
+func (s *Scale) getLitersTotal() float64 {
+	total := s.litersTotal
+
+	for _, t := range s.taps {
+		if t.activeKeg > 0 {
+			total += s.catalog.CalcLitersConsumed(t.activeKeg, t.weight)
+		}
 	}
 
 	return total
 }
 
-func (s *Scale) addCurrentKegToTotal() error {
-	if s.activeKeg == 0 {
+func (s *Scale) addCurrentKegToTotal(t *tap) error {
+	if t.activeKeg == 0 {
 		return nil // there is no active keg
 	}
 
-	s.beersTotal += s.activeKeg * 2 // liters to beers
+	s.beersTotal += s.catalog.KegBeers(t.activeKeg)
+	s.litersTotal += float64(t.activeKeg)
 	s.monitor.BeersTotal.WithLabelValues().Set(float64(s.getBeersTotal()))
 	if err := s.store.SetBeersTotal(s.beersTotal); err != nil {
 		return fmt.Errorf("could not store beers_total: %w", err)
 	}
+	if err := s.store.SetLitersTotal(s.litersTotal); err != nil {
+		return fmt.Errorf("could not store liters_total: %w", err)
+	}
 
 	return nil
 }
 
-// shouldSendOpen applies the rules for sending a message when the pub is open
-// we don't want to spam the group with messages
-// it could happen for example when the scale is restarted or lost Wi-Fi connection for a while
-func (s *Scale) shouldSendOpen() bool {
-	// send message only once in 12 hours
-	if time.Since(s.pub.openedAt) < 12*time.Hour {
-		return false
-	}
+// updateMetrics updates beer/keg related metrics of the tap for prometheus
+func (s *Scale) updateMetrics(t *tap) {
+	s.monitor.Weight.WithLabelValues(t.id).Set(t.weight)
+	s.monitor.BeersLeft.WithLabelValues(t.id).Set(float64(t.beersLeft))
+	s.monitor.ActiveKeg.WithLabelValues(t.id).Set(float64(t.activeKeg))
 
-	// send message only if the pub was closed for at least 3 hours
-	if time.Since(s.pub.closedAt) < 3*time.Hour {
-		return false
+	consumption := s.getConsumptionOutput(t)
+	s.monitor.ConsumptionRate.WithLabelValues(t.id).Set(consumption.SessionRate)
+	if consumption.EmptyAt != nil {
+		s.monitor.KegEmptyEta.WithLabelValues(t.id).Set(float64(consumption.EmptyAt.Unix()))
+	} else {
+		s.monitor.KegEmptyEta.WithLabelValues(t.id).Set(0)
 	}
-
-	return true
-}
-
-// updateMetrics updates beer/keg related metrics for prometheus
-func (s *Scale) updateMetrics() {
-	s.monitor.Weight.WithLabelValues().Set(s.weight)
-	s.monitor.BeersLeft.WithLabelValues().Set(float64(s.beersLeft))
-	s.monitor.ActiveKeg.WithLabelValues().Set(float64(s.activeKeg))
 	s.monitor.BeersTotal.WithLabelValues().Set(float64(s.getBeersTotal()))
 }
 
@@ -671,9 +782,9 @@ func (s *Scale) shouldRefreshBank(lastRefresh time.Time, force bool) bool {
 		return true
 	}
 
-	now := time.Now().In(utils.GetTz())
+	now := s.clock.Now().In(utils.GetTz())
 
-	// refresh every 5 minutes between 20:00 and 24:00
+	// refresh every 5 minutes between 19:00 and midnight
 	// refresh every 15 minutes the rest of the time
 	if now.Hour() >= 19 && now.Hour() <= 24 {
 		if lastRefresh.Add(5 * time.Minute).After(now) {
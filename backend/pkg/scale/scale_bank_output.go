@@ -15,6 +15,11 @@ type BalanceOutput struct {
 	Balance   decimal.Decimal `json:"balance"`
 }
 
+// isEmpty is true when the provider does not know the balance
+func (b BalanceOutput) isEmpty() bool {
+	return b.AccountID == 0 && b.Currency == "" && b.Balance.IsZero()
+}
+
 type TransactionOutput struct {
 	ID                 int64           `json:"id"`
 	Date               time.Time       `json:"date"`
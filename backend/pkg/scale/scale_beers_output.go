@@ -7,11 +7,17 @@ import (
 
 // GetPushResponse is a response for scale push event
 // Scale has display and it is able to display four digits
-func (s *Scale) GetPushResponse() string {
+// every tap scale displays beers left in its own keg
+func (s *Scale) GetPushResponse(tapID string) string {
 	s.mux.RLock()
 	defer s.mux.RUnlock()
 
-	return leftPad(fmt.Sprintf("%d", s.beersLeft), " ", 4)
+	beersLeft := 0
+	if t, found := s.taps[tapID]; found {
+		beersLeft = t.beersLeft
+	}
+
+	return leftPad(fmt.Sprintf("%d", beersLeft), " ", 4)
 }
 
 func leftPad(input, padChar string, length int) string {
@@ -2,6 +2,8 @@ package scale
 
 import (
 	"testing"
+
+	"github.com/kotrzina/keg-scale/pkg/store"
 )
 
 func TestScale_GetPushResponse(t *testing.T) {
@@ -21,10 +23,12 @@ func TestScale_GetPushResponse(t *testing.T) {
 
 	for _, tt := range cases {
 		s := &Scale{
-			beersLeft: tt.beersLeft,
+			taps: map[string]*tap{
+				store.DefaultTap: {id: store.DefaultTap, beersLeft: tt.beersLeft},
+			},
 		}
 
-		got := s.GetPushResponse()
+		got := s.GetPushResponse(store.DefaultTap)
 		if got != tt.want {
 			t.Errorf("Scale.GetPushResponse() = %v, want %v", got, tt.want)
 		}
@@ -0,0 +1,70 @@
+package scale
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/kotrzina/keg-scale/pkg/store"
+)
+
+const (
+	ChartMetricBeersLeft = "scale_beers_left"
+	ChartMetricActiveKeg = "scale_active_keg"
+)
+
+type ChartPoint struct {
+	At    time.Time `json:"at"`
+	Value int       `json:"value"`
+}
+
+// GetChartData returns chart points of the tap from the local measurement rollups
+// the rollup resolution follows the step and the last known value is used for every step
+// steps before the first known value are skipped
+func (s *Scale) GetChartData(tapID, metric string, start, end time.Time, step time.Duration) ([]ChartPoint, error) {
+	if metric != ChartMetricBeersLeft && metric != ChartMetricActiveKeg {
+		return nil, fmt.Errorf("unknown chart metric: %s", metric)
+	}
+
+	if step <= 0 {
+		return nil, fmt.Errorf("invalid chart step: %s", step)
+	}
+
+	resolution := store.MeasurementResolution5m
+	if step >= time.Hour {
+		resolution = store.MeasurementResolution1h
+	}
+	if step >= 24*time.Hour {
+		resolution = store.MeasurementResolution1d
+	}
+
+	rollups, err := s.store.GetMeasurementRollups(tapID, resolution, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("could not get measurement rollups: %w", err)
+	}
+
+	points := []ChartPoint{}
+	i := 0
+	var last *store.MeasurementRollup
+	for at := start.Truncate(step); !at.After(end); at = at.Add(step) {
+		for i < len(rollups) && !rollups[i].Bucket.After(at) {
+			last = &rollups[i]
+			i++
+		}
+
+		if last == nil {
+			continue
+		}
+
+		value := last.BeersLeft
+		if metric == ChartMetricActiveKeg {
+			value = last.ActiveKeg
+		}
+
+		points = append(points, ChartPoint{
+			At:    at,
+			Value: value,
+		})
+	}
+
+	return points, nil
+}
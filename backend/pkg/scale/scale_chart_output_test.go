@@ -0,0 +1,50 @@
+package scale
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kotrzina/keg-scale/pkg/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScale_GetChartData(t *testing.T) {
+	s := createScaleWithMeasurements(t, 40, 40, 35)
+
+	start := time.Now().Add(-time.Hour)
+	end := time.Now()
+
+	points, err := s.GetChartData(store.DefaultTap, ChartMetricBeersLeft, start, end, 5*time.Minute)
+	require.NoError(t, err)
+	require.NotEmpty(t, points)
+	assert.Equal(t, DefaultKegCatalog().CalcBeersLeft(30, 35000), points[len(points)-1].Value)
+
+	points, err = s.GetChartData(store.DefaultTap, ChartMetricActiveKeg, start, end, time.Hour)
+	require.NoError(t, err)
+	require.NotEmpty(t, points)
+	assert.Equal(t, 30, points[len(points)-1].Value)
+
+	// no measurements for the tap
+	points, err = s.GetChartData("left", ChartMetricBeersLeft, start, end, 5*time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, points)
+
+	_, err = s.GetChartData(store.DefaultTap, "scale_weight", start, end, 5*time.Minute)
+	assert.Error(t, err)
+}
+
+func TestScale_GetChartData_CarryForward(t *testing.T) {
+	fs := &store.FakeStore{}
+	s := createScaleWithMeasurements(t)
+	s.store = fs
+
+	base := time.Date(2025, 3, 14, 18, 0, 0, 0, time.UTC)
+	require.NoError(t, fs.AddMeasurement(store.Measurement{Tap: store.DefaultTap, At: base.Add(-2 * time.Hour), ActiveKeg: 30, BeersLeft: 40}))
+	require.NoError(t, fs.AddMeasurement(store.Measurement{Tap: store.DefaultTap, At: base.Add(12 * time.Minute), ActiveKeg: 30, BeersLeft: 35}))
+
+	points, err := s.GetChartData(store.DefaultTap, ChartMetricBeersLeft, base, base.Add(20*time.Minute), 5*time.Minute)
+	require.NoError(t, err)
+	require.Len(t, points, 5)
+	assert.Equal(t, []int{40, 40, 35, 35, 35}, []int{points[0].Value, points[1].Value, points[2].Value, points[3].Value, points[4].Value})
+}
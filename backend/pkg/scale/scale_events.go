@@ -1,20 +1,62 @@
 package scale
 
 import (
+	"encoding/json"
 	"fmt"
 	"time"
+
+	"github.com/kotrzina/keg-scale/pkg/store"
 )
 
 type EventType string
 
-type Event func(et EventType) error
+type Event func(payload EventPayload) error
 
 const (
-	EventOpen         EventType = "pub_open"
-	EventClose        EventType = "pub_close"
-	EventNewKegTapped EventType = "new_keg_tapped"
+	EventOpen           EventType = "pub_open"
+	EventClose          EventType = "pub_close"
+	EventNewKegTapped   EventType = "new_keg_tapped"
+	EventPour           EventType = "pour"
+	EventRekegAmbiguous EventType = "rekeg_ambiguous"
+	EventKegLow         EventType = "keg_low"
+	EventKegEmpty       EventType = "keg_empty"
+	EventScaleOffline   EventType = "scale_offline"
+	EventScaleOnline    EventType = "scale_online"
+	EventWarehouseLow   EventType = "warehouse_low"
+	EventScaleUnhealthy EventType = "scale_unhealthy"
+	EventKegLoss        EventType = "keg_loss"
 )
 
+const (
+	EventReasonScale   = "scale"   // detected from the scale measurements
+	EventReasonManual  = "manual"  // triggered by a user
+	EventReasonTimeout = "timeout" // no data from the scales
+)
+
+// EventPayload is the structured data of an event
+// it is stored with the event and passed to all registered callbacks
+type EventPayload struct {
+	ID         int64         `json:"id"` // zero until the event is stored
+	Type       EventType     `json:"type"`
+	At         time.Time     `json:"at"`
+	Tap        string        `json:"tap,omitempty"`
+	Keg        int           `json:"keg,omitempty"`        // active or candidate keg size in liters
+	Weight     float64       `json:"weight,omitempty"`     // in grams
+	BeersLeft  int           `json:"beers_left,omitempty"` // in the keg or in the warehouse for warehouse events
+	Reason     string        `json:"reason,omitempty"`
+	Confidence float64       `json:"confidence,omitempty"` // rekeg confidence
+	Pour       *Pour         `json:"pour,omitempty"`
+	Issue      string        `json:"issue,omitempty"`   // scale health issue
+	Health     *HealthOutput `json:"health,omitempty"`  // scale health report when the issue appeared
+	Loss       *KegLoss      `json:"loss,omitempty"`    // beer lost while the pub was closed
+	Details    string        `json:"details,omitempty"` // legacy events stored as text
+}
+
+type EventsOutput struct {
+	Events     []EventPayload `json:"events"`
+	NextBefore int64          `json:"next_before"` // pass as before to get the next page, zero for the last page
+}
+
 // RegisterEvent registers a callback for a specific event
 // The function checks if the event type is already registered and appends the callback to the list of callbacks
 func (s *Scale) RegisterEvent(eventType EventType, callback Event) {
@@ -25,22 +67,101 @@ func (s *Scale) RegisterEvent(eventType EventType, callback Event) {
 	}
 }
 
-func (s *Scale) dispatchEvent(event EventType) {
-	go func() {
-		// log event to storage
-		eventString := fmt.Sprintf("%s AT %s", event, time.Now().Format(time.RFC3339))
-		err := s.store.AddEvent(eventString)
-		if err != nil {
-			s.logger.Error("failed to add event", "event", event, "error", err)
+// newEvent creates an event payload without any tap
+func (s *Scale) newEvent(event EventType, reason string) EventPayload {
+	return EventPayload{
+		Type:   event,
+		At:     s.clock.Now(),
+		Reason: reason,
+	}
+}
+
+// newTapEvent creates an event payload with the current state of the tap
+func (s *Scale) newTapEvent(event EventType, t *tap, reason string) EventPayload {
+	payload := s.newEvent(event, reason)
+	payload.Tap = t.id
+	payload.Keg = t.activeKeg
+	payload.Weight = t.weight
+	payload.BeersLeft = t.beersLeft
+
+	return payload
+}
+
+// dispatchEvent logs the event to the storage and runs all registered callbacks
+// the event is stored right away, so the ids follow the order of the events, only the callbacks run in the background
+func (s *Scale) dispatchEvent(payload EventPayload) {
+	// log event to storage
+	record, err := eventRecord(payload)
+	if err != nil {
+		s.logger.Errorf("failed to encode event %s: %v", payload.Type, err)
+	} else {
+		id, serr := s.store.AddEvent(record)
+		if serr != nil {
+			s.logger.Errorf("failed to add event %s: %v", payload.Type, serr)
 		}
+		payload.ID = id
+	}
+
+	hooks := s.events[payload.Type]
+	s.dispatching.Add(1)
+	go func() {
+		defer s.dispatching.Done()
 
 		// actually dispatch events
-		if s.events[event] != nil {
-			for _, hook := range s.events[event] {
-				if err = hook(event); err != nil {
-					s.logger.Errorf("failed to run hook for event %s: %s", event, err)
-				}
+		for _, hook := range hooks {
+			if err := hook(payload); err != nil {
+				s.logger.Errorf("failed to run hook for event %s: %s", payload.Type, err)
 			}
 		}
 	}()
 }
+
+// WaitEvents waits until the callbacks of all dispatched events are finished
+func (s *Scale) WaitEvents() {
+	s.dispatching.Wait()
+}
+
+func eventRecord(payload EventPayload) (store.EventRecord, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return store.EventRecord{}, fmt.Errorf("could not marshal event payload: %w", err)
+	}
+
+	return store.EventRecord{
+		Type: string(payload.Type),
+		At:   payload.At,
+		Tap:  payload.Tap,
+		Data: data,
+	}, nil
+}
+
+// GetEvents returns stored events matching the filter from newest to oldest
+func (s *Scale) GetEvents(filter store.EventFilter) (EventsOutput, error) {
+	records, err := s.store.GetEvents(filter)
+	if err != nil {
+		return EventsOutput{}, fmt.Errorf("could not get events: %w", err)
+	}
+
+	output := EventsOutput{
+		Events: make([]EventPayload, 0, len(records)),
+	}
+	for _, record := range records {
+		var payload EventPayload
+		if err := json.Unmarshal(record.Data, &payload); err != nil {
+			s.logger.Warnf("Could not decode event %d: %v", record.ID, err)
+		}
+
+		// columns are the source of truth
+		payload.ID = record.ID
+		payload.Type = EventType(record.Type)
+		payload.At = record.At
+		payload.Tap = record.Tap
+		output.Events = append(output.Events, payload)
+	}
+
+	if filter.Limit > 0 && len(records) == filter.Limit {
+		output.NextBefore = records[len(records)-1].ID
+	}
+
+	return output, nil
+}
@@ -0,0 +1,82 @@
+package scale
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kotrzina/keg-scale/pkg/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScale_dispatchEvent(t *testing.T) {
+	s := createScaleWithMeasurements(t, 40, 40)
+	tp := s.taps[store.DefaultTap]
+
+	received := make(chan EventPayload, 1)
+	s.RegisterEvent(EventRekegAmbiguous, func(payload EventPayload) error {
+		received <- payload
+		return nil
+	})
+
+	types := []string{string(EventOpen), string(EventRekegAmbiguous)}
+	storedEvents := func(n int) func() bool {
+		return func() bool {
+			events, err := s.GetEvents(store.EventFilter{Types: types})
+			return err == nil && len(events.Events) == n
+		}
+	}
+
+	s.dispatchEvent(s.newEvent(EventOpen, EventReasonManual))
+	require.Eventually(t, storedEvents(1), time.Second, 10*time.Millisecond)
+
+	payload := s.newTapEvent(EventRekegAmbiguous, tp, EventReasonScale)
+	payload.Keg = 10
+	payload.Confidence = 0.5
+	s.dispatchEvent(payload)
+
+	select {
+	case p := <-received:
+		assert.Positive(t, p.ID)
+		assert.Equal(t, store.DefaultTap, p.Tap)
+		assert.Equal(t, 10, p.Keg)
+		assert.InEpsilon(t, 40000.0, p.Weight, 0.000001)
+	case <-time.After(time.Second):
+		require.Fail(t, "callback was not called")
+	}
+
+	require.Eventually(t, storedEvents(2), time.Second, 10*time.Millisecond)
+
+	events, err := s.GetEvents(store.EventFilter{Types: types, Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, events.Events, 1)
+	assert.Equal(t, EventRekegAmbiguous, events.Events[0].Type)
+	assert.Equal(t, EventReasonScale, events.Events[0].Reason)
+	assert.Equal(t, tp.beersLeft, events.Events[0].BeersLeft)
+	assert.InEpsilon(t, 0.5, events.Events[0].Confidence, 0.000001)
+	assert.Equal(t, events.Events[0].ID, events.NextBefore)
+
+	// the last page
+	events, err = s.GetEvents(store.EventFilter{Types: types, BeforeID: events.NextBefore, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, events.Events, 1)
+	assert.Equal(t, EventOpen, events.Events[0].Type)
+	assert.Empty(t, events.Events[0].Tap)
+	assert.Zero(t, events.NextBefore)
+}
+
+func TestScale_NewKegTappedConfidence(t *testing.T) {
+	s := createScaleWithMeasurements(t, 63.5, 63.5)
+
+	// the 50l keg is replaced by a 10l keg
+	addMeasurements(t, s, 14500, 14500, 150, -20, 16000, 16000)
+	require.Equal(t, 10, s.taps[store.DefaultTap].activeKeg)
+
+	s.WaitEvents()
+	events, err := s.GetEvents(store.EventFilter{Types: []string{string(EventNewKegTapped)}})
+	require.NoError(t, err)
+	require.Len(t, events.Events, 2)
+	assert.Equal(t, 10, events.Events[0].Keg, "the newest event first")
+	assert.Equal(t, 50, events.Events[1].Keg)
+	assert.GreaterOrEqual(t, events.Events[0].Confidence, rekegConfirmConfidence)
+}
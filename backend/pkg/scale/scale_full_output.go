@@ -5,12 +5,14 @@ import (
 	"time"
 
 	"github.com/hako/durafmt"
+	"github.com/kotrzina/keg-scale/pkg/store"
 	"github.com/kotrzina/keg-scale/pkg/utils"
 )
 
 type WarehouseItem struct {
-	Keg    int `json:"keg"`
-	Amount int `json:"amount"`
+	Keg    int    `json:"keg"`
+	Label  string `json:"label"`
+	Amount int    `json:"amount"`
 }
 
 type PubOutput struct {
@@ -27,23 +29,57 @@ type BtDevice struct {
 	LastSeen        string `json:"last_seen"`
 }
 
+type TapOutput struct {
+	ID                 string            `json:"id"`
+	IsOk               bool              `json:"is_ok"`
+	BeersLeft          int               `json:"beers_left"`
+	LitersLeft         float64           `json:"liters_left"`
+	LastWeight         float64           `json:"last_weight"`
+	LastWeightFormated string            `json:"last_weight_formated"`
+	LastAt             string            `json:"last_at"`
+	LastAtDuration     string            `json:"last_at_duration"`
+	Rssi               float64           `json:"rssi"`
+	LastUpdate         string            `json:"last_update"`
+	LastUpdateDuration string            `json:"last_update_duration"`
+	ActiveKeg          int               `json:"active_keg"`
+	ActiveKegAt        time.Time         `json:"active_keg_at"`
+	IsLow              bool              `json:"is_low"`
+	CandidateKeg       int               `json:"candidate_keg"`
+	Consumption        ConsumptionOutput `json:"consumption"`
+	Pours              PourOutput        `json:"pours"`
+	Rekeg              RekegOutput       `json:"rekeg"`
+	Calibrating        bool              `json:"calibrating"` // measurements wait for the calibration to finish
+	Health             HealthOutput      `json:"health"`
+}
+
+// FullOutput top-level scale fields describe the default tap
+// all taps including the default one are listed in Taps
 type FullOutput struct {
-	IsOk               bool            `json:"is_ok"`
-	BeersLeft          int             `json:"beers_left"`
-	BeersTotal         int             `json:"beers_total"`
-	LastWeight         float64         `json:"last_weight"`
-	LastWeightFormated string          `json:"last_weight_formated"`
-	LastAt             string          `json:"last_at"`
-	LastAtDuration     string          `json:"last_at_duration"`
-	Rssi               float64         `json:"rssi"`
-	LastUpdate         string          `json:"last_update"`
-	LastUpdateDuration string          `json:"last_update_duration"`
-	Pub                PubOutput       `json:"pub"`
-	ActiveKeg          int             `json:"active_keg"`
-	ActiveKegAt        time.Time       `json:"active_keg_at"`
-	IsLow              bool            `json:"is_low"`
-	Warehouse          []WarehouseItem `json:"warehouse"`
-	WarehouseBeerLeft  int             `json:"warehouse_beer_left"`
+	IsOk               bool              `json:"is_ok"`
+	BeersLeft          int               `json:"beers_left"`
+	LitersLeft         float64           `json:"liters_left"`
+	BeersTotal         int               `json:"beers_total"`
+	LitersTotal        float64           `json:"liters_total"`
+	LastWeight         float64           `json:"last_weight"`
+	LastWeightFormated string            `json:"last_weight_formated"`
+	LastAt             string            `json:"last_at"`
+	LastAtDuration     string            `json:"last_at_duration"`
+	Rssi               float64           `json:"rssi"`
+	LastUpdate         string            `json:"last_update"`
+	LastUpdateDuration string            `json:"last_update_duration"`
+	Pub                PubOutput         `json:"pub"`
+	ActiveKeg          int               `json:"active_keg"`
+	ActiveKegAt        time.Time         `json:"active_keg_at"`
+	IsLow              bool              `json:"is_low"`
+	Warehouse          []WarehouseItem   `json:"warehouse"`
+	WarehouseBeerLeft  int               `json:"warehouse_beer_left"`
+	WarehouseLiters    float64           `json:"warehouse_liters"`
+	Deposits           DepositOutput     `json:"deposits"` // empty kegs waiting for the return
+	Consumption        ConsumptionOutput `json:"consumption"`
+	Pours              PourOutput        `json:"pours"`
+	Rekeg              RekegOutput       `json:"rekeg"`
+	Health             HealthOutput      `json:"health"`
+	Taps               []TapOutput       `json:"taps"`
 
 	BankBalance      BalanceOutput       `json:"bank_balance"`
 	BankTransactions []TransactionOutput `json:"bank_transactions"`
@@ -56,12 +92,13 @@ func (s *Scale) GetScale() FullOutput {
 	s.mux.RLock()
 	defer s.mux.RUnlock()
 
-	warehouse := []WarehouseItem{
-		{Keg: 10, Amount: s.warehouse[0]},
-		{Keg: 15, Amount: s.warehouse[1]},
-		{Keg: 20, Amount: s.warehouse[2]},
-		{Keg: 30, Amount: s.warehouse[3]},
-		{Keg: 50, Amount: s.warehouse[4]},
+	warehouse := make([]WarehouseItem, 0, len(s.catalog))
+	for _, kt := range s.catalog.Types() {
+		warehouse = append(warehouse, WarehouseItem{
+			Keg:    kt.Size,
+			Label:  kt.Label,
+			Amount: s.warehouse[kt.Size],
+		})
 	}
 
 	// Copy the transactions
@@ -87,27 +124,46 @@ func (s *Scale) GetScale() FullOutput {
 		i++
 	}
 
+	taps := make([]TapOutput, 0, len(s.taps))
+	for _, id := range s.tapIDs() {
+		taps = append(taps, s.getTapOutput(s.taps[id]))
+	}
+
+	main := s.getTapOutput(newTap(store.DefaultTap))
+	if t, found := s.taps[store.DefaultTap]; found {
+		main = s.getTapOutput(t)
+	}
+
 	output := FullOutput{
 		IsOk:               s.isOk(),
-		BeersLeft:          s.beersLeft,
+		BeersLeft:          main.BeersLeft,
+		LitersLeft:         main.LitersLeft,
 		BeersTotal:         s.getBeersTotal(),
-		LastWeight:         s.weight,
-		LastWeightFormated: fmt.Sprintf("%.2f", s.weight/1000),
-		LastAt:             utils.FormatDate(s.weightAt),
-		LastAtDuration:     durafmt.Parse(time.Since(s.weightAt).Round(time.Second)).LimitFirstN(2).Format(s.fmtUnits),
-		Rssi:               s.rssi,
-		LastUpdate:         utils.FormatDate(s.lastOk),
-		LastUpdateDuration: durafmt.Parse(time.Since(s.lastOk).Round(time.Second)).LimitFirstN(2).Format(s.fmtUnits),
+		LitersTotal:        s.getLitersTotal(),
+		LastWeight:         main.LastWeight,
+		LastWeightFormated: main.LastWeightFormated,
+		LastAt:             main.LastAt,
+		LastAtDuration:     main.LastAtDuration,
+		Rssi:               main.Rssi,
+		LastUpdate:         main.LastUpdate,
+		LastUpdateDuration: main.LastUpdateDuration,
 		Pub: PubOutput{
 			IsOpen:   s.pub.isOpen,
 			OpenedAt: utils.FormatDate(s.pub.openedAt),
 			ClosedAt: utils.FormatDate(s.pub.closedAt),
 		},
-		ActiveKeg:         s.activeKeg,
-		ActiveKegAt:       s.activeKegAt,
-		IsLow:             s.isLow,
+		ActiveKeg:         main.ActiveKeg,
+		ActiveKegAt:       main.ActiveKegAt,
+		IsLow:             main.IsLow,
+		Consumption:       main.Consumption,
+		Pours:             main.Pours,
+		Rekeg:             main.Rekeg,
+		Health:            main.Health,
 		Warehouse:         warehouse,
-		WarehouseBeerLeft: GetWarehouseBeersLeft(s.warehouse),
+		WarehouseBeerLeft: s.catalog.WarehouseBeers(s.warehouse),
+		WarehouseLiters:   s.catalog.WarehouseLiters(s.warehouse),
+		Deposits:          s.getDeposits(),
+		Taps:              taps,
 		BankBalance:       s.bank.balance,
 		BankTransactions:  bt,
 
@@ -117,3 +173,28 @@ func (s *Scale) GetScale() FullOutput {
 
 	return output
 }
+
+func (s *Scale) getTapOutput(t *tap) TapOutput {
+	return TapOutput{
+		ID:                 t.id,
+		IsOk:               s.isTapOk(t),
+		BeersLeft:          t.beersLeft,
+		LitersLeft:         s.catalog.CalcLitersLeft(t.activeKeg, t.weight),
+		LastWeight:         t.weight,
+		LastWeightFormated: fmt.Sprintf("%.2f", t.weight/1000),
+		LastAt:             utils.FormatDate(t.weightAt),
+		LastAtDuration:     durafmt.Parse(s.clock.Since(t.weightAt).Round(time.Second)).LimitFirstN(2).Format(s.fmtUnits),
+		Rssi:               t.rssi,
+		LastUpdate:         utils.FormatDate(t.lastOk),
+		LastUpdateDuration: durafmt.Parse(s.clock.Since(t.lastOk).Round(time.Second)).LimitFirstN(2).Format(s.fmtUnits),
+		ActiveKeg:          t.activeKeg,
+		ActiveKegAt:        t.activeKegAt,
+		IsLow:              t.isLow,
+		CandidateKeg:       t.candidateKeg,
+		Consumption:        s.getConsumptionOutput(t),
+		Pours:              s.getPourOutput(t),
+		Rekeg:              s.getRekegOutput(t),
+		Calibrating:        t.calibration.session != nil,
+		Health:             s.getHealthOutput(t),
+	}
+}
@@ -0,0 +1,56 @@
+package scale
+
+import (
+	"time"
+
+	"github.com/hako/durafmt"
+	"github.com/kotrzina/keg-scale/pkg/store"
+)
+
+type KegOutput struct {
+	store.KegRecord
+	IsActive        bool   `json:"is_active"`
+	Duration        string `json:"duration"`
+	DurationSeconds int64  `json:"duration_seconds"`
+}
+
+// GetKegHistory returns kegs from the ledger from newest to oldest
+// empty tapID returns kegs of all taps
+// active kegs have up-to-date values from the scale
+func (s *Scale) GetKegHistory(tapID string, limit int) ([]KegOutput, error) {
+	kegs, err := s.store.GetKegs(tapID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	output := make([]KegOutput, len(kegs))
+	for i, keg := range kegs {
+		isActive := keg.EmptiedAt == nil
+		end := s.clock.Now()
+		if isActive {
+			if t, found := s.taps[keg.Tap]; found && keg.ID == t.kegRecord.ID {
+				keg = t.kegRecord
+			}
+			keg.BeersPoured = s.catalog.CalcBeersConsumed(keg.Size, keg.EndWeight)
+			keg.LitersPoured = s.catalog.CalcLitersConsumed(keg.Size, keg.EndWeight)
+		} else {
+			end = *keg.EmptiedAt
+			if keg.LitersPoured == 0 {
+				keg.LitersPoured = float64(keg.BeersPoured) * DefaultServingSize // closed before liters were tracked
+			}
+		}
+
+		d := end.Sub(keg.TappedAt).Round(time.Second)
+		output[i] = KegOutput{
+			KegRecord:       keg,
+			IsActive:        isActive,
+			Duration:        durafmt.Parse(d).LimitFirstN(2).Format(s.fmtUnits),
+			DurationSeconds: int64(d.Seconds()),
+		}
+	}
+
+	return output, nil
+}
@@ -6,16 +6,19 @@ import (
 	"testing"
 	"time"
 
+	"github.com/kotrzina/keg-scale/pkg/clock"
 	"github.com/kotrzina/keg-scale/pkg/config"
 	"github.com/kotrzina/keg-scale/pkg/prometheus"
 	"github.com/kotrzina/keg-scale/pkg/store"
+	"github.com/kotrzina/keg-scale/pkg/utils"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestScale_AddMeasurement(t *testing.T) {
 	s := createScaleWithMeasurements(t, []float64{10, 3, 20, 30, 40, 81, 50, 60}...)
-	assert.InEpsilon(t, 60000.0, s.weight, 0.000001)
+	assert.InEpsilon(t, 60000.0, s.taps[store.DefaultTap].weight, 0.000001)
 }
 
 func createScaleWithMeasurements(t *testing.T, weights ...float64) *Scale {
@@ -23,20 +26,48 @@ func createScaleWithMeasurements(t *testing.T, weights ...float64) *Scale {
 	logger := logrus.New()
 	var buf bytes.Buffer
 	logger.SetOutput(&buf)
+
+	// all measurements come at once, filtering is tested separately
+	conf := config.NewConfig()
+	conf.Filter.Window = 1
+	conf.Filter.MaxRate = 0
+
 	s := New(
 		context.Background(),
 		prometheus.New(),
 		&store.FakeStore{},
-		config.NewConfig(),
+		conf,
+		clock.New(),
 		logger,
 	)
 	for _, weight := range weights {
-		assert.NoError(t, s.AddMeasurement(weight*1000))
+		assert.NoError(t, s.AddMeasurement(store.DefaultTap, weight*1000))
 	}
 	return s
 }
 
-func TestScale_shouldSendOpen(t *testing.T) {
+// createScaleWithClock creates a scale driven by the fake clock, the store returns the same time
+func createScaleWithClock(t *testing.T, clk *clock.Fake) *Scale {
+	t.Helper()
+	logger := logrus.New()
+	var buf bytes.Buffer
+	logger.SetOutput(&buf)
+
+	conf := config.NewConfig()
+	conf.BankProvider = config.BankProviderFio
+	conf.FioToken = ""
+
+	return New(
+		context.Background(),
+		prometheus.New(),
+		&store.FakeStore{Clock: clk},
+		conf,
+		clk,
+		logger,
+	)
+}
+
+func TestScale_decideOpen(t *testing.T) {
 	cases := []struct {
 		name        string
 		openBefore  time.Duration
@@ -48,14 +79,108 @@ func TestScale_shouldSendOpen(t *testing.T) {
 		{"at least 3 hours closed", 24 * time.Hour, 2 * time.Hour, false},
 	}
 
+	clk := clock.NewFake(time.Date(2025, 3, 14, 18, 0, 0, 0, time.UTC))
 	for _, tt := range cases {
 		s := &Scale{
 			pub: pub{
-				openedAt: time.Now().Add(-tt.openBefore),
-				closedAt: time.Now().Add(-tt.closeBefore),
+				openedAt: clk.Now().Add(-tt.openBefore),
+				closedAt: clk.Now().Add(-tt.closeBefore),
+				policy:   DefaultOpenPolicy(),
 			},
+			clock: clk,
 		}
 
-		assert.Equal(t, tt.shouldSend, s.shouldSendOpen(), tt.name)
+		assert.Equal(t, tt.shouldSend, s.decideOpen(false).Send, tt.name)
+	}
+}
+
+func TestScale_OpenCloseDebounce(t *testing.T) {
+	clk := clock.NewFake(time.Date(2025, 3, 14, 17, 0, 0, 0, time.UTC))
+	s := createScaleWithClock(t, clk)
+	closeAfter := s.okLimit()
+
+	// the store says the pub has just been opened, so the backend restart does not announce it again
+	assert.NoError(t, s.Ping(store.DefaultTap))
+	assert.True(t, s.GetScale().Pub.IsOpen)
+	assert.Equal(t, 0, countEvents(t, s, EventOpen)[EventOpen])
+
+	// regular pings keep the pub open
+	for i := 0; i < 10; i++ {
+		clk.Advance(closeAfter - time.Second)
+		s.Recheck()
+		assert.True(t, s.GetScale().Pub.IsOpen)
+		assert.NoError(t, s.Ping(store.DefaultTap))
 	}
+
+	// the scale stopped sending data
+	clk.Advance(closeAfter - time.Second)
+	s.Recheck()
+	assert.True(t, s.GetScale().Pub.IsOpen, "closes only after close_after")
+	clk.Advance(2 * time.Second)
+	s.Recheck()
+	assert.False(t, s.GetScale().Pub.IsOpen)
+	assert.Equal(t, 1, countEvents(t, s, EventClose)[EventClose])
+	assert.Equal(t, clk.Now().Add(-closeAfter), s.pub.closedAt, "closed at the last message")
+
+	// short outage of the scale during the evening - reopened without the message
+	clk.Advance(time.Hour)
+	assert.NoError(t, s.Ping(store.DefaultTap))
+	assert.True(t, s.GetScale().Pub.IsOpen)
+	assert.Equal(t, 0, countEvents(t, s, EventOpen)[EventOpen])
+
+	// next day
+	clk.Advance(closeAfter + time.Second)
+	s.Recheck()
+	assert.False(t, s.GetScale().Pub.IsOpen)
+	clk.Advance(20 * time.Hour)
+	s.Recheck()
+	assert.NoError(t, s.Ping(store.DefaultTap))
+	assert.True(t, s.GetScale().Pub.IsOpen)
+	assert.Equal(t, 1, countEvents(t, s, EventOpen)[EventOpen])
+	assert.Equal(t, 2, countEvents(t, s, EventClose)[EventClose])
+}
+
+func TestScale_shouldRefreshBank(t *testing.T) {
+	tz := utils.GetTz()
+	cases := []struct {
+		name        string
+		now         time.Time
+		lastRefresh time.Duration // before now
+		force       bool
+		expected    bool
+	}{
+		{"evening - refreshed recently", time.Date(2025, 3, 14, 21, 0, 0, 0, tz), 4 * time.Minute, false, false},
+		{"evening - 5 minutes", time.Date(2025, 3, 14, 21, 0, 0, 0, tz), 5 * time.Minute, false, true},
+		{"evening starts at 19", time.Date(2025, 3, 14, 19, 0, 0, 0, tz), 6 * time.Minute, false, true},
+		{"before midnight", time.Date(2025, 3, 14, 23, 59, 0, 0, tz), 6 * time.Minute, false, true},
+		{"day - refreshed recently", time.Date(2025, 3, 14, 10, 0, 0, 0, tz), 14 * time.Minute, false, false},
+		{"day - 15 minutes", time.Date(2025, 3, 14, 10, 0, 0, 0, tz), 15 * time.Minute, false, true},
+		{"after midnight", time.Date(2025, 3, 15, 0, 30, 0, 0, tz), 6 * time.Minute, false, false},
+		{"forced", time.Date(2025, 3, 14, 10, 0, 0, 0, tz), time.Second, true, true},
+	}
+
+	for _, tt := range cases {
+		clk := clock.NewFake(tt.now)
+		s := &Scale{clock: clk}
+
+		assert.Equal(t, tt.expected, s.shouldRefreshBank(tt.now.Add(-tt.lastRefresh), tt.force), tt.name)
+	}
+}
+
+func TestScale_Totals(t *testing.T) {
+	s := createScaleWithMeasurements(t)
+	require.NoError(t, s.SetKegType(store.KegType{Size: 15, EmptyWeight: 7000, ServingSize: 0.3}))
+
+	tp := s.taps[store.DefaultTap]
+	tp.activeKeg = 15
+	tp.weight = 10000 // 3 liters left
+
+	assert.Equal(t, 40, s.getBeersTotal())
+	assert.InEpsilon(t, 12.0, s.getLitersTotal(), 0.000001)
+
+	require.NoError(t, s.addCurrentKegToTotal(tp))
+	tp.activeKeg = 0
+	assert.Equal(t, 50, s.getBeersTotal())
+	assert.InEpsilon(t, 15.0, s.getLitersTotal(), 0.000001)
+	assert.InEpsilon(t, 15.0, s.GetScale().LitersTotal, 0.000001)
 }
@@ -0,0 +1,208 @@
+package scale
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hako/durafmt"
+	"github.com/kotrzina/keg-scale/pkg/store"
+	"github.com/kotrzina/keg-scale/pkg/utils"
+	"github.com/shopspring/decimal"
+)
+
+const sessionHistoryMax = 100 // max number of sessions returned at once
+
+// pubSession tracks statistics of the current open/close cycle of the pub
+type pubSession struct {
+	record store.PubSession      // zero ID when the pub is closed
+	taps   map[string]sessionTap // tap id => lowest beers left of its keg in the session
+}
+
+// sessionTap counts beers of a single tap by its lowest beers left, so noise does not add up
+type sessionTap struct {
+	keg    int
+	lowest int
+}
+
+type PubSessionOutput struct {
+	store.PubSession
+	Duration string `json:"duration"`
+}
+
+type PubSessionsOutput struct {
+	Current  *PubSessionOutput  `json:"current"` // tonight so far, nil when the pub is closed
+	Sessions []PubSessionOutput `json:"sessions"`
+}
+
+// loadPubSession continues the open session after a restart
+// a session left open by a closed pub is closed at the last close time
+func (s *Scale) loadPubSession() {
+	sessions, err := s.store.GetPubSessions(1)
+	if err != nil {
+		s.logger.Errorf("Could not load pub session: %v", err)
+		return
+	}
+
+	if len(sessions) == 0 || sessions[0].ClosedAt != nil {
+		return
+	}
+
+	s.pub.session.record = sessions[0]
+	s.resetSessionTaps()
+	if !s.pub.isOpen {
+		s.endPubSession()
+	}
+}
+
+// startPubSession starts a new session when the pub opens
+func (s *Scale) startPubSession() {
+	record := store.PubSession{
+		OpenedAt:       s.pub.openedAt,
+		PeakAttendance: len(s.attendance.active),
+		Income:         decimal.Zero,
+	}
+
+	id, err := s.store.AddPubSession(record)
+	if err != nil {
+		s.logger.Errorf("Could not store pub session: %v", err)
+		return
+	}
+
+	record.ID = id
+	s.pub.session.record = record
+	s.resetSessionTaps()
+}
+
+// endPubSession finishes the current session when the pub closes
+func (s *Scale) endPubSession() {
+	if s.pub.session.record.ID == 0 {
+		return
+	}
+
+	closedAt := s.pub.closedAt
+	s.pub.session.record.ClosedAt = &closedAt
+	s.pub.session.record.Income = s.sessionIncome(s.pub.session.record.OpenedAt, closedAt)
+	s.storePubSession()
+
+	s.pub.session = pubSession{}
+}
+
+func (s *Scale) resetSessionTaps() {
+	s.pub.session.taps = make(map[string]sessionTap, len(s.taps))
+	for _, t := range s.taps {
+		s.pub.session.taps[t.id] = sessionTap{keg: t.activeKeg, lowest: t.beersLeft}
+	}
+}
+
+// trackSessionBeers adds beers poured from the tap since its last lowest value
+func (s *Scale) trackSessionBeers(t *tap) {
+	if s.pub.session.record.ID == 0 {
+		return
+	}
+
+	st, found := s.pub.session.taps[t.id]
+	if !found || st.keg != t.activeKeg || t.activeKeg == 0 {
+		s.pub.session.taps[t.id] = sessionTap{keg: t.activeKeg, lowest: t.beersLeft}
+		return
+	}
+
+	if t.beersLeft >= st.lowest {
+		return
+	}
+
+	s.pub.session.record.BeersPoured += st.lowest - t.beersLeft
+	s.pub.session.taps[t.id] = sessionTap{keg: st.keg, lowest: t.beersLeft}
+	s.storePubSession()
+}
+
+// trackSessionKeg counts a newly tapped keg
+func (s *Scale) trackSessionKeg() {
+	if s.pub.session.record.ID == 0 {
+		return
+	}
+
+	s.pub.session.record.KegsTapped++
+	s.storePubSession()
+}
+
+// trackSessionAttendance keeps the peak number of BT devices
+func (s *Scale) trackSessionAttendance() {
+	if s.pub.session.record.ID == 0 || len(s.attendance.active) <= s.pub.session.record.PeakAttendance {
+		return
+	}
+
+	s.pub.session.record.PeakAttendance = len(s.attendance.active)
+	s.storePubSession()
+}
+
+func (s *Scale) storePubSession() {
+	if err := s.store.UpdatePubSession(s.pub.session.record); err != nil {
+		s.logger.Errorf("Could not update pub session %d: %v", s.pub.session.record.ID, err)
+	}
+}
+
+// sessionIncome sums incoming bank payments dated within the session days
+// bank transactions have only dates, so the whole days are used
+func (s *Scale) sessionIncome(from, to time.Time) decimal.Decimal {
+	fromDay := day(from)
+	toDay := day(to)
+
+	income := decimal.Zero
+	for _, t := range s.bank.transactions {
+		d := day(t.Date)
+		if t.Amount.IsPositive() && !d.Before(fromDay) && !d.After(toDay) {
+			income = income.Add(t.Amount)
+		}
+	}
+
+	return income
+}
+
+// day returns the start of the day in the local timezone
+func day(t time.Time) time.Time {
+	local := t.In(utils.GetTz())
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, utils.GetTz())
+}
+
+// GetPubSessions returns the current session with live statistics and the last closed sessions
+func (s *Scale) GetPubSessions(limit int) (PubSessionsOutput, error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	limit = min(limit, sessionHistoryMax)
+	records, err := s.store.GetPubSessions(limit + 1) // the first one may be the open one
+	if err != nil {
+		return PubSessionsOutput{}, fmt.Errorf("could not get pub sessions: %w", err)
+	}
+
+	output := PubSessionsOutput{
+		Sessions: make([]PubSessionOutput, 0, len(records)),
+	}
+
+	if current := s.pub.session.record; current.ID > 0 {
+		current.Income = s.sessionIncome(current.OpenedAt, s.clock.Now())
+		o := s.getPubSessionOutput(current)
+		output.Current = &o
+	}
+
+	for _, record := range records {
+		if record.ClosedAt == nil || len(output.Sessions) == limit {
+			continue
+		}
+		output.Sessions = append(output.Sessions, s.getPubSessionOutput(record))
+	}
+
+	return output, nil
+}
+
+func (s *Scale) getPubSessionOutput(record store.PubSession) PubSessionOutput {
+	end := s.clock.Now()
+	if record.ClosedAt != nil {
+		end = *record.ClosedAt
+	}
+
+	return PubSessionOutput{
+		PubSession: record,
+		Duration:   durafmt.Parse(end.Sub(record.OpenedAt).Round(time.Minute)).LimitFirstN(2).Format(s.fmtUnits),
+	}
+}
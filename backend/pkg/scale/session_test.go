@@ -0,0 +1,79 @@
+package scale
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kotrzina/keg-scale/pkg/store"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScale_PubSession(t *testing.T) {
+	s := createScaleWithMeasurements(t, 40, 40)
+	require.Equal(t, 30, s.taps[store.DefaultTap].activeKeg)
+	s.bank.transactions = []TransactionOutput{
+		{Date: time.Now(), Amount: decimal.NewFromInt(250)},
+		{Date: time.Now(), Amount: decimal.NewFromInt(-1000)},                   // outgoing payment
+		{Date: time.Now().Add(-48 * time.Hour), Amount: decimal.NewFromInt(75)}, // another day
+	}
+
+	s.updatePub(true, true)
+	require.Positive(t, s.pub.session.record.ID)
+
+	// 6 beers with some noise going up and down
+	addMeasurements(t, s, 39000, 39300, 38000, 37000)
+	s.SetDevices(map[string]Device{
+		"a": {LastSeen: time.Now()},
+		"b": {LastSeen: time.Now()},
+	})
+	s.SetDevices(map[string]Device{
+		"c": {LastSeen: time.Now()},
+	})
+	require.NoError(t, s.SetActiveKeg(store.DefaultTap, 50))
+
+	sessions, err := s.GetPubSessions(10)
+	require.NoError(t, err)
+	require.NotNil(t, sessions.Current, "tonight so far")
+	assert.Equal(t, 6, sessions.Current.BeersPoured)
+	assert.Equal(t, 1, sessions.Current.KegsTapped)
+	assert.Equal(t, 3, sessions.Current.PeakAttendance)
+	assert.True(t, decimal.NewFromInt(250).Equal(sessions.Current.Income))
+	assert.Empty(t, sessions.Sessions)
+
+	s.updatePub(false, false)
+	assert.Zero(t, s.pub.session.record.ID)
+
+	sessions, err = s.GetPubSessions(10)
+	require.NoError(t, err)
+	assert.Nil(t, sessions.Current)
+	require.Len(t, sessions.Sessions, 1)
+	assert.Equal(t, 6, sessions.Sessions[0].BeersPoured)
+	require.NotNil(t, sessions.Sessions[0].ClosedAt)
+	assert.True(t, decimal.NewFromInt(250).Equal(sessions.Sessions[0].Income))
+}
+
+func TestScale_loadPubSession(t *testing.T) {
+	fs := &store.FakeStore{}
+	s := createScaleWithMeasurements(t)
+	s.store = fs
+
+	_, err := fs.AddPubSession(store.PubSession{OpenedAt: time.Now().Add(-time.Hour), BeersPoured: 4})
+	require.NoError(t, err)
+
+	// the pub is open - the session continues
+	s.pub.isOpen = true
+	s.loadPubSession()
+	assert.Equal(t, 4, s.pub.session.record.BeersPoured)
+
+	// the pub was closed during the restart
+	s.pub.session = pubSession{}
+	s.pub.isOpen = false
+	s.loadPubSession()
+	assert.Zero(t, s.pub.session.record.ID)
+
+	sessions, err := fs.GetPubSessions(1)
+	require.NoError(t, err)
+	require.NotNil(t, sessions[0].ClosedAt)
+}
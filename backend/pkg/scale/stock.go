@@ -0,0 +1,378 @@
+package scale
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/kotrzina/keg-scale/pkg/store"
+)
+
+const warehouseHistoryLimit = 1000
+
+// WarehouseActor describes who changed the warehouse and why
+type WarehouseActor struct {
+	Source store.WarehouseSource `json:"source"`
+	Actor  string                `json:"actor"`
+	Reason string                `json:"reason"`
+}
+
+// loadStock loads the kegs in the warehouse
+// the legacy warehouse counts become anonymous kegs when there is no inventory yet
+func (s *Scale) loadStock() {
+	kegs, err := s.store.GetStockKegs(true)
+	if err != nil {
+		s.logger.Errorf("Could not load warehouse inventory: %v", err)
+		return
+	}
+
+	if len(kegs) == 0 {
+		kegs = s.migrateWarehouse()
+	}
+
+	s.stock = kegs
+	sortStock(s.stock)
+	s.warehouse = stockCounts(s.stock)
+}
+
+// migrateWarehouse creates anonymous kegs for the warehouse counts stored before the inventory existed
+func (s *Scale) migrateWarehouse() []store.StockKeg {
+	warehouse, err := s.store.GetWarehouse()
+	if err != nil || warehouse == nil {
+		return nil
+	}
+
+	sizes := make([]int, 0, len(warehouse))
+	for size := range warehouse {
+		sizes = append(sizes, size)
+	}
+	slices.Sort(sizes)
+
+	kegs := []store.StockKeg{}
+	by := WarehouseActor{Source: store.WarehouseSourceSystem, Reason: "migrated from the warehouse counts"}
+	for _, size := range sizes {
+		migrated := 0
+		for range warehouse[size] {
+			keg := store.StockKeg{
+				Size:        size,
+				PurchasedAt: s.clock.Now(),
+				Note:        "migrated from the warehouse counts",
+			}
+			id, err := s.store.AddStockKeg(keg)
+			if err != nil {
+				s.logger.Errorf("Could not migrate warehouse keg %d: %v", size, err)
+				continue
+			}
+			keg.ID = id
+			kegs = append(kegs, keg)
+			migrated++
+		}
+		if migrated > 0 {
+			s.logWarehouseChange(store.WarehouseChangeCorrection, size, migrated, 0, by)
+		}
+	}
+
+	if len(kegs) > 0 {
+		s.logger.Infof("Migrated %d warehouse kegs to the inventory", len(kegs))
+	}
+
+	return kegs
+}
+
+// sortStock sorts kegs in the order they should be tapped - first in, first out by the best before date
+// kegs without the best before date go last, the older purchase goes first otherwise
+func sortStock(kegs []store.StockKeg) {
+	sort.SliceStable(kegs, func(i, j int) bool {
+		a, b := kegs[i], kegs[j]
+		if (a.BestBefore == nil) != (b.BestBefore == nil) {
+			return a.BestBefore != nil
+		}
+		if a.BestBefore != nil && !a.BestBefore.Equal(*b.BestBefore) {
+			return a.BestBefore.Before(*b.BestBefore)
+		}
+		if !a.PurchasedAt.Equal(b.PurchasedAt) {
+			return a.PurchasedAt.Before(b.PurchasedAt)
+		}
+		return a.ID < b.ID
+	})
+}
+
+// stockCounts returns the warehouse counts - keg size => amount
+func stockCounts(kegs []store.StockKeg) map[int]int {
+	warehouse := map[int]int{}
+	for _, keg := range kegs {
+		warehouse[keg.Size]++
+	}
+
+	return warehouse
+}
+
+// findStockKeg returns the index of the keg in the warehouse, the first keg of the size when id is zero
+// it returns -1 when there is no such keg
+func (s *Scale) findStockKeg(id int64, size int) int {
+	for i, keg := range s.stock {
+		if id > 0 && keg.ID == id {
+			return i
+		}
+		if id == 0 && keg.Size == size {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// updateWarehouse recounts the warehouse after the inventory change
+func (s *Scale) updateWarehouse(reason string) error {
+	s.warehouse = stockCounts(s.stock)
+	if err := s.store.SetWarehouse(s.warehouse); err != nil {
+		return fmt.Errorf("could not update store warehouse: %w", err)
+	}
+
+	s.checkWarehouse(reason)
+	return nil
+}
+
+// logWarehouseChange records the change in the warehouse audit log
+// the warehouse is already changed, so the failure is only logged
+func (s *Scale) logWarehouseChange(kind store.WarehouseChangeKind, size, delta int, stockID int64, by WarehouseActor) {
+	_, err := s.store.AddWarehouseChange(store.WarehouseChange{
+		Size:      size,
+		Delta:     delta,
+		Kind:      kind,
+		StockID:   stockID,
+		Source:    by.Source,
+		Actor:     by.Actor,
+		Reason:    by.Reason,
+		CreatedAt: s.clock.Now(),
+	})
+	if err != nil {
+		s.logger.Errorf("Could not record warehouse change (%s %+d × %dl): %v", kind, delta, size, err)
+	}
+}
+
+// takeStockKeg takes the keg out of the warehouse
+func (s *Scale) takeStockKeg(i int, reason store.StockOutReason, tap, note string) (store.StockKeg, error) {
+	keg := s.stock[i]
+	now := s.clock.Now()
+	keg.OutAt = &now
+	keg.OutReason = reason
+	keg.Tap = tap
+	if note != "" {
+		keg.Note = note
+	}
+
+	if err := s.store.UpdateStockKeg(keg); err != nil {
+		return store.StockKeg{}, fmt.Errorf("could not update stock keg: %w", err)
+	}
+
+	s.stock = slices.Delete(s.stock, i, i+1)
+	return keg, nil
+}
+
+// tapStockKeg takes the first keg of the size from the warehouse for the tap
+// it returns zero when the keg is not in the warehouse
+func (s *Scale) tapStockKeg(t *tap, size int) (int64, error) {
+	i := s.findStockKeg(0, size)
+	if i < 0 {
+		s.logger.Warnf("Keg %d is not available in the warehouse", size)
+		return 0, nil
+	}
+
+	keg, err := s.takeStockKeg(i, store.StockOutReasonTapped, t.id, "")
+	if err != nil {
+		return 0, err
+	}
+	s.logWarehouseChange(store.WarehouseChangeTapped, keg.Size, -1, keg.ID, WarehouseActor{
+		Source: store.WarehouseSourceAutoRekeg,
+		Reason: fmt.Sprintf("tapped on tap %s", t.id),
+	})
+
+	if err := s.updateWarehouse(EventReasonScale); err != nil {
+		return 0, err
+	}
+
+	s.logger.Infof("Stock keg %d (%d l %s) tapped (tap %s)", keg.ID, keg.Size, keg.Brand, t.id)
+	return keg.ID, nil
+}
+
+// AddStockKeg adds the purchased keg to the warehouse
+func (s *Scale) AddStockKeg(keg store.StockKeg, by WarehouseActor) (store.StockKeg, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	keg, err := s.addStockKeg(keg)
+	if err != nil {
+		return store.StockKeg{}, err
+	}
+	s.logWarehouseChange(store.WarehouseChangeAdd, keg.Size, 1, keg.ID, by)
+
+	return keg, s.updateWarehouse(EventReasonManual)
+}
+
+func (s *Scale) addStockKeg(keg store.StockKeg) (store.StockKeg, error) {
+	if !s.catalog.Has(keg.Size) {
+		return store.StockKeg{}, fmt.Errorf("invalid keg")
+	}
+	if keg.Price.IsNegative() {
+		return store.StockKeg{}, fmt.Errorf("price cannot be negative")
+	}
+	if keg.Deposit.IsNegative() {
+		return store.StockKeg{}, fmt.Errorf("deposit cannot be negative")
+	}
+	if keg.PurchasedAt.IsZero() {
+		keg.PurchasedAt = s.clock.Now()
+	}
+	keg.ID = 0
+	keg.OutAt = nil
+	keg.OutReason = ""
+	keg.Tap = ""
+
+	id, err := s.store.AddStockKeg(keg)
+	if err != nil {
+		return store.StockKeg{}, fmt.Errorf("could not add stock keg: %w", err)
+	}
+	keg.ID = id
+
+	s.stock = append(s.stock, keg)
+	sortStock(s.stock)
+
+	return keg, nil
+}
+
+// RemoveStockKeg removes the keg from the warehouse without tapping it - returned, sold, broken...
+// the first keg of the size is removed when id is zero, the reason is stored as the keg note
+func (s *Scale) RemoveStockKeg(id int64, size int, by WarehouseActor) (store.StockKeg, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	keg, err := s.removeStockKeg(id, size, by.Reason)
+	if err != nil {
+		return store.StockKeg{}, err
+	}
+	s.logWarehouseChange(store.WarehouseChangeRemove, keg.Size, -1, keg.ID, by)
+
+	return keg, s.updateWarehouse(EventReasonManual)
+}
+
+func (s *Scale) removeStockKeg(id int64, size int, note string) (store.StockKeg, error) {
+	i := s.findStockKeg(id, size)
+	if i < 0 {
+		return store.StockKeg{}, fmt.Errorf("keg is not in the warehouse")
+	}
+
+	return s.takeStockKeg(i, store.StockOutReasonRemoved, "", note)
+}
+
+// Stocktake sets the counted amount of kegs - keg size => amount
+// missing kegs are added as anonymous, surplus kegs are removed in the tapping order
+// every size with a difference gets a single correction entry in the audit log
+func (s *Scale) Stocktake(counts map[int]int, by WarehouseActor) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	sizes := make([]int, 0, len(counts))
+	for size, amount := range counts {
+		if !s.catalog.Has(size) {
+			return fmt.Errorf("invalid keg %d", size)
+		}
+		if amount < 0 {
+			return fmt.Errorf("amount of keg %d cannot be negative", size)
+		}
+		sizes = append(sizes, size)
+	}
+	slices.Sort(sizes)
+
+	note := "stocktake"
+	if by.Reason != "" {
+		note = "stocktake: " + by.Reason
+	}
+
+	for _, size := range sizes {
+		delta, err := s.stocktakeKeg(size, counts[size], note)
+		if delta != 0 {
+			// the kegs are already changed even when the stocktake failed halfway
+			s.logWarehouseChange(store.WarehouseChangeCorrection, size, delta, 0, by)
+			s.logger.Infof("Stocktake corrected keg %d by %+d", size, delta)
+		}
+		if err != nil {
+			if uerr := s.updateWarehouse(EventReasonManual); uerr != nil {
+				s.logger.Errorf("Could not update warehouse after failed stocktake: %v", uerr)
+			}
+			return fmt.Errorf("stocktake of keg %d failed after %+d: %w", size, delta, err)
+		}
+	}
+
+	return s.updateWarehouse(EventReasonManual)
+}
+
+// stocktakeKeg adds or removes kegs of the size until the warehouse has the amount
+// it returns the change applied before a failure
+func (s *Scale) stocktakeKeg(size, amount int, note string) (int, error) {
+	delta := 0
+	for s.warehouse[size]+delta < amount {
+		if _, err := s.addStockKeg(store.StockKeg{Size: size, Note: note}); err != nil {
+			return delta, err
+		}
+		delta++
+	}
+	for s.warehouse[size]+delta > amount {
+		if _, err := s.removeStockKeg(0, size, note); err != nil {
+			return delta, err
+		}
+		delta--
+	}
+
+	return delta, nil
+}
+
+// GetWarehouseHistory returns the warehouse audit log from the newest change
+func (s *Scale) GetWarehouseHistory(limit int) ([]store.WarehouseChange, error) {
+	if limit < 1 || limit > warehouseHistoryLimit {
+		return nil, fmt.Errorf("limit must be between 1 and %d", warehouseHistoryLimit)
+	}
+
+	changes, err := s.store.GetWarehouseChanges(limit)
+	if err != nil {
+		return nil, fmt.Errorf("could not get warehouse history: %w", err)
+	}
+
+	return changes, nil
+}
+
+// GetStockKegs returns kegs in the warehouse in the order they should be tapped
+func (s *Scale) GetStockKegs() []store.StockKeg {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	return slices.Clone(s.stock)
+}
+
+// IncreaseWarehouse adds an anonymous keg to the warehouse
+func (s *Scale) IncreaseWarehouse(keg int, by WarehouseActor) error {
+	_, err := s.AddStockKeg(store.StockKeg{Size: keg}, by)
+	return err
+}
+
+// DecreaseWarehouse removes the first keg of the size from the warehouse
+// it does nothing when there is no such keg
+func (s *Scale) DecreaseWarehouse(keg int, by WarehouseActor) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if !s.catalog.Has(keg) {
+		return fmt.Errorf("invalid keg")
+	}
+
+	if s.warehouse[keg] == 0 {
+		return nil
+	}
+
+	removed, err := s.removeStockKeg(0, keg, by.Reason)
+	if err != nil {
+		return err
+	}
+	s.logWarehouseChange(store.WarehouseChangeRemove, removed.Size, -1, removed.ID, by)
+
+	return s.updateWarehouse(EventReasonManual)
+}
@@ -0,0 +1,246 @@
+package scale
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kotrzina/keg-scale/pkg/store"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScale_StockMigration(t *testing.T) {
+	s := createScaleWithMeasurements(t)
+
+	// the fake store has legacy counts 10:1, 15:2, 20:3, 30:4, 50:5
+	kegs := s.GetStockKegs()
+	require.Len(t, kegs, 15)
+	assert.Equal(t, map[int]int{10: 1, 15: 2, 20: 3, 30: 4, 50: 5}, s.warehouse)
+	for _, keg := range kegs {
+		assert.Positive(t, keg.ID)
+		assert.Empty(t, keg.Brand)
+		assert.Nil(t, keg.OutAt)
+	}
+}
+
+func TestScale_StockFifo(t *testing.T) {
+	s := createScaleWithMeasurements(t)
+	s.stock = nil
+
+	now := s.clock.Now()
+	soon := now.Add(30 * 24 * time.Hour)
+	later := now.Add(60 * 24 * time.Hour)
+
+	noDate, err := s.AddStockKeg(store.StockKeg{Size: 30, Brand: "Unknown", PurchasedAt: now.Add(-48 * time.Hour)}, WarehouseActor{})
+	require.NoError(t, err)
+	fresh, err := s.AddStockKeg(store.StockKeg{Size: 30, Brand: "Policka", Price: decimal.NewFromInt(1290), BestBefore: &later}, WarehouseActor{})
+	require.NoError(t, err)
+	old, err := s.AddStockKeg(store.StockKeg{Size: 30, Brand: "Bernard", Supplier: "maneo", BestBefore: &soon}, WarehouseActor{})
+	require.NoError(t, err)
+	_, err = s.AddStockKeg(store.StockKeg{Size: 50, Brand: "Policka", BestBefore: &soon}, WarehouseActor{})
+	require.NoError(t, err)
+
+	kegs := s.GetStockKegs()
+	require.Len(t, kegs, 4)
+	assert.Equal(t, old.ID, kegs[0].ID, "the nearest best before goes first")
+	assert.Equal(t, 50, kegs[1].Size)
+	assert.Equal(t, fresh.ID, kegs[2].ID)
+	assert.Equal(t, noDate.ID, kegs[3].ID, "kegs without best before go last")
+	assert.Equal(t, 3, s.warehouse[30])
+	assert.Equal(t, 1, s.warehouse[50])
+	assert.False(t, kegs[2].PurchasedAt.IsZero(), "purchase date defaults to now")
+
+	// keg size must be known and the price cannot be negative
+	_, err = s.AddStockKeg(store.StockKeg{Size: 25}, WarehouseActor{})
+	require.Error(t, err)
+	_, err = s.AddStockKeg(store.StockKeg{Size: 30, Price: decimal.NewFromInt(-1)}, WarehouseActor{})
+	require.Error(t, err)
+
+	// the first keg of the size is removed
+	removed, err := s.RemoveStockKeg(0, 30, WarehouseActor{Reason: "returned to the supplier"})
+	require.NoError(t, err)
+	assert.Equal(t, old.ID, removed.ID)
+	assert.Equal(t, store.StockOutReasonRemoved, removed.OutReason)
+	assert.Equal(t, "returned to the supplier", removed.Note)
+	require.NotNil(t, removed.OutAt)
+
+	// or the exact keg
+	removed, err = s.RemoveStockKeg(noDate.ID, 0, WarehouseActor{})
+	require.NoError(t, err)
+	assert.Equal(t, "Unknown", removed.Brand)
+
+	_, err = s.RemoveStockKeg(noDate.ID, 0, WarehouseActor{})
+	require.Error(t, err, "keg is not in the warehouse anymore")
+
+	kegs = s.GetStockKegs()
+	require.Len(t, kegs, 2)
+	assert.Equal(t, 1, s.warehouse[30])
+
+	// removed kegs stay in the store
+	all, err := s.store.GetStockKegs(false)
+	require.NoError(t, err)
+	assert.Len(t, all, 15+4)
+}
+
+func TestScale_StockTappedByRekeg(t *testing.T) {
+	s := createScaleWithMeasurements(t, 63.5, 63.5)
+	s.stock = nil
+
+	soon := s.clock.Now().Add(30 * 24 * time.Hour)
+	later := s.clock.Now().Add(60 * 24 * time.Hour)
+	fresh, err := s.AddStockKeg(store.StockKeg{Size: 10, Brand: "Policka", BestBefore: &later}, WarehouseActor{})
+	require.NoError(t, err)
+	old, err := s.AddStockKeg(store.StockKeg{Size: 10, Brand: "Bernard", BestBefore: &soon}, WarehouseActor{})
+	require.NoError(t, err)
+
+	// the 50l keg is almost empty, it is removed and a 10l keg is tapped
+	addMeasurements(t, s, 14500, 14500, 150, -20, 16000, 16000)
+	require.Equal(t, 10, s.taps[store.DefaultTap].activeKeg)
+
+	kegs := s.GetStockKegs()
+	require.Len(t, kegs, 1)
+	assert.Equal(t, fresh.ID, kegs[0].ID, "the keg with the nearest best before was tapped")
+	assert.Equal(t, 1, s.warehouse[10])
+
+	history, err := s.GetKegHistory(store.DefaultTap, 1)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, old.ID, history[0].StockID)
+
+	all, err := s.store.GetStockKegs(false)
+	require.NoError(t, err)
+	for _, keg := range all {
+		if keg.ID == old.ID {
+			assert.Equal(t, store.StockOutReasonTapped, keg.OutReason)
+			assert.Equal(t, store.DefaultTap, keg.Tap)
+		}
+	}
+
+	changes, err := s.GetWarehouseHistory(1)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, store.WarehouseChangeTapped, changes[0].Kind)
+	assert.Equal(t, store.WarehouseSourceAutoRekeg, changes[0].Source)
+	assert.Equal(t, old.ID, changes[0].StockID)
+	assert.Equal(t, -1, changes[0].Delta)
+}
+
+func TestScale_WarehouseHistory(t *testing.T) {
+	s := createScaleWithMeasurements(t)
+
+	// migration of the legacy counts is recorded per keg size
+	changes, err := s.GetWarehouseHistory(100)
+	require.NoError(t, err)
+	require.Len(t, changes, 5)
+	assert.Equal(t, 50, changes[0].Size)
+	assert.Equal(t, 5, changes[0].Delta)
+	assert.Equal(t, store.WarehouseChangeCorrection, changes[0].Kind)
+	assert.Equal(t, store.WarehouseSourceSystem, changes[0].Source)
+
+	by := WarehouseActor{Source: store.WarehouseSourceWeb, Actor: "admin", Reason: "delivery"}
+	keg, err := s.AddStockKeg(store.StockKeg{Size: 30, Brand: "Policka"}, by)
+	require.NoError(t, err)
+	_, err = s.RemoveStockKeg(keg.ID, 0, WarehouseActor{Source: store.WarehouseSourceBotka, Actor: "420123", Reason: "broken"})
+	require.NoError(t, err)
+
+	// failed changes are not recorded
+	_, err = s.AddStockKeg(store.StockKeg{Size: 25}, by)
+	require.Error(t, err)
+
+	changes, err = s.GetWarehouseHistory(2)
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	assert.Equal(t, store.WarehouseChangeRemove, changes[0].Kind)
+	assert.Equal(t, -1, changes[0].Delta)
+	assert.Equal(t, store.WarehouseSourceBotka, changes[0].Source)
+	assert.Equal(t, "broken", changes[0].Reason)
+	assert.Equal(t, store.WarehouseChangeAdd, changes[1].Kind)
+	assert.Equal(t, 1, changes[1].Delta)
+	assert.Equal(t, keg.ID, changes[1].StockID)
+	assert.Equal(t, "admin", changes[1].Actor)
+	assert.False(t, changes[1].CreatedAt.IsZero())
+
+	_, err = s.GetWarehouseHistory(0)
+	require.Error(t, err)
+}
+
+func TestScale_Stocktake(t *testing.T) {
+	s := createScaleWithMeasurements(t)
+	s.config.WarehouseLowBeers = 60
+	s.warehouseLow = true
+
+	soon := s.clock.Now().Add(30 * 24 * time.Hour)
+	branded, err := s.AddStockKeg(store.StockKeg{Size: 50, Brand: "Policka", BestBefore: &soon}, WarehouseActor{})
+	require.NoError(t, err)
+
+	// 30l kegs are missing, 50l kegs are surplus, 10l count is right
+	by := WarehouseActor{Source: store.WarehouseSourceWeb, Actor: "admin", Reason: "monthly count"}
+	require.NoError(t, s.Stocktake(map[int]int{10: 1, 30: 6, 50: 2}, by))
+	assert.Equal(t, map[int]int{10: 1, 15: 2, 20: 3, 30: 6, 50: 2}, s.warehouse, "sizes not counted stay")
+
+	for _, keg := range s.GetStockKegs() {
+		assert.NotEqual(t, branded.ID, keg.ID, "surplus kegs are removed in the tapping order")
+	}
+
+	changes, err := s.GetWarehouseHistory(2)
+	require.NoError(t, err)
+	require.Len(t, changes, 2, "single correction per size")
+	assert.Equal(t, 50, changes[0].Size)
+	assert.Equal(t, -4, changes[0].Delta)
+	assert.Equal(t, store.WarehouseChangeCorrection, changes[0].Kind)
+	assert.Equal(t, "monthly count", changes[0].Reason)
+	assert.Equal(t, 30, changes[1].Size)
+	assert.Equal(t, 2, changes[1].Delta)
+
+	all, err := s.store.GetStockKegs(false)
+	require.NoError(t, err)
+	for _, keg := range all {
+		if keg.ID == branded.ID {
+			assert.Equal(t, store.StockOutReasonRemoved, keg.OutReason)
+			assert.Equal(t, "stocktake: monthly count", keg.Note)
+		}
+	}
+
+	// the whole stocktake is validated first
+	require.Error(t, s.Stocktake(map[int]int{30: 1, 25: 1}, by))
+	require.Error(t, s.Stocktake(map[int]int{30: -1}, by))
+	assert.Equal(t, 6, s.warehouse[30])
+
+	// nothing changes when the count is right
+	require.NoError(t, s.Stocktake(map[int]int{30: 6}, by))
+	changes, err = s.GetWarehouseHistory(1)
+	require.NoError(t, err)
+	assert.Equal(t, 50, changes[0].Size)
+}
+
+// failingStockStore fails to add a stock keg after the given amount of kegs
+type failingStockStore struct {
+	store.Storage
+	kegs int
+}
+
+func (f *failingStockStore) AddStockKeg(keg store.StockKeg) (int64, error) {
+	if f.kegs == 0 {
+		return 0, errors.New("connection lost")
+	}
+	f.kegs--
+	return f.Storage.AddStockKeg(keg)
+}
+
+func TestScale_StocktakeFailure(t *testing.T) {
+	s := createScaleWithMeasurements(t)
+	s.store = &failingStockStore{Storage: s.store, kegs: 2}
+
+	by := WarehouseActor{Source: store.WarehouseSourceWeb, Actor: "admin"}
+	require.Error(t, s.Stocktake(map[int]int{30: 8}, by))
+	assert.Equal(t, 6, s.warehouse[30], "two of the missing kegs were added")
+
+	changes, err := s.GetWarehouseHistory(1)
+	require.NoError(t, err)
+	require.Len(t, changes, 1, "the applied change is logged")
+	assert.Equal(t, 30, changes[0].Size)
+	assert.Equal(t, 2, changes[0].Delta)
+	assert.Equal(t, store.WarehouseChangeCorrection, changes[0].Kind)
+}
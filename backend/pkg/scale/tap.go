@@ -0,0 +1,159 @@
+package scale
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/kotrzina/keg-scale/pkg/store"
+)
+
+// maxTaps protects the store from scales sending random tap ids
+const maxTaps = 10
+
+// tap represents a single scale with its own keg
+// the state is persisted separately for every tap
+type tap struct {
+	id string
+
+	weight       float64 // current scale value
+	weightAt     time.Time
+	candidateKeg int             // candidate keg size
+	activeKeg    int             // int value of the active keg in liters
+	activeKegAt  time.Time       // time when the active keg was set
+	beersLeft    int             // how many beers are left in the keg
+	isLow        bool            // is the keg low and needs to be replaced soon
+	kegRecord    store.KegRecord // ledger record of the active keg, zero ID when there is none
+
+	lastOk  time.Time
+	offline bool // the scale stopped sending data, reported once
+	rssi    float64
+
+	consumption consumption
+	history     consumptionHistory
+	pour        pourDetector
+	filter      weightFilter
+	rekeg       rekeg
+	calibration calibration
+	health      health
+	closed      closedWatch
+}
+
+func newTap(id string) *tap {
+	return &tap{
+		id:           id,
+		weight:       0,
+		weightAt:     time.Unix(0, 0), // time of last weight measurement
+		candidateKeg: 0,
+		activeKeg:    0,
+		activeKegAt:  time.Unix(0, 0),
+		beersLeft:    0,
+		isLow:        false,
+		rekeg:        rekeg{state: RekegStateIdle},
+		lastOk:       time.Unix(0, 0), // never seen
+		offline:      true,            // new scale goes online with the first ping
+	}
+}
+
+// isTapOk returns true if the tap scale sent data within the close_after limit
+func (s *Scale) isTapOk(t *tap) bool {
+	return s.clock.Since(t.lastOk) < s.okLimit()
+}
+
+// getTap returns the tap with the given id
+// unknown taps are registered and persisted
+func (s *Scale) getTap(id string) (*tap, error) {
+	if t, found := s.taps[id]; found {
+		return t, nil
+	}
+
+	if len(s.taps) >= maxTaps {
+		return nil, fmt.Errorf("too many taps, could not register tap %q", id)
+	}
+
+	t := newTap(id)
+	s.taps[id] = t
+
+	if err := s.store.SetTaps(s.tapIDs()); err != nil {
+		return nil, fmt.Errorf("could not store taps: %w", err)
+	}
+
+	s.logger.Infof("New tap %q registered", id)
+
+	return t, nil
+}
+
+// existingTap returns the tap with the given id without registering a new one
+func (s *Scale) existingTap(id string) (*tap, error) {
+	t, found := s.taps[id]
+	if !found {
+		return nil, fmt.Errorf("unknown tap: %s", id)
+	}
+
+	return t, nil
+}
+
+// tapIDs returns ids of all taps, the default tap goes first
+func (s *Scale) tapIDs() []string {
+	ids := make([]string, 0, len(s.taps))
+	for id := range s.taps {
+		ids = append(ids, id)
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		if ids[i] == store.DefaultTap || ids[j] == store.DefaultTap {
+			return ids[i] == store.DefaultTap
+		}
+		return ids[i] < ids[j]
+	})
+
+	return ids
+}
+
+// loadTap loads tap state from the store
+func (s *Scale) loadTap(id string) *tap {
+	t := newTap(id)
+
+	weight, err := s.store.GetWeight(id)
+	if err == nil {
+		t.weight = weight
+	}
+
+	weightAt, err := s.store.GetWeightAt(id)
+	if err == nil {
+		t.weightAt = weightAt
+	}
+
+	activeKeg, err := s.store.GetActiveKeg(id)
+	if err == nil {
+		t.activeKeg = activeKeg
+	}
+
+	activeKegAt, err := s.store.GetActiveKegAt(id)
+	if err == nil {
+		t.activeKegAt = activeKegAt
+	}
+
+	candidateKeg, err := s.store.GetCandidateKeg(id)
+	if err == nil {
+		t.candidateKeg = candidateKeg
+	}
+
+	beersLeft, err := s.store.GetBeersLeft(id)
+	if err == nil {
+		t.beersLeft = beersLeft
+	}
+
+	isLow, err := s.store.GetIsLow(id)
+	if err == nil {
+		t.isLow = isLow
+	}
+
+	lastOk, err := s.store.GetLastOk(id)
+	if err == nil {
+		t.lastOk = lastOk
+	}
+	t.offline = false // computed when all taps are loaded
+
+	return t
+}
@@ -0,0 +1,65 @@
+package scale
+
+import (
+	"testing"
+
+	"github.com/kotrzina/keg-scale/pkg/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScale_MultipleTaps(t *testing.T) {
+	// 30l keg on the main tap
+	s := createScaleWithMeasurements(t, 40, 40, 35)
+
+	// 50l keg on the second tap
+	for _, w := range []float64{63500, 63500, 60000} {
+		require.NoError(t, s.AddMeasurement("left", w))
+	}
+
+	output := s.GetScale()
+	require.Len(t, output.Taps, 2)
+	assert.Equal(t, store.DefaultTap, output.Taps[0].ID)
+	assert.Equal(t, 30, output.Taps[0].ActiveKeg)
+	assert.Equal(t, "left", output.Taps[1].ID)
+	assert.Equal(t, 50, output.Taps[1].ActiveKeg)
+
+	// top-level fields describe the main tap
+	assert.Equal(t, 30, output.ActiveKeg)
+	assert.Equal(t, output.Taps[0].BeersLeft, output.BeersLeft)
+
+	// both kegs are consumed
+	assert.Equal(t,
+		DefaultKegCatalog().CalcBeersConsumed(30, 35000)+DefaultKegCatalog().CalcBeersConsumed(50, 60000),
+		output.BeersTotal,
+	)
+
+	// every tap has its own ledger
+	kegs, err := s.GetKegHistory("left", 10)
+	require.NoError(t, err)
+	require.Len(t, kegs, 1)
+	assert.Equal(t, 50, kegs[0].Size)
+	assert.Equal(t, "left", kegs[0].Tap)
+
+	kegs, err = s.GetKegHistory("", 10)
+	require.NoError(t, err)
+	assert.Len(t, kegs, 2)
+
+	// emptying one tap keeps the other one
+	require.NoError(t, s.SetActiveKeg("left", 0))
+	output = s.GetScale()
+	assert.Equal(t, 0, output.Taps[1].ActiveKeg)
+	assert.Equal(t, 30, output.Taps[0].ActiveKeg)
+
+	require.Error(t, s.SetActiveKeg("unknown", 30))
+}
+
+func TestScale_TooManyTaps(t *testing.T) {
+	s := createScaleWithMeasurements(t)
+
+	for i := 1; i < maxTaps; i++ {
+		require.NoError(t, s.Ping(string(rune('a'+i))))
+	}
+
+	assert.Error(t, s.Ping("overflow"))
+}
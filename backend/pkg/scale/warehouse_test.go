@@ -3,11 +3,26 @@ package scale
 import (
 	"testing"
 
+	"github.com/kotrzina/keg-scale/pkg/store"
 	"github.com/stretchr/testify/assert"
 )
 
-func TestGetWarehouseBeersLeft(t *testing.T) {
-	assert.Equal(t, 0, GetWarehouseBeersLeft([5]int{0, 0, 0, 0, 0}), "Expected 0 beers left")
-	assert.Equal(t, 20, GetWarehouseBeersLeft([5]int{1, 0, 0, 0, 0}), "Expected 20 beers left")
-	assert.Equal(t, 60, GetWarehouseBeersLeft([5]int{1, 0, 1, 0, 0}), "Expected 60 beers left")
+func TestKegCatalog_WarehouseBeers(t *testing.T) {
+	c := DefaultKegCatalog()
+	assert.Equal(t, 0, c.WarehouseBeers(map[int]int{}), "Expected 0 beers left")
+	assert.Equal(t, 20, c.WarehouseBeers(map[int]int{10: 1}), "Expected 20 beers left")
+	assert.Equal(t, 60, c.WarehouseBeers(map[int]int{10: 1, 20: 1}), "Expected 60 beers left")
+	assert.Equal(t, 110, c.WarehouseBeers(map[int]int{5: 1, 50: 1}), "Expected 110 beers left")
+}
+
+func TestKegCatalog_WarehouseBeersServingSize(t *testing.T) {
+	c := NewKegCatalog([]store.KegType{
+		{Size: 15, EmptyWeight: 7000, ServingSize: 0.3},
+		{Size: 30, EmptyWeight: 10000, Yield: 0.9},
+	})
+
+	assert.Equal(t, 50, c.WarehouseBeers(map[int]int{15: 1}), "15 l in 0.3 l glasses")
+	assert.Equal(t, 54, c.WarehouseBeers(map[int]int{30: 1}), "10 % of the keg is lost")
+	assert.Equal(t, 154, c.WarehouseBeers(map[int]int{15: 2, 30: 1}))
+	assert.InEpsilon(t, 60.0, c.WarehouseLiters(map[int]int{15: 2, 30: 1}), 0.000001)
 }
@@ -0,0 +1,199 @@
+package sim
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kotrzina/keg-scale/pkg/store"
+)
+
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+
+	MessagePush = "push"
+	MessagePing = "ping"
+)
+
+// timeLayouts are accepted timestamps - RFC 3339 and the PostgreSQL text output
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999Z07",
+	"2006-01-02 15:04:05",
+}
+
+// Record is a single message of the recorded measurement log
+type Record struct {
+	At        time.Time `json:"at"`
+	Tap       string    `json:"tap"`        // default tap when empty
+	Type      string    `json:"type"`       // push or ping, push when empty
+	Weight    float64   `json:"weight"`     // raw weight in grams
+	MessageID uint64    `json:"message_id"` // scale counter, zero when unknown
+	Rssi      float64   `json:"rssi"`       // zero when unknown
+}
+
+// ReadFile reads records from a CSV or JSONL file, the format is detected from the extension
+func ReadFile(path string) ([]Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open %s: %w", path, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	format := FormatCSV
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".jsonl" || ext == ".json" {
+		format = FormatJSONL
+	}
+
+	return ReadRecords(f, format)
+}
+
+// ReadRecords reads records in the given format and orders them by time
+// CSV needs a header with at least the at and weight columns, unknown columns are ignored
+// so an export of the measurements table can be replayed directly
+func ReadRecords(r io.Reader, format string) ([]Record, error) {
+	var records []Record
+	var err error
+
+	switch format {
+	case FormatCSV:
+		records, err = readCSV(r)
+	case FormatJSONL:
+		records, err = readJSONL(r)
+	default:
+		return nil, fmt.Errorf("unknown format: %s", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range records {
+		if records[i].Tap == "" {
+			records[i].Tap = store.DefaultTap
+		}
+		if records[i].Type == "" {
+			records[i].Type = MessagePush
+		}
+		if records[i].Type != MessagePush && records[i].Type != MessagePing {
+			return nil, fmt.Errorf("record %d: invalid type %q", i+1, records[i].Type)
+		}
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].At.Before(records[j].At)
+	})
+
+	return records, nil
+}
+
+func readJSONL(r io.Reader) ([]Record, error) {
+	records := []Record{}
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		var rec Record
+		if err := json.Unmarshal([]byte(text), &rec); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		records = append(records, rec)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read records: %w", err)
+	}
+
+	return records, nil
+}
+
+func readCSV(r io.Reader) ([]Record, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("could not read csv header: %w", err)
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"at", "weight"} {
+		if _, found := columns[required]; !found {
+			return nil, fmt.Errorf("missing csv column: %s", required)
+		}
+	}
+
+	records := []Record{}
+	for line := 2; ; line++ {
+		row, rerr := reader.Read()
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			return nil, fmt.Errorf("line %d: %w", line, rerr)
+		}
+
+		value := func(column string) string {
+			i, found := columns[column]
+			if !found || i >= len(row) {
+				return ""
+			}
+			return strings.TrimSpace(row[i])
+		}
+
+		rec := Record{
+			Tap:  value("tap"),
+			Type: value("type"),
+		}
+
+		if rec.At, err = parseTime(value("at")); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if rec.Weight, err = strconv.ParseFloat(value("weight"), 64); err != nil {
+			return nil, fmt.Errorf("line %d: invalid weight: %w", line, err)
+		}
+		if v := value("message_id"); v != "" {
+			if rec.MessageID, err = strconv.ParseUint(v, 10, 64); err != nil {
+				return nil, fmt.Errorf("line %d: invalid message_id: %w", line, err)
+			}
+		}
+		if v := value("rssi"); v != "" {
+			if rec.Rssi, err = strconv.ParseFloat(v, 64); err != nil {
+				return nil, fmt.Errorf("line %d: invalid rssi: %w", line, err)
+			}
+		}
+
+		records = append(records, rec)
+	}
+
+	return records, nil
+}
+
+func parseTime(s string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid time: %q", s)
+}
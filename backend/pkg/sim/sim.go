@@ -0,0 +1,193 @@
+package sim
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/kotrzina/keg-scale/pkg/clock"
+	"github.com/kotrzina/keg-scale/pkg/config"
+	"github.com/kotrzina/keg-scale/pkg/prometheus"
+	"github.com/kotrzina/keg-scale/pkg/scale"
+	"github.com/kotrzina/keg-scale/pkg/store"
+	"github.com/sirupsen/logrus"
+)
+
+// sim replays recorded scale messages through scale.Scale with a virtual clock and the fake store
+// the same code path as the push handler is used, so incidents from production can be reproduced
+
+const defaultRecheckInterval = 15 * time.Second // same as the recheck ticker of the scale
+
+type Options struct {
+	Config          *config.Config // scale configuration, the bank is never refreshed
+	RecheckInterval time.Duration  // virtual time between periodic rechecks
+	Logger          *logrus.Logger // scale logs, discarded when nil
+}
+
+// Transition is a change of the observed scale state
+type Transition struct {
+	At    time.Time `json:"at"`
+	Tap   string    `json:"tap,omitempty"` // empty for the pub state
+	Field string    `json:"field"`
+	From  string    `json:"from"`
+	To    string    `json:"to"`
+}
+
+type Result struct {
+	Records     int                  `json:"records"`
+	Transitions []Transition         `json:"transitions"`
+	Events      []scale.EventPayload `json:"events"` // ordered by time and type
+	Final       scale.FullOutput     `json:"final"`
+}
+
+// snapshot is the observed state - field => value for every tap and the pub
+type snapshot map[string]map[string]string
+
+// Replay runs the records through a new scale and collects its state transitions and events
+func Replay(records []Record, opts Options) (Result, error) {
+	if len(records) == 0 {
+		return Result{}, fmt.Errorf("no records to replay")
+	}
+
+	conf := opts.Config
+	if conf == nil {
+		return Result{}, fmt.Errorf("missing config")
+	}
+	simConf := *conf
+	simConf.BankProvider = config.BankProviderFio
+	simConf.FioToken = "" // never call the bank from the simulation
+
+	interval := opts.RecheckInterval
+	if interval <= 0 {
+		interval = defaultRecheckInterval
+	}
+
+	logger := opts.Logger
+	if logger == nil {
+		logger = logrus.New()
+		logger.SetOutput(io.Discard)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clk := clock.NewFake(records[0].At)
+	storage := &store.FakeStore{Clock: clk}
+	s := scale.New(ctx, prometheus.New(), storage, &simConf, clk, logger)
+
+	result := Result{Records: len(records)}
+	previous := observe(s)
+	step := func() {
+		s.WaitEvents() // events of the step are stored before the next one starts
+		current := observe(s)
+		result.Transitions = append(result.Transitions, diff(clk.Now(), previous, current)...)
+		previous = current
+	}
+
+	nextRecheck := records[0].At.Add(interval)
+	for i, rec := range records {
+		for !nextRecheck.After(rec.At) {
+			clk.Set(nextRecheck)
+			s.Recheck()
+			step()
+			nextRecheck = nextRecheck.Add(interval)
+		}
+
+		clk.Set(rec.At)
+		if err := apply(s, rec); err != nil {
+			return Result{}, fmt.Errorf("record %d at %s: %w", i+1, rec.At.Format(time.RFC3339), err)
+		}
+		step()
+	}
+
+	// let the scales time out after the last record like they would in production
+	end := records[len(records)-1].At.Add(time.Duration(s.GetOpenPolicy().Policy.CloseAfter) + interval)
+	for !nextRecheck.After(end) {
+		clk.Set(nextRecheck)
+		s.Recheck()
+		step()
+		nextRecheck = nextRecheck.Add(interval)
+	}
+
+	events, err := s.GetEvents(store.EventFilter{})
+	if err != nil {
+		return Result{}, err
+	}
+	result.Events = events.Events
+	sort.SliceStable(result.Events, func(i, j int) bool {
+		// events of the same step are dispatched concurrently, the type keeps the order stable
+		if result.Events[i].At.Equal(result.Events[j].At) {
+			return result.Events[i].Type < result.Events[j].Type
+		}
+		return result.Events[i].At.Before(result.Events[j].At)
+	})
+	result.Final = s.GetScale()
+
+	return result, nil
+}
+
+// apply processes the record the same way as the push handler
+func apply(s *scale.Scale, rec Record) error {
+	if err := s.Ping(rec.Tap); err != nil {
+		return err
+	}
+	if rec.MessageID > 0 || rec.Rssi != 0 {
+		s.ObserveMessage(rec.Tap, rec.MessageID, rec.Rssi)
+	}
+
+	if rec.Type == MessagePush {
+		return s.AddMeasurement(rec.Tap, rec.Weight)
+	}
+
+	return nil
+}
+
+func observe(s *scale.Scale) snapshot {
+	output := s.GetScale()
+
+	state := snapshot{
+		"": {"pub_open": strconv.FormatBool(output.Pub.IsOpen)},
+	}
+	for _, t := range output.Taps {
+		state[t.ID] = map[string]string{
+			"active_keg":    strconv.Itoa(t.ActiveKeg),
+			"candidate_keg": strconv.Itoa(t.CandidateKeg),
+			"is_low":        strconv.FormatBool(t.IsLow),
+			"is_ok":         strconv.FormatBool(t.IsOk),
+			"rekeg":         string(t.Rekeg.State),
+		}
+	}
+
+	return state
+}
+
+func diff(at time.Time, previous, current snapshot) []Transition {
+	transitions := []Transition{}
+
+	taps := make([]string, 0, len(current))
+	for tap := range current {
+		taps = append(taps, tap)
+	}
+	sort.Strings(taps)
+
+	for _, tap := range taps {
+		fields := make([]string, 0, len(current[tap]))
+		for field := range current[tap] {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+
+		for _, field := range fields {
+			from := previous[tap][field]
+			to := current[tap][field]
+			if from != to {
+				transitions = append(transitions, Transition{At: at, Tap: tap, Field: field, From: from, To: to})
+			}
+		}
+	}
+
+	return transitions
+}
@@ -0,0 +1,102 @@
+package sim
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kotrzina/keg-scale/pkg/config"
+	"github.com/kotrzina/keg-scale/pkg/scale"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// replayFile replays a recorded incident from testdata
+func replayFile(t *testing.T, name string) Result {
+	t.Helper()
+
+	records, err := ReadFile("testdata/" + name)
+	require.NoError(t, err)
+
+	result, err := Replay(records, Options{Config: config.NewConfig()})
+	require.NoError(t, err)
+
+	return result
+}
+
+func eventTypes(result Result) []scale.EventType {
+	types := []scale.EventType{}
+	for _, e := range result.Events {
+		types = append(types, e.Type)
+	}
+	return types
+}
+
+func transitions(result Result, tap, field string) []string {
+	values := []string{}
+	for _, t := range result.Transitions {
+		if t.Tap == tap && t.Field == field {
+			values = append(values, t.From+" -> "+t.To)
+		}
+	}
+	return values
+}
+
+func TestReplay_Rekeg10lTo20l(t *testing.T) {
+	result := replayFile(t, "rekeg_10l_to_20l.csv")
+
+	assert.Equal(t, []string{"0 -> 10", "10 -> 20"}, transitions(result, "main", "active_keg"))
+	assert.Equal(t, []string{"idle -> candidate", "candidate -> idle", "idle -> removed", "removed -> candidate", "candidate -> idle"},
+		transitions(result, "main", "rekeg"))
+	assert.Equal(t, []string{"false -> true", "true -> false"}, transitions(result, "", "pub_open"),
+		"the scale goes silent and the pub closes after the last record")
+
+	assert.Equal(t, []scale.EventType{
+		scale.EventNewKegTapped,
+		scale.EventKegLow,
+		scale.EventNewKegTapped,
+		scale.EventClose, // the silent scale of the closed pub is not offline
+	}, eventTypes(result))
+	assert.Equal(t, 20, result.Final.ActiveKeg)
+	assert.Equal(t, 40, result.Final.BeersLeft)
+}
+
+func TestReplay_SpikeIsFiltered(t *testing.T) {
+	records, err := ReadRecords(strings.NewReader(`
+{"at": "2025-03-14T18:00:00Z", "weight": 40000}
+{"at": "2025-03-14T18:00:10Z", "weight": 40000}
+{"at": "2025-03-14T18:00:20Z", "weight": 40000}
+{"at": "2025-03-14T18:00:30Z", "weight": 52000}
+{"at": "2025-03-14T18:00:40Z", "weight": 40000}
+{"at": "2025-03-14T18:00:50Z", "type": "ping"}
+`), FormatJSONL)
+	require.NoError(t, err)
+	require.Len(t, records, 6)
+
+	result, err := Replay(records, Options{Config: config.NewConfig()})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"0 -> 30"}, transitions(result, "main", "active_keg"), "someone leaning on the keg is not a new keg")
+}
+
+func TestReadRecords(t *testing.T) {
+	records, err := ReadRecords(strings.NewReader(`tap,at,weight,active_keg,beers_left
+left,2025-03-14 18:00:05.5+01,31000,20,42
+,2025-03-14 18:00:00+01,40000,30,60
+`), FormatCSV)
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+
+	// ordered by time, unknown columns ignored
+	assert.Equal(t, "main", records[0].Tap)
+	assert.Equal(t, MessagePush, records[0].Type)
+	assert.InDelta(t, 40000, records[0].Weight, 0.1)
+	assert.Equal(t, "left", records[1].Tap)
+	assert.Equal(t, time.Date(2025, 3, 14, 17, 0, 5, 500000000, time.UTC), records[1].At.UTC())
+
+	_, err = ReadRecords(strings.NewReader("at,tap\n2025-03-14T18:00:00Z,main\n"), FormatCSV)
+	assert.ErrorContains(t, err, "missing csv column: weight")
+
+	_, err = ReadRecords(strings.NewReader(`{"at": "2025-03-14T18:00:00Z", "type": "pull"}`), FormatJSONL)
+	assert.ErrorContains(t, err, "invalid type")
+}
@@ -1,6 +1,35 @@
 package store
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/kotrzina/keg-scale/pkg/utils"
+	"github.com/shopspring/decimal"
+)
+
+// DefaultTap is the tap used by scales which do not send their tap id
+// its values are stored under the original keys without any tap suffix
+const DefaultTap = "main"
+
+// EventRecord is a single event with its structured payload
+type EventRecord struct {
+	ID   int64           `json:"id"`
+	Type string          `json:"type"`
+	At   time.Time       `json:"at"`
+	Tap  string          `json:"tap"` // empty for events without tap
+	Data json.RawMessage `json:"data"`
+}
+
+// EventFilter selects events, zero values match everything
+type EventFilter struct {
+	Types    []string
+	Tap      string
+	From     time.Time // inclusive
+	To       time.Time // exclusive
+	BeforeID int64     // pagination - only events older than this id
+	Limit    int
+}
 
 type ConversationMessageAuthor string
 
@@ -16,36 +45,286 @@ type ConservationMessage struct {
 	Author  ConversationMessageAuthor `json:"author"` // user or bot
 }
 
+type KegEndReason string
+
+const (
+	KegEndReasonAuto   KegEndReason = "auto"   // keg detected as empty or replaced by the scale
+	KegEndReasonManual KegEndReason = "manual" // keg set manually using the API
+)
+
+// KegRecord represents a single keg in the keg ledger - from tapping to emptying
+type KegRecord struct {
+	ID           int64        `json:"id"`
+	Tap          string       `json:"tap"`
+	Size         int          `json:"size"` // in liters
+	TappedAt     time.Time    `json:"tapped_at"`
+	EmptiedAt    *time.Time   `json:"emptied_at"`   // nil for the active keg
+	StartWeight  float64      `json:"start_weight"` // in grams
+	EndWeight    float64      `json:"end_weight"`   // in grams - the lowest weight seen for the keg
+	BeersPoured  int          `json:"beers_poured"`
+	LitersPoured float64      `json:"liters_poured"`
+	EndReason    KegEndReason `json:"end_reason"` // empty for the active keg
+	StockID      int64        `json:"stock_id"`   // keg from the warehouse inventory, zero when unknown
+}
+
+type StockOutReason string
+
+const (
+	StockOutReasonTapped  StockOutReason = "tapped"  // keg was tapped
+	StockOutReasonRemoved StockOutReason = "removed" // keg was removed manually - returned, sold, broken...
+)
+
+type WarehouseChangeKind string
+
+const (
+	WarehouseChangeAdd        WarehouseChangeKind = "add"        // purchased keg added
+	WarehouseChangeRemove     WarehouseChangeKind = "remove"     // keg removed without tapping
+	WarehouseChangeTapped     WarehouseChangeKind = "tapped"     // keg taken from the warehouse to the tap
+	WarehouseChangeCorrection WarehouseChangeKind = "correction" // stocktake or migration
+)
+
+type WarehouseSource string
+
+const (
+	WarehouseSourceWeb       WarehouseSource = "web"
+	WarehouseSourceBotka     WarehouseSource = "botka"
+	WarehouseSourceAutoRekeg WarehouseSource = "auto-rekeg"
+	WarehouseSourceSystem    WarehouseSource = "system"
+)
+
+// WarehouseChange is an entry of the warehouse audit log
+type WarehouseChange struct {
+	ID        int64               `json:"id"`
+	Size      int                 `json:"size"`  // keg size in liters
+	Delta     int                 `json:"delta"` // change of the amount of kegs
+	Kind      WarehouseChangeKind `json:"kind"`
+	StockID   int64               `json:"stock_id"` // changed keg, zero for corrections
+	Source    WarehouseSource     `json:"source"`
+	Actor     string              `json:"actor"`
+	Reason    string              `json:"reason"`
+	CreatedAt time.Time           `json:"created_at"`
+}
+
+// StockKeg is a single keg in the warehouse inventory - from purchase to tapping
+type StockKeg struct {
+	ID          int64           `json:"id"`
+	Size        int             `json:"size"` // in liters
+	Brand       string          `json:"brand"`
+	Style       string          `json:"style"`
+	Supplier    string          `json:"supplier"`
+	Price       decimal.Decimal `json:"price"`   // purchase price in CZK
+	Deposit     decimal.Decimal `json:"deposit"` // deposit paid for the keg in CZK, zero to use the keg type default
+	PurchasedAt time.Time       `json:"purchased_at"`
+	BestBefore  *time.Time      `json:"best_before"` // nil when unknown
+	OutAt       *time.Time      `json:"out_at"`      // nil while the keg is in the warehouse
+	OutReason   StockOutReason  `json:"out_reason"`  // empty while the keg is in the warehouse
+	Tap         string          `json:"tap"`         // tap of the tapped keg
+	Note        string          `json:"note"`
+}
+
+// EmptyKeg is an emptied keg waiting for the return to the supplier
+type EmptyKeg struct {
+	ID         int64           `json:"id"`
+	Size       int             `json:"size"`     // in liters
+	StockID    int64           `json:"stock_id"` // keg from the warehouse inventory, zero when unknown
+	KegID      int64           `json:"keg_id"`   // record in the keg ledger
+	Tap        string          `json:"tap"`
+	Supplier   string          `json:"supplier"` // where the keg goes back, empty when unknown
+	Deposit    decimal.Decimal `json:"deposit"`  // deposit paid for the keg in CZK
+	EmptiedAt  time.Time       `json:"emptied_at"`
+	ReturnedAt *time.Time      `json:"returned_at"` // nil while the keg waits for the return
+	Refund     decimal.Decimal `json:"refund"`      // deposit refunded by the supplier
+	Note       string          `json:"note"`
+}
+
+// BankTransaction is a transaction downloaded from the bank, the id comes from the bank
+type BankTransaction struct {
+	ID                 int64           `json:"id"`
+	Date               time.Time       `json:"date"`
+	Amount             decimal.Decimal `json:"amount"` // negative for outgoing payments
+	Currency           string          `json:"currency"`
+	Account            string          `json:"account"`
+	AccountName        string          `json:"account_name"`
+	BankName           string          `json:"bank_name"`
+	BankCode           string          `json:"bank_code"`
+	ConstantSymbol     string          `json:"constant_symbol"`
+	VariableSymbol     string          `json:"variable_symbol"`
+	SpecificSymbol     string          `json:"specific_symbol"`
+	UserIdentification string          `json:"user_identification"`
+	RecipientMessage   string          `json:"recipient_message"`
+	Type               string          `json:"type"`
+	Specification      string          `json:"specification"`
+	Comment            string          `json:"comment"`
+	BIC                string          `json:"bic"`
+	OrderID            string          `json:"order_id"`
+	PayerReference     string          `json:"payer_reference"`
+}
+
+// BankSync is the period of the bank transactions already downloaded to the store
+type BankSync struct {
+	From time.Time `json:"from"` // the oldest day downloaded
+	To   time.Time `json:"to"`   // the newest day downloaded
+}
+
+// KegType represents a keg type in the keg catalog
+type KegType struct {
+	Size        int             `json:"size"`         // in liters, unique in the catalog
+	EmptyWeight float64         `json:"empty_weight"` // tare weight in grams
+	Label       string          `json:"label"`
+	Supplier    string          `json:"supplier"`
+	ServingSize float64         `json:"serving_size"` // liters - beers are counted in this serving
+	Servings    []float64       `json:"servings"`     // liters - serving sizes poured from the keg
+	Yield       float64         `json:"yield"`        // ratio of the volume which ends up in glasses - foam and leftovers are lost
+	Density     float64         `json:"density"`      // kg per liter
+	Deposit     decimal.Decimal `json:"deposit"`      // default deposit of the keg in CZK
+}
+
+// MeasurementResolution is a size of the measurement rollup bucket
+type MeasurementResolution string
+
+const (
+	MeasurementResolution5m MeasurementResolution = "5m"
+	MeasurementResolution1h MeasurementResolution = "1h"
+	MeasurementResolution1d MeasurementResolution = "1d"
+)
+
+// MeasurementResolutions lists all rollups maintained for measurements
+var MeasurementResolutions = []MeasurementResolution{
+	MeasurementResolution5m,
+	MeasurementResolution1h,
+	MeasurementResolution1d,
+}
+
+// Bucket returns the start of the rollup bucket containing the time
+// daily buckets start at the local midnight, so an evening in the pub is not split
+func (r MeasurementResolution) Bucket(at time.Time) time.Time {
+	if r == MeasurementResolution1d {
+		local := at.In(utils.GetTz())
+		return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, utils.GetTz())
+	}
+
+	return at.Truncate(r.Duration())
+}
+
+// Duration returns the size of the rollup bucket
+func (r MeasurementResolution) Duration() time.Duration {
+	switch r {
+	case MeasurementResolution1h:
+		return time.Hour
+	case MeasurementResolution1d:
+		return 24 * time.Hour
+	default:
+		return 5 * time.Minute
+	}
+}
+
+// Measurement is a single accepted weight measurement from the tap scale
+type Measurement struct {
+	Tap       string    `json:"tap"`
+	At        time.Time `json:"at"`
+	Weight    float64   `json:"weight"` // in grams
+	ActiveKeg int       `json:"active_keg"`
+	BeersLeft int       `json:"beers_left"`
+}
+
+// MeasurementRollup aggregates measurements of one tap in a time bucket
+// ActiveKeg and BeersLeft are the last values seen in the bucket
+type MeasurementRollup struct {
+	Tap        string                `json:"tap"`
+	Resolution MeasurementResolution `json:"resolution"`
+	Bucket     time.Time             `json:"bucket"` // start of the bucket
+	Count      int                   `json:"count"`
+	WeightAvg  float64               `json:"weight_avg"`
+	WeightMin  float64               `json:"weight_min"`
+	WeightMax  float64               `json:"weight_max"`
+	ActiveKeg  int                   `json:"active_keg"`
+	BeersLeft  int                   `json:"beers_left"`
+	LastAt     time.Time             `json:"last_at"`
+}
+
+// PubSession is a single open/close cycle of the pub with its statistics
+type PubSession struct {
+	ID             int64           `json:"id"`
+	OpenedAt       time.Time       `json:"opened_at"`
+	ClosedAt       *time.Time      `json:"closed_at"` // nil while the pub is open
+	BeersPoured    int             `json:"beers_poured"`
+	KegsTapped     int             `json:"kegs_tapped"`
+	PeakAttendance int             `json:"peak_attendance"` // max number of BT devices seen at once
+	Income         decimal.Decimal `json:"income"`          // incoming bank payments in CZK
+}
+
+// Calibration converts raw readings of a tap scale to grams: weight = raw * gain + offset
+// it is computed from two captured points - tare and reference weight
+type Calibration struct {
+	ID              int64     `json:"id"`
+	Tap             string    `json:"tap"`
+	Offset          float64   `json:"offset"` // in grams
+	Gain            float64   `json:"gain"`
+	TareRaw         float64   `json:"tare_raw"`         // raw reading of the tare point
+	TareWeight      float64   `json:"tare_weight"`      // known weight of the tare point in grams
+	ReferenceRaw    float64   `json:"reference_raw"`    // raw reading of the reference point
+	ReferenceWeight float64   `json:"reference_weight"` // known weight of the reference point in grams
+	CreatedAt       time.Time `json:"created_at"`
+}
+
 type Storage interface {
-	AddEvent(event string) error  // add event
-	GetEvents() ([]string, error) // get events
+	AddEvent(event EventRecord) (int64, error)           // add event and return its id
+	GetEvents(filter EventFilter) ([]EventRecord, error) // get events from newest to oldest
+	Prune() error                                        // delete old rows outside the retention
+
+	SetTaps(taps []string) error // set list of known taps
+	GetTaps() ([]string, error)  // get list of known taps
 
-	SetWeight(weight float64) error // set weight
-	GetWeight() (float64, error)    // get weight
+	SetWeight(tap string, weight float64) error // set weight
+	GetWeight(tap string) (float64, error)      // get weight
 
-	SetWeightAt(weightAt time.Time) error // set weight at
-	GetWeightAt() (time.Time, error)      // get weight at
+	SetWeightAt(tap string, weightAt time.Time) error // set weight at
+	GetWeightAt(tap string) (time.Time, error)        // get weight at
 
-	SetActiveKeg(weight int) error // set active keg
-	GetActiveKeg() (int, error)    // get active keg
+	SetActiveKeg(tap string, keg int) error // set active keg
+	GetActiveKeg(tap string) (int, error)   // get active keg
 
-	SetActiveKegAt(at time.Time) error  // set active keg at
-	GetActiveKegAt() (time.Time, error) // get active keg at
+	SetActiveKegAt(tap string, at time.Time) error // set active keg at
+	GetActiveKegAt(tap string) (time.Time, error)  // get active keg at
 
-	SetBeersLeft(beersLeft int) error // set beers left
-	GetBeersLeft() (int, error)       // get beers left
+	SetCandidateKeg(tap string, keg int) error // set candidate keg
+	GetCandidateKeg(tap string) (int, error)   // get candidate keg
+
+	SetBeersLeft(tap string, beersLeft int) error // set beers left
+	GetBeersLeft(tap string) (int, error)         // get beers left
 
 	SetBeersTotal(beersTotal int) error // set beers total
 	GetBeersTotal() (int, error)        // get beers total
 
-	SetIsLow(isLow bool) error // set is low flag
-	GetIsLow() (bool, error)   // get is low flag
+	SetLitersTotal(litersTotal float64) error // set liters total
+	GetLitersTotal() (float64, error)         // get liters total
+
+	SetIsLow(tap string, isLow bool) error // set is low flag
+	GetIsLow(tap string) (bool, error)     // get is low flag
+
+	SetWarehouse(warehouse map[int]int) error // set warehouse - keg size => amount
+	GetWarehouse() (map[int]int, error)       // get warehouse - keg size => amount
+
+	AddStockKeg(keg StockKeg) (int64, error)       // add keg to the warehouse inventory and return its id
+	UpdateStockKeg(keg StockKeg) error             // update keg in the warehouse inventory
+	GetStockKegs(inStock bool) ([]StockKeg, error) // get kegs from the oldest purchase, only kegs in the warehouse when inStock
 
-	SetWarehouse(warehouse [5]int) error // set warehouse
-	GetWarehouse() ([5]int, error)       // get warehouse
+	AddWarehouseChange(change WarehouseChange) (int64, error) // add entry to the warehouse audit log
+	GetWarehouseChanges(limit int) ([]WarehouseChange, error) // get entries of the warehouse audit log from newest to oldest
 
-	SetLastOk(lastOk time.Time) error // set last ok
-	GetLastOk() (time.Time, error)    // get last ok
+	AddEmptyKeg(keg EmptyKeg) (int64, error)        // add emptied keg and return its id
+	UpdateEmptyKegs(kegs []EmptyKeg) error          // update emptied kegs by id in one transaction
+	GetEmptyKegs(awaiting bool) ([]EmptyKeg, error) // get emptied kegs from the oldest, only kegs not returned yet when awaiting
+
+	AddBankTransactions(transactions []BankTransaction) (int, error)   // add bank transactions, known ids are skipped, returns the number of added
+	GetBankTransactions(from, to time.Time) ([]BankTransaction, error) // get bank transactions dated from (inclusive) to (exclusive) from the oldest
+	SetBankSync(sync BankSync) error                                   // set the period of the downloaded bank transactions
+	GetBankSync() (BankSync, error)                                    // get the period of the downloaded bank transactions, zero when never synced
+	SetBankBalance(balance string) error                               // set the last known bank balance as JSON
+	GetBankBalance() (string, error)                                   // get the last known bank balance as JSON, empty when unknown
+
+	SetLastOk(tap string, lastOk time.Time) error // set last ok
+	GetLastOk(tap string) (time.Time, error)      // get last ok
 
 	SetOpenAt(openAt time.Time) error // set open at
 	GetOpenAt() (time.Time, error)    // get open at
@@ -56,6 +335,11 @@ type Storage interface {
 	SetIsOpen(isOpen bool) error // set is open flag
 	GetIsOpen() (bool, error)    // get is open flag
 
+	SetOpenPolicy(policy string) error     // set opening message policy as JSON
+	GetOpenPolicy() (string, error)        // get opening message policy as JSON, empty when not set
+	SetOpenOverride(override string) error // set manual opening message override as JSON, empty removes it
+	GetOpenOverride() (string, error)      // get manual opening message override as JSON, empty when not set
+
 	SetTodayBeer(todayBeer string) error // set today beer
 	GetTodayBeer() (string, error)       // get today beer
 	ResetTodayBeer() error               // reset today beer
@@ -69,4 +353,22 @@ type Storage interface {
 
 	SetAttendanceIrks(irks map[string]string) error // set irks
 	GetAttendanceIrks() (map[string]string, error)  // get irks
+
+	AddKeg(keg KegRecord) (int64, error)                // add keg to the ledger and return its id
+	UpdateKeg(keg KegRecord) error                      // update keg in the ledger
+	GetKegs(tap string, limit int) ([]KegRecord, error) // get kegs from the ledger from newest to oldest, empty tap for all taps
+
+	GetKegTypes() ([]KegType, error)  // get keg catalog ordered by size
+	SetKegType(kegType KegType) error // add or update keg type in the catalog
+	DeleteKegType(size int) error     // delete keg type from the catalog
+
+	AddMeasurement(m Measurement) error                                                                                  // add measurement and update its rollups
+	GetMeasurementRollups(tap string, resolution MeasurementResolution, from, to time.Time) ([]MeasurementRollup, error) // get rollups from oldest to newest including the last one before from
+
+	AddPubSession(session PubSession) (int64, error) // add pub session and return its id
+	UpdatePubSession(session PubSession) error       // update pub session
+	GetPubSessions(limit int) ([]PubSession, error)  // get pub sessions from newest to oldest
+
+	AddCalibration(c Calibration) (int64, error)                  // add calibration to the history and return its id
+	GetCalibrations(tap string, limit int) ([]Calibration, error) // get calibrations of the tap from newest to oldest
 }
@@ -1,62 +1,145 @@
 package store
 
 import (
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
 	"time"
+
+	"github.com/kotrzina/keg-scale/pkg/clock"
 )
 
 // FakeStore is primarily used for testing purposes
 type FakeStore struct {
-	beersLeft int
-	isLow     bool
+	Clock clock.Clock // time of the returned timestamps, the wall clock when nil
+
+	taps      []string
+	beersLeft map[string]int
+	isLow     map[string]bool
+	kegs      []KegRecord
+	kegTypes  []KegType
+
+	measurements []Measurement
+	calibrations []Calibration
+	events       []EventRecord
+	pubSessions  []PubSession
+	stockKegs    []StockKeg
+	changes      []WarehouseChange
+	emptyKegs    []EmptyKeg
+	bankTxs      []BankTransaction
+	bankSync     BankSync
+	bankBalance  string
+	openPolicy   string
+	openOverride string
+	eventsMux    sync.Mutex // events are added from goroutines
 }
 
-func (s *FakeStore) AddEvent(_ string) error {
+func (s *FakeStore) now() time.Time {
+	if s.Clock == nil {
+		return time.Now()
+	}
+
+	return s.Clock.Now()
+}
+
+func (s *FakeStore) AddEvent(event EventRecord) (int64, error) {
+	s.eventsMux.Lock()
+	defer s.eventsMux.Unlock()
+
+	event.ID = int64(len(s.events) + 1)
+	s.events = append(s.events, event)
+	return event.ID, nil
+}
+
+// Prune does nothing, the fake store keeps everything in memory for a single test
+func (s *FakeStore) Prune() error {
 	return nil
 }
 
-func (s *FakeStore) GetEvents() ([]string, error) {
-	return []string{}, nil
+func (s *FakeStore) GetEvents(filter EventFilter) ([]EventRecord, error) {
+	s.eventsMux.Lock()
+	defer s.eventsMux.Unlock()
+
+	events := []EventRecord{}
+	for i := len(s.events) - 1; i >= 0; i-- {
+		e := s.events[i]
+		if len(filter.Types) > 0 && !slices.Contains(filter.Types, e.Type) ||
+			filter.Tap != "" && e.Tap != filter.Tap ||
+			!filter.From.IsZero() && e.At.Before(filter.From) ||
+			!filter.To.IsZero() && !e.At.Before(filter.To) ||
+			filter.BeforeID > 0 && e.ID >= filter.BeforeID {
+			continue
+		}
+
+		events = append(events, e)
+		if filter.Limit > 0 && len(events) == filter.Limit {
+			break
+		}
+	}
+
+	return events, nil
 }
 
-func (s *FakeStore) SetWeight(_ float64) error {
+func (s *FakeStore) SetTaps(taps []string) error {
+	s.taps = taps
 	return nil
 }
 
-func (s *FakeStore) GetWeight() (float64, error) {
+func (s *FakeStore) GetTaps() ([]string, error) {
+	return s.taps, nil
+}
+
+func (s *FakeStore) SetWeight(_ string, _ float64) error {
+	return nil
+}
+
+func (s *FakeStore) GetWeight(_ string) (float64, error) {
 	return 12, nil
 }
 
-func (s *FakeStore) SetWeightAt(_ time.Time) error {
+func (s *FakeStore) SetWeightAt(_ string, _ time.Time) error {
 	return nil
 }
 
-func (s *FakeStore) GetWeightAt() (time.Time, error) {
-	return time.Now(), nil
+func (s *FakeStore) GetWeightAt(_ string) (time.Time, error) {
+	return s.now(), nil
 }
 
-func (s *FakeStore) SetActiveKeg(_ int) error {
+func (s *FakeStore) SetActiveKeg(_ string, _ int) error {
 	return nil
 }
 
-func (s *FakeStore) GetActiveKeg() (int, error) {
+func (s *FakeStore) GetActiveKeg(_ string) (int, error) {
 	return 0, nil
 }
 
-func (s *FakeStore) SetActiveKegAt(_ time.Time) error {
+func (s *FakeStore) SetActiveKegAt(_ string, _ time.Time) error {
+	return nil
+}
+
+func (s *FakeStore) GetActiveKegAt(_ string) (time.Time, error) {
+	return s.now(), nil
+}
+
+func (s *FakeStore) SetCandidateKeg(_ string, _ int) error {
 	return nil
 }
 
-func (s *FakeStore) GetActiveKegAt() (time.Time, error) {
-	return time.Now(), nil
+func (s *FakeStore) GetCandidateKeg(_ string) (int, error) {
+	return 0, nil
 }
 
-func (s *FakeStore) SetBeersLeft(beersLeft int) error {
-	s.beersLeft = beersLeft
+func (s *FakeStore) SetBeersLeft(tap string, beersLeft int) error {
+	if s.beersLeft == nil {
+		s.beersLeft = map[string]int{}
+	}
+	s.beersLeft[tap] = beersLeft
 	return nil
 }
 
-func (s *FakeStore) GetBeersLeft() (int, error) {
-	return s.beersLeft, nil
+func (s *FakeStore) GetBeersLeft(tap string) (int, error) {
+	return s.beersLeft[tap], nil
 }
 
 func (s *FakeStore) SetBeersTotal(_ int) error {
@@ -67,30 +150,41 @@ func (s *FakeStore) GetBeersTotal() (int, error) {
 	return 0, nil
 }
 
-func (s *FakeStore) SetIsLow(isLow bool) error {
-	s.isLow = isLow
+func (s *FakeStore) SetLitersTotal(_ float64) error {
 	return nil
 }
 
-func (s *FakeStore) GetIsLow() (bool, error) {
-	return s.isLow, nil
+func (s *FakeStore) GetLitersTotal() (float64, error) {
+	return 0, nil
 }
 
-func (s *FakeStore) SetWarehouse(_ [5]int) error {
+func (s *FakeStore) SetIsLow(tap string, isLow bool) error {
+	if s.isLow == nil {
+		s.isLow = map[string]bool{}
+	}
+	s.isLow[tap] = isLow
 	return nil
 }
 
-func (s *FakeStore) GetWarehouse() ([5]int, error) {
-	warehouse := [5]int{1, 2, 3, 4, 5}
+func (s *FakeStore) GetIsLow(tap string) (bool, error) {
+	return s.isLow[tap], nil
+}
+
+func (s *FakeStore) SetWarehouse(_ map[int]int) error {
+	return nil
+}
+
+func (s *FakeStore) GetWarehouse() (map[int]int, error) {
+	warehouse := map[int]int{10: 1, 15: 2, 20: 3, 30: 4, 50: 5}
 	return warehouse, nil
 }
 
-func (s *FakeStore) SetLastOk(_ time.Time) error {
+func (s *FakeStore) SetLastOk(_ string, _ time.Time) error {
 	return nil
 }
 
-func (s *FakeStore) GetLastOk() (time.Time, error) {
-	return time.Now(), nil
+func (s *FakeStore) GetLastOk(_ string) (time.Time, error) {
+	return s.now(), nil
 }
 
 func (s *FakeStore) SetOpenAt(_ time.Time) error {
@@ -98,7 +192,7 @@ func (s *FakeStore) SetOpenAt(_ time.Time) error {
 }
 
 func (s *FakeStore) GetOpenAt() (time.Time, error) {
-	return time.Now(), nil
+	return s.now(), nil
 }
 
 func (s *FakeStore) SetCloseAt(_ time.Time) error {
@@ -106,7 +200,7 @@ func (s *FakeStore) SetCloseAt(_ time.Time) error {
 }
 
 func (s *FakeStore) GetCloseAt() (time.Time, error) {
-	return time.Now(), nil
+	return s.now(), nil
 }
 
 func (s *FakeStore) SetIsOpen(_ bool) error {
@@ -117,6 +211,24 @@ func (s *FakeStore) GetIsOpen() (bool, error) {
 	return false, nil
 }
 
+func (s *FakeStore) SetOpenPolicy(policy string) error {
+	s.openPolicy = policy
+	return nil
+}
+
+func (s *FakeStore) GetOpenPolicy() (string, error) {
+	return s.openPolicy, nil
+}
+
+func (s *FakeStore) SetOpenOverride(override string) error {
+	s.openOverride = override
+	return nil
+}
+
+func (s *FakeStore) GetOpenOverride() (string, error) {
+	return s.openOverride, nil
+}
+
 func (s *FakeStore) SetTodayBeer(_ string) error {
 	return nil
 }
@@ -156,3 +268,307 @@ func (s *FakeStore) SetAttendanceIrks(_ map[string]string) error {
 func (s *FakeStore) GetAttendanceIrks() (map[string]string, error) {
 	return map[string]string{}, nil
 }
+
+func (s *FakeStore) AddKeg(keg KegRecord) (int64, error) {
+	keg.ID = int64(len(s.kegs) + 1)
+	s.kegs = append(s.kegs, keg)
+	return keg.ID, nil
+}
+
+func (s *FakeStore) UpdateKeg(keg KegRecord) error {
+	for i := range s.kegs {
+		if s.kegs[i].ID == keg.ID {
+			s.kegs[i] = keg
+			return nil
+		}
+	}
+
+	return fmt.Errorf("keg not found: %d", keg.ID)
+}
+
+func (s *FakeStore) GetKegs(tap string, limit int) ([]KegRecord, error) {
+	kegs := make([]KegRecord, 0, len(s.kegs))
+	for i := len(s.kegs) - 1; i >= 0 && len(kegs) < limit; i-- {
+		if tap == "" || s.kegs[i].Tap == tap {
+			kegs = append(kegs, s.kegs[i])
+		}
+	}
+
+	return kegs, nil
+}
+
+func (s *FakeStore) GetKegTypes() ([]KegType, error) {
+	types := make([]KegType, len(s.kegTypes))
+	copy(types, s.kegTypes)
+	sort.Slice(types, func(i, j int) bool {
+		return types[i].Size < types[j].Size
+	})
+
+	return types, nil
+}
+
+func (s *FakeStore) SetKegType(kegType KegType) error {
+	for i := range s.kegTypes {
+		if s.kegTypes[i].Size == kegType.Size {
+			s.kegTypes[i] = kegType
+			return nil
+		}
+	}
+
+	s.kegTypes = append(s.kegTypes, kegType)
+	return nil
+}
+
+func (s *FakeStore) DeleteKegType(size int) error {
+	for i := range s.kegTypes {
+		if s.kegTypes[i].Size == size {
+			s.kegTypes = append(s.kegTypes[:i], s.kegTypes[i+1:]...)
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func (s *FakeStore) AddMeasurement(m Measurement) error {
+	s.measurements = append(s.measurements, m)
+	return nil
+}
+
+// GetMeasurementRollups computes rollups from stored measurements on every call
+func (s *FakeStore) GetMeasurementRollups(
+	tap string,
+	resolution MeasurementResolution,
+	from, to time.Time,
+) ([]MeasurementRollup, error) {
+	buckets := map[time.Time]*MeasurementRollup{}
+	sums := map[time.Time]float64{}
+	for _, m := range s.measurements {
+		if m.Tap != tap {
+			continue
+		}
+
+		bucket := resolution.Bucket(m.At)
+		r, found := buckets[bucket]
+		if !found {
+			r = &MeasurementRollup{
+				Tap:        tap,
+				Resolution: resolution,
+				Bucket:     bucket,
+				WeightMin:  m.Weight,
+				WeightMax:  m.Weight,
+			}
+			buckets[bucket] = r
+		}
+
+		r.Count++
+		sums[bucket] += m.Weight
+		r.WeightMin = min(r.WeightMin, m.Weight)
+		r.WeightMax = max(r.WeightMax, m.Weight)
+		r.WeightAvg = sums[bucket] / float64(r.Count)
+		if !m.At.Before(r.LastAt) {
+			r.ActiveKeg = m.ActiveKeg
+			r.BeersLeft = m.BeersLeft
+			r.LastAt = m.At
+		}
+	}
+
+	all := make([]MeasurementRollup, 0, len(buckets))
+	for _, r := range buckets {
+		all = append(all, *r)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].Bucket.Before(all[j].Bucket)
+	})
+
+	rollups := []MeasurementRollup{}
+	for i, r := range all {
+		if r.Bucket.Before(from) {
+			// keep only the last rollup before the interval
+			if i+1 < len(all) && all[i+1].Bucket.Before(from) {
+				continue
+			}
+		} else if r.Bucket.After(to) {
+			break
+		}
+		rollups = append(rollups, r)
+	}
+
+	return rollups, nil
+}
+
+func (s *FakeStore) AddCalibration(c Calibration) (int64, error) {
+	c.ID = int64(len(s.calibrations) + 1)
+	s.calibrations = append(s.calibrations, c)
+	return c.ID, nil
+}
+
+func (s *FakeStore) GetCalibrations(tap string, limit int) ([]Calibration, error) {
+	calibrations := make([]Calibration, 0, len(s.calibrations))
+	for i := len(s.calibrations) - 1; i >= 0 && len(calibrations) < limit; i-- {
+		if s.calibrations[i].Tap == tap {
+			calibrations = append(calibrations, s.calibrations[i])
+		}
+	}
+
+	return calibrations, nil
+}
+
+func (s *FakeStore) AddPubSession(session PubSession) (int64, error) {
+	session.ID = int64(len(s.pubSessions) + 1)
+	s.pubSessions = append(s.pubSessions, session)
+	return session.ID, nil
+}
+
+func (s *FakeStore) UpdatePubSession(session PubSession) error {
+	for i := range s.pubSessions {
+		if s.pubSessions[i].ID == session.ID {
+			s.pubSessions[i] = session
+			return nil
+		}
+	}
+
+	return fmt.Errorf("pub session not found: %d", session.ID)
+}
+
+func (s *FakeStore) GetPubSessions(limit int) ([]PubSession, error) {
+	sessions := make([]PubSession, 0, min(limit, len(s.pubSessions)))
+	for i := len(s.pubSessions) - 1; i >= 0 && len(sessions) < limit; i-- {
+		sessions = append(sessions, s.pubSessions[i])
+	}
+
+	return sessions, nil
+}
+
+func (s *FakeStore) AddStockKeg(keg StockKeg) (int64, error) {
+	keg.ID = int64(len(s.stockKegs) + 1)
+	s.stockKegs = append(s.stockKegs, keg)
+	return keg.ID, nil
+}
+
+func (s *FakeStore) UpdateStockKeg(keg StockKeg) error {
+	for i := range s.stockKegs {
+		if s.stockKegs[i].ID == keg.ID {
+			s.stockKegs[i] = keg
+			return nil
+		}
+	}
+
+	return fmt.Errorf("stock keg not found: %d", keg.ID)
+}
+
+func (s *FakeStore) GetStockKegs(inStock bool) ([]StockKeg, error) {
+	kegs := make([]StockKeg, 0, len(s.stockKegs))
+	for _, keg := range s.stockKegs {
+		if !inStock || keg.OutAt == nil {
+			kegs = append(kegs, keg)
+		}
+	}
+
+	sort.SliceStable(kegs, func(i, j int) bool {
+		return kegs[i].PurchasedAt.Before(kegs[j].PurchasedAt)
+	})
+
+	return kegs, nil
+}
+
+func (s *FakeStore) AddWarehouseChange(change WarehouseChange) (int64, error) {
+	change.ID = int64(len(s.changes) + 1)
+	s.changes = append(s.changes, change)
+	return change.ID, nil
+}
+
+func (s *FakeStore) GetWarehouseChanges(limit int) ([]WarehouseChange, error) {
+	changes := make([]WarehouseChange, 0, min(limit, len(s.changes)))
+	for i := len(s.changes) - 1; i >= 0 && len(changes) < limit; i-- {
+		changes = append(changes, s.changes[i])
+	}
+
+	return changes, nil
+}
+
+func (s *FakeStore) AddEmptyKeg(keg EmptyKeg) (int64, error) {
+	keg.ID = int64(len(s.emptyKegs) + 1)
+	s.emptyKegs = append(s.emptyKegs, keg)
+	return keg.ID, nil
+}
+
+func (s *FakeStore) UpdateEmptyKegs(kegs []EmptyKeg) error {
+	indexes := make([]int, 0, len(kegs))
+	for _, keg := range kegs {
+		i := slices.IndexFunc(s.emptyKegs, func(e EmptyKeg) bool { return e.ID == keg.ID })
+		if i < 0 {
+			return fmt.Errorf("empty keg not found: %d", keg.ID)
+		}
+		indexes = append(indexes, i)
+	}
+
+	for n, i := range indexes {
+		s.emptyKegs[i] = kegs[n]
+	}
+	return nil
+}
+
+func (s *FakeStore) GetEmptyKegs(awaiting bool) ([]EmptyKeg, error) {
+	kegs := make([]EmptyKeg, 0, len(s.emptyKegs))
+	for _, keg := range s.emptyKegs {
+		if !awaiting || keg.ReturnedAt == nil {
+			kegs = append(kegs, keg)
+		}
+	}
+
+	sort.SliceStable(kegs, func(i, j int) bool {
+		return kegs[i].EmptiedAt.Before(kegs[j].EmptiedAt)
+	})
+
+	return kegs, nil
+}
+
+func (s *FakeStore) AddBankTransactions(transactions []BankTransaction) (int, error) {
+	added := 0
+	for _, t := range transactions {
+		if slices.ContainsFunc(s.bankTxs, func(known BankTransaction) bool { return known.ID == t.ID }) {
+			continue
+		}
+		s.bankTxs = append(s.bankTxs, t)
+		added++
+	}
+
+	return added, nil
+}
+
+func (s *FakeStore) GetBankTransactions(from, to time.Time) ([]BankTransaction, error) {
+	transactions := []BankTransaction{}
+	for _, t := range s.bankTxs {
+		if !t.Date.Before(from) && t.Date.Before(to) {
+			transactions = append(transactions, t)
+		}
+	}
+
+	sort.SliceStable(transactions, func(i, j int) bool {
+		if !transactions[i].Date.Equal(transactions[j].Date) {
+			return transactions[i].Date.Before(transactions[j].Date)
+		}
+		return transactions[i].ID < transactions[j].ID
+	})
+
+	return transactions, nil
+}
+
+func (s *FakeStore) SetBankSync(sync BankSync) error {
+	s.bankSync = sync
+	return nil
+}
+
+func (s *FakeStore) GetBankSync() (BankSync, error) {
+	return s.bankSync, nil
+}
+
+func (s *FakeStore) SetBankBalance(balance string) error {
+	s.bankBalance = balance
+	return nil
+}
+
+func (s *FakeStore) GetBankBalance() (string, error) {
+	return s.bankBalance, nil
+}
@@ -9,11 +9,14 @@ import (
 	"strings"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 const (
 	tablePrefix = "pub_"
+
+	eventsLimit           = 500                 // only the newest events are kept
+	measurementsRetention = 30 * 24 * time.Hour // older raw measurements are deleted, their rollups are kept
 )
 
 type PostgresStore struct {
@@ -52,6 +55,15 @@ func (s *PostgresStore) migrate() error {
 			created_at TIMESTAMPTZ DEFAULT NOW()
 		)`, tablePrefix),
 
+		// Structured events - the text event column is kept for legacy rows
+		fmt.Sprintf(`ALTER TABLE %sevents ALTER COLUMN event SET DEFAULT ''`, tablePrefix),
+		fmt.Sprintf(`ALTER TABLE %sevents ADD COLUMN IF NOT EXISTS type TEXT NOT NULL DEFAULT ''`, tablePrefix),
+		fmt.Sprintf(`ALTER TABLE %sevents ADD COLUMN IF NOT EXISTS tap TEXT NOT NULL DEFAULT ''`, tablePrefix),
+		fmt.Sprintf(`ALTER TABLE %sevents ADD COLUMN IF NOT EXISTS data JSONB NOT NULL DEFAULT '{}'`, tablePrefix),
+		fmt.Sprintf(`UPDATE %sevents SET type = split_part(event, ' ', 1), data = jsonb_build_object('details', event) WHERE type = ''`, tablePrefix),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %sevents_created_at_idx ON %sevents (created_at)`, tablePrefix, tablePrefix),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %sevents_type_created_at_idx ON %sevents (type, created_at)`, tablePrefix, tablePrefix),
+
 		// Key-value store for simple values
 		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %skv (
 			key TEXT PRIMARY KEY,
@@ -72,6 +84,163 @@ func (s *PostgresStore) migrate() error {
 		// Index for conversation messages
 		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %sconversation_messages_conv_id_idx ON %sconversation_messages (conv_id)`,
 			tablePrefix, tablePrefix),
+
+		// Keg ledger
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %skegs (
+			id SERIAL PRIMARY KEY,
+			size INT NOT NULL,
+			tapped_at TIMESTAMPTZ NOT NULL,
+			emptied_at TIMESTAMPTZ,
+			start_weight DOUBLE PRECISION NOT NULL,
+			end_weight DOUBLE PRECISION NOT NULL,
+			beers_poured INT NOT NULL DEFAULT 0,
+			end_reason TEXT NOT NULL DEFAULT ''
+		)`, tablePrefix),
+		fmt.Sprintf(`ALTER TABLE %skegs ADD COLUMN IF NOT EXISTS tap TEXT NOT NULL DEFAULT '%s'`, tablePrefix, DefaultTap),
+		fmt.Sprintf(`ALTER TABLE %skegs ADD COLUMN IF NOT EXISTS liters_poured DOUBLE PRECISION NOT NULL DEFAULT 0`, tablePrefix),
+		fmt.Sprintf(`ALTER TABLE %skegs ADD COLUMN IF NOT EXISTS stock_id BIGINT NOT NULL DEFAULT 0`, tablePrefix),
+
+		// Warehouse inventory
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %sstock_kegs (
+			id BIGSERIAL PRIMARY KEY,
+			size INT NOT NULL,
+			brand TEXT NOT NULL DEFAULT '',
+			style TEXT NOT NULL DEFAULT '',
+			supplier TEXT NOT NULL DEFAULT '',
+			price NUMERIC(12, 2) NOT NULL DEFAULT 0,
+			purchased_at TIMESTAMPTZ NOT NULL,
+			best_before TIMESTAMPTZ,
+			out_at TIMESTAMPTZ,
+			out_reason TEXT NOT NULL DEFAULT '',
+			tap TEXT NOT NULL DEFAULT '',
+			note TEXT NOT NULL DEFAULT ''
+		)`, tablePrefix),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %sstock_kegs_in_stock_idx ON %sstock_kegs (purchased_at) WHERE out_at IS NULL`,
+			tablePrefix, tablePrefix),
+		fmt.Sprintf(`ALTER TABLE %sstock_kegs ADD COLUMN IF NOT EXISTS deposit NUMERIC(12, 2) NOT NULL DEFAULT 0`, tablePrefix),
+
+		// Empty kegs waiting for the return to the supplier
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %sempty_kegs (
+			id BIGSERIAL PRIMARY KEY,
+			size INT NOT NULL,
+			stock_id BIGINT NOT NULL DEFAULT 0,
+			keg_id BIGINT NOT NULL DEFAULT 0,
+			tap TEXT NOT NULL DEFAULT '',
+			supplier TEXT NOT NULL DEFAULT '',
+			deposit NUMERIC(12, 2) NOT NULL DEFAULT 0,
+			emptied_at TIMESTAMPTZ NOT NULL,
+			returned_at TIMESTAMPTZ,
+			refund NUMERIC(12, 2) NOT NULL DEFAULT 0,
+			note TEXT NOT NULL DEFAULT ''
+		)`, tablePrefix),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %sempty_kegs_awaiting_idx ON %sempty_kegs (emptied_at) WHERE returned_at IS NULL`,
+			tablePrefix, tablePrefix),
+
+		// Bank transactions keyed by the bank id
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %sbank_transactions (
+			id BIGINT PRIMARY KEY,
+			date TIMESTAMPTZ NOT NULL,
+			amount NUMERIC(12, 2) NOT NULL,
+			currency TEXT NOT NULL DEFAULT '',
+			account TEXT NOT NULL DEFAULT '',
+			account_name TEXT NOT NULL DEFAULT '',
+			bank_name TEXT NOT NULL DEFAULT '',
+			bank_code TEXT NOT NULL DEFAULT '',
+			constant_symbol TEXT NOT NULL DEFAULT '',
+			variable_symbol TEXT NOT NULL DEFAULT '',
+			specific_symbol TEXT NOT NULL DEFAULT '',
+			user_identification TEXT NOT NULL DEFAULT '',
+			recipient_message TEXT NOT NULL DEFAULT '',
+			type TEXT NOT NULL DEFAULT '',
+			specification TEXT NOT NULL DEFAULT '',
+			comment TEXT NOT NULL DEFAULT '',
+			bic TEXT NOT NULL DEFAULT '',
+			order_id TEXT NOT NULL DEFAULT '',
+			payer_reference TEXT NOT NULL DEFAULT ''
+		)`, tablePrefix),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %sbank_transactions_date_idx ON %sbank_transactions (date)`,
+			tablePrefix, tablePrefix),
+
+		// Warehouse audit log
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %swarehouse_changes (
+			id BIGSERIAL PRIMARY KEY,
+			size INT NOT NULL,
+			delta INT NOT NULL,
+			kind TEXT NOT NULL,
+			stock_id BIGINT NOT NULL DEFAULT 0,
+			source TEXT NOT NULL,
+			actor TEXT NOT NULL DEFAULT '',
+			reason TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMPTZ NOT NULL
+		)`, tablePrefix),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %swarehouse_changes_created_at_idx ON %swarehouse_changes (created_at)`,
+			tablePrefix, tablePrefix),
+
+		// Keg catalog
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %skeg_types (
+			size INT PRIMARY KEY,
+			empty_weight DOUBLE PRECISION NOT NULL,
+			label TEXT NOT NULL DEFAULT '',
+			supplier TEXT NOT NULL DEFAULT ''
+		)`, tablePrefix),
+		fmt.Sprintf(`ALTER TABLE %skeg_types ADD COLUMN IF NOT EXISTS serving_size DOUBLE PRECISION NOT NULL DEFAULT 0`, tablePrefix),
+		fmt.Sprintf(`ALTER TABLE %skeg_types ADD COLUMN IF NOT EXISTS servings DOUBLE PRECISION[] NOT NULL DEFAULT '{}'`, tablePrefix),
+		fmt.Sprintf(`ALTER TABLE %skeg_types ADD COLUMN IF NOT EXISTS yield DOUBLE PRECISION NOT NULL DEFAULT 0`, tablePrefix),
+		fmt.Sprintf(`ALTER TABLE %skeg_types ADD COLUMN IF NOT EXISTS density DOUBLE PRECISION NOT NULL DEFAULT 0`, tablePrefix),
+		fmt.Sprintf(`ALTER TABLE %skeg_types ADD COLUMN IF NOT EXISTS deposit NUMERIC(12, 2) NOT NULL DEFAULT 0`, tablePrefix),
+
+		// Measurements time-series with rollups
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %smeasurements (
+			id BIGSERIAL PRIMARY KEY,
+			tap TEXT NOT NULL,
+			at TIMESTAMPTZ NOT NULL,
+			weight DOUBLE PRECISION NOT NULL,
+			active_keg INT NOT NULL,
+			beers_left INT NOT NULL
+		)`, tablePrefix),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %smeasurements_tap_at_idx ON %smeasurements (tap, at)`,
+			tablePrefix, tablePrefix),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %smeasurement_rollups (
+			tap TEXT NOT NULL,
+			resolution TEXT NOT NULL,
+			bucket TIMESTAMPTZ NOT NULL,
+			count INT NOT NULL,
+			weight_sum DOUBLE PRECISION NOT NULL,
+			weight_min DOUBLE PRECISION NOT NULL,
+			weight_max DOUBLE PRECISION NOT NULL,
+			active_keg INT NOT NULL,
+			beers_left INT NOT NULL,
+			last_at TIMESTAMPTZ NOT NULL,
+			PRIMARY KEY (tap, resolution, bucket)
+		)`, tablePrefix),
+
+		// Pub sessions - open/close cycles with statistics
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %ssessions (
+			id SERIAL PRIMARY KEY,
+			opened_at TIMESTAMPTZ NOT NULL,
+			closed_at TIMESTAMPTZ,
+			beers_poured INT NOT NULL DEFAULT 0,
+			kegs_tapped INT NOT NULL DEFAULT 0,
+			peak_attendance INT NOT NULL DEFAULT 0,
+			income NUMERIC(12, 2) NOT NULL DEFAULT 0
+		)`, tablePrefix),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %ssessions_opened_at_idx ON %ssessions (opened_at)`,
+			tablePrefix, tablePrefix),
+
+		// Scale calibration history
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %scalibrations (
+			id SERIAL PRIMARY KEY,
+			tap TEXT NOT NULL,
+			"offset" DOUBLE PRECISION NOT NULL,
+			gain DOUBLE PRECISION NOT NULL,
+			tare_raw DOUBLE PRECISION NOT NULL,
+			tare_weight DOUBLE PRECISION NOT NULL,
+			reference_raw DOUBLE PRECISION NOT NULL,
+			reference_weight DOUBLE PRECISION NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL
+		)`, tablePrefix),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %scalibrations_tap_idx ON %scalibrations (tap, created_at)`,
+			tablePrefix, tablePrefix),
 	}
 
 	for _, migration := range migrations {
@@ -85,6 +254,16 @@ func (s *PostgresStore) migrate() error {
 
 // Helper methods for key-value store
 
+// tapKey returns the key for a tap specific value
+// the default tap uses keys without suffix to stay compatible with single tap data
+func tapKey(key, tap string) string {
+	if tap == "" || tap == DefaultTap {
+		return key
+	}
+
+	return key + ":" + tap
+}
+
 func (s *PostgresStore) setValue(key, value string) error {
 	query := fmt.Sprintf(`
 		INSERT INTO %skv (key, value, updated_at)
@@ -155,98 +334,174 @@ func (s *PostgresStore) getStructArray(key string, result interface{}) error {
 
 // Storage interface implementation
 
-func (s *PostgresStore) AddEvent(event string) error {
-	// Insert event
-	query := fmt.Sprintf("INSERT INTO %sevents (event) VALUES ($1)", tablePrefix)
-	if _, err := s.db.ExecContext(s.ctx, query, event); err != nil {
-		return err
+func (s *PostgresStore) AddEvent(event EventRecord) (int64, error) {
+	query := fmt.Sprintf(`
+		INSERT INTO %sevents (type, tap, data, created_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`, tablePrefix)
+
+	var id int64
+	if err := s.db.QueryRowContext(s.ctx, query, event.Type, event.Tap, []byte(event.Data), event.At).Scan(&id); err != nil {
+		return 0, fmt.Errorf("failed to add event: %w", err)
 	}
 
+	return id, nil
+}
+
+// Prune deletes the old rows, it runs periodically so the inserts stay cheap
+func (s *PostgresStore) Prune() error {
 	// Keep only last 500 events
 	deleteQuery := fmt.Sprintf(`
-		DELETE FROM %sevents
+		DELETE FROM %[1]sevents
 		WHERE id NOT IN (
-			SELECT id FROM %sevents ORDER BY id DESC LIMIT 500
+			SELECT id FROM %[1]sevents ORDER BY id DESC LIMIT $1
 		)
-	`, tablePrefix, tablePrefix)
-	_, err := s.db.ExecContext(s.ctx, deleteQuery)
-	return err
+	`, tablePrefix)
+	if _, err := s.db.ExecContext(s.ctx, deleteQuery, eventsLimit); err != nil {
+		return fmt.Errorf("failed to delete old events: %w", err)
+	}
+
+	// Keep only raw measurements within the retention, charts are served from the rollups
+	deleteQuery = fmt.Sprintf("DELETE FROM %smeasurements WHERE at < $1", tablePrefix)
+	if _, err := s.db.ExecContext(s.ctx, deleteQuery, time.Now().Add(-measurementsRetention)); err != nil {
+		return fmt.Errorf("failed to delete old measurements: %w", err)
+	}
+
+	return nil
 }
 
-func (s *PostgresStore) GetEvents() ([]string, error) {
-	query := fmt.Sprintf("SELECT event FROM %sevents ORDER BY id ASC", tablePrefix)
-	rows, err := s.db.QueryContext(s.ctx, query)
+func (s *PostgresStore) GetEvents(filter EventFilter) ([]EventRecord, error) {
+	conditions := []string{"TRUE"}
+	args := []any{}
+	arg := func(value any) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if len(filter.Types) > 0 {
+		conditions = append(conditions, "type = ANY("+arg(pq.Array(filter.Types))+")")
+	}
+	if filter.Tap != "" {
+		conditions = append(conditions, "tap = "+arg(filter.Tap))
+	}
+	if !filter.From.IsZero() {
+		conditions = append(conditions, "created_at >= "+arg(filter.From))
+	}
+	if !filter.To.IsZero() {
+		conditions = append(conditions, "created_at < "+arg(filter.To))
+	}
+	if filter.BeforeID > 0 {
+		conditions = append(conditions, "id < "+arg(filter.BeforeID))
+	}
+
+	query := fmt.Sprintf(
+		"SELECT id, type, tap, data, created_at FROM %sevents WHERE %s ORDER BY id DESC",
+		tablePrefix,
+		strings.Join(conditions, " AND "),
+	)
+	if filter.Limit > 0 {
+		query += " LIMIT " + arg(filter.Limit)
+	}
+
+	rows, err := s.db.QueryContext(s.ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to get events: %w", err)
 	}
 	defer func() { _ = rows.Close() }()
 
-	var events []string
+	events := []EventRecord{}
 	for rows.Next() {
-		var event string
-		if err := rows.Scan(&event); err != nil {
-			return nil, err
+		var e EventRecord
+		var data []byte
+		if err := rows.Scan(&e.ID, &e.Type, &e.Tap, &data, &e.At); err != nil {
+			return nil, fmt.Errorf("failed to scan event: %w", err)
 		}
-		events = append(events, event)
+		e.Data = data
+		events = append(events, e)
 	}
 
 	return events, rows.Err()
 }
 
-func (s *PostgresStore) SetWeight(weight float64) error {
-	return s.setValue("weight", fmt.Sprintf("%f", weight))
+func (s *PostgresStore) SetTaps(taps []string) error {
+	return s.setStructArray("taps", taps)
+}
+
+func (s *PostgresStore) GetTaps() ([]string, error) {
+	var taps []string
+	if err := s.getStructArray("taps", &taps); err != nil {
+		return nil, err
+	}
+	return taps, nil
 }
 
-func (s *PostgresStore) GetWeight() (float64, error) {
-	val, err := s.getValue("weight")
+func (s *PostgresStore) SetWeight(tap string, weight float64) error {
+	return s.setValue(tapKey("weight", tap), fmt.Sprintf("%f", weight))
+}
+
+func (s *PostgresStore) GetWeight(tap string) (float64, error) {
+	val, err := s.getValue(tapKey("weight", tap))
 	if err != nil {
 		return 0, err
 	}
 	return strconv.ParseFloat(val, 64)
 }
 
-func (s *PostgresStore) SetWeightAt(weightAt time.Time) error {
-	return s.setValue("weight_at", weightAt.Format(time.RFC3339))
+func (s *PostgresStore) SetWeightAt(tap string, weightAt time.Time) error {
+	return s.setValue(tapKey("weight_at", tap), weightAt.Format(time.RFC3339))
 }
 
-func (s *PostgresStore) GetWeightAt() (time.Time, error) {
-	val, err := s.getValue("weight_at")
+func (s *PostgresStore) GetWeightAt(tap string) (time.Time, error) {
+	val, err := s.getValue(tapKey("weight_at", tap))
 	if err != nil {
 		return time.Time{}, err
 	}
 	return time.Parse(time.RFC3339, val)
 }
 
-func (s *PostgresStore) SetActiveKeg(weight int) error {
-	return s.setValue("active_keg", strconv.Itoa(weight))
+func (s *PostgresStore) SetActiveKeg(tap string, keg int) error {
+	return s.setValue(tapKey("active_keg", tap), strconv.Itoa(keg))
 }
 
-func (s *PostgresStore) GetActiveKeg() (int, error) {
-	val, err := s.getValue("active_keg")
+func (s *PostgresStore) GetActiveKeg(tap string) (int, error) {
+	val, err := s.getValue(tapKey("active_keg", tap))
 	if err != nil {
 		return 0, err
 	}
 	return strconv.Atoi(val)
 }
 
-func (s *PostgresStore) SetActiveKegAt(at time.Time) error {
-	return s.setValue("active_keg_at", at.Format(time.RFC3339))
+func (s *PostgresStore) SetActiveKegAt(tap string, at time.Time) error {
+	return s.setValue(tapKey("active_keg_at", tap), at.Format(time.RFC3339))
 }
 
-func (s *PostgresStore) GetActiveKegAt() (time.Time, error) {
-	val, err := s.getValue("active_keg_at")
+func (s *PostgresStore) GetActiveKegAt(tap string) (time.Time, error) {
+	val, err := s.getValue(tapKey("active_keg_at", tap))
 	if err != nil {
 		return time.Time{}, err
 	}
 	return time.Parse(time.RFC3339, val)
 }
 
-func (s *PostgresStore) SetBeersLeft(beersLeft int) error {
-	return s.setValue("beers_left", strconv.Itoa(beersLeft))
+func (s *PostgresStore) SetCandidateKeg(tap string, keg int) error {
+	return s.setValue(tapKey("candidate_keg", tap), strconv.Itoa(keg))
 }
 
-func (s *PostgresStore) GetBeersLeft() (int, error) {
-	val, err := s.getValue("beers_left")
+func (s *PostgresStore) GetCandidateKeg(tap string) (int, error) {
+	val, err := s.getValue(tapKey("candidate_keg", tap))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(val)
+}
+
+func (s *PostgresStore) SetBeersLeft(tap string, beersLeft int) error {
+	return s.setValue(tapKey("beers_left", tap), strconv.Itoa(beersLeft))
+}
+
+func (s *PostgresStore) GetBeersLeft(tap string) (int, error) {
+	val, err := s.getValue(tapKey("beers_left", tap))
 	if err != nil {
 		return 0, err
 	}
@@ -265,53 +520,83 @@ func (s *PostgresStore) GetBeersTotal() (int, error) {
 	return strconv.Atoi(val)
 }
 
-func (s *PostgresStore) SetIsLow(isLow bool) error {
-	return s.setValue("is_low", strconv.FormatBool(isLow))
+func (s *PostgresStore) SetLitersTotal(litersTotal float64) error {
+	return s.setValue("liters_total", strconv.FormatFloat(litersTotal, 'f', -1, 64))
+}
+
+func (s *PostgresStore) GetLitersTotal() (float64, error) {
+	val, err := s.getValue("liters_total")
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(val, 64)
+}
+
+func (s *PostgresStore) SetIsLow(tap string, isLow bool) error {
+	return s.setValue(tapKey("is_low", tap), strconv.FormatBool(isLow))
 }
 
-func (s *PostgresStore) GetIsLow() (bool, error) {
-	val, err := s.getValue("is_low")
+func (s *PostgresStore) GetIsLow(tap string) (bool, error) {
+	val, err := s.getValue(tapKey("is_low", tap))
 	if err != nil {
 		return false, err
 	}
 	return strconv.ParseBool(val)
 }
 
-func (s *PostgresStore) SetWarehouse(warehouse [5]int) error {
-	val := fmt.Sprintf("%d,%d,%d,%d,%d", warehouse[0], warehouse[1], warehouse[2], warehouse[3], warehouse[4])
-	return s.setValue("warehouse", val)
+func (s *PostgresStore) SetWarehouse(warehouse map[int]int) error {
+	data, err := json.Marshal(warehouse)
+	if err != nil {
+		return fmt.Errorf("failed to marshal warehouse: %w", err)
+	}
+	return s.setValue("warehouse", string(data))
 }
 
-func (s *PostgresStore) GetWarehouse() ([5]int, error) {
+func (s *PostgresStore) GetWarehouse() (map[int]int, error) {
 	val, err := s.getValue("warehouse")
 	if err != nil {
-		return [5]int{0, 0, 0, 0, 0}, err
+		return map[int]int{}, err
+	}
+
+	// legacy format - comma separated amounts of 10l, 15l, 20l, 30l and 50l kegs
+	if !strings.HasPrefix(val, "{") {
+		return parseLegacyWarehouse(val)
+	}
+
+	var warehouse map[int]int
+	if err := json.Unmarshal([]byte(val), &warehouse); err != nil {
+		return map[int]int{}, fmt.Errorf("invalid warehouse format in the storage")
 	}
 
-	var warehouse [5]int
+	return warehouse, nil
+}
+
+func parseLegacyWarehouse(val string) (map[int]int, error) {
+	sizes := []int{10, 15, 20, 30, 50}
 	parts := strings.Split(val, ",")
 
-	if len(parts) != 5 {
-		return [5]int{0, 0, 0, 0, 0}, fmt.Errorf("invalid warehouse format in the storage")
+	if len(parts) != len(sizes) {
+		return map[int]int{}, fmt.Errorf("invalid warehouse format in the storage")
 	}
 
+	warehouse := make(map[int]int, len(sizes))
 	for i, part := range parts {
 		x, err := strconv.Atoi(part)
 		if err != nil {
-			return [5]int{0, 0, 0, 0, 0}, fmt.Errorf("invalid warehouse format in the storage")
+			return map[int]int{}, fmt.Errorf("invalid warehouse format in the storage")
 		}
-		warehouse[i] = x
+		warehouse[sizes[i]] = x
 	}
 
 	return warehouse, nil
 }
 
-func (s *PostgresStore) SetLastOk(lastOk time.Time) error {
-	return s.setValue("last_ok", lastOk.Format(time.RFC3339))
+func (s *PostgresStore) SetLastOk(tap string, lastOk time.Time) error {
+	return s.setValue(tapKey("last_ok", tap), lastOk.Format(time.RFC3339))
 }
 
-func (s *PostgresStore) GetLastOk() (time.Time, error) {
-	val, err := s.getValue("last_ok")
+func (s *PostgresStore) GetLastOk(tap string) (time.Time, error) {
+	val, err := s.getValue(tapKey("last_ok", tap))
 	if err != nil {
 		return time.Time{}, err
 	}
@@ -354,6 +639,40 @@ func (s *PostgresStore) GetIsOpen() (bool, error) {
 	return strconv.ParseBool(val)
 }
 
+func (s *PostgresStore) SetOpenPolicy(policy string) error {
+	if err := s.setValue("open_policy", policy); err != nil {
+		return fmt.Errorf("failed to set open policy: %w", err)
+	}
+
+	return nil
+}
+
+func (s *PostgresStore) GetOpenPolicy() (string, error) {
+	val, err := s.getValue("open_policy")
+	if err != nil {
+		//nolint:nilerr // the policy is not set
+		return "", nil
+	}
+	return val, nil
+}
+
+func (s *PostgresStore) SetOpenOverride(override string) error {
+	if err := s.setValue("open_override", override); err != nil {
+		return fmt.Errorf("failed to set open override: %w", err)
+	}
+
+	return nil
+}
+
+func (s *PostgresStore) GetOpenOverride() (string, error) {
+	val, err := s.getValue("open_override")
+	if err != nil {
+		//nolint:nilerr // the override is not set
+		return "", nil
+	}
+	return val, nil
+}
+
 func (s *PostgresStore) SetTodayBeer(todayBeer string) error {
 	return s.setValue("today_beer", todayBeer)
 }
@@ -439,3 +758,914 @@ func (s *PostgresStore) SetAttendanceIrks(irks map[string]string) error {
 func (s *PostgresStore) GetAttendanceIrks() (map[string]string, error) {
 	return s.getMap("attendance_irks")
 }
+
+func (s *PostgresStore) AddKeg(keg KegRecord) (int64, error) {
+	query := fmt.Sprintf(`
+		INSERT INTO %skegs (size, tapped_at, emptied_at, start_weight, end_weight, beers_poured, end_reason, tap, liters_poured, stock_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id
+	`, tablePrefix)
+
+	var id int64
+	err := s.db.QueryRowContext(
+		s.ctx,
+		query,
+		keg.Size,
+		keg.TappedAt,
+		keg.EmptiedAt,
+		keg.StartWeight,
+		keg.EndWeight,
+		keg.BeersPoured,
+		string(keg.EndReason),
+		keg.Tap,
+		keg.LitersPoured,
+		keg.StockID,
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to add keg: %w", err)
+	}
+
+	return id, nil
+}
+
+func (s *PostgresStore) UpdateKeg(keg KegRecord) error {
+	query := fmt.Sprintf(`
+		UPDATE %skegs
+		SET size = $2, tapped_at = $3, emptied_at = $4, start_weight = $5, end_weight = $6, beers_poured = $7, end_reason = $8, tap = $9,
+			liters_poured = $10, stock_id = $11
+		WHERE id = $1
+	`, tablePrefix)
+
+	res, err := s.db.ExecContext(
+		s.ctx,
+		query,
+		keg.ID,
+		keg.Size,
+		keg.TappedAt,
+		keg.EmptiedAt,
+		keg.StartWeight,
+		keg.EndWeight,
+		keg.BeersPoured,
+		string(keg.EndReason),
+		keg.Tap,
+		keg.LitersPoured,
+		keg.StockID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update keg: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to update keg: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("keg not found: %d", keg.ID)
+	}
+
+	return nil
+}
+
+func (s *PostgresStore) GetKegs(tap string, limit int) ([]KegRecord, error) {
+	query := fmt.Sprintf(`
+		SELECT id, tap, size, tapped_at, emptied_at, start_weight, end_weight, beers_poured, end_reason, liters_poured, stock_id
+		FROM %skegs
+		WHERE $1 = '' OR tap = $1
+		ORDER BY tapped_at DESC, id DESC
+		LIMIT $2
+	`, tablePrefix)
+	rows, err := s.db.QueryContext(s.ctx, query, tap, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get kegs: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	kegs := []KegRecord{}
+	for rows.Next() {
+		var keg KegRecord
+		var emptiedAt sql.NullTime
+		var endReason string
+		err := rows.Scan(
+			&keg.ID,
+			&keg.Tap,
+			&keg.Size,
+			&keg.TappedAt,
+			&emptiedAt,
+			&keg.StartWeight,
+			&keg.EndWeight,
+			&keg.BeersPoured,
+			&endReason,
+			&keg.LitersPoured,
+			&keg.StockID,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan keg: %w", err)
+		}
+		if emptiedAt.Valid {
+			keg.EmptiedAt = &emptiedAt.Time
+		}
+		keg.EndReason = KegEndReason(endReason)
+		kegs = append(kegs, keg)
+	}
+
+	return kegs, rows.Err()
+}
+
+func (s *PostgresStore) GetKegTypes() ([]KegType, error) {
+	query := fmt.Sprintf(`
+		SELECT size, empty_weight, label, supplier, serving_size, servings, yield, density, deposit
+		FROM %skeg_types
+		ORDER BY size ASC
+	`, tablePrefix)
+	rows, err := s.db.QueryContext(s.ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get keg types: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	types := []KegType{}
+	for rows.Next() {
+		var kt KegType
+		err := rows.Scan(
+			&kt.Size,
+			&kt.EmptyWeight,
+			&kt.Label,
+			&kt.Supplier,
+			&kt.ServingSize,
+			pq.Array(&kt.Servings),
+			&kt.Yield,
+			&kt.Density,
+			&kt.Deposit,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan keg type: %w", err)
+		}
+		types = append(types, kt)
+	}
+
+	return types, rows.Err()
+}
+
+func (s *PostgresStore) SetKegType(kegType KegType) error {
+	servings := kegType.Servings
+	if servings == nil {
+		servings = []float64{} // nil array is NULL
+	}
+
+	query := fmt.Sprintf(`
+		INSERT INTO %skeg_types (size, empty_weight, label, supplier, serving_size, servings, yield, density, deposit)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (size) DO UPDATE SET empty_weight = $2, label = $3, supplier = $4,
+			serving_size = $5, servings = $6, yield = $7, density = $8, deposit = $9
+	`, tablePrefix)
+	_, err := s.db.ExecContext(
+		s.ctx,
+		query,
+		kegType.Size,
+		kegType.EmptyWeight,
+		kegType.Label,
+		kegType.Supplier,
+		kegType.ServingSize,
+		pq.Array(servings),
+		kegType.Yield,
+		kegType.Density,
+		kegType.Deposit,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set keg type: %w", err)
+	}
+
+	return nil
+}
+
+func (s *PostgresStore) DeleteKegType(size int) error {
+	query := fmt.Sprintf("DELETE FROM %skeg_types WHERE size = $1", tablePrefix)
+	if _, err := s.db.ExecContext(s.ctx, query, size); err != nil {
+		return fmt.Errorf("failed to delete keg type: %w", err)
+	}
+
+	return nil
+}
+
+// AddMeasurement stores the raw measurement and updates all its rollups in one transaction
+func (s *PostgresStore) AddMeasurement(m Measurement) error {
+	tx, err := s.db.BeginTx(s.ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	query := fmt.Sprintf(`
+		INSERT INTO %smeasurements (tap, at, weight, active_keg, beers_left)
+		VALUES ($1, $2, $3, $4, $5)
+	`, tablePrefix)
+	if _, err = tx.ExecContext(s.ctx, query, m.Tap, m.At, m.Weight, m.ActiveKeg, m.BeersLeft); err != nil {
+		return fmt.Errorf("failed to add measurement: %w", err)
+	}
+
+	// the last values win, even when measurements come out of order
+	rollupQuery := fmt.Sprintf(`
+		INSERT INTO %[1]smeasurement_rollups AS r
+			(tap, resolution, bucket, count, weight_sum, weight_min, weight_max, active_keg, beers_left, last_at)
+		VALUES ($1, $2, $3, 1, $4, $4, $4, $5, $6, $7)
+		ON CONFLICT (tap, resolution, bucket) DO UPDATE SET
+			count = r.count + 1,
+			weight_sum = r.weight_sum + EXCLUDED.weight_sum,
+			weight_min = LEAST(r.weight_min, EXCLUDED.weight_min),
+			weight_max = GREATEST(r.weight_max, EXCLUDED.weight_max),
+			active_keg = CASE WHEN EXCLUDED.last_at >= r.last_at THEN EXCLUDED.active_keg ELSE r.active_keg END,
+			beers_left = CASE WHEN EXCLUDED.last_at >= r.last_at THEN EXCLUDED.beers_left ELSE r.beers_left END,
+			last_at = GREATEST(r.last_at, EXCLUDED.last_at)
+	`, tablePrefix)
+	for _, resolution := range MeasurementResolutions {
+		bucket := resolution.Bucket(m.At)
+		_, err = tx.ExecContext(s.ctx, rollupQuery, m.Tap, string(resolution), bucket, m.Weight, m.ActiveKeg, m.BeersLeft, m.At)
+		if err != nil {
+			return fmt.Errorf("failed to update %s measurement rollup: %w", resolution, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit measurement: %w", err)
+	}
+
+	return nil
+}
+
+func (s *PostgresStore) GetMeasurementRollups(
+	tap string,
+	resolution MeasurementResolution,
+	from, to time.Time,
+) ([]MeasurementRollup, error) {
+	query := fmt.Sprintf(`
+		SELECT * FROM (
+			(
+				SELECT tap, resolution, bucket, count, weight_sum, weight_min, weight_max, active_keg, beers_left, last_at
+				FROM %[1]smeasurement_rollups
+				WHERE tap = $1 AND resolution = $2 AND bucket < $3
+				ORDER BY bucket DESC
+				LIMIT 1
+			)
+			UNION ALL
+			(
+				SELECT tap, resolution, bucket, count, weight_sum, weight_min, weight_max, active_keg, beers_left, last_at
+				FROM %[1]smeasurement_rollups
+				WHERE tap = $1 AND resolution = $2 AND bucket >= $3 AND bucket <= $4
+			)
+		) rollups
+		ORDER BY bucket ASC
+	`, tablePrefix)
+	rows, err := s.db.QueryContext(s.ctx, query, tap, string(resolution), from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get measurement rollups: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	rollups := []MeasurementRollup{}
+	for rows.Next() {
+		var r MeasurementRollup
+		var res string
+		var weightSum float64
+		err := rows.Scan(
+			&r.Tap,
+			&res,
+			&r.Bucket,
+			&r.Count,
+			&weightSum,
+			&r.WeightMin,
+			&r.WeightMax,
+			&r.ActiveKeg,
+			&r.BeersLeft,
+			&r.LastAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan measurement rollup: %w", err)
+		}
+		r.Resolution = MeasurementResolution(res)
+		if r.Count > 0 {
+			r.WeightAvg = weightSum / float64(r.Count)
+		}
+		rollups = append(rollups, r)
+	}
+
+	return rollups, rows.Err()
+}
+
+func (s *PostgresStore) AddCalibration(c Calibration) (int64, error) {
+	query := fmt.Sprintf(`
+		INSERT INTO %scalibrations (tap, "offset", gain, tare_raw, tare_weight, reference_raw, reference_weight, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id
+	`, tablePrefix)
+
+	var id int64
+	err := s.db.QueryRowContext(
+		s.ctx,
+		query,
+		c.Tap,
+		c.Offset,
+		c.Gain,
+		c.TareRaw,
+		c.TareWeight,
+		c.ReferenceRaw,
+		c.ReferenceWeight,
+		c.CreatedAt,
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to add calibration: %w", err)
+	}
+
+	return id, nil
+}
+
+func (s *PostgresStore) GetCalibrations(tap string, limit int) ([]Calibration, error) {
+	query := fmt.Sprintf(`
+		SELECT id, tap, "offset", gain, tare_raw, tare_weight, reference_raw, reference_weight, created_at
+		FROM %scalibrations
+		WHERE tap = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2
+	`, tablePrefix)
+	rows, err := s.db.QueryContext(s.ctx, query, tap, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get calibrations: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	calibrations := []Calibration{}
+	for rows.Next() {
+		var c Calibration
+		err := rows.Scan(
+			&c.ID,
+			&c.Tap,
+			&c.Offset,
+			&c.Gain,
+			&c.TareRaw,
+			&c.TareWeight,
+			&c.ReferenceRaw,
+			&c.ReferenceWeight,
+			&c.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan calibration: %w", err)
+		}
+		calibrations = append(calibrations, c)
+	}
+
+	return calibrations, rows.Err()
+}
+
+func (s *PostgresStore) AddPubSession(session PubSession) (int64, error) {
+	query := fmt.Sprintf(`
+		INSERT INTO %ssessions (opened_at, closed_at, beers_poured, kegs_tapped, peak_attendance, income)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`, tablePrefix)
+
+	var id int64
+	err := s.db.QueryRowContext(
+		s.ctx,
+		query,
+		session.OpenedAt,
+		session.ClosedAt,
+		session.BeersPoured,
+		session.KegsTapped,
+		session.PeakAttendance,
+		session.Income,
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to add pub session: %w", err)
+	}
+
+	return id, nil
+}
+
+func (s *PostgresStore) UpdatePubSession(session PubSession) error {
+	query := fmt.Sprintf(`
+		UPDATE %ssessions
+		SET opened_at = $2, closed_at = $3, beers_poured = $4, kegs_tapped = $5, peak_attendance = $6, income = $7
+		WHERE id = $1
+	`, tablePrefix)
+
+	res, err := s.db.ExecContext(
+		s.ctx,
+		query,
+		session.ID,
+		session.OpenedAt,
+		session.ClosedAt,
+		session.BeersPoured,
+		session.KegsTapped,
+		session.PeakAttendance,
+		session.Income,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update pub session: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to update pub session: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("pub session not found: %d", session.ID)
+	}
+
+	return nil
+}
+
+func (s *PostgresStore) GetPubSessions(limit int) ([]PubSession, error) {
+	query := fmt.Sprintf(`
+		SELECT id, opened_at, closed_at, beers_poured, kegs_tapped, peak_attendance, income
+		FROM %ssessions
+		ORDER BY opened_at DESC, id DESC
+		LIMIT $1
+	`, tablePrefix)
+	rows, err := s.db.QueryContext(s.ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pub sessions: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	sessions := []PubSession{}
+	for rows.Next() {
+		var session PubSession
+		var closedAt sql.NullTime
+		err := rows.Scan(
+			&session.ID,
+			&session.OpenedAt,
+			&closedAt,
+			&session.BeersPoured,
+			&session.KegsTapped,
+			&session.PeakAttendance,
+			&session.Income,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan pub session: %w", err)
+		}
+		if closedAt.Valid {
+			session.ClosedAt = &closedAt.Time
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+func (s *PostgresStore) AddStockKeg(keg StockKeg) (int64, error) {
+	query := fmt.Sprintf(`
+		INSERT INTO %sstock_kegs (size, brand, style, supplier, price, purchased_at, best_before, out_at, out_reason, tap, note, deposit)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		RETURNING id
+	`, tablePrefix)
+
+	var id int64
+	err := s.db.QueryRowContext(
+		s.ctx,
+		query,
+		keg.Size,
+		keg.Brand,
+		keg.Style,
+		keg.Supplier,
+		keg.Price,
+		keg.PurchasedAt,
+		keg.BestBefore,
+		keg.OutAt,
+		string(keg.OutReason),
+		keg.Tap,
+		keg.Note,
+		keg.Deposit,
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to add stock keg: %w", err)
+	}
+
+	return id, nil
+}
+
+func (s *PostgresStore) UpdateStockKeg(keg StockKeg) error {
+	query := fmt.Sprintf(`
+		UPDATE %sstock_kegs
+		SET size = $2, brand = $3, style = $4, supplier = $5, price = $6, purchased_at = $7, best_before = $8,
+			out_at = $9, out_reason = $10, tap = $11, note = $12, deposit = $13
+		WHERE id = $1
+	`, tablePrefix)
+
+	res, err := s.db.ExecContext(
+		s.ctx,
+		query,
+		keg.ID,
+		keg.Size,
+		keg.Brand,
+		keg.Style,
+		keg.Supplier,
+		keg.Price,
+		keg.PurchasedAt,
+		keg.BestBefore,
+		keg.OutAt,
+		string(keg.OutReason),
+		keg.Tap,
+		keg.Note,
+		keg.Deposit,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update stock keg: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to update stock keg: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("stock keg not found: %d", keg.ID)
+	}
+
+	return nil
+}
+
+func (s *PostgresStore) GetStockKegs(inStock bool) ([]StockKeg, error) {
+	query := fmt.Sprintf(`
+		SELECT id, size, brand, style, supplier, price, purchased_at, best_before, out_at, out_reason, tap, note, deposit
+		FROM %sstock_kegs
+		WHERE NOT $1 OR out_at IS NULL
+		ORDER BY purchased_at ASC, id ASC
+	`, tablePrefix)
+	rows, err := s.db.QueryContext(s.ctx, query, inStock)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stock kegs: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	kegs := []StockKeg{}
+	for rows.Next() {
+		var keg StockKeg
+		var bestBefore, outAt sql.NullTime
+		var outReason string
+		err := rows.Scan(
+			&keg.ID,
+			&keg.Size,
+			&keg.Brand,
+			&keg.Style,
+			&keg.Supplier,
+			&keg.Price,
+			&keg.PurchasedAt,
+			&bestBefore,
+			&outAt,
+			&outReason,
+			&keg.Tap,
+			&keg.Note,
+			&keg.Deposit,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan stock keg: %w", err)
+		}
+		if bestBefore.Valid {
+			keg.BestBefore = &bestBefore.Time
+		}
+		if outAt.Valid {
+			keg.OutAt = &outAt.Time
+		}
+		keg.OutReason = StockOutReason(outReason)
+		kegs = append(kegs, keg)
+	}
+
+	return kegs, rows.Err()
+}
+
+func (s *PostgresStore) AddWarehouseChange(change WarehouseChange) (int64, error) {
+	query := fmt.Sprintf(`
+		INSERT INTO %swarehouse_changes (size, delta, kind, stock_id, source, actor, reason, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id
+	`, tablePrefix)
+
+	var id int64
+	err := s.db.QueryRowContext(
+		s.ctx,
+		query,
+		change.Size,
+		change.Delta,
+		string(change.Kind),
+		change.StockID,
+		string(change.Source),
+		change.Actor,
+		change.Reason,
+		change.CreatedAt,
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to add warehouse change: %w", err)
+	}
+
+	return id, nil
+}
+
+func (s *PostgresStore) GetWarehouseChanges(limit int) ([]WarehouseChange, error) {
+	query := fmt.Sprintf(`
+		SELECT id, size, delta, kind, stock_id, source, actor, reason, created_at
+		FROM %swarehouse_changes
+		ORDER BY created_at DESC, id DESC
+		LIMIT $1
+	`, tablePrefix)
+	rows, err := s.db.QueryContext(s.ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get warehouse changes: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	changes := []WarehouseChange{}
+	for rows.Next() {
+		var change WarehouseChange
+		var kind, source string
+		err := rows.Scan(
+			&change.ID,
+			&change.Size,
+			&change.Delta,
+			&kind,
+			&change.StockID,
+			&source,
+			&change.Actor,
+			&change.Reason,
+			&change.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan warehouse change: %w", err)
+		}
+		change.Kind = WarehouseChangeKind(kind)
+		change.Source = WarehouseSource(source)
+		changes = append(changes, change)
+	}
+
+	return changes, rows.Err()
+}
+
+func (s *PostgresStore) AddEmptyKeg(keg EmptyKeg) (int64, error) {
+	query := fmt.Sprintf(`
+		INSERT INTO %sempty_kegs (size, stock_id, keg_id, tap, supplier, deposit, emptied_at, returned_at, refund, note)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id
+	`, tablePrefix)
+
+	var id int64
+	err := s.db.QueryRowContext(
+		s.ctx,
+		query,
+		keg.Size,
+		keg.StockID,
+		keg.KegID,
+		keg.Tap,
+		keg.Supplier,
+		keg.Deposit,
+		keg.EmptiedAt,
+		keg.ReturnedAt,
+		keg.Refund,
+		keg.Note,
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to add empty keg: %w", err)
+	}
+
+	return id, nil
+}
+
+// UpdateEmptyKegs updates all kegs in one transaction, nothing is changed when any of them fails
+func (s *PostgresStore) UpdateEmptyKegs(kegs []EmptyKeg) error {
+	tx, err := s.db.BeginTx(s.ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	query := fmt.Sprintf(`
+		UPDATE %sempty_kegs
+		SET size = $2, stock_id = $3, keg_id = $4, tap = $5, supplier = $6, deposit = $7, emptied_at = $8,
+			returned_at = $9, refund = $10, note = $11
+		WHERE id = $1
+	`, tablePrefix)
+
+	for _, keg := range kegs {
+		res, err := tx.ExecContext(
+			s.ctx,
+			query,
+			keg.ID,
+			keg.Size,
+			keg.StockID,
+			keg.KegID,
+			keg.Tap,
+			keg.Supplier,
+			keg.Deposit,
+			keg.EmptiedAt,
+			keg.ReturnedAt,
+			keg.Refund,
+			keg.Note,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to update empty keg: %w", err)
+		}
+
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to update empty keg: %w", err)
+		}
+		if affected == 0 {
+			return fmt.Errorf("empty keg not found: %d", keg.ID)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit empty kegs: %w", err)
+	}
+
+	return nil
+}
+
+func (s *PostgresStore) GetEmptyKegs(awaiting bool) ([]EmptyKeg, error) {
+	query := fmt.Sprintf(`
+		SELECT id, size, stock_id, keg_id, tap, supplier, deposit, emptied_at, returned_at, refund, note
+		FROM %sempty_kegs
+		WHERE NOT $1 OR returned_at IS NULL
+		ORDER BY emptied_at ASC, id ASC
+	`, tablePrefix)
+	rows, err := s.db.QueryContext(s.ctx, query, awaiting)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get empty kegs: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	kegs := []EmptyKeg{}
+	for rows.Next() {
+		var keg EmptyKeg
+		var returnedAt sql.NullTime
+		err := rows.Scan(
+			&keg.ID,
+			&keg.Size,
+			&keg.StockID,
+			&keg.KegID,
+			&keg.Tap,
+			&keg.Supplier,
+			&keg.Deposit,
+			&keg.EmptiedAt,
+			&returnedAt,
+			&keg.Refund,
+			&keg.Note,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan empty keg: %w", err)
+		}
+		if returnedAt.Valid {
+			keg.ReturnedAt = &returnedAt.Time
+		}
+		kegs = append(kegs, keg)
+	}
+
+	return kegs, rows.Err()
+}
+
+func (s *PostgresStore) AddBankTransactions(transactions []BankTransaction) (int, error) {
+	tx, err := s.db.BeginTx(s.ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	query := fmt.Sprintf(`
+		INSERT INTO %sbank_transactions (id, date, amount, currency, account, account_name, bank_name, bank_code,
+			constant_symbol, variable_symbol, specific_symbol, user_identification, recipient_message, type,
+			specification, comment, bic, order_id, payer_reference)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)
+		ON CONFLICT (id) DO NOTHING
+	`, tablePrefix)
+
+	added := 0
+	for _, t := range transactions {
+		res, err := tx.ExecContext(
+			s.ctx,
+			query,
+			t.ID,
+			t.Date,
+			t.Amount,
+			t.Currency,
+			t.Account,
+			t.AccountName,
+			t.BankName,
+			t.BankCode,
+			t.ConstantSymbol,
+			t.VariableSymbol,
+			t.SpecificSymbol,
+			t.UserIdentification,
+			t.RecipientMessage,
+			t.Type,
+			t.Specification,
+			t.Comment,
+			t.BIC,
+			t.OrderID,
+			t.PayerReference,
+		)
+		if err != nil {
+			return 0, fmt.Errorf("failed to add bank transaction %d: %w", t.ID, err)
+		}
+
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return 0, fmt.Errorf("failed to add bank transaction %d: %w", t.ID, err)
+		}
+		added += int(affected)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit bank transactions: %w", err)
+	}
+
+	return added, nil
+}
+
+func (s *PostgresStore) GetBankTransactions(from, to time.Time) ([]BankTransaction, error) {
+	query := fmt.Sprintf(`
+		SELECT id, date, amount, currency, account, account_name, bank_name, bank_code, constant_symbol,
+			variable_symbol, specific_symbol, user_identification, recipient_message, type, specification,
+			comment, bic, order_id, payer_reference
+		FROM %sbank_transactions
+		WHERE date >= $1 AND date < $2
+		ORDER BY date ASC, id ASC
+	`, tablePrefix)
+	rows, err := s.db.QueryContext(s.ctx, query, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bank transactions: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	transactions := []BankTransaction{}
+	for rows.Next() {
+		var t BankTransaction
+		err := rows.Scan(
+			&t.ID,
+			&t.Date,
+			&t.Amount,
+			&t.Currency,
+			&t.Account,
+			&t.AccountName,
+			&t.BankName,
+			&t.BankCode,
+			&t.ConstantSymbol,
+			&t.VariableSymbol,
+			&t.SpecificSymbol,
+			&t.UserIdentification,
+			&t.RecipientMessage,
+			&t.Type,
+			&t.Specification,
+			&t.Comment,
+			&t.BIC,
+			&t.OrderID,
+			&t.PayerReference,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan bank transaction: %w", err)
+		}
+		transactions = append(transactions, t)
+	}
+
+	return transactions, rows.Err()
+}
+
+func (s *PostgresStore) SetBankSync(sync BankSync) error {
+	data, err := json.Marshal(sync)
+	if err != nil {
+		return fmt.Errorf("failed to marshal bank sync: %w", err)
+	}
+
+	if err := s.setValue("bank_sync", string(data)); err != nil {
+		return fmt.Errorf("failed to set bank sync: %w", err)
+	}
+
+	return nil
+}
+
+func (s *PostgresStore) GetBankSync() (BankSync, error) {
+	val, err := s.getValue("bank_sync")
+	if err != nil {
+		//nolint:nilerr // the bank was never synced
+		return BankSync{}, nil
+	}
+
+	var sync BankSync
+	if err := json.Unmarshal([]byte(val), &sync); err != nil {
+		return BankSync{}, fmt.Errorf("failed to unmarshal bank sync: %w", err)
+	}
+
+	return sync, nil
+}
+
+func (s *PostgresStore) SetBankBalance(balance string) error {
+	if err := s.setValue("bank_balance", balance); err != nil {
+		return fmt.Errorf("failed to set bank balance: %w", err)
+	}
+
+	return nil
+}
+
+func (s *PostgresStore) GetBankBalance() (string, error) {
+	val, err := s.getValue("bank_balance")
+	if err != nil {
+		//nolint:nilerr // the balance is not known yet
+		return "", nil
+	}
+	return val, nil
+}
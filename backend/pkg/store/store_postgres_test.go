@@ -2,11 +2,14 @@ package store
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"testing"
 	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/kotrzina/keg-scale/pkg/utils"
+	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -44,6 +47,16 @@ func cleanupTables(t *testing.T, s *PostgresStore) {
 		"DELETE FROM " + tablePrefix + "events",
 		"DELETE FROM " + tablePrefix + "kv",
 		"DELETE FROM " + tablePrefix + "conversation_messages",
+		"DELETE FROM " + tablePrefix + "kegs",
+		"DELETE FROM " + tablePrefix + "keg_types",
+		"DELETE FROM " + tablePrefix + "measurements",
+		"DELETE FROM " + tablePrefix + "measurement_rollups",
+		"DELETE FROM " + tablePrefix + "calibrations",
+		"DELETE FROM " + tablePrefix + "sessions",
+		"DELETE FROM " + tablePrefix + "stock_kegs",
+		"DELETE FROM " + tablePrefix + "warehouse_changes",
+		"DELETE FROM " + tablePrefix + "empty_kegs",
+		"DELETE FROM " + tablePrefix + "bank_transactions",
 	}
 
 	for _, query := range queries {
@@ -57,50 +70,87 @@ func TestPostgresStore_Events(t *testing.T) {
 	store := setupTestStore(t)
 
 	// Initially empty
-	events, err := store.GetEvents()
+	events, err := store.GetEvents(EventFilter{})
 	require.NoError(t, err)
 	assert.Empty(t, events)
 
 	// Add events
-	require.NoError(t, store.AddEvent("event1"))
-	require.NoError(t, store.AddEvent("event2"))
-	require.NoError(t, store.AddEvent("event3"))
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+	records := []EventRecord{
+		{Type: "pub_open", At: base, Data: []byte(`{"reason":"forced"}`)},
+		{Type: "pour", At: base.Add(time.Minute), Tap: DefaultTap, Data: []byte(`{"weight":30000}`)},
+		{Type: "pour", At: base.Add(2 * time.Minute), Tap: "left", Data: []byte(`{"weight":20000}`)},
+		{Type: "pub_close", At: base.Add(3 * time.Minute), Data: []byte(`{}`)},
+	}
+	ids := make([]int64, len(records))
+	for i, record := range records {
+		ids[i], err = store.AddEvent(record)
+		require.NoError(t, err)
+	}
+
+	// Newest first
+	events, err = store.GetEvents(EventFilter{})
+	require.NoError(t, err)
+	require.Len(t, events, 4)
+	assert.Equal(t, ids[3], events[0].ID)
+	assert.Equal(t, "pub_close", events[0].Type)
+	assert.True(t, base.Equal(events[3].At))
+	assert.JSONEq(t, `{"reason":"forced"}`, string(events[3].Data))
+
+	// Filter by type and tap
+	events, err = store.GetEvents(EventFilter{Types: []string{"pour"}, Tap: "left"})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, ids[2], events[0].ID)
 
-	events, err = store.GetEvents()
+	// Filter by time
+	events, err = store.GetEvents(EventFilter{From: base.Add(time.Minute), To: base.Add(3 * time.Minute)})
 	require.NoError(t, err)
-	assert.Len(t, events, 3)
-	assert.Equal(t, []string{"event1", "event2", "event3"}, events)
+	require.Len(t, events, 2)
+
+	// Pagination
+	events, err = store.GetEvents(EventFilter{Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	events, err = store.GetEvents(EventFilter{Limit: 2, BeforeID: events[1].ID})
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, ids[0], events[1].ID)
 }
 
-func TestPostgresStore_EventsLimit(t *testing.T) {
+func TestPostgresStore_EventsRetention(t *testing.T) {
 	store := setupTestStore(t)
 
-	// Add more than 500 events
-	for i := 0; i < 510; i++ {
-		require.NoError(t, store.AddEvent("event"))
+	_, err := store.AddEvent(EventRecord{Type: "pub_open", At: time.Now(), Data: []byte(`{}`)})
+	require.NoError(t, err)
+	for range eventsLimit {
+		_, err = store.AddEvent(EventRecord{Type: "pub_close", At: time.Now(), Data: []byte(`{}`)})
+		require.NoError(t, err)
 	}
 
-	events, err := store.GetEvents()
+	require.NoError(t, store.Prune())
+	events, err := store.GetEvents(EventFilter{Limit: eventsLimit + 1})
 	require.NoError(t, err)
-	assert.Len(t, events, 500)
+	require.Len(t, events, eventsLimit)
+	assert.Equal(t, "pub_close", events[eventsLimit-1].Type, "the oldest event is deleted")
 }
 
 func TestPostgresStore_Weight(t *testing.T) {
 	store := setupTestStore(t)
 
 	// Get weight when not set
-	_, err := store.GetWeight()
+	_, err := store.GetWeight(DefaultTap)
 	require.Error(t, err)
 
 	// Set and get weight
-	require.NoError(t, store.SetWeight(42.5))
-	weight, err := store.GetWeight()
+	require.NoError(t, store.SetWeight(DefaultTap, 42.5))
+	weight, err := store.GetWeight(DefaultTap)
 	require.NoError(t, err)
 	assert.InEpsilon(t, 42.5, weight, 0.0001)
 
 	// Update weight
-	require.NoError(t, store.SetWeight(100.25))
-	weight, err = store.GetWeight()
+	require.NoError(t, store.SetWeight(DefaultTap, 100.25))
+	weight, err = store.GetWeight(DefaultTap)
 	require.NoError(t, err)
 	assert.InEpsilon(t, 100.25, weight, 0.0001)
 }
@@ -109,13 +159,13 @@ func TestPostgresStore_WeightAt(t *testing.T) {
 	store := setupTestStore(t)
 
 	// Get weight at when not set
-	_, err := store.GetWeightAt()
+	_, err := store.GetWeightAt(DefaultTap)
 	require.Error(t, err)
 
 	// Set and get weight at
 	now := time.Now().Truncate(time.Second)
-	require.NoError(t, store.SetWeightAt(now))
-	weightAt, err := store.GetWeightAt()
+	require.NoError(t, store.SetWeightAt(DefaultTap, now))
+	weightAt, err := store.GetWeightAt(DefaultTap)
 	require.NoError(t, err)
 	assert.Equal(t, now.UTC(), weightAt.UTC())
 }
@@ -124,18 +174,18 @@ func TestPostgresStore_ActiveKeg(t *testing.T) {
 	store := setupTestStore(t)
 
 	// Get active keg when not set
-	_, err := store.GetActiveKeg()
+	_, err := store.GetActiveKeg(DefaultTap)
 	require.Error(t, err)
 
 	// Set and get active keg
-	require.NoError(t, store.SetActiveKeg(50))
-	activeKeg, err := store.GetActiveKeg()
+	require.NoError(t, store.SetActiveKeg(DefaultTap, 50))
+	activeKeg, err := store.GetActiveKeg(DefaultTap)
 	require.NoError(t, err)
 	assert.Equal(t, 50, activeKeg)
 
 	// Update active keg
-	require.NoError(t, store.SetActiveKeg(30))
-	activeKeg, err = store.GetActiveKeg()
+	require.NoError(t, store.SetActiveKeg(DefaultTap, 30))
+	activeKeg, err = store.GetActiveKeg(DefaultTap)
 	require.NoError(t, err)
 	assert.Equal(t, 30, activeKeg)
 }
@@ -144,13 +194,13 @@ func TestPostgresStore_ActiveKegAt(t *testing.T) {
 	store := setupTestStore(t)
 
 	// Get active keg at when not set
-	_, err := store.GetActiveKegAt()
+	_, err := store.GetActiveKegAt(DefaultTap)
 	require.Error(t, err)
 
 	// Set and get active keg at
 	now := time.Now().Truncate(time.Second)
-	require.NoError(t, store.SetActiveKegAt(now))
-	activeKegAt, err := store.GetActiveKegAt()
+	require.NoError(t, store.SetActiveKegAt(DefaultTap, now))
+	activeKegAt, err := store.GetActiveKegAt(DefaultTap)
 	require.NoError(t, err)
 	assert.Equal(t, now.UTC(), activeKegAt.UTC())
 }
@@ -159,12 +209,12 @@ func TestPostgresStore_BeersLeft(t *testing.T) {
 	store := setupTestStore(t)
 
 	// Get beers left when not set
-	_, err := store.GetBeersLeft()
+	_, err := store.GetBeersLeft(DefaultTap)
 	require.Error(t, err)
 
 	// Set and get beers left
-	require.NoError(t, store.SetBeersLeft(100))
-	beersLeft, err := store.GetBeersLeft()
+	require.NoError(t, store.SetBeersLeft(DefaultTap, 100))
+	beersLeft, err := store.GetBeersLeft(DefaultTap)
 	require.NoError(t, err)
 	assert.Equal(t, 100, beersLeft)
 }
@@ -183,26 +233,58 @@ func TestPostgresStore_BeersTotal(t *testing.T) {
 	assert.Equal(t, 200, beersTotal)
 }
 
+func TestPostgresStore_LitersTotal(t *testing.T) {
+	store := setupTestStore(t)
+
+	// Get liters total when not set
+	_, err := store.GetLitersTotal()
+	require.Error(t, err)
+
+	// Set and get liters total
+	require.NoError(t, store.SetLitersTotal(1234.5))
+	litersTotal, err := store.GetLitersTotal()
+	require.NoError(t, err)
+	assert.InEpsilon(t, 1234.5, litersTotal, 0.0001)
+}
+
 func TestPostgresStore_IsLow(t *testing.T) {
 	store := setupTestStore(t)
 
 	// Get is low when not set
-	_, err := store.GetIsLow()
+	_, err := store.GetIsLow(DefaultTap)
 	require.Error(t, err)
 
 	// Set and get is low
-	require.NoError(t, store.SetIsLow(true))
-	isLow, err := store.GetIsLow()
+	require.NoError(t, store.SetIsLow(DefaultTap, true))
+	isLow, err := store.GetIsLow(DefaultTap)
 	require.NoError(t, err)
 	assert.True(t, isLow)
 
 	// Update is low
-	require.NoError(t, store.SetIsLow(false))
-	isLow, err = store.GetIsLow()
+	require.NoError(t, store.SetIsLow(DefaultTap, false))
+	isLow, err = store.GetIsLow(DefaultTap)
 	require.NoError(t, err)
 	assert.False(t, isLow)
 }
 
+func TestPostgresStore_OpenOverride(t *testing.T) {
+	store := setupTestStore(t)
+
+	override, err := store.GetOpenOverride()
+	require.NoError(t, err)
+	assert.Empty(t, override)
+
+	require.NoError(t, store.SetOpenOverride(`{"action":"skip","until":"2025-03-14T20:00:00Z"}`))
+	override, err = store.GetOpenOverride()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"action":"skip","until":"2025-03-14T20:00:00Z"}`, override)
+
+	require.NoError(t, store.SetOpenOverride(""))
+	override, err = store.GetOpenOverride()
+	require.NoError(t, err)
+	assert.Empty(t, override)
+}
+
 func TestPostgresStore_IsOpen(t *testing.T) {
 	store := setupTestStore(t)
 
@@ -231,31 +313,40 @@ func TestPostgresStore_Warehouse(t *testing.T) {
 	require.Error(t, err)
 
 	// Set and get warehouse
-	warehouse := [5]int{10, 20, 30, 40, 50}
+	warehouse := map[int]int{10: 10, 15: 20, 20: 30, 30: 40, 50: 50}
 	require.NoError(t, store.SetWarehouse(warehouse))
 	result, err := store.GetWarehouse()
 	require.NoError(t, err)
 	assert.Equal(t, warehouse, result)
 
 	// Update warehouse
-	warehouse2 := [5]int{1, 2, 3, 4, 5}
+	warehouse2 := map[int]int{5: 1, 25: 2, 50: 5}
 	require.NoError(t, store.SetWarehouse(warehouse2))
 	result, err = store.GetWarehouse()
 	require.NoError(t, err)
 	assert.Equal(t, warehouse2, result)
 }
 
+func TestPostgresStore_WarehouseLegacy(t *testing.T) {
+	store := setupTestStore(t)
+
+	require.NoError(t, store.setValue("warehouse", "1,2,3,4,5"))
+	result, err := store.GetWarehouse()
+	require.NoError(t, err)
+	assert.Equal(t, map[int]int{10: 1, 15: 2, 20: 3, 30: 4, 50: 5}, result)
+}
+
 func TestPostgresStore_LastOk(t *testing.T) {
 	store := setupTestStore(t)
 
 	// Get last ok when not set
-	_, err := store.GetLastOk()
+	_, err := store.GetLastOk(DefaultTap)
 	require.Error(t, err)
 
 	// Set and get last ok
 	now := time.Now().Truncate(time.Second)
-	require.NoError(t, store.SetLastOk(now))
-	lastOk, err := store.GetLastOk()
+	require.NoError(t, store.SetLastOk(DefaultTap, now))
+	lastOk, err := store.GetLastOk(DefaultTap)
 	require.NoError(t, err)
 	assert.Equal(t, now.UTC(), lastOk.UTC())
 }
@@ -435,14 +526,14 @@ func TestPostgresStore_MigrationsIdempotent(t *testing.T) {
 	}
 
 	// Set some data
-	require.NoError(t, store1.SetWeight(42.0))
+	require.NoError(t, store1.SetWeight(DefaultTap, 42.0))
 
 	// Create another store (simulating restart)
 	store2, err := NewPostgresStore(ctx, dsn)
 	require.NoError(t, err)
 
 	// Data should still be there
-	weight, err := store2.GetWeight()
+	weight, err := store2.GetWeight(DefaultTap)
 	require.NoError(t, err)
 	assert.InEpsilon(t, 42.0, weight, 0.0001)
 
@@ -505,3 +596,568 @@ func TestPostgresStore_AttendanceIrks(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, updatedIrks, irks)
 }
+
+func TestPostgresStore_Kegs(t *testing.T) {
+	store := setupTestStore(t)
+
+	// Initially empty
+	kegs, err := store.GetKegs("", 10)
+	require.NoError(t, err)
+	assert.Empty(t, kegs)
+
+	// Add kegs
+	tappedAt := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	id1, err := store.AddKeg(KegRecord{Size: 50, TappedAt: tappedAt, StartWeight: 63500, EndWeight: 63500})
+	require.NoError(t, err)
+	id2, err := store.AddKeg(KegRecord{Size: 30, TappedAt: tappedAt.Add(24 * time.Hour), StartWeight: 40000, EndWeight: 40000})
+	require.NoError(t, err)
+	assert.NotEqual(t, id1, id2)
+
+	// Close the first keg
+	emptiedAt := tappedAt.Add(20 * time.Hour)
+	require.NoError(t, store.UpdateKeg(KegRecord{
+		ID:           id1,
+		Size:         50,
+		TappedAt:     tappedAt,
+		EmptiedAt:    &emptiedAt,
+		StartWeight:  63500,
+		EndWeight:    13600,
+		BeersPoured:  99,
+		LitersPoured: 49.4,
+		EndReason:    KegEndReasonAuto,
+	}))
+
+	// Newest first
+	kegs, err = store.GetKegs("", 10)
+	require.NoError(t, err)
+	require.Len(t, kegs, 2)
+	assert.Equal(t, id2, kegs[0].ID)
+	assert.Nil(t, kegs[0].EmptiedAt)
+	assert.Empty(t, kegs[0].EndReason)
+
+	assert.Equal(t, id1, kegs[1].ID)
+	require.NotNil(t, kegs[1].EmptiedAt)
+	assert.Equal(t, emptiedAt.UTC(), kegs[1].EmptiedAt.UTC())
+	assert.Equal(t, 99, kegs[1].BeersPoured)
+	assert.InEpsilon(t, 49.4, kegs[1].LitersPoured, 0.0001)
+	assert.Zero(t, kegs[1].StockID)
+	assert.Equal(t, KegEndReasonAuto, kegs[1].EndReason)
+
+	// Limit
+	kegs, err = store.GetKegs("", 1)
+	require.NoError(t, err)
+	assert.Len(t, kegs, 1)
+
+	// Update of unknown keg
+	require.Error(t, store.UpdateKeg(KegRecord{ID: 999999}))
+}
+
+func TestPostgresStore_KegTypes(t *testing.T) {
+	store := setupTestStore(t)
+
+	// Initially empty
+	types, err := store.GetKegTypes()
+	require.NoError(t, err)
+	assert.Empty(t, types)
+
+	// Add keg types
+	require.NoError(t, store.SetKegType(KegType{Size: 25, EmptyWeight: 8500, Label: "25l", Supplier: "maneo", Deposit: decimal.NewFromInt(1500)}))
+	require.NoError(t, store.SetKegType(KegType{
+		Size:        5,
+		EmptyWeight: 4000,
+		Label:       "5l",
+		ServingSize: 0.3,
+		Servings:    []float64{0.3, 0.4},
+		Yield:       0.9,
+		Density:     1.01,
+	}))
+
+	types, err = store.GetKegTypes()
+	require.NoError(t, err)
+	require.Len(t, types, 2)
+	assert.Equal(t, 5, types[0].Size)
+	assert.Equal(t, 25, types[1].Size)
+	assert.Equal(t, "maneo", types[1].Supplier)
+	assert.True(t, decimal.NewFromInt(1500).Equal(types[1].Deposit))
+	assert.True(t, types[0].Deposit.IsZero())
+	assert.InEpsilon(t, 0.3, types[0].ServingSize, 0.0001)
+	assert.Equal(t, []float64{0.3, 0.4}, types[0].Servings)
+	assert.InEpsilon(t, 0.9, types[0].Yield, 0.0001)
+	assert.InEpsilon(t, 1.01, types[0].Density, 0.0001)
+	assert.Empty(t, types[1].Servings)
+
+	// Update keg type
+	require.NoError(t, store.SetKegType(KegType{Size: 25, EmptyWeight: 8700, Label: "25l", Supplier: "baracek"}))
+	types, err = store.GetKegTypes()
+	require.NoError(t, err)
+	require.Len(t, types, 2)
+	assert.InEpsilon(t, 8700.0, types[1].EmptyWeight, 0.0001)
+	assert.Equal(t, "baracek", types[1].Supplier)
+
+	// Delete keg type
+	require.NoError(t, store.DeleteKegType(5))
+	types, err = store.GetKegTypes()
+	require.NoError(t, err)
+	require.Len(t, types, 1)
+	assert.Equal(t, 25, types[0].Size)
+}
+
+func TestPostgresStore_Taps(t *testing.T) {
+	store := setupTestStore(t)
+
+	// Get taps when not set
+	_, err := store.GetTaps()
+	require.Error(t, err)
+
+	require.NoError(t, store.SetTaps([]string{DefaultTap, "second"}))
+	taps, err := store.GetTaps()
+	require.NoError(t, err)
+	assert.Equal(t, []string{DefaultTap, "second"}, taps)
+
+	// values are isolated per tap
+	require.NoError(t, store.SetActiveKeg(DefaultTap, 50))
+	require.NoError(t, store.SetActiveKeg("second", 30))
+	require.NoError(t, store.SetCandidateKeg("second", 15))
+
+	keg, err := store.GetActiveKeg(DefaultTap)
+	require.NoError(t, err)
+	assert.Equal(t, 50, keg)
+
+	keg, err = store.GetActiveKeg("second")
+	require.NoError(t, err)
+	assert.Equal(t, 30, keg)
+
+	keg, err = store.GetCandidateKeg("second")
+	require.NoError(t, err)
+	assert.Equal(t, 15, keg)
+
+	_, err = store.GetCandidateKeg(DefaultTap)
+	require.Error(t, err)
+
+	// default tap keeps the original key
+	val, err := store.getValue("active_keg")
+	require.NoError(t, err)
+	assert.Equal(t, "50", val)
+}
+
+func TestPostgresStore_KegsPerTap(t *testing.T) {
+	store := setupTestStore(t)
+
+	_, err := store.AddKeg(KegRecord{Tap: DefaultTap, Size: 50, TappedAt: time.Now().Add(-time.Hour)})
+	require.NoError(t, err)
+	_, err = store.AddKeg(KegRecord{Tap: "second", Size: 30, TappedAt: time.Now()})
+	require.NoError(t, err)
+
+	kegs, err := store.GetKegs("", 10)
+	require.NoError(t, err)
+	assert.Len(t, kegs, 2)
+
+	kegs, err = store.GetKegs("second", 10)
+	require.NoError(t, err)
+	require.Len(t, kegs, 1)
+	assert.Equal(t, 30, kegs[0].Size)
+	assert.Equal(t, "second", kegs[0].Tap)
+}
+
+func TestPostgresStore_Measurements(t *testing.T) {
+	store := setupTestStore(t)
+
+	base := time.Date(2025, 3, 14, 18, 0, 0, 0, time.UTC)
+	measurements := []Measurement{
+		{Tap: DefaultTap, At: base.Add(1 * time.Minute), Weight: 40000, ActiveKeg: 30, BeersLeft: 60},
+		{Tap: DefaultTap, At: base.Add(3 * time.Minute), Weight: 38000, ActiveKeg: 30, BeersLeft: 56},
+		{Tap: DefaultTap, At: base.Add(2 * time.Minute), Weight: 39000, ActiveKeg: 30, BeersLeft: 58}, // out of order
+		{Tap: DefaultTap, At: base.Add(7 * time.Minute), Weight: 36000, ActiveKeg: 30, BeersLeft: 52},
+		{Tap: "left", At: base.Add(1 * time.Minute), Weight: 60000, ActiveKeg: 50, BeersLeft: 90},
+	}
+	for _, m := range measurements {
+		require.NoError(t, store.AddMeasurement(m))
+	}
+
+	rollups, err := store.GetMeasurementRollups(DefaultTap, MeasurementResolution5m, base, base.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, rollups, 2)
+	assert.True(t, base.Equal(rollups[0].Bucket))
+	assert.Equal(t, 3, rollups[0].Count)
+	assert.InEpsilon(t, 39000.0, rollups[0].WeightAvg, 0.000001)
+	assert.InEpsilon(t, 38000.0, rollups[0].WeightMin, 0.000001)
+	assert.InEpsilon(t, 40000.0, rollups[0].WeightMax, 0.000001)
+	assert.Equal(t, 56, rollups[0].BeersLeft) // the latest measurement wins
+	assert.Equal(t, 52, rollups[1].BeersLeft)
+
+	rollups, err = store.GetMeasurementRollups(DefaultTap, MeasurementResolution1h, base, base.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, rollups, 1)
+	assert.Equal(t, 4, rollups[0].Count)
+	assert.Equal(t, 30, rollups[0].ActiveKeg)
+
+	// the last rollup before the interval is included
+	rollups, err = store.GetMeasurementRollups(DefaultTap, MeasurementResolution5m, base.Add(30*time.Minute), base.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, rollups, 1)
+	assert.Equal(t, 52, rollups[0].BeersLeft)
+
+	rollups, err = store.GetMeasurementRollups("left", MeasurementResolution1d, base, base.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, rollups, 1)
+	assert.Equal(t, 90, rollups[0].BeersLeft)
+
+	// the daily bucket starts at the local midnight, not at the midnight in UTC
+	midnight := time.Date(2025, 3, 15, 0, 0, 0, 0, utils.GetTz())
+	require.NoError(t, store.AddMeasurement(Measurement{Tap: "night", At: midnight.Add(-30 * time.Minute), Weight: 40000, ActiveKeg: 30, BeersLeft: 60}))
+	require.NoError(t, store.AddMeasurement(Measurement{Tap: "night", At: midnight.Add(30 * time.Minute), Weight: 38000, ActiveKeg: 30, BeersLeft: 56}))
+	rollups, err = store.GetMeasurementRollups("night", MeasurementResolution1d, midnight, midnight.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, rollups, 2)
+	assert.True(t, midnight.AddDate(0, 0, -1).Equal(rollups[0].Bucket))
+	assert.True(t, midnight.Equal(rollups[1].Bucket))
+	assert.Equal(t, 1, rollups[1].Count)
+}
+
+func TestPostgresStore_MeasurementsRetention(t *testing.T) {
+	store := setupTestStore(t)
+
+	old := time.Now().Add(-2 * measurementsRetention)
+	require.NoError(t, store.AddMeasurement(Measurement{Tap: DefaultTap, At: old, Weight: 40000, ActiveKeg: 30, BeersLeft: 60}))
+	require.NoError(t, store.AddMeasurement(Measurement{Tap: "left", At: old, Weight: 60000, ActiveKeg: 50, BeersLeft: 90}))
+	require.NoError(t, store.AddMeasurement(Measurement{Tap: DefaultTap, At: time.Now(), Weight: 39000, ActiveKeg: 30, BeersLeft: 58}))
+	require.NoError(t, store.Prune())
+
+	count := func(tap string) int {
+		var n int
+		query := fmt.Sprintf("SELECT COUNT(*) FROM %smeasurements WHERE tap = $1", tablePrefix)
+		require.NoError(t, store.db.QueryRowContext(store.ctx, query, tap).Scan(&n))
+		return n
+	}
+	assert.Equal(t, 1, count(DefaultTap))
+	assert.Equal(t, 0, count("left"))
+
+	// rollups of the deleted measurements are kept
+	rollups, err := store.GetMeasurementRollups(DefaultTap, MeasurementResolution1d, old, old.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, rollups, 1)
+	assert.Equal(t, 60, rollups[0].BeersLeft)
+}
+
+func TestPostgresStore_Calibrations(t *testing.T) {
+	store := setupTestStore(t)
+
+	// Initially empty
+	calibrations, err := store.GetCalibrations(DefaultTap, 10)
+	require.NoError(t, err)
+	assert.Empty(t, calibrations)
+
+	base := time.Date(2025, 3, 14, 18, 0, 0, 0, time.UTC)
+	for i, gain := range []float64{1.1, 0.9} {
+		id, err := store.AddCalibration(Calibration{
+			Tap:             DefaultTap,
+			Offset:          -500,
+			Gain:            gain,
+			TareRaw:         500,
+			ReferenceRaw:    20500,
+			ReferenceWeight: 20000,
+			CreatedAt:       base.Add(time.Duration(i) * time.Hour),
+		})
+		require.NoError(t, err)
+		assert.Positive(t, id)
+	}
+	_, err = store.AddCalibration(Calibration{Tap: "left", Gain: 1, CreatedAt: base})
+	require.NoError(t, err)
+
+	// Newest first, only the requested tap
+	calibrations, err = store.GetCalibrations(DefaultTap, 10)
+	require.NoError(t, err)
+	require.Len(t, calibrations, 2)
+	assert.InEpsilon(t, 0.9, calibrations[0].Gain, 0.000001)
+	assert.InEpsilon(t, 1.1, calibrations[1].Gain, 0.000001)
+	assert.InEpsilon(t, -500.0, calibrations[0].Offset, 0.000001)
+	assert.True(t, base.Add(time.Hour).Equal(calibrations[0].CreatedAt))
+
+	// Limit
+	calibrations, err = store.GetCalibrations(DefaultTap, 1)
+	require.NoError(t, err)
+	require.Len(t, calibrations, 1)
+	assert.InEpsilon(t, 0.9, calibrations[0].Gain, 0.000001)
+}
+
+func TestPostgresStore_PubSessions(t *testing.T) {
+	store := setupTestStore(t)
+
+	// Initially empty
+	sessions, err := store.GetPubSessions(10)
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+
+	base := time.Date(2025, 3, 14, 18, 0, 0, 0, time.UTC)
+	closedAt := base.Add(5 * time.Hour)
+	id, err := store.AddPubSession(PubSession{OpenedAt: base, Income: decimal.Zero})
+	require.NoError(t, err)
+
+	// Close the session with statistics
+	require.NoError(t, store.UpdatePubSession(PubSession{
+		ID:             id,
+		OpenedAt:       base,
+		ClosedAt:       &closedAt,
+		BeersPoured:    42,
+		KegsTapped:     1,
+		PeakAttendance: 12,
+		Income:         decimal.NewFromFloat(1250.50),
+	}))
+	_, err = store.AddPubSession(PubSession{OpenedAt: base.Add(24 * time.Hour), Income: decimal.Zero})
+	require.NoError(t, err)
+
+	// Newest first, open session has no end
+	sessions, err = store.GetPubSessions(10)
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	assert.Nil(t, sessions[0].ClosedAt)
+	require.NotNil(t, sessions[1].ClosedAt)
+	assert.True(t, closedAt.Equal(*sessions[1].ClosedAt))
+	assert.Equal(t, 42, sessions[1].BeersPoured)
+	assert.Equal(t, 12, sessions[1].PeakAttendance)
+	assert.True(t, decimal.NewFromFloat(1250.50).Equal(sessions[1].Income))
+
+	// Limit
+	sessions, err = store.GetPubSessions(1)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+
+	// Unknown session
+	require.Error(t, store.UpdatePubSession(PubSession{ID: 999999, OpenedAt: base}))
+}
+
+func TestPostgresStore_StockKegs(t *testing.T) {
+	store := setupTestStore(t)
+
+	// Initially empty
+	kegs, err := store.GetStockKegs(false)
+	require.NoError(t, err)
+	assert.Empty(t, kegs)
+
+	base := time.Date(2025, 3, 14, 18, 0, 0, 0, time.UTC)
+	bestBefore := base.Add(90 * 24 * time.Hour)
+	id1, err := store.AddStockKeg(StockKeg{
+		Size:        50,
+		Brand:       "Policka",
+		Style:       "Hostinska 10",
+		Supplier:    "maneo",
+		Price:       decimal.NewFromInt(1890),
+		Deposit:     decimal.NewFromInt(1500),
+		PurchasedAt: base,
+		BestBefore:  &bestBefore,
+	})
+	require.NoError(t, err)
+	id2, err := store.AddStockKeg(StockKeg{Size: 30, PurchasedAt: base.Add(time.Hour), Price: decimal.Zero})
+	require.NoError(t, err)
+	assert.NotEqual(t, id1, id2)
+
+	// Oldest purchase first
+	kegs, err = store.GetStockKegs(true)
+	require.NoError(t, err)
+	require.Len(t, kegs, 2)
+	assert.Equal(t, id1, kegs[0].ID)
+	assert.Equal(t, "Policka", kegs[0].Brand)
+	assert.Equal(t, "Hostinska 10", kegs[0].Style)
+	assert.Equal(t, "maneo", kegs[0].Supplier)
+	assert.True(t, decimal.NewFromInt(1890).Equal(kegs[0].Price))
+	assert.True(t, decimal.NewFromInt(1500).Equal(kegs[0].Deposit))
+	require.NotNil(t, kegs[0].BestBefore)
+	assert.True(t, bestBefore.Equal(*kegs[0].BestBefore))
+	assert.Nil(t, kegs[1].BestBefore)
+
+	// Tap the first keg
+	outAt := base.Add(48 * time.Hour)
+	tapped := kegs[0]
+	tapped.OutAt = &outAt
+	tapped.OutReason = StockOutReasonTapped
+	tapped.Tap = DefaultTap
+	require.NoError(t, store.UpdateStockKeg(tapped))
+
+	kegs, err = store.GetStockKegs(true)
+	require.NoError(t, err)
+	require.Len(t, kegs, 1)
+	assert.Equal(t, id2, kegs[0].ID)
+
+	kegs, err = store.GetStockKegs(false)
+	require.NoError(t, err)
+	require.Len(t, kegs, 2)
+	require.NotNil(t, kegs[0].OutAt)
+	assert.True(t, outAt.Equal(*kegs[0].OutAt))
+	assert.Equal(t, StockOutReasonTapped, kegs[0].OutReason)
+	assert.Equal(t, DefaultTap, kegs[0].Tap)
+
+	// Unknown keg
+	require.Error(t, store.UpdateStockKeg(StockKeg{ID: 999999, PurchasedAt: base}))
+}
+
+func TestPostgresStore_WarehouseChanges(t *testing.T) {
+	store := setupTestStore(t)
+
+	// Initially empty
+	changes, err := store.GetWarehouseChanges(10)
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+
+	base := time.Date(2025, 3, 14, 18, 0, 0, 0, time.UTC)
+	_, err = store.AddWarehouseChange(WarehouseChange{
+		Size:      50,
+		Delta:     1,
+		Kind:      WarehouseChangeAdd,
+		StockID:   7,
+		Source:    WarehouseSourceWeb,
+		Actor:     "admin",
+		Reason:    "delivery",
+		CreatedAt: base,
+	})
+	require.NoError(t, err)
+	_, err = store.AddWarehouseChange(WarehouseChange{
+		Size:      30,
+		Delta:     -2,
+		Kind:      WarehouseChangeCorrection,
+		Source:    WarehouseSourceWeb,
+		CreatedAt: base.Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	// Newest first
+	changes, err = store.GetWarehouseChanges(10)
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	assert.Equal(t, -2, changes[0].Delta)
+	assert.Equal(t, WarehouseChangeCorrection, changes[0].Kind)
+	assert.Equal(t, 50, changes[1].Size)
+	assert.Equal(t, int64(7), changes[1].StockID)
+	assert.Equal(t, WarehouseSourceWeb, changes[1].Source)
+	assert.Equal(t, "admin", changes[1].Actor)
+	assert.Equal(t, "delivery", changes[1].Reason)
+	assert.True(t, base.Equal(changes[1].CreatedAt))
+
+	// Limit
+	changes, err = store.GetWarehouseChanges(1)
+	require.NoError(t, err)
+	assert.Len(t, changes, 1)
+}
+
+func TestPostgresStore_EmptyKegs(t *testing.T) {
+	store := setupTestStore(t)
+
+	// Initially empty
+	kegs, err := store.GetEmptyKegs(false)
+	require.NoError(t, err)
+	assert.Empty(t, kegs)
+
+	base := time.Date(2025, 3, 14, 18, 0, 0, 0, time.UTC)
+	id1, err := store.AddEmptyKeg(EmptyKeg{
+		Size:      50,
+		StockID:   3,
+		KegID:     7,
+		Tap:       DefaultTap,
+		Supplier:  "maneo",
+		Deposit:   decimal.NewFromInt(1500),
+		EmptiedAt: base,
+		Refund:    decimal.Zero,
+	})
+	require.NoError(t, err)
+	id2, err := store.AddEmptyKeg(EmptyKeg{Size: 30, EmptiedAt: base.Add(time.Hour), Deposit: decimal.Zero, Refund: decimal.Zero})
+	require.NoError(t, err)
+	assert.NotEqual(t, id1, id2)
+
+	// Oldest first
+	kegs, err = store.GetEmptyKegs(true)
+	require.NoError(t, err)
+	require.Len(t, kegs, 2)
+	assert.Equal(t, id1, kegs[0].ID)
+	assert.Equal(t, int64(3), kegs[0].StockID)
+	assert.Equal(t, int64(7), kegs[0].KegID)
+	assert.Equal(t, "maneo", kegs[0].Supplier)
+	assert.True(t, decimal.NewFromInt(1500).Equal(kegs[0].Deposit))
+	assert.True(t, base.Equal(kegs[0].EmptiedAt))
+	assert.Nil(t, kegs[0].ReturnedAt)
+
+	// Return the first keg
+	returnedAt := base.Add(48 * time.Hour)
+	returned := kegs[0]
+	returned.ReturnedAt = &returnedAt
+	returned.Refund = decimal.NewFromInt(1400)
+	returned.Note = "damaged valve"
+	require.NoError(t, store.UpdateEmptyKegs([]EmptyKeg{returned}))
+
+	kegs, err = store.GetEmptyKegs(true)
+	require.NoError(t, err)
+	require.Len(t, kegs, 1)
+	assert.Equal(t, id2, kegs[0].ID)
+
+	kegs, err = store.GetEmptyKegs(false)
+	require.NoError(t, err)
+	require.Len(t, kegs, 2)
+	require.NotNil(t, kegs[0].ReturnedAt)
+	assert.True(t, returnedAt.Equal(*kegs[0].ReturnedAt))
+	assert.True(t, decimal.NewFromInt(1400).Equal(kegs[0].Refund))
+	assert.Equal(t, "damaged valve", kegs[0].Note)
+
+	// Unknown keg rolls back the known one
+	other := kegs[1]
+	other.Note = "lost"
+	require.Error(t, store.UpdateEmptyKegs([]EmptyKeg{other, {ID: 999999, EmptiedAt: base}}))
+	kegs, err = store.GetEmptyKegs(true)
+	require.NoError(t, err)
+	require.Len(t, kegs, 1)
+	assert.Empty(t, kegs[0].Note)
+}
+
+func TestPostgresStore_BankTransactions(t *testing.T) {
+	store := setupTestStore(t)
+
+	base := time.Date(2025, 3, 14, 0, 0, 0, 0, time.UTC)
+	added, err := store.AddBankTransactions([]BankTransaction{
+		{ID: 102, Date: base.Add(24 * time.Hour), Amount: decimal.NewFromInt(-5000), AccountName: "Maneo"},
+		{ID: 101, Date: base, Amount: decimal.NewFromInt(250), Currency: "CZK", VariableSymbol: "42", RecipientMessage: "pivo"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, added)
+
+	// Known ids are skipped
+	added, err = store.AddBankTransactions([]BankTransaction{
+		{ID: 101, Date: base, Amount: decimal.NewFromInt(999)},
+		{ID: 103, Date: base.Add(48 * time.Hour), Amount: decimal.NewFromInt(100)},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, added)
+
+	// Oldest first, to is exclusive
+	transactions, err := store.GetBankTransactions(base, base.Add(48*time.Hour))
+	require.NoError(t, err)
+	require.Len(t, transactions, 2)
+	assert.Equal(t, int64(101), transactions[0].ID)
+	assert.True(t, base.Equal(transactions[0].Date))
+	assert.True(t, decimal.NewFromInt(250).Equal(transactions[0].Amount))
+	assert.Equal(t, "CZK", transactions[0].Currency)
+	assert.Equal(t, "42", transactions[0].VariableSymbol)
+	assert.Equal(t, "pivo", transactions[0].RecipientMessage)
+	assert.Equal(t, int64(102), transactions[1].ID)
+	assert.Equal(t, "Maneo", transactions[1].AccountName)
+
+	// Never synced
+	sync, err := store.GetBankSync()
+	require.NoError(t, err)
+	assert.True(t, sync.From.IsZero())
+
+	require.NoError(t, store.SetBankSync(BankSync{From: base, To: base.Add(48 * time.Hour)}))
+	sync, err = store.GetBankSync()
+	require.NoError(t, err)
+	assert.True(t, base.Equal(sync.From))
+	assert.True(t, base.Add(48*time.Hour).Equal(sync.To))
+}
+
+func TestPostgresStore_BankBalance(t *testing.T) {
+	store := setupTestStore(t)
+
+	balance, err := store.GetBankBalance()
+	require.NoError(t, err)
+	assert.Empty(t, balance)
+
+	require.NoError(t, store.SetBankBalance(`{"account_id":2501201133,"currency":"CZK","balance":"4200.5"}`))
+	balance, err = store.GetBankBalance()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"account_id":2501201133,"currency":"CZK","balance":"4200.5"}`, balance)
+}
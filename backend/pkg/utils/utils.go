@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"mvdan.cc/xurls/v2"
@@ -49,13 +50,18 @@ func FormatTime(t time.Time) string {
 	return t.In(GetTz()).Format("15:04")
 }
 
-func GetTz() *time.Location {
+var loadTz = sync.OnceValue(func() *time.Location {
 	tz, err := time.LoadLocation("Europe/Prague")
 	if err != nil {
 		_, _ = os.Stderr.WriteString("Failed to load timezone: " + err.Error())
 		os.Exit(1)
 	}
 	return tz
+})
+
+// GetTz returns the timezone of the pub, the location is loaded only once
+func GetTz() *time.Location {
+	return loadTz()
 }
 
 type Ok struct {
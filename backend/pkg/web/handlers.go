@@ -12,11 +12,14 @@ import (
 
 	"github.com/dundee/qrpay"
 	"github.com/kotrzina/keg-scale/pkg/ai"
+	"github.com/kotrzina/keg-scale/pkg/clock"
 	"github.com/kotrzina/keg-scale/pkg/config"
 	"github.com/kotrzina/keg-scale/pkg/hook"
 	"github.com/kotrzina/keg-scale/pkg/promector"
 	"github.com/kotrzina/keg-scale/pkg/prometheus"
+	"github.com/kotrzina/keg-scale/pkg/reorder"
 	"github.com/kotrzina/keg-scale/pkg/scale"
+	"github.com/kotrzina/keg-scale/pkg/store"
 	"github.com/kotrzina/keg-scale/pkg/utils"
 	"github.com/kotrzina/keg-scale/pkg/wa"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -33,6 +36,8 @@ type HandlerRepository struct {
 	logger    *logrus.Logger
 	wa        *wa.WhatsAppClient
 	botka     *hook.Botka
+	planner   *reorder.Planner
+	clock     clock.Clock
 }
 
 func NewHandlerRepository(
@@ -44,7 +49,8 @@ func NewHandlerRepository(
 	logger *logrus.Logger,
 	wa *wa.WhatsAppClient,
 	botka *hook.Botka,
-
+	planner *reorder.Planner,
+	clk clock.Clock,
 ) *HandlerRepository {
 	return &HandlerRepository{
 		scale:     scale,
@@ -55,6 +61,8 @@ func NewHandlerRepository(
 		logger:    logger,
 		wa:        wa,
 		botka:     botka,
+		planner:   planner,
+		clock:     clk,
 	}
 }
 
@@ -84,11 +92,15 @@ func (hr *HandlerRepository) scaleMessageHandler() func(http.ResponseWriter, *ht
 			return
 		}
 
-		hr.scale.Ping()
-		hr.scale.SetRssi(message.Rssi)
+		if err = hr.scale.Ping(message.Tap); err != nil {
+			hr.logger.Warnf("Could not accept scale message: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		hr.scale.ObserveMessage(message.Tap, message.MessageID, message.Rssi)
 
 		if message.MessageType == PushMessageType {
-			err = hr.scale.AddMeasurement(message.Value)
+			err = hr.scale.AddMeasurement(message.Tap, message.Value)
 			if err != nil {
 				hr.logger.Warnf("Could not create measurement: %v", err)
 				http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -97,10 +109,11 @@ func (hr *HandlerRepository) scaleMessageHandler() func(http.ResponseWriter, *ht
 
 			hr.logger.WithFields(logrus.Fields{
 				"message_id": message.MessageID,
+				"tap":        message.Tap,
 			}).Infof("Scale new value: %0.2f", message.Value)
 		}
 
-		_, err = w.Write([]byte(hr.scale.GetPushResponse()))
+		_, err = w.Write([]byte(hr.scale.GetPushResponse(message.Tap)))
 		if err != nil {
 			hr.logger.Errorf("Could not write response: %v", err)
 		}
@@ -132,7 +145,8 @@ func (hr *HandlerRepository) activeKegHandler() func(http.ResponseWriter, *http.
 		}
 
 		type input struct {
-			Keg int `json:"keg"`
+			Keg int    `json:"keg"`
+			Tap string `json:"tap"`
 		}
 
 		var data input
@@ -142,14 +156,16 @@ func (hr *HandlerRepository) activeKegHandler() func(http.ResponseWriter, *http.
 			return
 		}
 
-		switch data.Keg {
-		case 0, 10, 15, 20, 30, 50: // all is well
-		default:
+		if data.Keg != 0 && !hr.scale.HasKegType(data.Keg) {
 			http.Error(w, "Invalid keg size", http.StatusBadRequest)
 			return
 		}
 
-		if err = hr.scale.SetActiveKeg(data.Keg); err != nil {
+		if data.Tap == "" {
+			data.Tap = store.DefaultTap
+		}
+
+		if err = hr.scale.SetActiveKeg(data.Tap, data.Keg); err != nil {
 			http.Error(w, "Could not set active keg", http.StatusInternalServerError)
 			return
 		}
@@ -181,8 +197,9 @@ func (hr *HandlerRepository) scaleDashboardHandler() func(http.ResponseWriter, *
 				Balance: decimal.NewFromInt(0),
 			}
 			data.Scale.BankTransactions = []scale.TransactionOutput{}
+			data.Scale.Deposits = scale.DepositOutput{Suppliers: []scale.SupplierDeposit{}, Total: decimal.Zero}
 			data.Scale.BtDevices = []scale.BtDevice{}
-			data.Scale.BtDevicesLastOk = time.Now()
+			data.Scale.BtDevicesLastOk = hr.clock.Now()
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -193,7 +210,121 @@ func (hr *HandlerRepository) scaleDashboardHandler() func(http.ResponseWriter, *
 	}
 }
 
-func (hr *HandlerRepository) scaleWarehouseHandler() func(http.ResponseWriter, *http.Request) {
+func (hr *HandlerRepository) kegsHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		limit := 50
+		if l := r.URL.Query().Get("limit"); l != "" {
+			n, err := strconv.Atoi(l)
+			if err != nil || n < 1 || n > 500 {
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+
+		kegs, err := hr.scale.GetKegHistory(r.URL.Query().Get("tap"), limit)
+		if err != nil {
+			hr.logger.Errorf("could not get keg history: %v", err)
+			http.Error(w, "could not get keg history", http.StatusInternalServerError)
+			return
+		}
+
+		type output struct {
+			Kegs []scale.KegOutput `json:"kegs"`
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err = json.NewEncoder(w).Encode(output{Kegs: kegs}); err != nil {
+			hr.logger.Errorf("Could not write response: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+}
+
+func (hr *HandlerRepository) pubSessionsHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		limit := 10
+		if l := r.URL.Query().Get("limit"); l != "" {
+			n, err := strconv.Atoi(l)
+			if err != nil || n < 1 || n > 100 {
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+
+		sessions, err := hr.scale.GetPubSessions(limit)
+		if err != nil {
+			hr.logger.Errorf("could not get pub sessions: %v", err)
+			http.Error(w, "could not get pub sessions", http.StatusInternalServerError)
+			return
+		}
+
+		// remove bank income if unauthorized
+		auth := r.Header.Get("Authorization")
+		if auth != hr.config.Password {
+			if sessions.Current != nil {
+				sessions.Current.Income = decimal.Zero
+			}
+			for i := range sessions.Sessions {
+				sessions.Sessions[i].Income = decimal.Zero
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err = json.NewEncoder(w).Encode(sessions); err != nil {
+			hr.logger.Errorf("Could not write response: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+}
+
+func (hr *HandlerRepository) openPolicyHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		auth := r.Header.Get("Authorization")
+		if auth != hr.config.Password {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if r.Method == http.MethodPost {
+			var policy scale.OpenPolicy
+			if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+				http.Error(w, "Could not read post body", http.StatusBadRequest)
+				return
+			}
+
+			if err := hr.scale.SetOpenPolicy(policy); err != nil {
+				hr.logger.Warnf("Could not update open policy: %v", err)
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(hr.scale.GetOpenPolicy()); err != nil {
+			hr.logger.Errorf("Could not write response: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+}
+
+func (hr *HandlerRepository) openOverrideHandler() func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
@@ -206,34 +337,307 @@ func (hr *HandlerRepository) scaleWarehouseHandler() func(http.ResponseWriter, *
 			return
 		}
 
-		type input struct {
-			Keg int    `json:"keg"`
-			Way string `json:"way"` // up or down
+		var data scale.OpenOverride // empty action removes the override
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+			http.Error(w, "Could not read post body", http.StatusBadRequest)
+			return
 		}
 
-		var data input
-		err := json.NewDecoder(r.Body).Decode(&data)
+		if err := hr.scale.SetOpenOverride(data.Action, data.Until); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(hr.scale.GetOpenPolicy()); err != nil {
+			hr.logger.Errorf("Could not write response: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+}
+
+// openPreviewHandler answers whether the opening message would be sent now (or at the given time) and why
+func (hr *HandlerRepository) openPreviewHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		auth := r.Header.Get("Authorization")
+		if auth != hr.config.Password {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		at := hr.clock.Now()
+		if v := r.URL.Query().Get("at"); v != "" {
+			parsed, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				http.Error(w, "Invalid at", http.StatusBadRequest)
+				return
+			}
+			at = parsed
+		}
+
+		manual := r.URL.Query().Get("manual") == "true"
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(hr.scale.PreviewOpen(at, manual)); err != nil {
+			hr.logger.Errorf("Could not write response: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+}
+
+func (hr *HandlerRepository) eventsHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		query := r.URL.Query()
+		filter := store.EventFilter{
+			Tap:   query.Get("tap"),
+			Limit: 50,
+		}
+
+		if t := query.Get("type"); t != "" {
+			filter.Types = strings.Split(t, ",")
+		}
+
+		if l := query.Get("limit"); l != "" {
+			n, err := strconv.Atoi(l)
+			if err != nil || n < 1 || n > 500 {
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+			filter.Limit = n
+		}
+
+		if b := query.Get("before"); b != "" {
+			id, err := strconv.ParseInt(b, 10, 64)
+			if err != nil || id < 1 {
+				http.Error(w, "Invalid before", http.StatusBadRequest)
+				return
+			}
+			filter.BeforeID = id
+		}
+
+		for param, target := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+			if v := query.Get(param); v != "" {
+				at, err := time.Parse(time.RFC3339, v)
+				if err != nil {
+					http.Error(w, fmt.Sprintf("Invalid %s, use RFC3339", param), http.StatusBadRequest)
+					return
+				}
+				*target = at
+			}
+		}
+
+		events, err := hr.scale.GetEvents(filter)
 		if err != nil {
-			http.Error(w, "Could not read post body", http.StatusBadRequest)
+			hr.logger.Errorf("could not get events: %v", err)
+			http.Error(w, "could not get events", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err = json.NewEncoder(w).Encode(events); err != nil {
+			hr.logger.Errorf("Could not write response: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+}
+
+func (hr *HandlerRepository) kegTypesHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost && r.Method != http.MethodDelete {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if r.Method != http.MethodGet {
+			auth := r.Header.Get("Authorization")
+			if auth != hr.config.Password {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			var data store.KegType
+			if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+				http.Error(w, "Could not read post body", http.StatusBadRequest)
+				return
+			}
+
+			var err error
+			if r.Method == http.MethodPost {
+				err = hr.scale.SetKegType(data)
+			} else {
+				err = hr.scale.DeleteKegType(data.Size)
+			}
+			if err != nil {
+				hr.logger.Warnf("Could not update keg catalog: %v", err)
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		type output struct {
+			KegTypes []store.KegType `json:"keg_types"`
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(output{KegTypes: hr.scale.GetKegTypes()}); err != nil {
+			hr.logger.Errorf("Could not write response: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+}
+
+func (hr *HandlerRepository) scaleCalibrationHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
-		if strings.EqualFold(data.Way, "up") {
-			if err := hr.scale.IncreaseWarehouse(data.Keg); err != nil {
-				http.Error(w, "Could not increase warehouse", http.StatusInternalServerError)
+		auth := r.Header.Get("Authorization")
+		if auth != hr.config.Password {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		tap := r.URL.Query().Get("tap")
+		if tap == "" {
+			tap = store.DefaultTap
+		}
+
+		if r.Method == http.MethodPost {
+			type input struct {
+				Tap    string  `json:"tap"`
+				Action string  `json:"action"` // start, tare, reference, finish or cancel
+				Keg    int     `json:"keg"`    // tare only - empty keg on the scale
+				Weight float64 `json:"weight"` // known weight in grams
+			}
+
+			var data input
+			if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+				http.Error(w, "Could not read post body", http.StatusBadRequest)
+				return
+			}
+			if data.Tap != "" {
+				tap = data.Tap
+			}
+
+			var err error
+			switch strings.ToLower(data.Action) {
+			case "start":
+				err = hr.scale.StartCalibration(tap)
+			case "tare":
+				err = hr.scale.CaptureCalibrationTare(tap, data.Keg, data.Weight)
+			case "reference":
+				err = hr.scale.CaptureCalibrationReference(tap, data.Weight)
+			case "finish":
+				_, err = hr.scale.FinishCalibration(tap)
+			case "cancel":
+				err = hr.scale.CancelCalibration(tap)
+			default:
+				err = fmt.Errorf("unknown calibration action: %q", data.Action)
+			}
+			if err != nil {
+				hr.logger.Warnf("Could not calibrate scale: %v", err)
+				http.Error(w, err.Error(), http.StatusBadRequest)
 				return
 			}
 		}
 
-		if strings.EqualFold(data.Way, "down") {
-			if err := hr.scale.DecreaseWarehouse(data.Keg); err != nil {
-				http.Error(w, "Could not increase warehouse", http.StatusInternalServerError)
+		output, err := hr.scale.GetCalibration(tap)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err = json.NewEncoder(w).Encode(output); err != nil {
+			hr.logger.Errorf("Could not write response: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+}
+
+func (hr *HandlerRepository) scaleWarehouseHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		authorized := r.Header.Get("Authorization") == hr.config.Password
+		if r.Method == http.MethodPost {
+			if !authorized {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
 				return
 			}
+
+			type input struct {
+				store.StockKeg
+				Keg    int    `json:"keg"`    // keg size, same as size
+				Action string `json:"action"` // add or remove
+				Way    string `json:"way"`    // up or down, legacy alias for add and remove
+				Actor  string `json:"actor"`  // who made the change, recorded in the warehouse history
+				Reason string `json:"reason"` // why the change was made, stored as the note of removed kegs
+			}
+
+			var data input
+			err := json.NewDecoder(r.Body).Decode(&data)
+			if err != nil {
+				http.Error(w, "Could not read post body", http.StatusBadRequest)
+				return
+			}
+
+			if data.Size == 0 {
+				data.Size = data.Keg
+			}
+			if data.Reason == "" {
+				data.Reason = data.Note
+			}
+			by := scale.WarehouseActor{Source: store.WarehouseSourceWeb, Actor: data.Actor, Reason: data.Reason}
+
+			switch {
+			case strings.EqualFold(data.Action, "add") || strings.EqualFold(data.Way, "up"):
+				_, err = hr.scale.AddStockKeg(data.StockKeg, by)
+			case strings.EqualFold(data.Way, "down"):
+				err = hr.scale.DecreaseWarehouse(data.Size, by)
+			case strings.EqualFold(data.Action, "remove"):
+				_, err = hr.scale.RemoveStockKeg(data.ID, data.Size, by)
+			default:
+				http.Error(w, "Unknown action", http.StatusBadRequest)
+				return
+			}
+			if err != nil {
+				hr.logger.Warnf("Could not update warehouse: %v", err)
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		type output struct {
+			Kegs []store.StockKeg `json:"kegs"`
+		}
+
+		// remove purchase prices if unauthorized
+		kegs := hr.scale.GetStockKegs()
+		if !authorized {
+			for i := range kegs {
+				kegs[i].Price = decimal.Zero
+				kegs[i].Deposit = decimal.Zero
+			}
 		}
 
 		w.Header().Set("Content-Type", "application/json")
-		if err = json.NewEncoder(w).Encode(utils.GetOk()); err != nil {
+		if err := json.NewEncoder(w).Encode(output{Kegs: kegs}); err != nil {
 			hr.logger.Errorf("Could not write response: %v", err)
 			w.WriteHeader(http.StatusInternalServerError)
 		}
@@ -327,10 +731,18 @@ func (hr *HandlerRepository) scaleChartHandler() func(http.ResponseWriter, *http
 	return func(w http.ResponseWriter, req *http.Request) {
 		metric := req.URL.Query().Get("metric")
 		interval := req.URL.Query().Get("interval")
+		tap := req.URL.Query().Get("tap")
+		if tap == "" {
+			tap = store.DefaultTap
+		}
+		if !tapIDRegexp.MatchString(tap) {
+			http.Error(w, "Invalid tap", http.StatusBadRequest)
+			return
+		}
 
 		allowedMetrics := []string{
-			"scale_beers_left",
-			"scale_active_keg",
+			scale.ChartMetricBeersLeft,
+			scale.ChartMetricActiveKeg,
 		}
 		if !listContains(allowedMetrics, metric) {
 			http.Error(w, "Now allowed metric", http.StatusBadRequest)
@@ -339,7 +751,7 @@ func (hr *HandlerRepository) scaleChartHandler() func(http.ResponseWriter, *http
 
 		var err error
 		var start time.Time
-		end := time.Now()
+		end := hr.clock.Now()
 
 		if strings.EqualFold(interval, "ted") {
 			// if open return current session
@@ -376,11 +788,36 @@ func (hr *HandlerRepository) scaleChartHandler() func(http.ResponseWriter, *http
 			step = 24 * time.Hour
 		}
 
-		data, err := hr.promector.GetRangeData(metric, start, end, step)
-		if err != nil {
-			hr.logger.Errorf("could not get range data for %s: %v", metric, err)
-			http.Error(w, "could not get range data", http.StatusInternalServerError)
-			return
+		var data []promector.RangeRecord
+		if hr.config.ChartSource == config.ChartSourcePrometheus {
+			// series recorded before multiple taps were supported have no tap label
+			matcher := fmt.Sprintf("tap=%q", tap)
+			if tap == store.DefaultTap {
+				matcher = fmt.Sprintf(`tap=~"%s|"`, tap)
+			}
+			query := fmt.Sprintf("%s{%s}", metric, matcher)
+			data, err = hr.promector.GetRangeData(query, start, end, step)
+			if err != nil {
+				hr.logger.Warnf("could not get range data for %s from prometheus, using local measurements: %v", metric, err)
+				data = nil
+			}
+		}
+
+		if data == nil {
+			points, err := hr.scale.GetChartData(tap, metric, start, end, step)
+			if err != nil {
+				hr.logger.Errorf("could not get chart data for %s: %v", metric, err)
+				http.Error(w, "could not get range data", http.StatusInternalServerError)
+				return
+			}
+
+			data = make([]promector.RangeRecord, len(points))
+			for i, point := range points {
+				data[i] = promector.RangeRecord{
+					Label: promector.FormatLabel(point.At, step),
+					Value: point.Value,
+				}
+			}
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -464,6 +901,111 @@ func (hr *HandlerRepository) forceBankRefresh() func(http.ResponseWriter, *http.
 	}
 }
 
+// bankTransactionsHandler returns stored bank transactions of the days from and to (both inclusive)
+// the last 14 days are returned by default
+func (hr *HandlerRepository) bankTransactionsHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		auth := r.Header.Get("Authorization")
+		if auth != hr.config.Password {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		now := hr.clock.Now().In(utils.GetTz())
+		to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, utils.GetTz())
+		from := to.AddDate(0, 0, -13)
+		query := r.URL.Query()
+		for param, target := range map[string]*time.Time{"from": &from, "to": &to} {
+			if v := query.Get(param); v != "" {
+				d, err := time.ParseInLocation(time.DateOnly, v, utils.GetTz())
+				if err != nil {
+					http.Error(w, fmt.Sprintf("Invalid %s, use YYYY-MM-DD", param), http.StatusBadRequest)
+					return
+				}
+				*target = d
+			}
+		}
+		if to.Before(from) {
+			http.Error(w, "Invalid period, to is before from", http.StatusBadRequest)
+			return
+		}
+
+		transactions, err := hr.scale.GetBankTransactions(from, to.AddDate(0, 0, 1))
+		if err != nil {
+			hr.logger.Errorf("could not get bank transactions: %v", err)
+			http.Error(w, "could not get bank transactions", http.StatusInternalServerError)
+			return
+		}
+
+		sync, err := hr.scale.GetBankSync()
+		if err != nil {
+			hr.logger.Errorf("could not get bank sync: %v", err)
+			http.Error(w, "could not get bank transactions", http.StatusInternalServerError)
+			return
+		}
+
+		type output struct {
+			Transactions []scale.TransactionOutput `json:"transactions"` // from the oldest
+			SyncedFrom   time.Time                 `json:"synced_from"`  // the oldest day in the store
+			SyncedTo     time.Time                 `json:"synced_to"`    // the newest day in the store
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(output{Transactions: transactions, SyncedFrom: sync.From, SyncedTo: sync.To})
+		if err != nil {
+			hr.logger.Errorf("Could not write response: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+}
+
+// bankStatementHandler imports the uploaded Fio CSV or ABO (GPC) statement sent as the request body
+func (hr *HandlerRepository) bankStatementHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		auth := r.Header.Get("Authorization")
+		if auth != hr.config.Password {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		added, err := hr.scale.ImportBankStatement(r.Context(), r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		sync, err := hr.scale.GetBankSync()
+		if err != nil {
+			hr.logger.Errorf("could not get bank sync: %v", err)
+			http.Error(w, "could not get bank sync", http.StatusInternalServerError)
+			return
+		}
+
+		type output struct {
+			Added      int       `json:"added"`       // new transactions in the store
+			SyncedFrom time.Time `json:"synced_from"` // the oldest day in the store
+			SyncedTo   time.Time `json:"synced_to"`   // the newest day in the store
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(output{Added: added, SyncedFrom: sync.From, SyncedTo: sync.To})
+		if err != nil {
+			hr.logger.Errorf("Could not write response: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+}
+
 var reCustomDuration = regexp.MustCompile(`^(\d{1,2})([hdwmy])$`)
 
 // parseCustomDuration parses custom duration string
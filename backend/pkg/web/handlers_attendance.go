@@ -7,7 +7,6 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
-	"time"
 
 	"github.com/kotrzina/keg-scale/pkg/scale"
 )
@@ -75,7 +74,7 @@ func (hr *HandlerRepository) attendanceHandler() func(http.ResponseWriter, *http
 				IdentityAddress: addr,
 				RSSI:            dev.Rssi,
 				Bounded:         bounded,
-				LastSeen:        time.Now(),
+				LastSeen:        hr.clock.Now(),
 			}
 		}
 
@@ -1,8 +1,20 @@
 package web
 
 import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/kotrzina/keg-scale/pkg/clock"
+	"github.com/kotrzina/keg-scale/pkg/config"
+	"github.com/kotrzina/keg-scale/pkg/prometheus"
+	"github.com/kotrzina/keg-scale/pkg/scale"
+	"github.com/kotrzina/keg-scale/pkg/store"
+	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -53,3 +65,40 @@ func TestResolveRPA(t *testing.T) {
 		})
 	}
 }
+
+func TestAttendanceHandler_Timeout(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	conf := config.NewConfig()
+	conf.FioToken = ""
+	conf.AuthToken = "token"
+	clk := clock.NewFake(time.Date(2025, 3, 14, 18, 0, 0, 0, time.UTC))
+	monitor := prometheus.New()
+	s := scale.New(context.Background(), monitor, &store.FakeStore{Clock: clk}, conf, clk, logger)
+	hr := NewHandlerRepository(s, nil, nil, conf, monitor, logger, nil, nil, nil, clk)
+
+	scan := func(addresses ...string) int {
+		ble := make([]string, len(addresses))
+		for i, address := range addresses {
+			ble[i] = `{"address": "` + address + `", "rssi": -60}`
+		}
+		req := httptest.NewRequest(http.MethodPost, "/api/attendance", strings.NewReader(`{"ble": [`+strings.Join(ble, ",")+`]}`))
+		req.Header.Set("Authorization", conf.AuthToken)
+		w := httptest.NewRecorder()
+		hr.attendanceHandler()(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusNoContent, scan("AA:AA:AA:AA:AA:AA", "BB:BB:BB:BB:BB:BB"))
+	assert.Len(t, s.GetScale().BtDevices, 2)
+
+	clk.Advance(10 * time.Minute)
+	assert.Equal(t, http.StatusNoContent, scan("AA:AA:AA:AA:AA:AA"))
+
+	// devices are forgotten 15 minutes after the last scan
+	clk.Advance(6 * time.Minute)
+	s.Recheck()
+	devices := s.GetScale().BtDevices
+	assert.Len(t, devices, 1)
+	assert.Equal(t, "AA:AA:AA:AA:AA:AA", devices[0].IdentityAddress)
+}
@@ -0,0 +1,234 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/kotrzina/keg-scale/pkg/reorder"
+	"github.com/kotrzina/keg-scale/pkg/scale"
+	"github.com/kotrzina/keg-scale/pkg/store"
+	"github.com/shopspring/decimal"
+)
+
+func (hr *HandlerRepository) reorderHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		auth := r.Header.Get("Authorization")
+		if auth != hr.config.Password {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		days := reorder.DefaultDays
+		if d := r.URL.Query().Get("days"); d != "" {
+			n, err := strconv.Atoi(d)
+			if err != nil || n < 1 || n > 365 {
+				http.Error(w, "Invalid days", http.StatusBadRequest)
+				return
+			}
+			days = n
+		}
+
+		plan, err := hr.planner.Plan(days)
+		if err != nil {
+			hr.logger.Errorf("could not plan the order: %v", err)
+			http.Error(w, "could not plan the order", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err = json.NewEncoder(w).Encode(plan); err != nil {
+			hr.logger.Errorf("Could not write response: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+}
+
+func (hr *HandlerRepository) warehouseHistoryHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		auth := r.Header.Get("Authorization")
+		if auth != hr.config.Password {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		limit := 100
+		if l := r.URL.Query().Get("limit"); l != "" {
+			n, err := strconv.Atoi(l)
+			if err != nil || n < 1 || n > 1000 {
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+
+		changes, err := hr.scale.GetWarehouseHistory(limit)
+		if err != nil {
+			hr.logger.Errorf("could not get warehouse history: %v", err)
+			http.Error(w, "could not get warehouse history", http.StatusInternalServerError)
+			return
+		}
+
+		type output struct {
+			Changes []store.WarehouseChange `json:"changes"`
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err = json.NewEncoder(w).Encode(output{Changes: changes}); err != nil {
+			hr.logger.Errorf("Could not write response: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+}
+
+func (hr *HandlerRepository) stocktakeHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		auth := r.Header.Get("Authorization")
+		if auth != hr.config.Password {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		type input struct {
+			Counts map[int]int `json:"counts"` // keg size => counted amount
+			Actor  string      `json:"actor"`
+			Reason string      `json:"reason"`
+		}
+
+		var data input
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil || len(data.Counts) == 0 {
+			http.Error(w, "Could not read post body", http.StatusBadRequest)
+			return
+		}
+
+		by := scale.WarehouseActor{Source: store.WarehouseSourceWeb, Actor: data.Actor, Reason: data.Reason}
+		if err := hr.scale.Stocktake(data.Counts, by); err != nil {
+			hr.logger.Warnf("Could not take stock: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		type output struct {
+			Kegs []store.StockKeg `json:"kegs"`
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(output{Kegs: hr.scale.GetStockKegs()}); err != nil {
+			hr.logger.Errorf("Could not write response: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+}
+
+func (hr *HandlerRepository) emptiesHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		auth := r.Header.Get("Authorization")
+		if auth != hr.config.Password {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if r.Method == http.MethodPost {
+			type input struct {
+				ID       int64            `json:"id"`       // returned keg, the oldest keg of the size when zero
+				Size     int              `json:"size"`     // keg size
+				Supplier string           `json:"supplier"` // optional, narrows kegs of the size
+				Amount   int              `json:"amount"`   // how many kegs of the size are returned at once, one by default
+				Refund   *decimal.Decimal `json:"refund"`   // refund per keg, the deposit when missing
+				Note     string           `json:"note"`
+			}
+
+			var data input
+			if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+				http.Error(w, "Could not read post body", http.StatusBadRequest)
+				return
+			}
+
+			var err error
+			if data.ID > 0 || data.Amount <= 1 {
+				_, err = hr.scale.ReturnEmptyKeg(data.ID, data.Size, data.Supplier, data.Refund, data.Note)
+			} else {
+				_, err = hr.scale.ReturnEmptyKegs(data.Size, data.Supplier, data.Amount, data.Refund, data.Note)
+			}
+			if err != nil {
+				hr.logger.Warnf("Could not return empty keg: %v", err)
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		type output struct {
+			Kegs     []store.EmptyKeg    `json:"kegs"`
+			Deposits scale.DepositOutput `json:"deposits"`
+		}
+
+		data := output{
+			Kegs:     hr.scale.GetEmptyKegs(),
+			Deposits: hr.scale.GetDeposits(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(data); err != nil {
+			hr.logger.Errorf("Could not write response: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+}
+
+func (hr *HandlerRepository) accountingHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		auth := r.Header.Get("Authorization")
+		if auth != hr.config.Password {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		months := 6
+		if m := r.URL.Query().Get("months"); m != "" {
+			n, err := strconv.Atoi(m)
+			if err != nil || n < 1 || n > 24 {
+				http.Error(w, "Invalid months", http.StatusBadRequest)
+				return
+			}
+			months = n
+		}
+
+		output, err := hr.scale.GetAccounting(months)
+		if err != nil {
+			hr.logger.Errorf("could not get accounting: %v", err)
+			http.Error(w, "could not get accounting", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err = json.NewEncoder(w).Encode(output); err != nil {
+			hr.logger.Errorf("Could not write response: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+}
@@ -55,10 +55,18 @@ func NewRouter(hr *HandlerRepository) *mux.Router {
 	router.HandleFunc("/api/scale/dashboard", hr.scaleDashboardHandler())
 	router.HandleFunc("/api/scale/chart", hr.scaleChartHandler())
 	router.HandleFunc("/api/scale/warehouse", hr.scaleWarehouseHandler())
+	router.HandleFunc("/api/warehouse/reorder", hr.reorderHandler())
+	router.HandleFunc("/api/warehouse/history", hr.warehouseHistoryHandler())
+	router.HandleFunc("/api/warehouse/stocktake", hr.stocktakeHandler())
+	router.HandleFunc("/api/warehouse/empties", hr.emptiesHandler())
+	router.HandleFunc("/api/accounting", hr.accountingHandler())
+	router.HandleFunc("/api/scale/calibration", hr.scaleCalibrationHandler())
 	router.HandleFunc("/api/ai/test", hr.aiTestHandler())
 	router.HandleFunc("/api/ai/chat", hr.aiTestHandler())
 	router.HandleFunc("/api/payment/qr", hr.paymentQrHandler())
 	router.HandleFunc("/api/bank/refresh", hr.forceBankRefresh())
+	router.HandleFunc("/api/bank/transactions", hr.bankTransactionsHandler())
+	router.HandleFunc("/api/bank/statement", hr.bankStatementHandler())
 
 	router.HandleFunc("/api/irks", hr.attendanceIrksHandler())
 	router.HandleFunc("/api/attendance", hr.attendanceHandler())
@@ -67,6 +75,13 @@ func NewRouter(hr *HandlerRepository) *mux.Router {
 	router.HandleFunc("/api/check/password", hr.checkPassword())
 
 	router.HandleFunc("/api/pub/active_keg", hr.activeKegHandler())
+	router.HandleFunc("/api/pub/sessions", hr.pubSessionsHandler())
+	router.HandleFunc("/api/pub/open_policy", hr.openPolicyHandler())
+	router.HandleFunc("/api/pub/open_policy/override", hr.openOverrideHandler())
+	router.HandleFunc("/api/pub/open_policy/preview", hr.openPreviewHandler())
+	router.HandleFunc("/api/kegs", hr.kegsHandler())
+	router.HandleFunc("/api/keg/types", hr.kegTypesHandler())
+	router.HandleFunc("/api/events", hr.eventsHandler())
 	router.HandleFunc("/api/wa/qr", hr.wa.QrCodeImageHandler)
 
 	router.HandleFunc("/terms", func(w http.ResponseWriter, r *http.Request) {
@@ -2,8 +2,11 @@ package web
 
 import (
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
+
+	"github.com/kotrzina/keg-scale/pkg/store"
 )
 
 const (
@@ -11,15 +14,19 @@ const (
 	PushMessageType = "push"
 )
 
+var tapIDRegexp = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
 type ScaleMessage struct {
 	MessageType string
 	MessageID   uint64 // arduino counter
 	Rssi        float64
 	Value       float64
+	Tap         string // tap id, scales without tap id belong to the default tap
 }
 
 // ParseScaleMessage parses a message from the scale
-// String format: messageType|messageId|rssi|value
+// String format: messageType|messageId|rssi|value|tap
+// tap is optional
 func ParseScaleMessage(message string) (ScaleMessage, error) {
 	chunks := strings.Split(message, "|")
 	if len(chunks) < 4 {
@@ -51,10 +58,19 @@ func ParseScaleMessage(message string) (ScaleMessage, error) {
 		}
 	}
 
+	tap := store.DefaultTap
+	if len(chunks) > 4 && chunks[4] != "" {
+		tap = chunks[4]
+		if !tapIDRegexp.MatchString(tap) {
+			return ScaleMessage{}, fmt.Errorf("invalid tap id")
+		}
+	}
+
 	return ScaleMessage{
 		MessageID:   requestID,
 		MessageType: messageType,
 		Rssi:        rssi,
 		Value:       value,
+		Tap:         tap,
 	}, nil
 }
@@ -3,6 +3,7 @@ package web
 import (
 	"testing"
 
+	"github.com/kotrzina/keg-scale/pkg/store"
 	"github.com/stretchr/testify/require"
 )
 
@@ -13,11 +14,13 @@ func TestScale_ParseScaleMessage(t *testing.T) {
 	}
 
 	tests := []testcases{
-		{"push|2887417|-74.7|1923.23", ScaleMessage{"push", 2887417, -74.7, 1923.23}},
-		{"push|2887417|-74.7|1923.23|", ScaleMessage{"push", 2887417, -74.7, 1923.23}}, // extra pipe
-		{"ping|2887417|-74.7|", ScaleMessage{"ping", 2887417, -74.7, 0}},
-		{"ping|2887417|-74.7||", ScaleMessage{"ping", 2887417, -74.7, 0}},   // extra pipe
-		{"push|471|-74.7|-47.25", ScaleMessage{"push", 471, -74.7, -47.25}}, // negative value
+		{"push|2887417|-74.7|1923.23", ScaleMessage{"push", 2887417, -74.7, 1923.23, store.DefaultTap}},
+		{"push|2887417|-74.7|1923.23|", ScaleMessage{"push", 2887417, -74.7, 1923.23, store.DefaultTap}}, // extra pipe
+		{"ping|2887417|-74.7|", ScaleMessage{"ping", 2887417, -74.7, 0, store.DefaultTap}},
+		{"ping|2887417|-74.7||", ScaleMessage{"ping", 2887417, -74.7, 0, store.DefaultTap}},   // extra pipe
+		{"push|471|-74.7|-47.25", ScaleMessage{"push", 471, -74.7, -47.25, store.DefaultTap}}, // negative value
+		{"push|12|-60|15000|left", ScaleMessage{"push", 12, -60, 15000, "left"}},              // tap id
+		{"ping|13|-60||left", ScaleMessage{"ping", 13, -60, 0, "left"}},                       // tap id
 	}
 
 	for _, test := range tests {
@@ -40,6 +43,15 @@ func TestScale_ParseScaleMessage(t *testing.T) {
 			if test.parsed.Value != parsed.Value {
 				t.Errorf("Expected Value to be %f, got %f", test.parsed.Value, parsed.Value)
 			}
+
+			if test.parsed.Tap != parsed.Tap {
+				t.Errorf("Expected Tap to be %s, got %s", test.parsed.Tap, parsed.Tap)
+			}
 		})
 	}
 }
+
+func TestScale_ParseScaleMessage_InvalidTap(t *testing.T) {
+	_, err := ParseScaleMessage("push|12|-60|15000|Left Tap")
+	require.Error(t, err)
+}
@@ -1,12 +1,66 @@
-import { Col, Offcanvas, Row, Table } from "react-bootstrap";
+import { Alert, Col, Offcanvas, Row, Table } from "react-bootstrap";
+import Form from "react-bootstrap/Form";
+import Button from "react-bootstrap/Button";
 import React from "react";
 import { useAuth } from "../contexts/AuthContext";
 import { buildUrl } from "../lib/Api";
 import PasswordBox from "./PasswordBox";
 
+// formatDay formats the local date as YYYY-MM-DD
+function formatDay(date) {
+    const month = String(date.getMonth() + 1).padStart(2, "0")
+    const day = String(date.getDate()).padStart(2, "0")
+    return date.getFullYear() + "-" + month + "-" + day
+}
+
 function Bank(props) {
 
     const { password, isAuthenticated } = useAuth();
+    const [from, setFrom] = React.useState(formatDay(new Date(Date.now() - 13 * 24 * 3600 * 1000)))
+    const [to, setTo] = React.useState(formatDay(new Date()))
+    const [period, setPeriod] = React.useState(null) // transactions of the chosen period
+    const [showError, setShowError] = React.useState(false)
+    const [imported, setImported] = React.useState(null) // new transactions of the uploaded statement
+
+    async function loadPeriod() {
+        const request = new Request(buildUrl("/api/bank/transactions?from=" + from + "&to=" + to), {
+            method: "GET",
+            headers: {
+                "Authorization": password,
+            },
+        });
+
+        const response = await fetch(request)
+        if (response.status === 200) {
+            const data = await response.json()
+            setPeriod(data.transactions)
+            setShowError(false)
+        } else {
+            setShowError(true)
+        }
+    }
+
+    async function importStatement(file) {
+        const request = new Request(buildUrl("/api/bank/statement"), {
+            method: "POST",
+            headers: {
+                "Authorization": password,
+            },
+            body: file,
+        });
+
+        const response = await fetch(request)
+        if (response.status === 200) {
+            const data = await response.json()
+            setImported(data.added)
+            setShowError(false)
+        } else {
+            setImported(null)
+            setShowError(true)
+        }
+    }
+
+    const transactions = period !== null ? period : props.transactions
 
     if (!isAuthenticated) {
         return (
@@ -28,10 +82,52 @@ function Bank(props) {
             props.setShowCanvas(false)
         }}>
             <Offcanvas.Header closeButton>
-                <Offcanvas.Title>Poslední transakce</Offcanvas.Title>
+                <Offcanvas.Title>{period !== null ? "Transakce" : "Poslední transakce"}</Offcanvas.Title>
             </Offcanvas.Header>
             <Offcanvas.Body>
                 <Row>
+                    <Alert hidden={!showError} variant={"danger"}>
+                        Chyba! Zkus to prosím později.
+                    </Alert>
+
+                    <Form className="d-flex mb-3" onSubmit={(e) => {
+                        e.preventDefault()
+                        void loadPeriod()
+                    }}>
+                        <Form.Control
+                            type="date"
+                            value={from}
+                            onChange={(e) => setFrom(e.target.value)}
+                            className="me-2"
+                            aria-label="Od"
+                        />
+                        <Form.Control
+                            type="date"
+                            value={to}
+                            onChange={(e) => setTo(e.target.value)}
+                            className="me-2"
+                            aria-label="Do"
+                        />
+                        <Button variant="primary" type="submit">Zobrazit</Button>
+                    </Form>
+
+                    <Form.Group className="mb-3">
+                        <Form.Label>Nahrát výpis (CSV nebo GPC)</Form.Label>
+                        <Form.Control
+                            type="file"
+                            accept=".csv,.gpc"
+                            onChange={(e) => {
+                                if (e.target.files.length > 0) {
+                                    void importStatement(e.target.files[0])
+                                }
+                                e.target.value = ""
+                            }}
+                        />
+                    </Form.Group>
+                    <Alert hidden={imported === null} variant={"success"}>
+                        Nahráno nových transakcí: {imported}
+                    </Alert>
+
                     <Col md={12}>
                         <Table>
                             <thead>
@@ -42,13 +138,14 @@ function Bank(props) {
                             </tr>
                             </thead>
                             <tbody>
-                            {props.transactions.slice().reverse().map((transaction, index) => (
+                            {transactions.slice().reverse().map((transaction, index) => (
                                 <tr key={index}>
                                     <td>
                                         {transaction.date
                                             ? new Date(transaction.date).toLocaleDateString("cs-CZ", {
                                                 day: "numeric",
-                                                month: "numeric"
+                                                month: "numeric",
+                                                year: period !== null ? "numeric" : undefined
                                             })
                                             : ""}
                                     </td>
@@ -31,6 +31,12 @@ const defaultScale = {
             { "keg": 50, "amount": 0 }
         ],
         warehouse_beer_left: 0,
+        deposits: {
+            suppliers: [],
+            kegs: 0,
+            total: "0",
+        },
+        taps: [],
         bank_balance: {
             balance: "0"
         },
@@ -45,6 +45,19 @@ function Dashboard() {
                     {data.scale.active_keg}&nbsp;l
                 </Field>
 
+                {(data.scale.taps || []).filter((tap) => tap.id !== "main").map((tap) => (
+                    <Field
+                        key={tap.id}
+                        title={"Pípa " + tap.id}
+                        info={tap.active_keg + " l bečka"}
+                        variant={!tap.is_ok ? "red" : tap.is_low ? "orange" : "green"}
+                        loading={isLoading}
+                        hidden={false}
+                    >
+                        <Pivo amount={tap.beers_left} />
+                    </Field>
+                ))}
+
                 <Field
                     title={"Váha"}
                     info={"před " + data.scale.last_at_duration}
@@ -85,6 +98,16 @@ function Dashboard() {
                     {data.scale.warehouse_beer_left}&nbsp;piv
                 </Field>
 
+                <Field
+                    title={"Zálohy"}
+                    info={data.scale.deposits.suppliers.map((s) => (s.supplier || "?") + " " + s.deposit + " Kč").join(", ")}
+                    variant={"orange"}
+                    loading={isLoading}
+                    hidden={data.scale.deposits.kegs <= 0}
+                >
+                    {data.scale.deposits.total}&nbsp;Kč
+                </Field>
+
                 <Field
                     title={"Status"}
                     info={"před " + data.scale.last_update_duration}